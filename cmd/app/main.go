@@ -26,7 +26,9 @@ import (
 	"inkwell-backend-V2.0/internal/controller"
 	"inkwell-backend-V2.0/internal/db"
 	"inkwell-backend-V2.0/internal/llm"
+	"inkwell-backend-V2.0/internal/mailer"
 	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/oidc"
 	"inkwell-backend-V2.0/internal/repository"
 	"inkwell-backend-V2.0/internal/service"
 	"inkwell-backend-V2.0/internal/utilities"
@@ -36,6 +38,7 @@ import (
 	"github.com/common-nighthawk/go-figure"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/term"
+	"gorm.io/gorm"
 )
 
 var (
@@ -43,6 +46,8 @@ var (
 	sttTtsCmd       *exec.Cmd
 	diffusionClient *llm.StableDiffusionWrapper
 	ollamaClient    *llm.OllamaClient
+	mailClient      mailer.Mailer
+	oidcProviders   *oidc.Registry
 	wg              = &sync.WaitGroup{}
 )
 
@@ -80,20 +85,27 @@ func main() {
 	runMigrations()
 
 	// Create repositories and register event listeners.
-	userRepo, assessmentRepo, storyRepo := createRepositories()
-	registerEventListeners(storyRepo)
+	userRepo, assessmentRepo, storyRepo, questionRepo, reviewRepo, sessionRepo, tokenRepo, attemptRepo, mfaRepo, oidcRepo, privacyRepo := createRepositories()
+	registerEventListeners(userRepo, storyRepo, reviewRepo)
+
+	// Give the configured admin accounts their role.
+	service.PromoteConfiguredAdmins(userRepo)
 
 	// Run background tasks.
-	runBackgroundTasks(storyRepo)
+	runBackgroundTasks(userRepo, storyRepo, assessmentRepo, sessionRepo, tokenRepo, attemptRepo, privacyRepo)
 
 	// Create services.
-	authService, userService, assessmentService, storyService := createServices(userRepo, assessmentRepo, storyRepo)
+	authService, userService, assessmentService, storyService, comicService := createServices(userRepo, assessmentRepo, storyRepo, sessionRepo, tokenRepo, attemptRepo, mfaRepo, oidcRepo)
+	profileService := service.NewProfileService(userRepo, sessionRepo, tokenRepo, mailClient)
+	privacyService := service.NewPrivacyService(db.GetDB(), userRepo, privacyRepo, sessionRepo)
+	questionBankService := service.NewQuestionBankService(questionRepo, ollamaClient)
+	reviewService := service.NewReviewService(reviewRepo, ollamaClient)
 
 	// Initialize and configure Gin router.
-	r := initRouter(cfg)
+	r := initRouter(cfg, sessionRepo)
 
 	// Register API routes.
-	controller.RegisterRoutes(r, authService, userService, assessmentService, storyService, ollamaClient)
+	controller.RegisterRoutes(r, authService, userService, profileService, privacyService, assessmentService, storyService, comicService, questionBankService, reviewService, ollamaClient)
 
 	// Start server and listen for termination signals.
 	runServer(cfg, r)
@@ -132,6 +144,20 @@ func initThirdPartyClients(cfg *config.APIConfig) {
 		os.Exit(1)
 	}
 
+	// Initialize the mailer for account emails.
+	mailClient, err = mailer.New(cfg.Mail)
+	if err != nil {
+		Log.Error("Failed to configure mail: %v", err)
+		os.Exit(1)
+	}
+
+	// Load the OpenID Connect login providers.
+	oidcProviders, err = oidc.NewRegistry(cfg.OIDC)
+	if err != nil {
+		Log.Error("Failed to configure OIDC providers: %v", err)
+		os.Exit(1)
+	}
+
 	// Initialize Stable Diffusion wrapper.
 	diffusionClient = &llm.StableDiffusionWrapper{AccessToken: cfg.ThirdParty.HFToken}
 
@@ -156,39 +182,147 @@ func initThirdPartyClients(cfg *config.APIConfig) {
 }
 
 func runMigrations() {
+	if err := prepareComicVersioning(); err != nil {
+		Log.Error("Comic versioning migration error: %v", err)
+		os.Exit(1)
+	}
+	if err := prepareAnswerAttempts(); err != nil {
+		Log.Error("Answer attempt migration error: %v", err)
+		os.Exit(1)
+	}
 	err := db.GetDB().AutoMigrate(&model.User{}, &model.Assessment{}, &model.Question{}, &model.Answer{},
-		&model.Story{}, &model.Sentence{}, &model.Comic{})
+		&model.Story{}, &model.Sentence{}, &model.Comic{}, &model.SkillEstimate{}, &model.Topic{},
+		&model.LevelHistory{}, &model.ReviewCard{}, &model.Session{}, &model.AccountToken{}, &model.LoginAttempt{},
+		&model.TOTPFactor{}, &model.RecoveryCode{}, &model.UserIdentity{}, &model.OIDCLoginState{},
+		&model.DataExport{}, &model.PrivacyEvent{})
 	if err != nil {
 		Log.Error("AutoMigration Error: %v", err)
 		os.Exit(1)
 	}
+	if err := service.BackfillComicHashes(repository.NewStoryRepository()); err != nil {
+		Log.Error("Comic hash migration error: %v", err)
+		os.Exit(1)
+	}
+	if err := uniqueUserEmails(); err != nil {
+		Log.Error("User email migration error: %v", err)
+		os.Exit(1)
+	}
+	if err := syncTopicsFromQuestions(); err != nil {
+		Log.Error("Topic migration error: %v", err)
+		os.Exit(1)
+	}
+	if err := closeLegacyAssessments(); err != nil {
+		Log.Error("Assessment migration error: %v", err)
+		os.Exit(1)
+	}
+}
+
+// uniqueUserEmails lowercases stored emails and adds a unique index on
+// LOWER(email), so that case variants of an address cannot open a second
+// account. Accounts that already differ only in case are left alone and
+// make the index fail until an admin merges or deletes them.
+func uniqueUserEmails() error {
+	err := db.GetDB().Exec(`
+		UPDATE users SET email = LOWER(TRIM(email))
+		WHERE email <> LOWER(TRIM(email)) AND NOT EXISTS (
+			SELECT 1 FROM users other WHERE other.id <> users.id AND LOWER(TRIM(other.email)) = LOWER(TRIM(users.email)))`).Error
+	if err != nil {
+		return err
+	}
+	err = db.GetDB().Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email)) WHERE email <> ''`).Error
+	if err != nil {
+		return fmt.Errorf("accounts whose emails differ only in case must be merged first: %w", err)
+	}
+	return nil
+}
+
+// syncTopicsFromQuestions creates a topic for every question category that
+// predates the topics table.
+func syncTopicsFromQuestions() error {
+	return db.GetDB().Exec(`
+		INSERT INTO topics (name, description, active, created_at, updated_at)
+		SELECT DISTINCT category, '', true, NOW(), NOW() FROM questions
+		ON CONFLICT (name) DO NOTHING`).Error
+}
+
+// prepareComicVersioning numbers comics created before versioning existed so
+// that the unique (story_id, version) index can be created by AutoMigrate.
+func prepareComicVersioning() error {
+	migrator := db.GetDB().Migrator()
+	if !migrator.HasTable(&model.Comic{}) || migrator.HasColumn(&model.Comic{}, "Version") {
+		return nil
+	}
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`ALTER TABLE comics ADD COLUMN version bigint NOT NULL DEFAULT 1`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			UPDATE comics SET version = numbered.rn
+			FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY story_id ORDER BY done_on, id) AS rn FROM comics) AS numbered
+			WHERE comics.id = numbered.id`).Error
+	})
+}
+
+// prepareAnswerAttempts numbers repeated answers to the same question so
+// that the unique (assessment_id, question_id, attempt) index can be created.
+func prepareAnswerAttempts() error {
+	migrator := db.GetDB().Migrator()
+	if !migrator.HasTable(&model.Answer{}) || migrator.HasColumn(&model.Answer{}, "Attempt") {
+		return nil
+	}
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`ALTER TABLE answers ADD COLUMN attempt bigint NOT NULL DEFAULT 1`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			UPDATE answers SET attempt = numbered.rn
+			FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY assessment_id, question_id ORDER BY created_at, id) AS rn FROM answers) AS numbered
+			WHERE answers.id = numbered.id`).Error
+	})
+}
+
+// closeLegacyAssessments abandons open sessions started before sessions
+// tracked their current question, as they cannot be resumed in order.
+func closeLegacyAssessments() error {
+	return db.GetDB().Exec(`
+		UPDATE assessments SET status = 'abandoned', ended_at = NOW()
+		WHERE status IN ('ongoing', 'pending') AND current_question_id = 0`).Error
 }
 
 //
 // REPOSITORIES & EVENT REGISTRATION
 //
 
-func createRepositories() (repository.UserRepository, repository.AssessmentRepository, repository.StoryRepository) {
+func createRepositories() (repository.UserRepository, repository.AssessmentRepository, repository.StoryRepository, repository.QuestionRepository, repository.ReviewRepository, repository.SessionRepository, repository.AccountTokenRepository, repository.LoginAttemptRepository, repository.MFARepository, repository.OIDCRepository, repository.PrivacyRepository) {
 	userRepo := repository.NewUserRepository()
 	assessmentRepo := repository.NewAssessmentRepository()
 	storyRepo := repository.NewStoryRepository()
-	return userRepo, assessmentRepo, storyRepo
+	questionRepo := repository.NewQuestionRepository(db.GetDB())
+	reviewRepo := repository.NewReviewRepository()
+	sessionRepo := repository.NewSessionRepository()
+	tokenRepo := repository.NewAccountTokenRepository()
+	attemptRepo := repository.NewLoginAttemptRepository()
+	mfaRepo := repository.NewMFARepository()
+	oidcRepo := repository.NewOIDCRepository()
+	privacyRepo := repository.NewPrivacyRepository()
+	return userRepo, assessmentRepo, storyRepo, questionRepo, reviewRepo, sessionRepo, tokenRepo, attemptRepo, mfaRepo, oidcRepo, privacyRepo
 }
 
-func registerEventListeners(storyRepo repository.StoryRepository) {
-	service.InitComicEventListeners(storyRepo)
+func registerEventListeners(userRepo repository.UserRepository, storyRepo repository.StoryRepository, reviewRepo repository.ReviewRepository) {
+	service.InitComicEventListeners(storyRepo, userRepo)
 	service.InitAnalysisEventListeners(storyRepo, ollamaClient)
+	service.InitReviewEventListeners(reviewRepo)
 }
 
 //
 // BACKGROUND TASKS
 //
 
-func runBackgroundTasks(storyRepo repository.StoryRepository) {
-	wg.Add(2)
+func runBackgroundTasks(userRepo repository.UserRepository, storyRepo repository.StoryRepository, assessmentRepo repository.AssessmentRepository, sessionRepo repository.SessionRepository, tokenRepo repository.AccountTokenRepository, attemptRepo repository.LoginAttemptRepository, privacyRepo repository.PrivacyRepository) {
+	wg.Add(3)
 	go func() {
 		defer wg.Done()
-		service.GenerateMissingComics(storyRepo)
+		service.GenerateMissingComics(storyRepo, userRepo)
 	}()
 	go func() {
 		defer wg.Done()
@@ -196,21 +330,34 @@ func runBackgroundTasks(storyRepo repository.StoryRepository) {
 			Log.Error("Error creating analysis for stories: %v", err)
 		}
 	}()
+	go func() {
+		defer wg.Done()
+		if err := service.CalibrateQuestionDifficulties(assessmentRepo); err != nil {
+			Log.Error("Error calibrating question difficulties: %v", err)
+		}
+	}()
+	service.StartAssessmentSweeper(assessmentRepo, time.Minute)
+	service.StartSessionCleanup(sessionRepo, time.Hour)
+	service.StartAccountTokenCleanup(tokenRepo, time.Hour)
+	service.StartLoginAttemptCleanup(attemptRepo, 24*time.Hour)
+	service.StartPrivacyTasks(userRepo, privacyRepo, time.Hour)
+	utilities.StartKeyRotation(time.Hour)
 }
 
 //
 // SERVICES & ROUTER INIT
 //
 
-func createServices(userRepo repository.UserRepository, assessmentRepo repository.AssessmentRepository, storyRepo repository.StoryRepository) (service.AuthService, service.UserService, service.AssessmentService, service.StoryService) {
-	authService := service.NewAuthService(userRepo)
-	userService := service.NewUserService(userRepo)
+func createServices(userRepo repository.UserRepository, assessmentRepo repository.AssessmentRepository, storyRepo repository.StoryRepository, sessionRepo repository.SessionRepository, tokenRepo repository.AccountTokenRepository, attemptRepo repository.LoginAttemptRepository, mfaRepo repository.MFARepository, oidcRepo repository.OIDCRepository) (service.AuthService, service.UserService, service.AssessmentService, service.StoryService, service.ComicService) {
+	authService := service.NewAuthService(userRepo, sessionRepo, tokenRepo, attemptRepo, mfaRepo, oidcRepo, oidcProviders, mailClient)
+	userService := service.NewUserService(userRepo, sessionRepo, attemptRepo, mfaRepo)
 	assessmentService := service.NewAssessmentService(assessmentRepo, ollamaClient)
-	storyService := service.NewStoryService(storyRepo, ollamaClient, diffusionClient)
-	return authService, userService, assessmentService, storyService
+	storyService := service.NewStoryService(storyRepo, userRepo, ollamaClient, diffusionClient)
+	comicService := service.NewComicService(storyRepo, userRepo)
+	return authService, userService, assessmentService, storyService, comicService
 }
 
-func initRouter(cfg *config.APIConfig) *gin.Engine {
+func initRouter(cfg *config.APIConfig, sessionRepo repository.SessionRepository) *gin.Engine {
 	gin.SetMode(cfg.Context.Mode)
 	router := gin.New()
 	if err := router.SetTrustedProxies(cfg.Context.TrustedProxies.Proxies); err != nil {
@@ -219,7 +366,7 @@ func initRouter(cfg *config.APIConfig) *gin.Engine {
 	// Register global middleware.
 	middlewares := []gin.HandlerFunc{
 		middleware.CORSMiddleware(),
-		middleware.AuthMiddleware(),
+		middleware.AuthMiddleware(sessionRepo),
 		middleware.RateLimitMiddleware(),
 		gin.Recovery(),
 	}
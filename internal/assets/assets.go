@@ -0,0 +1,9 @@
+// Package assets bundles static files that must ship inside the binary.
+package assets
+
+import "embed"
+
+// Fonts holds the default TrueType fonts used for PDF generation.
+//
+//go:embed fonts/*.ttf
+var Fonts embed.FS
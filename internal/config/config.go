@@ -27,6 +27,13 @@ type APIConfig struct {
 	DB             DBConfig             `xml:"DB"`
 	ThirdParty     ThirdPartyConfig     `xml:"THIRD_PARTY"`
 	Logging        LoggingConfig        `xml:"LOGGING"`
+	PDF            PDFConfig            `xml:"PDF"`
+	Admin          AdminConfig          `xml:"ADMIN"`
+	Assessment     AssessmentConfig     `xml:"ASSESSMENT"`
+	Mail           MailConfig           `xml:"MAIL"`
+	OIDC           OIDCConfig           `xml:"OIDC"`
+	Profile        ProfileConfig        `xml:"PROFILE"`
+	Privacy        PrivacyConfig        `xml:"PRIVACY"`
 }
 
 // ContextConfig holds basic server settings.
@@ -59,6 +66,61 @@ type AuthenticationConfig struct {
 	SessionTimeouts          map[string]int    `xml:"SESSION_TIMEOUT"`
 	SecretKeys               map[string]string `xml:"SECRET_KEY"`
 	TimeUnits                map[string]string
+	PasswordHash             PasswordHashConfig `xml:"PASSWORD_HASH"`
+	// LegacyAuthHash keeps the old login, where the client sends a bcrypt
+	// of "email::sha256(password)" as authhash, for clients not yet updated.
+	LegacyAuthHash bool                `xml:"LEGACY_AUTHHASH"`
+	Signing        SigningConfig       `xml:"SIGNING"`
+	Issuer         string              `xml:"ISSUER"` // iss claim; checked when set
+	LoginThrottle  LoginThrottleConfig `xml:"LOGIN_THROTTLE"`
+	MFA            MFAConfig           `xml:"MFA"`
+	Audience       string              `xml:"AUDIENCE"` // aud claim; checked when set
+}
+
+// MFAConfig holds the TOTP two-factor settings. Users with one of the
+// RequiredRoles must enrol before they can log in. EncryptionKey, when set,
+// encrypts the TOTP secrets stored in the database.
+type MFAConfig struct {
+	Issuer           string   `xml:"ISSUER"` // name shown in authenticator apps
+	RequiredRoles    []string `xml:"REQUIRED_ROLE"`
+	ChallengeMinutes int      `xml:"CHALLENGE_MINUTES"` // how long the second login step may take
+	EncryptionKey    string   `xml:"ENCRYPTION_KEY"`
+}
+
+// LoginThrottleConfig limits failed logins. Failures are counted per
+// account and per IP address within WindowMinutes. After FreeAttempts an
+// account must wait between attempts, doubling from one second up to
+// MaxDelaySeconds; at LockoutAttempts it is locked for LockoutMinutes, as
+// is an IP address at IPLockoutAttempts. Zero values use the defaults.
+type LoginThrottleConfig struct {
+	WindowMinutes      int `xml:"WINDOW_MINUTES"`
+	FreeAttempts       int `xml:"FREE_ATTEMPTS"`
+	MaxDelaySeconds    int `xml:"MAX_DELAY_SECONDS"`
+	LockoutAttempts    int `xml:"LOCKOUT_ATTEMPTS"`
+	IPLockoutAttempts  int `xml:"IP_LOCKOUT_ATTEMPTS"`
+	LockoutMinutes     int `xml:"LOCKOUT_MINUTES"`
+	AuditRetentionDays int `xml:"AUDIT_RETENTION_DAYS"` // how long login attempts are kept
+}
+
+// SigningConfig selects how tokens are signed. HS256 uses the SECRET_KEY
+// values; RS256 and EdDSA use key pairs kept in KeyDir, which are rotated
+// every RotationDays. A retired key keeps verifying tokens for RetainHours,
+// which defaults to the refresh token lifetime.
+type SigningConfig struct {
+	Algorithm    string `xml:"ALGORITHM,attr"` // HS256 (default), RS256 or EdDSA
+	KeyDir       string `xml:"KEY_DIR"`
+	RotationDays int    `xml:"ROTATION_DAYS"`
+	RetainHours  int    `xml:"RETAIN_HOURS"`
+}
+
+// PasswordHashConfig holds the argon2id parameters for new password hashes.
+// Zero values fall back to the defaults in utilities.
+type PasswordHashConfig struct {
+	MemoryKiB   uint32 `xml:"MEMORY_KIB"`
+	Iterations  uint32 `xml:"ITERATIONS"`
+	Parallelism uint8  `xml:"PARALLELISM"`
+	SaltLength  uint32 `xml:"SALT_LENGTH"`
+	KeyLength   uint32 `xml:"KEY_LENGTH"`
 }
 
 // UnmarshalXML customizes XML parsing for AuthenticationConfig.
@@ -151,6 +213,96 @@ type LoggingConfig struct {
 	CompressLogs bool `xml:"COMPRESS_LOGS"`
 }
 
+// PDFConfig holds settings for generated PDF documents.
+type PDFConfig struct {
+	FontDir    string `xml:"FONT_DIR"`    // directory of TrueType files; empty uses the bundled font
+	FontFamily string `xml:"FONT_FAMILY"` // file prefix, e.g. "NotoSans" for NotoSans-Regular.ttf
+}
+
+// AdminConfig lists the accounts that are given the admin role.
+type AdminConfig struct {
+	Emails []string `xml:"EMAIL"`
+}
+
+// ProfileConfig limits what users can choose in their profile. Empty
+// lists allow any well-formed value.
+type ProfileConfig struct {
+	TTSVoices   []string `xml:"TTS_VOICE"`
+	UILanguages []string `xml:"UI_LANGUAGE"`
+	AvatarMaxKB int      `xml:"AVATAR_MAX_KB"` // size of an uploaded avatar before resizing; default 5120
+}
+
+// PrivacyConfig controls data exports and account erasure. ExportDir
+// must not be under working/, which is served publicly.
+type PrivacyConfig struct {
+	ExportDir            string `xml:"EXPORT_DIR"`             // default "exports"
+	ExportRetentionHours int    `xml:"EXPORT_RETENTION_HOURS"` // default 72
+	ErasureGraceDays     int    `xml:"ERASURE_GRACE_DAYS"`     // default 14
+}
+
+// AssessmentConfig holds time limits and the retry policy for assessment
+// sessions. Times are in seconds; 0 disables a limit.
+type AssessmentConfig struct {
+	QuestionTimeLimit int `xml:"QUESTION_TIME_LIMIT"`
+	SessionTimeLimit  int `xml:"SESSION_TIME_LIMIT"`
+	MaxRetries        int `xml:"MAX_RETRIES"`   // extra attempts after a wrong answer
+	AbandonAfter      int `xml:"ABANDON_AFTER"` // idle time before an ongoing session is abandoned
+	// PlacementRetestDays is how long a placement level stands before the
+	// placement test may be retaken; 0 allows a re-test at any time.
+	PlacementRetestDays int `xml:"PLACEMENT_RETEST_DAYS"`
+}
+
+// MailConfig selects how account emails are sent. The "smtp" driver
+// delivers them through SMTP; "file" writes them to Dir for local testing.
+type MailConfig struct {
+	Driver string     `xml:"DRIVER,attr"`
+	From   string     `xml:"FROM"`
+	Dir    string     `xml:"DIR"` // where the file driver writes messages
+	SMTP   SMTPConfig `xml:"SMTP"`
+	// LinkBaseURL is the frontend address that links in emails point to.
+	LinkBaseURL string `xml:"LINK_BASE_URL"`
+	// VerifyTokenHours and ResetTokenMinutes are how long the links stay valid.
+	VerifyTokenHours  int `xml:"VERIFY_TOKEN_HOURS"`
+	ResetTokenMinutes int `xml:"RESET_TOKEN_MINUTES"`
+	// RequireVerifiedEmail refuses logins until the email address is verified.
+	RequireVerifiedEmail bool `xml:"REQUIRE_VERIFIED_EMAIL"`
+}
+
+// SMTPConfig holds the SMTP server settings. Port 465 uses implicit TLS;
+// other ports upgrade with STARTTLS when the server offers it.
+type SMTPConfig struct {
+	Host     string `xml:"HOST"`
+	Port     int    `xml:"PORT"`
+	Username string `xml:"USERNAME"`
+	Password string `xml:"PASSWORD"`
+}
+
+// OIDCConfig lists the OpenID Connect providers users can log in with.
+// RedirectURI is the frontend page the providers send the user back to,
+// which must be registered with every provider.
+type OIDCConfig struct {
+	RedirectURI string               `xml:"REDIRECT_URI"`
+	Providers   []OIDCProviderConfig `xml:"PROVIDER"`
+}
+
+// OIDCProviderConfig is one identity provider, such as Google Workspace or
+// Microsoft Entra ID. Issuer is the base of its discovery document.
+type OIDCProviderConfig struct {
+	Name         string `xml:"NAME,attr"`
+	DisplayName  string `xml:"DISPLAY_NAME"`
+	Issuer       string `xml:"ISSUER"`
+	ClientID     string `xml:"CLIENT_ID"`
+	ClientSecret string `xml:"CLIENT_SECRET"`
+	Scopes       string `xml:"SCOPES"` // space-separated; default "openid email profile"
+	// AllowedDomains restricts logins to these email domains; empty allows any.
+	AllowedDomains []string `xml:"ALLOWED_DOMAIN"`
+	// AllowSignup creates accounts for unknown users on their first login.
+	AllowSignup bool `xml:"ALLOW_SIGNUP"`
+	// TrustEmail treats the provider's email addresses as verified when its
+	// tokens carry no email_verified claim, as with Microsoft Entra ID.
+	TrustEmail bool `xml:"TRUST_EMAIL"`
+}
+
 // LoadConfig loads and parses the XML configuration from the given file.
 func LoadConfig(xmlPath string) (*APIConfig, error) {
 	once.Do(func() {
@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"inkwell-backend-V2.0/internal/db"
 	"inkwell-backend-V2.0/internal/repository"
@@ -58,29 +61,89 @@ func (ac *AnalysisController) GetOverview(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
 		return
 	}
-	progressData, err := service.GenerateProgressData(db.GetDB(), uid)
+	rng, err := parseReportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	progressData, err := service.GenerateProgressData(db.GetDB(), uid, rng)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"initial_progress": progressData.InitialProgress,
-		"current_progress": progressData.CurrentProgress,
-	})
+	c.JSON(http.StatusOK, progressData)
 }
 
+// DownloadReport renders the initial or current progress report as a PDF,
+// optionally limited to the from/to dates (YYYY-MM-DD, both inclusive).
 func (ac *AnalysisController) DownloadReport(c *gin.Context) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	uid, ok := userIDVal.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
 	reportType := c.Query("type")
 	var filename string
-	if reportType == "initial" {
+	if reportType == service.ReportInitial {
 		filename = "initial_progress_report.pdf"
-	} else if reportType == "current" {
+	} else if reportType == service.ReportCurrent {
 		filename = "progress_report.pdf"
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report type"})
 		return
 	}
-	pdfContent := []byte("%PDF-1.4 dummy pdf content")
+	rng, err := parseReportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := repository.NewUserRepository().GetUserByID(uid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	report, err := service.BuildProgressReport(db.GetDB(), user, reportType, rng)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	pdfContent, err := service.RenderProgressReport(report)
+	if err != nil {
+		log.Printf("Failed to render %s progress report for user %d: %v", reportType, uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate report"})
+		return
+	}
 	c.Header("Content-Disposition", "attachment; filename="+filename)
 	c.Data(http.StatusOK, "application/pdf", pdfContent)
 }
+
+// parseReportRange reads the optional from/to query parameters. Dates are
+// inclusive, so the upper bound is moved to the start of the following day.
+func parseReportRange(c *gin.Context) (service.ReportRange, error) {
+	var rng service.ReportRange
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return rng, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+		rng.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return rng, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+		rng.To = t.AddDate(0, 0, 1)
+	}
+	if !rng.From.IsZero() && !rng.To.IsZero() && !rng.From.Before(rng.To) {
+		return rng, fmt.Errorf("from date must not be after to date")
+	}
+	return rng, nil
+}
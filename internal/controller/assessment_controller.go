@@ -2,14 +2,11 @@ package controller
 
 import (
 	"inkwell-backend-V2.0/internal/model"
-	"inkwell-backend-V2.0/internal/repository"
 	"inkwell-backend-V2.0/internal/service"
 
+	"errors"
 	"log"
 	"net/http"
-	"time"
-
-	"math/rand"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,27 +19,79 @@ func NewAssessmentController(assessmentService service.AssessmentService) *Asses
 	return &AssessmentController{AssessmentService: assessmentService}
 }
 
+// StartAssessment opens an adaptive session. Questions are served one at a
+// time: the first here, each following one in the response to its predecessor.
 func (ac *AssessmentController) StartAssessment(c *gin.Context) {
-	grammarTopics := []string{
-		"Tenses", "Subject-Verb Agreement", "Active and Passive Voice",
-		"Direct and Indirect Speech", "Punctuation Rules",
-	}
-	src := rand.NewSource(time.Now().UnixNano())
-	ra := rand.New(src)
-	selectedTopic := grammarTopics[ra.Intn(len(grammarTopics))]
-	assessment, questions, err := ac.AssessmentService.CreateAssessment(c, selectedTopic)
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	assessment, question, err := ac.AssessmentService.CreateAssessment(uid)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"session_id": assessment.SessionID,
-		"topic":      selectedTopic,
-		"questions":  questions,
+		"topic":      assessment.Category,
+		"question":   question,
+		"questions":  []model.LearnerQuestion{*question},
+	})
+}
+
+// GetPlacementStatus returns the user's CEFR level and whether they may take the placement test.
+func (ac *AssessmentController) GetPlacementStatus(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	status, err := ac.AssessmentService.GetPlacementStatus(uid)
+	if err != nil {
+		assessmentError(c, err, "Failed to fetch placement status")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// StartPlacement opens a placement test. It is answered like any other
+// session, and the response to its last answer carries the new level.
+func (ac *AssessmentController) StartPlacement(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	assessment, question, err := ac.AssessmentService.StartPlacement(uid)
+	if err != nil {
+		assessmentError(c, err, "Failed to start placement test")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": assessment.SessionID,
+		"kind":       assessment.Kind,
+		"question":   question,
 	})
 }
 
+// GetSkills returns the user's estimated ability per topic.
+func (ac *AssessmentController) GetSkills(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	skills, err := ac.AssessmentService.GetSkillEstimates(uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch skill estimates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"skills": skills})
+}
+
+// SubmitAssessment answers the current question of one of the user's sessions.
 func (ac *AssessmentController) SubmitAssessment(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
 	var req struct {
 		SessionID  string `json:"session_id" binding:"required"`
 		QuestionID uint   `json:"question_id" binding:"required"`
@@ -53,58 +102,81 @@ func (ac *AssessmentController) SubmitAssessment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: missing required fields"})
 		return
 	}
-	assessment, err := ac.AssessmentService.GetAssessmentBySessionID(req.SessionID)
+	answerResponse, err := ac.AssessmentService.SubmitAnswer(uid, req.SessionID, req.QuestionID, req.Answer)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		assessmentError(c, err, "Failed to save answer")
 		return
 	}
-	question, err := repository.NewAssessmentRepository().GetQuestionByID(req.QuestionID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+	c.JSON(http.StatusOK, answerResponse)
+}
+
+func (ac *AssessmentController) GetAssessment(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
 		return
 	}
-	var belongs bool
-	for _, q := range assessment.Questions {
-		if q.ID == question.ID {
-			belongs = true
-			break
-		}
-	}
-	if !belongs {
-		log.Printf("Assessment Questions: %+v", assessment.Questions)
-		log.Printf("Submitted Question ID: %d", req.QuestionID)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Question does not belong to this assessment"})
+	assessment, err := ac.AssessmentService.GetAssessmentBySessionID(uid, c.Param("session_id"))
+	if err != nil {
+		assessmentError(c, err, "Failed to fetch assessment")
 		return
 	}
-	isCorrect := question.CorrectAnswer == req.Answer
-	feedback := "Incorrect"
-	if isCorrect {
-		feedback = "Correct"
-	}
-	answer := model.Answer{
-		AssessmentID: assessment.ID,
-		SessionID:    req.SessionID,
-		QuestionID:   req.QuestionID,
-		UserID:       assessment.UserID,
-		Answer:       req.Answer,
-		IsCorrect:    isCorrect,
-		Feedback:     feedback,
+	c.JSON(http.StatusOK, assessment)
+}
+
+// GetAssessmentReview reveals the correct answers once the session is completed.
+func (ac *AssessmentController) GetAssessmentReview(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
 	}
-	answerResponse, err := ac.AssessmentService.SaveAnswer(&answer)
+	review, err := ac.AssessmentService.GetAssessmentReview(uid, c.Param("session_id"))
 	if err != nil {
-		log.Printf("Failed to save answer: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save answer"})
+		assessmentError(c, err, "Failed to fetch review")
 		return
 	}
-	c.JSON(http.StatusOK, answerResponse)
+	c.JSON(http.StatusOK, review)
 }
 
-func (ac *AssessmentController) GetAssessment(c *gin.Context) {
-	sessionID := c.Param("session_id")
-	assessment, err := ac.AssessmentService.GetAssessmentBySessionID(sessionID)
+// AbandonAssessment ends one of the user's ongoing sessions early.
+func (ac *AssessmentController) AbandonAssessment(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	assessment, err := ac.AssessmentService.AbandonAssessment(uid, c.Param("session_id"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+		assessmentError(c, err, "Failed to abandon assessment")
 		return
 	}
-	c.JSON(http.StatusOK, assessment)
+	c.JSON(http.StatusOK, gin.H{"session_id": assessment.SessionID, "status": assessment.Status})
+}
+
+func currentUserID(c *gin.Context) (uint, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return 0, false
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return uid, true
+}
+
+func assessmentError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrAssessmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+	case errors.Is(err, service.ErrAssessmentExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAssessmentClosed), errors.Is(err, service.ErrNotCurrentQuestion),
+		errors.Is(err, service.ErrAlreadyAnswered), errors.Is(err, service.ErrReviewUnavailable),
+		errors.Is(err, service.ErrPlacementNotDue), errors.Is(err, service.ErrPlacementInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
 }
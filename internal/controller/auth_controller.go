@@ -3,7 +3,10 @@ package controller
 import (
 	"inkwell-backend-V2.0/internal/model"
 	"inkwell-backend-V2.0/internal/service"
+	"inkwell-backend-V2.0/internal/utilities"
 
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -18,11 +21,24 @@ func NewAuthController(authService service.AuthService) *AuthController {
 }
 
 func (ac *AuthController) Register(c *gin.Context) {
-	var user model.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var input struct {
+		Username  string `json:"username"`
+		Email     string `json:"email"`
+		Password  string `json:"password"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	user := model.User{
+		Username:  input.Username,
+		Email:     input.Email,
+		Password:  input.Password,
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+	}
 	if err := ac.AuthService.Register(&user); err != nil {
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
@@ -30,16 +46,36 @@ func (ac *AuthController) Register(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
 }
 
+// Login authenticates with email and password. Older clients may send
+// authhash instead, which is accepted only while LEGACY_AUTHHASH is enabled.
 func (ac *AuthController) Login(c *gin.Context) {
 	var creds struct {
 		Email    string `json:"email"`
+		Password string `json:"password"`
 		AuthHash string `json:"authhash"`
 	}
-	if err := c.ShouldBindJSON(&creds); err != nil {
+	if err := c.ShouldBindJSON(&creds); err != nil || creds.Email == "" || creds.Password == "" && creds.AuthHash == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	user, err := ac.AuthService.Login(creds.Email, creds.AuthHash)
+	var user *service.LoginResponse
+	var err error
+	if creds.Password != "" {
+		user, err = ac.AuthService.Login(creds.Email, creds.Password, clientInfo(c))
+	} else {
+		user, err = ac.AuthService.LoginWithAuthHash(creds.Email, creds.AuthHash, clientInfo(c))
+	}
+	if errors.Is(err, service.ErrAuthHashDisabled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if loginThrottled(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
@@ -55,10 +91,155 @@ func (ac *AuthController) Refresh(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	newTokens, err := ac.AuthService.RefreshTokens(req.RefreshToken)
+	newTokens, err := ac.AuthService.RefreshTokens(req.RefreshToken, clientInfo(c))
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, newTokens)
 }
+
+// RequestEmailVerification emails a new verification link. It answers the
+// same whether or not the address belongs to an account.
+func (ac *AuthController) RequestEmailVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := ac.AuthService.RequestEmailVerification(req.Email); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address belongs to an unverified account, a verification email has been sent"})
+}
+
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := ac.AuthService.VerifyEmail(req.Token); err != nil {
+		accountTokenError(c, err, "Failed to verify email")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+}
+
+// RequestPasswordReset emails a reset link. It answers the same whether or
+// not the address belongs to an account.
+func (ac *AuthController) RequestPasswordReset(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := ac.AuthService.RequestPasswordReset(req.Email); err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address belongs to an account, a password reset email has been sent"})
+}
+
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := ac.AuthService.ResetPassword(req.Token, req.Password); err != nil {
+		accountTokenError(c, err, "Failed to reset password")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed; log in with the new password"})
+}
+
+// Logout ends the session the access token belongs to.
+func (ac *AuthController) Logout(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if err := ac.AuthService.Logout(uid, c.GetString("session_id")); err != nil {
+		sessionError(c, err, "Failed to log out")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll ends all of the user's sessions on every device.
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if err := ac.AuthService.LogoutAll(uid); err != nil {
+		sessionError(c, err, "Failed to log out")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+}
+
+// ListSessions lists the user's active sessions with their device and IP address.
+func (ac *AuthController) ListSessions(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	sessions, err := ac.AuthService.ListSessions(uid, c.GetString("session_id"))
+	if err != nil {
+		sessionError(c, err, "Failed to fetch sessions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession ends one of the user's other sessions.
+func (ac *AuthController) RevokeSession(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if err := ac.AuthService.RevokeSession(uid, c.Param("id")); err != nil {
+		sessionError(c, err, "Failed to revoke session")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// JWKS publishes the public keys tokens are signed with, so that other
+// services can verify them. Clients should fetch it again on an unknown kid.
+func (ac *AuthController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utilities.JWKS())
+}
+
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+func accountTokenError(c *gin.Context, err error, message string) {
+	if errors.Is(err, service.ErrInvalidAccountToken) || errors.Is(err, service.ErrEmptyPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("%s: %v", message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+func sessionError(c *gin.Context, err error, message string) {
+	if errors.Is(err, service.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("%s: %v", message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -16,17 +16,20 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"inkwell-backend-V2.0/internal/llm"
+	"inkwell-backend-V2.0/internal/service"
 )
 
 // ChatController handles chat-related endpoints
 type ChatController struct {
-	ollamaClient *llm.OllamaClient
+	ollamaClient   *llm.OllamaClient
+	profileService service.ProfileService
 }
 
 // NewChatController creates a new chat controller
-func NewChatController(ollamaClient *llm.OllamaClient) *ChatController {
+func NewChatController(ollamaClient *llm.OllamaClient, profileService service.ProfileService) *ChatController {
 	return &ChatController{
-		ollamaClient: ollamaClient,
+		ollamaClient:   ollamaClient,
+		profileService: profileService,
 	}
 }
 
@@ -217,8 +220,12 @@ func (cc *ChatController) SpeechToText(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"text": text})
 }
 
-// TextToSpeech converts text to speech and returns audio
+// TextToSpeech converts text to speech in the user's preferred voice and returns audio
 func (cc *ChatController) TextToSpeech(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
 	var req struct {
 		Text string `json:"text" binding:"required"`
 	}
@@ -226,6 +233,10 @@ func (cc *ChatController) TextToSpeech(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
 		return
 	}
+	voice, err := cc.profileService.SpeechVoice(uid)
+	if err != nil {
+		log.Printf("Failed to load the voice of user %d: %v", uid, err)
+	}
 
 	// Create working directory if it doesn't exist
 	if err := os.MkdirAll("./working", 0755); err != nil {
@@ -236,7 +247,7 @@ func (cc *ChatController) TextToSpeech(c *gin.Context) {
 	outFile := fmt.Sprintf("./working/tts_%d.wav", time.Now().Unix())
 	defer os.Remove(outFile) // Clean up after sending
 
-	if err := GetSpeechFromTTS(req.Text, outFile); err != nil {
+	if err := GetSpeechFromTTS(req.Text, voice, outFile); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "TTS failed: " + err.Error()})
 		return
 	}
@@ -289,9 +300,14 @@ func SendAudioToSTT(audioFile string) (string, error) {
 	return result["text"], nil
 }
 
-func GetSpeechFromTTS(text string, outFile string) error {
+// GetSpeechFromTTS writes the spoken text to outFile. An empty voice uses
+// the TTS service's default voice.
+func GetSpeechFromTTS(text, voice, outFile string) error {
 	formData := url.Values{}
 	formData.Set("text", text)
+	if voice != "" {
+		formData.Set("voice", voice)
+	}
 
 	resp, err := http.PostForm("http://localhost:8001/tts", formData)
 	if err != nil {
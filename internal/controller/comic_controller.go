@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ComicController struct {
+	ComicService service.ComicService
+}
+
+func NewComicController(comicService service.ComicService) *ComicController {
+	return &ComicController{ComicService: comicService}
+}
+
+// GetComicVersions lists every generated version of a story's comic, newest first.
+func (cc *ComicController) GetComicVersions(c *gin.Context) {
+	uid, storyID, ok := comicRequestIDs(c)
+	if !ok {
+		return
+	}
+	comics, err := cc.ComicService.GetComicVersions(uid, storyID)
+	if err != nil {
+		if errors.Is(err, service.ErrStoryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Story not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comic versions"})
+		return
+	}
+	c.JSON(http.StatusOK, service.ToComicResponses(comics))
+}
+
+// RebuildComic forces a new comic version regardless of whether the story changed.
+func (cc *ComicController) RebuildComic(c *gin.Context) {
+	uid, storyID, ok := comicRequestIDs(c)
+	if !ok {
+		return
+	}
+	comic, err := cc.ComicService.RebuildComic(uid, storyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrStoryNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Story not found"})
+		case errors.Is(err, service.ErrStoryNotCompleted):
+			c.JSON(http.StatusConflict, gin.H{"error": "Story must be completed before its comic can be built"})
+		default:
+			log.Printf("Failed to rebuild comic for story %d: %v", storyID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild comic"})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, service.ToComicResponses([]model.Comic{*comic})[0])
+}
+
+func comicRequestIDs(c *gin.Context) (uint, uint, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return 0, 0, false
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return 0, 0, false
+	}
+	storyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid story ID"})
+		return 0, 0, false
+	}
+	return uid, uint(storyID), true
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"inkwell-backend-V2.0/internal/service"
+)
+
+// VerifyMFA completes a login with a code from the authenticator app or a recovery code.
+func (ac *AuthController) VerifyMFA(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		service.MFACodeInput
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	response, err := ac.AuthService.VerifyMFA(req.MFAToken, req.MFACodeInput, clientInfo(c))
+	if err != nil {
+		mfaError(c, err, "Failed to verify code")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// StartMFAEnrollment sets up an authenticator during login, for users whose
+// role requires two-factor authentication.
+func (ac *AuthController) StartMFAEnrollment(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	setup, err := ac.AuthService.StartMFAEnrollment(req.MFAToken)
+	if err != nil {
+		mfaError(c, err, "Failed to set up two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+func (ac *AuthController) GetMFAStatus(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	status, err := ac.AuthService.GetMFAStatus(uid)
+	if err != nil {
+		mfaError(c, err, "Failed to fetch two-factor status")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// SetupMFA creates a new authenticator secret for the logged-in user.
+func (ac *AuthController) SetupMFA(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	setup, err := ac.AuthService.SetupMFA(uid)
+	if err != nil {
+		mfaError(c, err, "Failed to set up two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// ConfirmMFA enables the authenticator with a first code and returns the recovery codes.
+func (ac *AuthController) ConfirmMFA(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	codes, err := ac.AuthService.ConfirmMFA(uid, req.Code, clientInfo(c))
+	if err != nil {
+		mfaError(c, err, "Failed to enable two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (ac *AuthController) DisableMFA(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req service.MFACodeInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := ac.AuthService.DisableMFA(uid, req, clientInfo(c)); err != nil {
+		mfaError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes; the old ones stop working.
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	codes, err := ac.AuthService.RegenerateRecoveryCodes(uid, req.Code, clientInfo(c))
+	if err != nil {
+		mfaError(c, err, "Failed to create recovery codes")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// loginThrottled answers 429 with Retry-After if err is a login throttle.
+func loginThrottled(c *gin.Context, err error) bool {
+	var throttled *service.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(throttled.RetryAfterSeconds()))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	return true
+}
+
+func mfaError(c *gin.Context, err error, message string) {
+	if loginThrottled(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidMFAToken), errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFARequired), errors.Is(err, service.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
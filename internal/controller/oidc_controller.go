@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"inkwell-backend-V2.0/internal/service"
+)
+
+// ListOIDCProviders lists the identity providers offered on the login page.
+func (ac *AuthController) ListOIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": ac.AuthService.ListOIDCProviders()})
+}
+
+// StartOIDCLogin returns the provider URL the frontend sends the user to,
+// and the binding it keeps until the provider sends the user back.
+func (ac *AuthController) StartOIDCLogin(c *gin.Context) {
+	authURL, binding, err := ac.AuthService.StartOIDCLogin(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		oidcError(c, err, "Failed to start login")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL, "binding": binding})
+}
+
+// CompleteOIDCLogin takes the code and state the provider sent back to the
+// frontend's redirect page, with the binding from the start of the login,
+// and logs the user in.
+func (ac *AuthController) CompleteOIDCLogin(c *gin.Context) {
+	var req struct {
+		Code    string `json:"code" binding:"required"`
+		State   string `json:"state" binding:"required"`
+		Binding string `json:"binding" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	response, err := ac.AuthService.CompleteOIDCLogin(c.Request.Context(), req.Code, req.State, req.Binding, clientInfo(c))
+	if err != nil {
+		oidcError(c, err, "Failed to log in")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func oidcError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidOIDCState), errors.Is(err, service.ErrOIDCEmailMissing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrOIDCEmailUnverified), errors.Is(err, service.ErrOIDCDomainNotAllowed),
+		errors.Is(err, service.ErrOIDCSignupDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
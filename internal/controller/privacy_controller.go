@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"inkwell-backend-V2.0/internal/service"
+)
+
+type PrivacyController struct {
+	PrivacyService service.PrivacyService
+}
+
+func NewPrivacyController(privacyService service.PrivacyService) *PrivacyController {
+	return &PrivacyController{PrivacyService: privacyService}
+}
+
+// RequestExport starts building an archive of the user's data.
+func (pc *PrivacyController) RequestExport(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	export, err := pc.PrivacyService.RequestExport(uid)
+	if err != nil {
+		privacyError(c, err, "Failed to start export")
+		return
+	}
+	c.JSON(http.StatusAccepted, export)
+}
+
+func (pc *PrivacyController) ListExports(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	exports, err := pc.PrivacyService.ListExports(uid)
+	if err != nil {
+		privacyError(c, err, "Failed to fetch exports")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": exports})
+}
+
+func (pc *PrivacyController) GetExport(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	export, err := pc.PrivacyService.GetExport(uid, c.Param("id"))
+	if err != nil {
+		privacyError(c, err, "Failed to fetch export")
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
+
+func (pc *PrivacyController) DownloadExport(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	path, err := pc.PrivacyService.OpenExport(uid, c.Param("id"))
+	if err != nil {
+		privacyError(c, err, "Failed to download export")
+		return
+	}
+	c.FileAttachment(path, "inkwell-data-export.zip")
+}
+
+// RequestErasure schedules the user's account for deletion and logs them
+// out everywhere. They can log in again to cancel during the grace period.
+func (pc *PrivacyController) RequestErasure(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	at, err := pc.PrivacyService.RequestErasure(uid, nil, c.GetString("session_id"), req.Password)
+	if err != nil {
+		privacyError(c, err, "Failed to schedule account deletion")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Account scheduled for deletion", "deletion_scheduled_for": at})
+}
+
+func (pc *PrivacyController) CancelErasure(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if err := pc.PrivacyService.CancelErasure(uid); err != nil {
+		privacyError(c, err, "Failed to cancel account deletion")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
+// EraseUser schedules another user's account for deletion on their behalf.
+func (pc *PrivacyController) EraseUser(c *gin.Context) {
+	actorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	at, err := pc.PrivacyService.RequestErasure(userID, &actorID, "", "")
+	if err != nil {
+		privacyError(c, err, "Failed to schedule account deletion")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Account scheduled for deletion", "deletion_scheduled_for": at})
+}
+
+// ListEvents lists the privacy audit trail, optionally for one user.
+func (pc *PrivacyController) ListEvents(c *gin.Context) {
+	var userID uint
+	if id := c.Query("user_id"); id != "" {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		userID = uint(n)
+	}
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = n
+	}
+	events, err := pc.PrivacyService.ListEvents(userID, limit)
+	if err != nil {
+		privacyError(c, err, "Failed to fetch privacy events")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+func privacyError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrExportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrExportInProgress), errors.Is(err, service.ErrExportNotReady):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrErasureNotScheduled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrReauthRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"inkwell-backend-V2.0/internal/service"
+)
+
+type ProfileController struct {
+	ProfileService service.ProfileService
+}
+
+func NewProfileController(profileService service.ProfileService) *ProfileController {
+	return &ProfileController{ProfileService: profileService}
+}
+
+func (pc *ProfileController) GetProfile(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	user, err := pc.ProfileService.GetProfile(uid)
+	if err != nil {
+		profileError(c, err, "Failed to fetch profile")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateProfile changes the fields present in the body.
+func (pc *ProfileController) UpdateProfile(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var input service.ProfileUpdate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	user, err := pc.ProfileService.UpdateProfile(uid, input)
+	if err != nil {
+		profileError(c, err, "Failed to update profile")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// SetAvatar takes the image from the "avatar" form field.
+func (pc *ProfileController) SetAvatar(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	// Leave room for the multipart headers around the file.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.MaxAvatarBytes()+64<<10)
+	file, err := c.FormFile("avatar")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrAvatarTooLarge.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing avatar file"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unreadable avatar file"})
+		return
+	}
+	defer f.Close()
+	// Read one byte past the limit so that oversized files are refused
+	// without reading them whole.
+	data, err := io.ReadAll(io.LimitReader(f, service.MaxAvatarBytes()+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unreadable avatar file"})
+		return
+	}
+	user, err := pc.ProfileService.SetAvatar(uid, data)
+	if err != nil {
+		profileError(c, err, "Failed to save avatar")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func (pc *ProfileController) RemoveAvatar(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	user, err := pc.ProfileService.RemoveAvatar(uid)
+	if err != nil {
+		profileError(c, err, "Failed to remove avatar")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// RequestEmailChange emails a confirmation link to the new address.
+func (pc *ProfileController) RequestEmailChange(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := pc.ProfileService.RequestEmailChange(uid, c.GetString("session_id"), req.Email, req.Password); err != nil {
+		profileError(c, err, "Failed to change email")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "A confirmation link has been sent to the new address"})
+}
+
+// ConfirmEmailChange is opened from the link sent to the new address, so
+// it works without logging in.
+func (pc *ProfileController) ConfirmEmailChange(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := pc.ProfileService.ConfirmEmailChange(req.Token); err != nil {
+		profileError(c, err, "Failed to change email")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email address changed; log in with the new address"})
+}
+
+// ChangePassword sets a new password and logs out the user's other devices.
+func (pc *ProfileController) ChangePassword(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := pc.ProfileService.ChangePassword(uid, c.GetString("session_id"), req.CurrentPassword, req.NewPassword); err != nil {
+		profileError(c, err, "Failed to change password")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+func profileError(c *gin.Context, err error, message string) {
+	var verr *service.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "details": verr.Errors})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrReauthRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAvatarTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidAvatar), errors.Is(err, service.ErrInvalidEmail), errors.Is(err, service.ErrSameEmail),
+		errors.Is(err, service.ErrEmptyPassword), errors.Is(err, service.ErrInvalidAccountToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
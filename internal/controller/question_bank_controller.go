@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize caps the size of an uploaded question file.
+const maxImportSize = 10 << 20
+
+type QuestionBankController struct {
+	QuestionBankService service.QuestionBankService
+}
+
+func NewQuestionBankController(questionBankService service.QuestionBankService) *QuestionBankController {
+	return &QuestionBankController{QuestionBankService: questionBankService}
+}
+
+func (qc *QuestionBankController) ListTopics(c *gin.Context) {
+	topics, err := qc.QuestionBankService.ListTopics()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch topics"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"topics": topics})
+}
+
+func (qc *QuestionBankController) CreateTopic(c *gin.Context) {
+	var input service.TopicInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	topic, err := qc.QuestionBankService.CreateTopic(input)
+	if err != nil {
+		questionBankError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, topic)
+}
+
+func (qc *QuestionBankController) UpdateTopic(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	var input service.TopicInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	topic, err := qc.QuestionBankService.UpdateTopic(id, input)
+	if err != nil {
+		questionBankError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, topic)
+}
+
+func (qc *QuestionBankController) DeleteTopic(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	if err := qc.QuestionBankService.DeleteTopic(id); err != nil {
+		questionBankError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListQuestions supports filtering by ?topic=, ?tag=, ?status= and ?active=true|false.
+func (qc *QuestionBankController) ListQuestions(c *gin.Context) {
+	filter, ok := questionFilter(c)
+	if !ok {
+		return
+	}
+	questions, err := qc.QuestionBankService.ListQuestions(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"questions": questions})
+}
+
+func (qc *QuestionBankController) GetQuestion(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	question, err := qc.QuestionBankService.GetQuestion(id)
+	if err != nil {
+		questionBankError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, question)
+}
+
+func (qc *QuestionBankController) CreateQuestion(c *gin.Context) {
+	var rec service.QuestionRecord
+	if err := c.ShouldBindJSON(&rec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	question, err := qc.QuestionBankService.CreateQuestion(rec)
+	if err != nil {
+		questionBankError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, question)
+}
+
+func (qc *QuestionBankController) UpdateQuestion(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	var rec service.QuestionRecord
+	if err := c.ShouldBindJSON(&rec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	question, err := qc.QuestionBankService.UpdateQuestion(id, rec)
+	if err != nil {
+		questionBankError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, question)
+}
+
+func (qc *QuestionBankController) DeleteQuestion(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	if err := qc.QuestionBankService.DeleteQuestion(id); err != nil {
+		questionBankError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GenerateQuestions has the LLM draft new questions for review.
+func (qc *QuestionBankController) GenerateQuestions(c *gin.Context) {
+	var req service.GenerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	result, err := qc.QuestionBankService.GenerateDrafts(req)
+	if err != nil {
+		var verr *service.ValidationError
+		if errors.As(err, &verr) {
+			questionBankError(c, err)
+			return
+		}
+		log.Printf("Question generation failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Question generation failed"})
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+func (qc *QuestionBankController) ApproveQuestion(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	question, err := qc.QuestionBankService.ApproveQuestion(id)
+	if err != nil {
+		questionBankError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, question)
+}
+
+func (qc *QuestionBankController) RejectQuestion(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	// The reason is optional, so an empty body is fine.
+	_ = c.ShouldBindJSON(&req)
+	question, err := qc.QuestionBankService.RejectQuestion(id, req.Reason)
+	if err != nil {
+		questionBankError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, question)
+}
+
+// ImportQuestions accepts a CSV or JSON file, either as the multipart field
+// "file" or as the raw request body. The format comes from ?format=, else
+// from the file extension or content type. ?dry_run=true only validates.
+func (qc *QuestionBankController) ImportQuestions(c *gin.Context) {
+	var body io.Reader
+	format := strings.ToLower(c.Query("format"))
+	if file, header, err := c.Request.FormFile("file"); err == nil {
+		defer file.Close()
+		body = io.LimitReader(file, maxImportSize)
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+	} else {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxImportSize))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		body = bytes.NewReader(data)
+		if format == "" {
+			switch ct := c.ContentType(); {
+			case strings.Contains(ct, "json"):
+				format = service.FormatJSON
+			case strings.Contains(ct, "csv"):
+				format = service.FormatCSV
+			}
+		}
+	}
+	if format != service.FormatCSV && format != service.FormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, use csv or json"})
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	report, err := qc.QuestionBankService.ImportQuestions(format, body, dryRun)
+	if err != nil {
+		if report == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Question import failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed; nothing was imported", "report": report})
+		return
+	}
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, report)
+}
+
+// ExportQuestions downloads the question bank as ?format=csv or json (default),
+// with the same filters as ListQuestions.
+func (qc *QuestionBankController) ExportQuestions(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", service.FormatJSON))
+	contentType := map[string]string{
+		service.FormatCSV:  "text/csv; charset=utf-8",
+		service.FormatJSON: "application/json",
+	}[format]
+	if contentType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, use csv or json"})
+		return
+	}
+	filter, ok := questionFilter(c)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	if err := qc.QuestionBankService.ExportQuestions(format, &buf, filter); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export questions"})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=questions."+format)
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+func questionFilter(c *gin.Context) (repository.QuestionFilter, bool) {
+	filter := repository.QuestionFilter{Topic: c.Query("topic"), Tag: c.Query("tag"), Status: c.Query("status")}
+	if v := c.Query("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "active must be true or false"})
+			return filter, false
+		}
+		filter.Active = &active
+	}
+	return filter, true
+}
+
+func pathID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func questionBankError(c *gin.Context, err error) {
+	var verr *service.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "details": verr.Errors})
+	case errors.Is(err, service.ErrTopicNotFound), errors.Is(err, service.ErrQuestionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTopicExists), errors.Is(err, service.ErrTopicInUse), errors.Is(err, service.ErrQuestionInUse),
+		errors.Is(err, service.ErrNotDraft):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Question bank error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
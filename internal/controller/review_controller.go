@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"inkwell-backend-V2.0/internal/service"
+)
+
+type ReviewController struct {
+	ReviewService service.ReviewService
+}
+
+func NewReviewController(reviewService service.ReviewService) *ReviewController {
+	return &ReviewController{ReviewService: reviewService}
+}
+
+// GetDueCards serves the user's review cards due today, most overdue first.
+func (rc *ReviewController) GetDueCards(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = n
+	}
+	cards, total, err := rc.ReviewService.GetDueCards(uid, limit)
+	if err != nil {
+		log.Printf("Failed to fetch review cards: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch review cards"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"due_count": total, "cards": cards})
+}
+
+// GradeCard records a review of one card and schedules its next one.
+func (rc *ReviewController) GradeCard(c *gin.Context) {
+	uid, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	cardID, err := strconv.ParseUint(c.Param("card_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid card ID"})
+		return
+	}
+	var req struct {
+		Quality *int   `json:"quality"`
+		Answer  string `json:"answer"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	result, err := rc.ReviewService.GradeCard(uid, uint(cardID), req.Quality, req.Answer)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, result)
+	case errors.Is(err, service.ErrReviewCardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrReviewCardLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidQuality):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrReviewUngraded):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Failed to grade review card: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grade review card"})
+	}
+}
@@ -5,15 +5,22 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"inkwell-backend-V2.0/internal/llm"
+	"inkwell-backend-V2.0/internal/model"
 	"inkwell-backend-V2.0/internal/service"
+	"inkwell-backend-V2.0/pkg/middleware"
 )
 
 func RegisterRoutes(
 	r *gin.Engine,
 	authService service.AuthService,
 	userService service.UserService,
+	profileService service.ProfileService,
+	privacyService service.PrivacyService,
 	assessmentService service.AssessmentService,
 	storyService service.StoryService,
+	comicService service.ComicService,
+	questionBankService service.QuestionBankService,
+	reviewService service.ReviewService,
 	ollamaClient *llm.OllamaClient, // Add ollama client parameter
 ) {
 	// Auth routes.
@@ -23,11 +30,56 @@ func RegisterRoutes(
 		authRoutes.POST("/register", authCtrl.Register)
 		authRoutes.POST("/login", authCtrl.Login)
 		authRoutes.POST("/refresh", authCtrl.Refresh)
+		authRoutes.POST("/verify-email/request", authCtrl.RequestEmailVerification)
+		authRoutes.POST("/verify-email/confirm", authCtrl.VerifyEmail)
+		authRoutes.POST("/password-reset/request", authCtrl.RequestPasswordReset)
+		authRoutes.POST("/password-reset/confirm", authCtrl.ResetPassword)
+		authRoutes.POST("/logout", authCtrl.Logout)
+		authRoutes.POST("/logout-all", authCtrl.LogoutAll)
+		authRoutes.GET("/sessions", authCtrl.ListSessions)
+		authRoutes.DELETE("/sessions/:id", authCtrl.RevokeSession)
+
+		authRoutes.POST("/mfa/verify", authCtrl.VerifyMFA)
+		authRoutes.POST("/mfa/enroll", authCtrl.StartMFAEnrollment)
+		authRoutes.GET("/mfa", authCtrl.GetMFAStatus)
+		authRoutes.POST("/mfa/setup", authCtrl.SetupMFA)
+		authRoutes.POST("/mfa/confirm", authCtrl.ConfirmMFA)
+		authRoutes.POST("/mfa/disable", authCtrl.DisableMFA)
+		authRoutes.POST("/mfa/recovery-codes", authCtrl.RegenerateRecoveryCodes)
+
+		authRoutes.GET("/oidc/providers", authCtrl.ListOIDCProviders)
+		authRoutes.GET("/oidc/:provider/start", authCtrl.StartOIDCLogin)
+		authRoutes.POST("/oidc/callback", authCtrl.CompleteOIDCLogin)
 	}
+	r.GET("/.well-known/jwks.json", authCtrl.JWKS)
 
 	// User routes.
 	userCtrl := NewUserController(userService)
-	r.GET("/user", userCtrl.GetAllUsers)
+	r.GET("/user", middleware.RequirePermission(model.PermViewUsers), userCtrl.GetAllUsers)
+
+	// Profile routes for the logged-in user.
+	profileCtrl := NewProfileController(profileService)
+	meRoutes := r.Group("/me")
+	{
+		meRoutes.GET("", profileCtrl.GetProfile)
+		meRoutes.PATCH("", profileCtrl.UpdateProfile)
+		meRoutes.PUT("/avatar", profileCtrl.SetAvatar)
+		meRoutes.DELETE("/avatar", profileCtrl.RemoveAvatar)
+		meRoutes.POST("/email", profileCtrl.RequestEmailChange)
+		meRoutes.PUT("/password", profileCtrl.ChangePassword)
+	}
+	r.POST("/auth/email-change/confirm", profileCtrl.ConfirmEmailChange)
+
+	// Data export and account erasure.
+	privacyCtrl := NewPrivacyController(privacyService)
+	{
+		meRoutes.DELETE("", privacyCtrl.RequestErasure)
+		meRoutes.DELETE("/deletion", privacyCtrl.CancelErasure)
+		meRoutes.POST("/exports", privacyCtrl.RequestExport)
+		meRoutes.GET("/exports", privacyCtrl.ListExports)
+		meRoutes.GET("/exports/:id", privacyCtrl.GetExport)
+		meRoutes.GET("/exports/:id/download", privacyCtrl.DownloadExport)
+	}
 
 	// Assessment routes.
 	assessmentCtrl := NewAssessmentController(assessmentService)
@@ -35,11 +87,59 @@ func RegisterRoutes(
 	{
 		assessRoutes.POST("/start", assessmentCtrl.StartAssessment)
 		assessRoutes.POST("/submit", assessmentCtrl.SubmitAssessment)
+		assessRoutes.GET("/skills", assessmentCtrl.GetSkills)
+		assessRoutes.GET("/placement", assessmentCtrl.GetPlacementStatus)
+		assessRoutes.POST("/placement", assessmentCtrl.StartPlacement)
 		assessRoutes.GET("/:session_id", assessmentCtrl.GetAssessment)
+		assessRoutes.GET("/:session_id/review", assessmentCtrl.GetAssessmentReview)
+		assessRoutes.POST("/:session_id/abandon", assessmentCtrl.AbandonAssessment)
+	}
+
+	// Spaced-repetition review.
+	reviewCtrl := NewReviewController(reviewService)
+	reviewRoutes := r.Group("/review")
+	{
+		reviewRoutes.GET("/due", reviewCtrl.GetDueCards)
+		reviewRoutes.POST("/:card_id/grade", reviewCtrl.GradeCard)
+	}
+
+	// Question bank administration.
+	questionBankCtrl := NewQuestionBankController(questionBankService)
+	adminRoutes := r.Group("/admin", middleware.RequirePermission(model.PermManageQuestions))
+	{
+		adminRoutes.GET("/topics", questionBankCtrl.ListTopics)
+		adminRoutes.POST("/topics", questionBankCtrl.CreateTopic)
+		adminRoutes.PUT("/topics/:id", questionBankCtrl.UpdateTopic)
+		adminRoutes.DELETE("/topics/:id", questionBankCtrl.DeleteTopic)
+
+		adminRoutes.GET("/questions", questionBankCtrl.ListQuestions)
+		adminRoutes.POST("/questions", questionBankCtrl.CreateQuestion)
+		adminRoutes.POST("/questions/import", questionBankCtrl.ImportQuestions)
+		adminRoutes.GET("/questions/export", questionBankCtrl.ExportQuestions)
+		adminRoutes.POST("/questions/generate", questionBankCtrl.GenerateQuestions)
+		adminRoutes.POST("/questions/:id/approve", questionBankCtrl.ApproveQuestion)
+		adminRoutes.POST("/questions/:id/reject", questionBankCtrl.RejectQuestion)
+		adminRoutes.GET("/questions/:id", questionBankCtrl.GetQuestion)
+		adminRoutes.PUT("/questions/:id", questionBankCtrl.UpdateQuestion)
+		adminRoutes.DELETE("/questions/:id", questionBankCtrl.DeleteQuestion)
+	}
+
+	// User administration.
+	userAdminRoutes := r.Group("/admin/users")
+	{
+		userAdminRoutes.GET("", middleware.RequirePermission(model.PermViewUsers), userCtrl.GetAllUsers)
+		userAdminRoutes.GET("/:id", middleware.RequirePermission(model.PermViewUsers), userCtrl.GetUser)
+		userAdminRoutes.PUT("/:id/role", middleware.RequirePermission(model.PermManageUsers), userCtrl.UpdateRole)
+		userAdminRoutes.POST("/:id/logout", middleware.RequirePermission(model.PermManageUsers), userCtrl.RevokeSessions)
+		userAdminRoutes.DELETE("/:id/mfa", middleware.RequirePermission(model.PermManageUsers), userCtrl.ResetMFA)
+		userAdminRoutes.POST("/:id/erase", middleware.RequirePermission(model.PermManageUsers), privacyCtrl.EraseUser)
 	}
+	r.GET("/admin/login-attempts", middleware.RequirePermission(model.PermManageUsers), userCtrl.ListLoginAttempts)
+	r.GET("/admin/privacy-events", middleware.RequirePermission(model.PermManageUsers), privacyCtrl.ListEvents)
 
 	// Story routes.
 	storyCtrl := NewStoryController(storyService)
+	comicCtrl := NewComicController(comicService)
 	storyRoutes := r.Group("/stories")
 	{
 		storyRoutes.GET("/", storyCtrl.GetStories)
@@ -48,6 +148,8 @@ func RegisterRoutes(
 		storyRoutes.POST("/:id/complete_story", storyCtrl.CompleteStory)
 		storyRoutes.GET("/progress", storyCtrl.GetProgress)
 		storyRoutes.GET("/comics", storyCtrl.GetComics)
+		storyRoutes.GET("/:id/comics", comicCtrl.GetComicVersions)
+		storyRoutes.POST("/:id/comics/rebuild", comicCtrl.RebuildComic)
 	}
 
 	// Analysis routes.
@@ -60,7 +162,7 @@ func RegisterRoutes(
 	}
 
 	// Chat routes - NEW
-	chatCtrl := NewChatController(ollamaClient)
+	chatCtrl := NewChatController(ollamaClient, profileService)
 	chatRoutes := r.Group("/chat")
 	{
 		chatRoutes.POST("/stream", chatCtrl.StreamChat)
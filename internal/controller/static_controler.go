@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 
 	"github.com/gin-gonic/gin"
+	"inkwell-backend-V2.0/internal/service"
 )
 
 type StaticController struct{}
@@ -18,11 +19,13 @@ func (sc *StaticController) ServeStatic(c *gin.Context) {
 }
 
 func (sc *StaticController) DownloadComic(c *gin.Context) {
-	filename := c.Param("filename")
+	filename := filepath.Base(c.Param("filename"))
 	filePath := "./working/comics/" + filename
-	if filepath.Ext(filename) == ".pdf" {
-		c.Header("Content-Disposition", "attachment; filename="+filename)
-		c.Header("Content-Type", "application/pdf")
+	if format, ok := service.ComicFormatByExtension(filepath.Ext(filename)); ok {
+		if !format.Inline {
+			c.Header("Content-Disposition", "attachment; filename="+filename)
+		}
+		c.Header("Content-Type", format.ContentType)
 	}
 	c.File(filePath)
 }
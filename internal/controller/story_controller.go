@@ -70,7 +70,7 @@ func (sc *StoryController) StartStory(c *gin.Context) {
 		"story_id":               story.ID,
 		"guidance":               "Begin with an exciting sentence!",
 		"current_sentence_count": 0,
-		"max_sentences":          5,
+		"max_sentences":          sc.StoryService.SentenceTarget(uid),
 		"story_status":           "in_progress",
 	})
 }
@@ -1,6 +1,10 @@
 package controller
 
 import (
+	"errors"
+	"log"
+	"strconv"
+
 	"inkwell-backend-V2.0/internal/service"
 
 	"net/http"
@@ -24,3 +28,117 @@ func (uc *UserController) GetAllUsers(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, users)
 }
+
+func (uc *UserController) GetUser(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	user, err := uc.UserService.GetUser(userID)
+	if err != nil {
+		userError(c, err, "Failed to fetch user")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateRole changes a user's role, which ends their sessions.
+func (uc *UserController) UpdateRole(c *gin.Context) {
+	actorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	user, err := uc.UserService.UpdateRole(actorID, userID, input.Role)
+	if err != nil {
+		userError(c, err, "Failed to update role")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// RevokeSessions logs a user out on every device.
+func (uc *UserController) RevokeSessions(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	if err := uc.UserService.RevokeSessions(userID); err != nil {
+		userError(c, err, "Failed to revoke sessions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked"})
+}
+
+// ResetMFA removes a user's two-factor setup, for a user who lost their
+// authenticator and recovery codes.
+func (uc *UserController) ResetMFA(c *gin.Context) {
+	actorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	if err := uc.UserService.ResetMFA(actorID, userID); err != nil {
+		userError(c, err, "Failed to reset two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+// maxLoginAttempts caps how many login attempts are listed at once.
+const maxLoginAttempts = 500
+
+// ListLoginAttempts lists recent logins for auditing, filtered by the
+// optional email and ip parameters.
+func (uc *UserController) ListLoginAttempts(c *gin.Context) {
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(n, maxLoginAttempts)
+	}
+	attempts, err := uc.UserService.ListLoginAttempts(c.Query("email"), c.Query("ip"), limit)
+	if err != nil {
+		log.Printf("Failed to fetch login attempts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login attempts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+}
+
+func userIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func userError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrCannotChangeOwnRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -126,10 +126,23 @@ type ChatMessage struct {
 }
 
 func (o *OllamaClient) callOllama(prompt string) (string, error) {
-	requestBody, _ := json.Marshal(map[string]interface{}{
+	return o.callOllamaWithOptions(prompt, nil)
+}
+
+// callOllamaJSON asks Ollama to constrain its output to valid JSON.
+func (o *OllamaClient) callOllamaJSON(prompt string) (string, error) {
+	return o.callOllamaWithOptions(prompt, map[string]interface{}{"format": "json", "stream": false})
+}
+
+func (o *OllamaClient) callOllamaWithOptions(prompt string, options map[string]interface{}) (string, error) {
+	body := map[string]interface{}{
 		"model":  "mistral",
 		"prompt": prompt,
-	})
+	}
+	for k, v := range options {
+		body[k] = v
+	}
+	requestBody, _ := json.Marshal(body)
 
 	req, err := http.NewRequest("POST", o.ollamaURL, bytes.NewBuffer(requestBody))
 	if err != nil {
@@ -202,13 +215,132 @@ func AggregateStreamedResponse(body string) string {
 	return builder.String()
 }
 
-func (o *OllamaClient) GenerateQuestions(topic string, limit int) ([]string, error) {
-	prompt := fmt.Sprintf("Generate %d multiple-choice questions on %s.", limit, topic)
-	response, err := o.callOllama(prompt)
+// GeneratedQuestion is one assessment item proposed by the LLM.
+type GeneratedQuestion struct {
+	MaskedSentence string `json:"masked_sentence"`
+	ErrorSentence  string `json:"error_sentence"`
+	CorrectAnswer  string `json:"correct_answer"`
+	Explanation    string `json:"explanation"`
+}
+
+// GenerateQuestions asks for count items of the given type ("masked" or
+// "error_correction") on a grammar topic at a learner level.
+func (o *OllamaClient) GenerateQuestions(topic, questionType, level string, count int) ([]GeneratedQuestion, error) {
+	var format string
+	switch questionType {
+	case "masked":
+		format = `Each item is a single English sentence with exactly one blank written as [MASK], ` +
+			`and the word or short phrase that correctly fills it. ` +
+			`Respond with JSON: {"questions": [{"masked_sentence": "...", "correct_answer": "...", "explanation": "..."}]}`
+	case "error_correction":
+		format = `Each item is a single English sentence containing exactly one grammatical error, ` +
+			`and the full corrected sentence. ` +
+			`Respond with JSON: {"questions": [{"error_sentence": "...", "correct_answer": "...", "explanation": "..."}]}`
+	default:
+		return nil, fmt.Errorf("unsupported question type: %s", questionType)
+	}
+	prompt := fmt.Sprintf(
+		"You write grammar exercises for English learners.\n"+
+			"Write %d different exercises testing the topic %q for a %s learner.\n%s\n"+
+			"Use natural, everyday sentences. Do not number the items or add any text outside the JSON.",
+		count, topic, level, format,
+	)
+
+	response, err := o.callOllamaJSON(prompt)
 	if err != nil {
 		return nil, err
 	}
-	return parseQuestions(response), nil
+	var result struct {
+		Questions []GeneratedQuestion `json:"questions"`
+	}
+	if err := json.Unmarshal([]byte(extractJSON(response)), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse generated questions: %w", err)
+	}
+	return result.Questions, nil
+}
+
+// CheckGrammar asks whether a sentence is grammatically correct standard English.
+func (o *OllamaClient) CheckGrammar(sentence string) (bool, string, error) {
+	prompt := fmt.Sprintf(
+		"Is the following sentence grammatically correct standard English? Sentence: %q\n"+
+			`Respond with JSON: {"grammatical": true or false, "reason": "short explanation"}`,
+		sentence,
+	)
+	response, err := o.callOllamaJSON(prompt)
+	if err != nil {
+		return false, "", err
+	}
+	var result struct {
+		Grammatical bool   `json:"grammatical"`
+		Reason      string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(extractJSON(response)), &result); err != nil {
+		return false, "", fmt.Errorf("failed to parse grammar check: %w", err)
+	}
+	return result.Grammatical, result.Reason, nil
+}
+
+// RubricCriterion is one line of a free-response marking rubric.
+type RubricCriterion struct {
+	Criterion string `json:"criterion"`
+	Points    int    `json:"points"`
+}
+
+// RubricScore is the mark awarded for one rubric criterion.
+type RubricScore struct {
+	Criterion string `json:"criterion"`
+	Points    int    `json:"points"`
+	Comment   string `json:"comment"`
+}
+
+// GradeWithRubric marks a free-text answer against each rubric criterion.
+// Scores are returned in rubric order and clamped to each criterion's maximum.
+func (o *OllamaClient) GradeWithRubric(task, answer string, rubric []RubricCriterion) ([]RubricScore, string, error) {
+	var criteria strings.Builder
+	for i, c := range rubric {
+		fmt.Fprintf(&criteria, "%d. %s (0-%d points)\n", i+1, c.Criterion, c.Points)
+	}
+	prompt := fmt.Sprintf(
+		"You are marking a short piece of writing by an English learner.\nTask: %s\nAnswer: %q\n"+
+			"Mark the answer against each criterion:\n%s"+
+			`Respond with JSON: {"scores": [{"criterion": "...", "points": 0, "comment": "..."}], "feedback": "one or two encouraging sentences"}`+
+			"\nList the scores in the same order as the criteria.",
+		task, answer, criteria.String(),
+	)
+	response, err := o.callOllamaJSON(prompt)
+	if err != nil {
+		return nil, "", err
+	}
+	var result struct {
+		Scores   []RubricScore `json:"scores"`
+		Feedback string        `json:"feedback"`
+	}
+	if err := json.Unmarshal([]byte(extractJSON(response)), &result); err != nil {
+		return nil, "", fmt.Errorf("failed to parse rubric grading: %w", err)
+	}
+	if len(result.Scores) != len(rubric) {
+		return nil, "", fmt.Errorf("rubric grading returned %d scores for %d criteria", len(result.Scores), len(rubric))
+	}
+	for i := range result.Scores {
+		result.Scores[i].Criterion = rubric[i].Criterion
+		if result.Scores[i].Points < 0 {
+			result.Scores[i].Points = 0
+		}
+		if result.Scores[i].Points > rubric[i].Points {
+			result.Scores[i].Points = rubric[i].Points
+		}
+	}
+	return result.Scores, result.Feedback, nil
+}
+
+// extractJSON trims code fences or chatter the model may wrap around a JSON object.
+func extractJSON(response string) string {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return response
+	}
+	return response[start : end+1]
 }
 
 func (o *OllamaClient) EvaluateAnswer(question, userAnswer, correctAnswer string) (bool, string, error) {
@@ -219,7 +351,7 @@ func (o *OllamaClient) EvaluateAnswer(question, userAnswer, correctAnswer string
 		question, userAnswer, correctAnswer,
 	)
 
-	response, err := o.callOllama(prompt)
+	response, err := o.callOllamaJSON(prompt)
 	if err != nil {
 		return false, "", err
 	}
@@ -231,26 +363,21 @@ func (o *OllamaClient) EvaluateAnswer(question, userAnswer, correctAnswer string
 		Feedback string `json:"feedback"`
 	}
 
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
+	if err := json.Unmarshal([]byte(extractJSON(response)), &result); err != nil {
 		return false, "", fmt.Errorf("failed to parse JSON response: %w", err)
 	}
 
 	return result.Correct, result.Feedback, nil
 }
 
-func parseQuestions(response string) []string {
-	var questions []string
-	lines := strings.Split(response, "\n")
-	for _, line := range lines {
-		if line != "" {
-			questions = append(questions, line)
-		}
+// CorrectSentence corrects a story sentence, pitching the feedback at the
+// writer's CEFR level when it is known.
+func (o *OllamaClient) CorrectSentence(sentence, level string) (string, string, error) {
+	prompt := "Please correct the following sentence if needed and provide feedback in the format 'Corrected: <corrected sentence> Feedback: <feedback message>'. "
+	if guidance, ok := levelGuidance[level]; ok {
+		prompt += fmt.Sprintf("The writer is an English learner at CEFR level %s: %s ", level, guidance)
 	}
-	return questions
-}
-
-func (o *OllamaClient) CorrectSentence(sentence string) (string, string, error) {
-	prompt := "Please correct the following sentence if needed and provide feedback in the format 'Corrected: <corrected sentence> Feedback: <feedback message>': " + sentence
+	prompt += "Sentence: " + sentence
 	response, err := o.callOllama(prompt)
 	if err != nil {
 		log.Println("Error calling Ollama:", err)
@@ -275,6 +402,16 @@ func (o *OllamaClient) CorrectSentence(sentence string) (string, string, error)
 	return correctedText, feedback, nil
 }
 
+// levelGuidance tells the LLM how to pitch feedback for each CEFR level.
+var levelGuidance = map[string]string{
+	"A1": "fix only errors that block understanding and explain them in very simple words.",
+	"A2": "fix basic grammar and spelling and explain each fix in one short, simple sentence.",
+	"B1": "fix grammar, spelling and word choice and briefly name the rule behind each fix.",
+	"B2": "fix all errors and suggest a more natural phrasing where one exists.",
+	"C1": "fix all errors and comment on style, register and idiomatic usage.",
+	"C2": "hold the sentence to native standard and point out subtle nuances of style.",
+}
+
 type AnalysisResponse struct {
 	Analysis         string   `json:"analysis"`
 	Tips             []string `json:"tips"`
@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileMailer writes each message to an .eml file and logs it, for local
+// testing without an SMTP server.
+type fileMailer struct {
+	from *mail.Address
+	dir  string
+}
+
+func (m *fileMailer) Send(msg Message) error {
+	data, err := compose(m.from, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(m.dir, fmt.Sprintf("%s-%d.eml", time.Now().Format("20060102-150405"), time.Now().UnixNano()%1e9))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s (%q) written to %s", msg.To, msg.Subject, path)
+	return nil
+}
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"inkwell-backend-V2.0/internal/config"
+)
+
+func TestFileMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m, err := New(config.MailConfig{Driver: DriverFile, Dir: dir, From: "Inkwell <hello@inkwell.test>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(Message{To: "ann@example.com", Subject: "Verify your email", Text: "Open the link", HTML: "<p>Open the link</p>"}); err != nil {
+		t.Fatal(err)
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(paths) != 1 {
+		t.Fatalf("%d files written", len(paths))
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("To"); got != "<ann@example.com>" {
+		t.Errorf("To: %s", got)
+	}
+	if got := msg.Header.Get("From"); !strings.Contains(got, "hello@inkwell.test") {
+		t.Errorf("From: %s", got)
+	}
+	if got := msg.Header.Get("Content-Type"); !strings.HasPrefix(got, "multipart/alternative;") {
+		t.Errorf("Content-Type: %s", got)
+	}
+
+	if err := m.Send(Message{To: "not an address"}); err == nil {
+		t.Error("invalid recipient accepted")
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	for _, cfg := range []config.MailConfig{
+		{Driver: "carrier-pigeon"},
+		{Driver: DriverSMTP},
+		{From: "not an address"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package mailer sends account emails such as address verification and
+// password reset links.
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"inkwell-backend-V2.0/internal/config"
+)
+
+const (
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+
+	defaultMailDir = "mail"
+)
+
+// Message is an email with a plain-text and an HTML version of the same content.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New creates the mailer selected by the DRIVER attribute; without one,
+// messages are written to files.
+func New(cfg config.MailConfig) (Mailer, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		if cfg.From != "" {
+			return nil, fmt.Errorf("invalid MAIL/FROM address: %w", err)
+		}
+		from = &mail.Address{Name: "Inkwell", Address: "no-reply@localhost"}
+	}
+	switch strings.ToLower(cfg.Driver) {
+	case DriverSMTP:
+		if cfg.SMTP.Host == "" {
+			return nil, errors.New("MAIL/SMTP/HOST is required for the smtp driver")
+		}
+		return &smtpMailer{from: from, cfg: cfg.SMTP}, nil
+	case DriverFile, "":
+		dir := cfg.Dir
+		if dir == "" {
+			dir = defaultMailDir
+		}
+		return &fileMailer{from: from, dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// compose builds a multipart/alternative MIME message.
+func compose(from *mail.Address, msg Message) ([]byte, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(from.Address)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&out, "%s: %s\r\n", h[0], h[1])
+	}
+	out.WriteString("\r\n")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
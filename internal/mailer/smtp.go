@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"inkwell-backend-V2.0/internal/config"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// smtpMailer delivers messages through an SMTP server.
+type smtpMailer struct {
+	from *mail.Address
+	cfg  config.SMTPConfig
+}
+
+func (m *smtpMailer) Send(msg Message) error {
+	data, err := compose(m.from, msg)
+	if err != nil {
+		return err
+	}
+	to, _ := mail.ParseAddress(msg.To)
+
+	port := m.cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && port != 465 {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template names an email; each has a <name>.txt file defining "subject"
+// and "body", and a <name>.html file defining "content" for the HTML layout.
+type Template string
+
+const (
+	TemplateVerifyEmail   Template = "verify_email"
+	TemplateResetPassword Template = "reset_password"
+	TemplateChangeEmail   Template = "change_email"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+// TemplateData is what the templates can refer to.
+type TemplateData struct {
+	Name      string // the user's first name or username
+	Link      string
+	ExpiresIn string // e.g. "48 hours"
+}
+
+// Render fills in an email template for the recipient.
+func Render(name Template, to string, data TemplateData) (Message, error) {
+	text, err := texttemplate.ParseFS(templateFS, "templates/"+string(name)+".txt")
+	if err != nil {
+		return Message{}, err
+	}
+	html, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+string(name)+".html")
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subject, body, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.ExecuteTemplate(&body, "body", data); err != nil {
+		return Message{}, err
+	}
+	if err := html.ExecuteTemplate(&htmlBody, "layout", struct {
+		TemplateData
+		Subject string
+	}{data, strings.TrimSpace(subject.String())}); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
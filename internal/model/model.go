@@ -3,58 +3,476 @@ package model
 import "time"
 
 type User struct {
-	ID                         uint      `json:"id" gorm:"primaryKey"`
-	Username                   string    `json:"username"`
-	Email                      string    `json:"email"`
-	Password                   string    `json:"password,omitempty"` // Exclude from JSON responses
-	FirstName                  string    `json:"first_name"`
-	LastName                   string    `json:"last_name"`
-	InitialAssessmentCompleted bool      `json:"initial_assessment_completed" gorm:"default:false"`
-	CreatedAt                  time.Time `json:"created_at"`
-	UpdatedAt                  time.Time `json:"updated_at"`
+	ID                         uint   `json:"id" gorm:"primaryKey"`
+	Username                   string `json:"username"`
+	Email                      string `json:"email"`
+	Password                   string `json:"-"` // password hash, never sent to clients
+	Role                       string `json:"role" gorm:"type:varchar(16);not null;default:learner"`
+	FirstName                  string `json:"first_name"`
+	LastName                   string `json:"last_name"`
+	InitialAssessmentCompleted bool   `json:"initial_assessment_completed" gorm:"default:false"` // set by the placement test
+	// Level is the CEFR level (A1–C2) from the latest placement test; empty until placed.
+	Level           string     `json:"level" gorm:"type:varchar(2)"`
+	LevelUpdatedAt  *time.Time `json:"level_updated_at,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// PendingEmail is a new address waiting to be confirmed from its inbox.
+	PendingEmail string `json:"pending_email,omitempty" gorm:"type:varchar(255)"`
+	// AvatarPath is relative to working/ and served under /static/.
+	AvatarPath  string          `json:"avatar_path,omitempty" gorm:"type:varchar(255)"`
+	Preferences UserPreferences `json:"preferences" gorm:"embedded;embeddedPrefix:pref_"`
+	// DeletionScheduledFor is when the account will be erased, unless the
+	// user cancels before then.
+	DeletionScheduledFor *time.Time `json:"deletion_scheduled_for,omitempty" gorm:"index"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// UserPreferences are the user's settings for the app.
+type UserPreferences struct {
+	TTSVoice    string `json:"tts_voice" gorm:"type:varchar(64)"` // empty for the TTS service's default voice
+	UILanguage  string `json:"ui_language" gorm:"type:varchar(16);not null;default:'en'"`
+	StoryLength string `json:"story_length" gorm:"type:varchar(8);not null;default:'medium'"`
+}
+
+// Story lengths a user can prefer.
+const (
+	StoryLengthShort  = "short"
+	StoryLengthMedium = "medium"
+	StoryLengthLong   = "long"
+)
+
+// Roles a user can have.
+const (
+	RoleLearner = "learner"
+	RoleTeacher = "teacher"
+	RoleAdmin   = "admin"
+)
+
+// Permissions required by protected routes.
+const (
+	PermManageQuestions = "questions:manage"
+	PermViewUsers       = "users:read"
+	PermManageUsers     = "users:manage"
+)
+
+// rolePermissions lists what each role may do beyond using the app as a learner.
+var rolePermissions = map[string][]string{
+	RoleLearner: {},
+	RoleTeacher: {PermManageQuestions},
+	RoleAdmin:   {PermManageQuestions, PermViewUsers, PermManageUsers},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// PermissionsFor returns the permissions granted by a role; unknown roles get none.
+func PermissionsFor(role string) []string {
+	return append([]string{}, rolePermissions[role]...)
+}
+
+// Outcomes of a LoginAttempt besides success.
+const (
+	LoginFailedCredentials = "invalid_credentials"
+	LoginFailedUnverified  = "email_not_verified"
+	LoginFailedThrottled   = "throttled"
+	LoginFailedMFA         = "invalid_mfa_code"
+	LoginMFAPending        = "mfa_required"  // password accepted, second step outstanding
+	LoginFailedOIDC        = "oidc_rejected" // provider login refused by domain, signup or email rules
+)
+
+// TOTPFactor is a user's authenticator app. It is unconfirmed until the
+// user has entered a first code from it.
+type TOTPFactor struct {
+	UserID      uint   `gorm:"primaryKey"`
+	Secret      string `gorm:"type:text;not null"` // encrypted when MFA/ENCRYPTION_KEY is set
+	ConfirmedAt *time.Time
+	// LastUsedStep is the time step of the last accepted code, so a code cannot be used twice.
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// RecoveryCode is a single-use code for logging in without the
+// authenticator app. Only its SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID       uint   `gorm:"primaryKey"`
+	UserID   uint   `gorm:"not null;index"`
+	CodeHash string `gorm:"type:char(64);not null"`
+	UsedAt   *time.Time
+}
+
+// LoginAttempt records a login for auditing and for throttling repeated
+// failures. Email is stored lowercased, whether or not an account has it.
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Email     string    `json:"email" gorm:"type:varchar(255);not null;index:idx_login_attempt_email,priority:1"`
+	UserID    *uint     `json:"user_id,omitempty" gorm:"index"`
+	IP        string    `json:"ip" gorm:"type:varchar(45);not null;index:idx_login_attempt_ip,priority:1"`
+	UserAgent string    `json:"user_agent" gorm:"type:text"`
+	Success   bool      `json:"success" gorm:"not null"`
+	Reason    string    `json:"reason,omitempty" gorm:"type:varchar(32)"` // why a failed attempt failed
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_login_attempt_email,priority:2;index:idx_login_attempt_ip,priority:2"`
+}
+
+// Purposes of an AccountToken.
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+	TokenPurposeChangeEmail   = "change_email"
+)
+
+// AccountToken is a single-use token sent by email to verify or change an
+// address, or to reset a password. Only the SHA-256 of the token is stored.
+type AccountToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"not null;index"`
+	Purpose   string     `gorm:"type:varchar(20);not null"`
+	TokenHash string     `gorm:"type:char(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // set once used, or when a newer token replaced it
+	CreatedAt time.Time
+}
+
+// UserIdentity links a user to an account at an OpenID Connect provider.
+type UserIdentity struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"-" gorm:"not null;index"`
+	Provider    string    `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_identity_subject"`
+	Subject     string    `json:"-" gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// OIDCLoginState is an OpenID Connect login in progress, kept from the
+// redirect to the provider until the user comes back. It is used once.
+type OIDCLoginState struct {
+	State        string    `gorm:"primaryKey;type:varchar(64)"`
+	Provider     string    `gorm:"type:varchar(50);not null"`
+	Nonce        string    `gorm:"type:varchar(64);not null"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+	// BindingHash is the SHA-256 of the secret the browser that started the
+	// login must present to complete it.
+	BindingHash string `gorm:"type:char(64);not null;default:''"`
+}
+
+// DataExport is a ZIP archive of everything stored about a user. It is
+// built in the background and deleted when it expires.
+type DataExport struct {
+	ID          string     `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID      uint       `json:"-" gorm:"not null;index"`
+	Status      string     `json:"status" gorm:"type:varchar(16);not null"` // pending, ready or failed
+	FilePath    string     `json:"-" gorm:"type:varchar(255)"`
+	Size        int64      `json:"size,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Statuses of a DataExport.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// PrivacyEvent is the audit trail of data exports and erasures. It outlives
+// the user it describes, so it holds no personal data beyond the user ID.
+type PrivacyEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	ActorID   *uint     `json:"actor_id,omitempty"` // the admin who acted; nil for the user or the system
+	Action    string    `json:"action" gorm:"type:varchar(32);not null"`
+	Detail    string    `json:"detail,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Actions recorded as PrivacyEvents.
+const (
+	PrivacyExportRequested  = "export_requested"
+	PrivacyExportReady      = "export_ready"
+	PrivacyExportFailed     = "export_failed"
+	PrivacyExportDownloaded = "export_downloaded"
+	PrivacyErasureRequested = "erasure_requested"
+	PrivacyErasureCancelled = "erasure_cancelled"
+	PrivacyErasureCompleted = "erasure_completed"
+)
+
+// Session is one refresh token, keyed by its jti. Refreshing replaces it
+// with a new one in the same family, which stands for one login on one
+// device; presenting a replaced token again revokes the whole family.
+type Session struct {
+	ID            string     `gorm:"primaryKey;type:varchar(36)"`
+	FamilyID      string     `gorm:"type:varchar(36);not null;index"`
+	UserID        uint       `gorm:"not null;index"`
+	UserAgent     string     `gorm:"type:text"`
+	IP            string     `gorm:"type:varchar(45)"`
+	StartedAt     time.Time  // when the family was created by a login
+	CreatedAt     time.Time  // when this token was issued
+	ExpiresAt     time.Time  `gorm:"not null;index"`
+	RevokedAt     *time.Time `gorm:"index"`
+	RevokedReason string     `gorm:"type:varchar(32)"` // rotated, logout, logout_all, single_session or reuse_detected
+	ReplacedBy    string     `gorm:"type:varchar(36)"`
 }
 
 type Assessment struct {
-	ID                   uint       `json:"id" gorm:"primaryKey"`
-	UserID               uint       `json:"user_id" gorm:"not null"`
-	SessionID            string     `json:"session_id" gorm:"not null;unique"`
-	Title                string     `json:"title" gorm:"not null"`
-	Description          string     `json:"description"`
-	Score                int        `json:"score" gorm:"not null"`
-	Category             string     `json:"category" gorm:"not null"`
-	Status               string     `json:"status" gorm:"default:'pending'"` // pending, completed
-	CurrentQuestionIndex int        `json:"current_question_index" gorm:"default:0"`
-	Answers              []Answer   `json:"answers" gorm:"foreignKey:AssessmentID"`
-	Questions            []Question `json:"questions" gorm:"many2many:assessment_questions"`
-	CreatedAt            time.Time  `json:"created_at"`
-	UpdatedAt            time.Time  `json:"updated_at"`
+	ID                   uint   `json:"id" gorm:"primaryKey"`
+	UserID               uint   `json:"user_id" gorm:"not null"`
+	SessionID            string `json:"session_id" gorm:"not null;unique"`
+	Title                string `json:"title" gorm:"not null"`
+	Description          string `json:"description"`
+	Score                int    `json:"score" gorm:"not null"`
+	Category             string `json:"category" gorm:"not null"`
+	Kind                 string `json:"kind" gorm:"type:varchar(16);not null;default:'practice'"` // practice or placement
+	Status               string `json:"status" gorm:"default:'pending'"`                          // ongoing, completed, abandoned or expired
+	CurrentQuestionIndex int    `json:"current_question_index" gorm:"default:0"`
+	// CurrentQuestionID is the only question that may be answered next.
+	CurrentQuestionID uint       `json:"current_question_id" gorm:"not null;default:0"`
+	QuestionServedAt  time.Time  `json:"question_served_at"`
+	QuestionDueAt     *time.Time `json:"question_due_at,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	EndedAt           *time.Time `json:"ended_at,omitempty"`
+	Answers           []Answer   `json:"answers" gorm:"foreignKey:AssessmentID"`
+	Questions         []Question `json:"questions" gorm:"many2many:assessment_questions"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
 }
 
 type Question struct {
 	ID             uint   `json:"id" gorm:"primaryKey"`
 	Category       string `json:"category" gorm:"not null"`
-	QuestionType   string `json:"question_type" gorm:"type:varchar(20);not null"` // "masked" or "error_correction"
+	QuestionType   string `json:"question_type" gorm:"type:varchar(20);not null"` // masked, error_correction, multiple_choice, reorder, sentence_combining or free_response
 	MaskedSentence string `json:"masked_sentence" gorm:"type:text"`
 	ErrorSentence  string `json:"error_sentence" gorm:"type:text"`
 	CorrectAnswer  string `json:"correct_answer" gorm:"type:text;not null"`
+	// Alternatives is a "|"-separated list of other accepted answers.
+	Alternatives string `json:"-" gorm:"type:text"`
+	// Payload holds the type-specific JSON (options, words, rubric, ...).
+	Payload string `json:"-" gorm:"type:text"`
+	// Difficulty is the Rasch item difficulty in logits; 0 is average.
+	Difficulty float64 `json:"difficulty" gorm:"default:0"`
+	Attempts   int     `json:"-" gorm:"default:0"`
+	// Tags is a comma-separated list of lower-case labels.
+	Tags string `json:"-" gorm:"type:text"`
+	// Inactive (retired) questions are kept for answer history but never served.
+	Active bool `json:"-" gorm:"not null;default:true;index"`
+	// Status is "approved" for questions in the bank, or "draft"/"rejected"
+	// for generated questions awaiting or failing review.
+	Status     string    `json:"-" gorm:"type:varchar(16);not null;default:'approved';index"`
+	Source     string    `json:"-" gorm:"type:varchar(16);not null;default:'manual'"` // manual, import or llm
+	ReviewNote string    `json:"-" gorm:"type:text"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+// RenderHint tells clients which input widget to show for a question and what to put in it.
+type RenderHint struct {
+	Widget    string   `json:"widget"` // fill_blank, rewrite, choice, reorder, combine or essay
+	Prompt    string   `json:"prompt,omitempty"`
+	Text      string   `json:"text,omitempty"`
+	Options   []string `json:"options,omitempty"`
+	Tokens    []string `json:"tokens,omitempty"`
+	Sentences []string `json:"sentences,omitempty"`
+	Hint      string   `json:"hint,omitempty"`
+	MinWords  int      `json:"min_words,omitempty"`
+	MaxWords  int      `json:"max_words,omitempty"`
+}
+
+// Topic is an assessment topic; questions belong to it through Question.Category.
+type Topic struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"not null;uniqueIndex"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SkillEstimate is a user's estimated ability in one topic, in logits on the
+// same scale as Question.Difficulty.
+type SkillEstimate struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	UserID    uint      `json:"-" gorm:"not null;uniqueIndex:idx_skill_user_topic"`
+	Topic     string    `json:"topic" gorm:"not null;uniqueIndex:idx_skill_user_topic"`
+	Ability   float64   `json:"ability"`
+	StdError  float64   `json:"std_error"`
+	Answers   int       `json:"answers"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Answer struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
-	AssessmentID uint      `json:"assessment_id"`
+	AssessmentID uint      `json:"assessment_id" gorm:"uniqueIndex:idx_answer_attempt"`
 	SessionID    string    `json:"session_id"`
-	QuestionID   uint      `json:"question_id"`
+	QuestionID   uint      `json:"question_id" gorm:"uniqueIndex:idx_answer_attempt"`
+	Attempt      int       `json:"attempt" gorm:"not null;default:1;uniqueIndex:idx_answer_attempt"`
 	UserID       uint      `json:"user_id"`
 	Answer       string    `json:"answer"`
 	IsCorrect    bool      `json:"is_correct"`
+	Score        float64   `json:"score"` // 0–1; partial credit for rubric-graded answers
 	Feedback     string    `json:"feedback"`
+	GradedBy     string    `json:"graded_by" gorm:"type:varchar(16)"` // the grading stage that decided
+	GradeReason  string    `json:"grade_reason" gorm:"type:text"`
+	ServedAt     time.Time `json:"served_at"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 type AnswerResponse struct {
-	IsCorrect bool   `json:"is_correct"`
-	Feedback  string `json:"feedback"`
+	IsCorrect    bool             `json:"is_correct"`
+	Score        float64          `json:"score"`
+	Feedback     string           `json:"feedback"`
+	GradedBy     string           `json:"graded_by"`
+	Attempt      int              `json:"attempt"`
+	AttemptsLeft int              `json:"attempts_left"` // retries left on this question after a wrong answer
+	Completed    bool             `json:"completed"`
+	Level        string           `json:"level,omitempty"` // set when a placement test completes
+	NextQuestion *LearnerQuestion `json:"next_question,omitempty"`
+	Ability      float64          `json:"ability"`
+	StdError     float64          `json:"std_error"`
+}
+
+// LevelHistory records each level a user has been placed at.
+type LevelHistory struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        uint      `json:"user_id" gorm:"not null;index"`
+	Level         string    `json:"level" gorm:"type:varchar(2);not null"`
+	PreviousLevel string    `json:"previous_level" gorm:"type:varchar(2)"`
+	Ability       float64   `json:"ability"`
+	AssessmentID  uint      `json:"assessment_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ReviewCard is a spaced-repetition card for an item the user got wrong:
+// either a question missed in an assessment or a correction that keeps
+// coming back in their story sentences. It is scheduled with SM-2.
+type ReviewCard struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	UserID     uint   `json:"-" gorm:"not null;uniqueIndex:idx_review_card_source;index:idx_review_card_due"`
+	SourceType string `json:"source_type" gorm:"type:varchar(16);not null;uniqueIndex:idx_review_card_source"` // question or sentence
+	// SourceKey identifies the item within its type: the question ID, or the
+	// correction as "wrong words→right words".
+	SourceKey  string    `json:"-" gorm:"type:varchar(255);not null;uniqueIndex:idx_review_card_source"`
+	QuestionID *uint     `json:"question_id,omitempty" gorm:"index"`
+	Question   *Question `json:"-" gorm:"foreignKey:QuestionID"`
+	Prompt     string    `json:"prompt" gorm:"type:text"`
+	Answer     string    `json:"-" gorm:"type:text"`
+	Detail     string    `json:"-" gorm:"type:text"` // what was wrong, shown after grading
+	// Occurrences counts how often the mistake has been made. Sentence cards
+	// are only scheduled once the correction recurs.
+	Occurrences int     `json:"occurrences" gorm:"not null;default:1"`
+	EaseFactor  float64 `json:"ease_factor" gorm:"not null;default:2.5"`
+	Interval    int     `json:"interval_days" gorm:"not null;default:0"`
+	Repetitions int     `json:"repetitions" gorm:"not null;default:0"`
+	Lapses      int     `json:"lapses" gorm:"not null;default:0"`
+	// DueAt is nil while the card is not scheduled.
+	DueAt          *time.Time `json:"due_at" gorm:"index:idx_review_card_due"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"-"`
+}
+
+// LearnerQuestion is a question as shown to a learner, without its correct
+// answer, alternatives or difficulty.
+type LearnerQuestion struct {
+	ID             uint        `json:"id"`
+	Category       string      `json:"category"`
+	QuestionType   string      `json:"question_type"`
+	MaskedSentence string      `json:"masked_sentence,omitempty"`
+	ErrorSentence  string      `json:"error_sentence,omitempty"`
+	Render         *RenderHint `json:"render,omitempty"`
+}
+
+// LearnerAnswer is one of the learner's answers. Feedback is left out as it
+// can name the correct answer; it is part of the review.
+type LearnerAnswer struct {
+	QuestionID uint      `json:"question_id"`
+	Attempt    int       `json:"attempt"`
+	Answer     string    `json:"answer"`
+	IsCorrect  bool      `json:"is_correct"`
+	Score      float64   `json:"score"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AssessmentView is the learner's view of a session.
+type AssessmentView struct {
+	SessionID            string            `json:"session_id"`
+	Title                string            `json:"title"`
+	Description          string            `json:"description"`
+	Category             string            `json:"category"`
+	Kind                 string            `json:"kind"`
+	Status               string            `json:"status"`
+	Score                int               `json:"score"`
+	CurrentQuestionIndex int               `json:"current_question_index"`
+	CurrentQuestion      *LearnerQuestion  `json:"current_question,omitempty"`
+	QuestionDueAt        *time.Time        `json:"question_due_at,omitempty"`
+	ExpiresAt            *time.Time        `json:"expires_at,omitempty"`
+	EndedAt              *time.Time        `json:"ended_at,omitempty"`
+	ReviewAvailable      bool              `json:"review_available"`
+	Questions            []LearnerQuestion `json:"questions"` // in the order served
+	Answers              []LearnerAnswer   `json:"answers"`
+	CreatedAt            time.Time         `json:"created_at"`
+}
+
+// AssessmentReview reveals the correct answers of a completed session.
+type AssessmentReview struct {
+	SessionID string       `json:"session_id"`
+	Title     string       `json:"title"`
+	Category  string       `json:"category"`
+	Score     int          `json:"score"`
+	Total     int          `json:"total"`
+	EndedAt   *time.Time   `json:"ended_at,omitempty"`
+	Items     []ReviewItem `json:"items"`
+}
+
+// ReviewItem is one question of a reviewed session with every attempt at
+// it; the first attempt is the one that was scored.
+type ReviewItem struct {
+	Question      LearnerQuestion `json:"question"`
+	CorrectAnswer string          `json:"correct_answer"`
+	Alternatives  []string        `json:"alternatives,omitempty"`
+	Attempts      []ReviewAttempt `json:"attempts"`
+}
+
+// ReviewAttempt is an answer with its grading.
+type ReviewAttempt struct {
+	Attempt   int       `json:"attempt"`
+	Answer    string    `json:"answer"`
+	IsCorrect bool      `json:"is_correct"`
+	Score     float64   `json:"score"`
+	Feedback  string    `json:"feedback"`
+	GradedBy  string    `json:"graded_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DueReviewCard is a review card as served to the learner, without its answer.
+type DueReviewCard struct {
+	ID          uint             `json:"id"`
+	SourceType  string           `json:"source_type"`
+	Prompt      string           `json:"prompt,omitempty"`
+	Question    *LearnerQuestion `json:"question,omitempty"`
+	DueAt       time.Time        `json:"due_at"`
+	Interval    int              `json:"interval_days"`
+	Repetitions int              `json:"repetitions"`
+	Lapses      int              `json:"lapses"`
+}
+
+// ReviewGradeResponse is the outcome of reviewing a card: the answer it
+// was looking for and when it comes back.
+type ReviewGradeResponse struct {
+	CardID        uint      `json:"card_id"`
+	Quality       int       `json:"quality"` // 0–5 on the SM-2 scale
+	IsCorrect     *bool     `json:"is_correct,omitempty"`
+	Feedback      string    `json:"feedback,omitempty"`
+	CorrectAnswer string    `json:"correct_answer"`
+	Detail        string    `json:"detail,omitempty"`
+	Interval      int       `json:"interval_days"`
+	EaseFactor    float64   `json:"ease_factor"`
+	DueAt         time.Time `json:"due_at"`
 }
 
 type Story struct {
@@ -82,10 +500,13 @@ type Sentence struct {
 type Comic struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
 	UserID      uint      `json:"user_id"`
-	StoryID     uint      `json:"story_id" gorm:"not null;index"`
+	StoryID     uint      `json:"story_id" gorm:"not null;index;uniqueIndex:idx_comic_story_version"`
+	Version     int       `json:"version" gorm:"not null;default:1;uniqueIndex:idx_comic_story_version"`
+	ContentHash string    `json:"content_hash" gorm:"type:varchar(64)"` // SHA-256 of the sentences and images rendered
 	Title       string    `json:"title"`
 	Thumbnail   string    `json:"thumbnail"`
 	ViewURL     string    `json:"view_url"`
 	DownloadURL string    `json:"download_url"`
+	Formats     string    `json:"formats"` // comma-separated, e.g. "pdf,cbz,epub,html"
 	DoneOn      time.Time `json:"done_on"`
 }
@@ -0,0 +1,212 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// acceptedAlgorithms are the ID token signatures accepted; "none" and the
+// HMAC algorithms never are.
+var acceptedAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}
+
+var errUnknownKey = errors.New("ID token signed with an unknown key")
+
+// Claims are the parts of an ID token used to find or create the user.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     *bool // nil when the provider does not say
+	GivenName         string
+	FamilyName        string
+	Name              string
+	PreferredUsername string
+}
+
+type idTokenClaims struct {
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"` // bool, or "true"/"false" from some providers
+	GivenName         string      `json:"given_name"`
+	FamilyName        string      `json:"family_name"`
+	Name              string      `json:"name"`
+	PreferredUsername string      `json:"preferred_username"`
+	Nonce             string      `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// verifyIDToken checks the ID token's signature against the provider's
+// keys, its issuer, audience, expiry and nonce.
+func (p *Provider) verifyIDToken(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(idToken, &idTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods(acceptedAlgorithms),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	c, ok := token.Claims.(*idTokenClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid ID token claims")
+	}
+	if c.Nonce == "" || c.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+	if c.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+
+	claims := &Claims{
+		Subject:           c.Subject,
+		Email:             c.Email,
+		GivenName:         c.GivenName,
+		FamilyName:        c.FamilyName,
+		Name:              c.Name,
+		PreferredUsername: c.PreferredUsername,
+	}
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		claims.EmailVerified = &v
+	case string:
+		verified := strings.EqualFold(v, "true")
+		claims.EmailVerified = &verified
+	}
+	return claims, nil
+}
+
+// publicKey returns the provider's key with the given kid, fetching the
+// key set again when the kid is unknown, since providers rotate keys.
+func (p *Provider) publicKey(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.keysFetched) >= keysRefetchGap
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, errUnknownKey
+	}
+	if err := p.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// A provider with a single key may leave kid out.
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return nil, errUnknownKey
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) error {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, doc.JWKSURI, nil)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("JWKS returned %d", status)
+	}
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.mu.Lock()
+	p.keys, p.keysFetched = keys, time.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,246 @@
+// Package oidc is an OpenID Connect relying party: it sends users to their
+// identity provider with the authorization code flow and PKCE, and checks
+// the ID token the provider returns.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"inkwell-backend-V2.0/internal/config"
+)
+
+const (
+	defaultScopes  = "openid email profile"
+	httpTimeout    = 10 * time.Second
+	discoveryTTL   = 24 * time.Hour
+	keysRefetchGap = time.Minute
+)
+
+// ProviderInfo is what clients need to offer a provider on the login page.
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// Provider is one configured identity provider.
+type Provider struct {
+	cfg         config.OIDCProviderConfig
+	redirectURI string
+	client      *http.Client
+
+	mu           sync.Mutex
+	discovery    *discoveryDocument
+	discoveredAt time.Time
+	keys         map[string]interface{}
+	keysFetched  time.Time
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	providers map[string]*Provider
+	order     []string
+}
+
+// NewRegistry checks the provider configuration. Discovery documents are
+// fetched on first use, so an unreachable provider does not stop startup.
+func NewRegistry(cfg config.OIDCConfig) (*Registry, error) {
+	r := &Registry{providers: map[string]*Provider{}}
+	for _, pc := range cfg.Providers {
+		name := strings.ToLower(strings.TrimSpace(pc.Name))
+		switch {
+		case name == "":
+			return nil, errors.New("OIDC provider without NAME")
+		case r.providers[name] != nil:
+			return nil, fmt.Errorf("duplicate OIDC provider %q", name)
+		case pc.Issuer == "" || pc.ClientID == "":
+			return nil, fmt.Errorf("OIDC provider %q needs ISSUER and CLIENT_ID", name)
+		case cfg.RedirectURI == "":
+			return nil, errors.New("OIDC/REDIRECT_URI is required when providers are configured")
+		}
+		pc.Name = name
+		if pc.DisplayName == "" {
+			pc.DisplayName = pc.Name
+		}
+		if pc.Scopes == "" {
+			pc.Scopes = defaultScopes
+		}
+		r.providers[name] = &Provider{cfg: pc, redirectURI: cfg.RedirectURI, client: &http.Client{Timeout: httpTimeout}}
+		r.order = append(r.order, name)
+	}
+	return r, nil
+}
+
+// Provider returns the provider with the given name.
+func (r *Registry) Provider(name string) (*Provider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	p, ok := r.providers[strings.ToLower(name)]
+	return p, ok
+}
+
+// List returns the providers in configuration order.
+func (r *Registry) List() []ProviderInfo {
+	list := []ProviderInfo{}
+	if r == nil {
+		return list
+	}
+	for _, name := range r.order {
+		p := r.providers[name]
+		list = append(list, ProviderInfo{Name: p.cfg.Name, DisplayName: p.cfg.DisplayName})
+	}
+	return list
+}
+
+func (p *Provider) Name() string             { return p.cfg.Name }
+func (p *Provider) AllowSignup() bool        { return p.cfg.AllowSignup }
+func (p *Provider) TrustEmail() bool         { return p.cfg.TrustEmail }
+func (p *Provider) AllowedDomains() []string { return p.cfg.AllowedDomains }
+
+// AuthRequest holds the random values that tie a provider's response to
+// the login that asked for it.
+type AuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// NewAuthRequest creates fresh random values for a login.
+func NewAuthRequest() (AuthRequest, error) {
+	var values [3]string
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return AuthRequest{}, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return AuthRequest{State: values[0], Nonce: values[1], CodeVerifier: values[2]}, nil
+}
+
+// AuthorizationURL is where the user is sent to log in at the provider.
+func (p *Provider) AuthorizationURL(ctx context.Context, req AuthRequest) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.redirectURI)
+	q.Set("scope", p.cfg.Scopes)
+	q.Set("state", req.State)
+	q.Set("nonce", req.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the
+// verified claims of the ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURI)
+	form.Set("client_id", p.cfg.ClientID)
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", status, tokens.Error, tokens.ErrorDescription)
+	}
+	return p.verifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// discover fetches the provider's discovery document, cached for a day.
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil && time.Since(p.discoveredAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+	endpoint := strings.TrimRight(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	var doc discoveryDocument
+	status, err := p.doJSON(req, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery document returned %d", status)
+	}
+	if doc.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", doc.Issuer, p.cfg.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	p.discovery, p.discoveredAt = &doc, time.Now()
+	return p.discovery, nil
+}
+
+// doJSON sends a request and decodes a JSON response of any status.
+func (p *Provider) doJSON(req *http.Request, out interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, out); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("invalid JSON from %s: %w", req.URL.Host, err)
+	}
+	return resp.StatusCode, nil
+}
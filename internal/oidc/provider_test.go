@@ -0,0 +1,301 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"inkwell-backend-V2.0/internal/config"
+)
+
+const testClientID = "inkwell-web"
+
+// mockProvider is an identity provider serving discovery, a key set and a
+// token endpoint that answers with the ID token the test chooses.
+type mockProvider struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+	kid string
+
+	mu       sync.Mutex
+	idToken  string
+	verifier string // code_verifier of the last token request
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{key: key, kid: "key-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 m.srv.URL,
+			"authorization_endpoint": m.srv.URL + "/authorize",
+			"token_endpoint":         m.srv.URL + "/token",
+			"jwks_uri":               m.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": m.kid, "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("client_id") != testClientID {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_request"})
+			return
+		}
+		m.verifier = r.PostFormValue("code_verifier")
+		writeJSON(w, map[string]string{"id_token": m.idToken})
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// claims returns valid ID token claims for the nonce.
+func (m *mockProvider) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            m.srv.URL,
+		"aud":            testClientID,
+		"sub":            "user-42",
+		"email":          "ann@example.com",
+		"email_verified": true,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+// sign signs claims with the provider's current key.
+func (m *mockProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	m.mu.Lock()
+	token.Header["kid"] = m.kid
+	key := m.key
+	m.mu.Unlock()
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (m *mockProvider) answer(idToken string) {
+	m.mu.Lock()
+	m.idToken = idToken
+	m.mu.Unlock()
+}
+
+func (m *mockProvider) provider(t *testing.T) *Provider {
+	t.Helper()
+	r, err := NewRegistry(config.OIDCConfig{
+		RedirectURI: "https://app.example.com/oidc/callback",
+		Providers:   []config.OIDCProviderConfig{{Name: "Mock", Issuer: m.srv.URL, ClientID: testClientID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := r.Provider("mock")
+	if !ok {
+		t.Fatal("provider not registered")
+	}
+	return p
+}
+
+func TestAuthorizationURLUsesPKCE(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+	req, err := NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := p.AuthorizationURL(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasPrefix(raw, m.srv.URL+"/authorize?") {
+		t.Fatalf("authorization URL %s: %v", raw, err)
+	}
+	q := u.Query()
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+	if q.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("PKCE challenge %q (%s)", q.Get("code_challenge"), q.Get("code_challenge_method"))
+	}
+	if q.Get("state") != req.State || q.Get("nonce") != req.Nonce || q.Get("client_id") != testClientID {
+		t.Errorf("query %v", q)
+	}
+
+	m.answer(m.sign(t, m.claims(req.Nonce)))
+	if _, err := p.Exchange(context.Background(), "code", req.CodeVerifier, req.Nonce); err != nil {
+		t.Fatal(err)
+	}
+	if m.verifier != req.CodeVerifier {
+		t.Errorf("token request sent verifier %q, want %q", m.verifier, req.CodeVerifier)
+	}
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	m := newMockProvider(t)
+	const nonce = "nonce-1"
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, _ := x509.MarshalPKIXPublicKey(&m.key.PublicKey)
+	with := func(key string, value interface{}) jwt.MapClaims {
+		c := m.claims(nonce)
+		if value == nil {
+			delete(c, key)
+		} else {
+			c[key] = value
+		}
+		return c
+	}
+	signWith := func(method jwt.SigningMethod, key interface{}, kid string) string {
+		token := jwt.NewWithClaims(method, m.claims(nonce))
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		idToken string
+	}{
+		{"wrong nonce", m.sign(t, with("nonce", "nonce-2"))},
+		{"no nonce", m.sign(t, with("nonce", nil))},
+		{"wrong issuer", m.sign(t, with("iss", "https://evil.example.com"))},
+		{"wrong audience", m.sign(t, with("aud", "another-client"))},
+		{"expired", m.sign(t, with("exp", time.Now().Add(-time.Hour).Unix()))},
+		{"no expiry", m.sign(t, with("exp", nil))},
+		{"issued in the future", m.sign(t, with("iat", time.Now().Add(time.Hour).Unix()))},
+		{"no subject", m.sign(t, with("sub", nil))},
+		{"HS256 with the public key", signWith(jwt.SigningMethodHS256, publicDER, m.kid)},
+		{"unsigned", signWith(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, m.kid)},
+		{"unknown key", signWith(jwt.SigningMethodRS256, other, m.kid)},
+		{"unknown kid", signWith(jwt.SigningMethodRS256, other, "key-2")},
+		{"not a JWT", "not-a-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := m.provider(t)
+			m.answer(tt.idToken)
+			if claims, err := p.Exchange(context.Background(), "code", "verifier", nonce); err == nil {
+				t.Errorf("accepted: %+v", claims)
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		p := m.provider(t)
+		m.answer(m.sign(t, with("email_verified", "false")))
+		claims, err := p.Exchange(context.Background(), "code", "verifier", nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "user-42" || claims.Email != "ann@example.com" || claims.EmailVerified == nil || *claims.EmailVerified {
+			t.Errorf("claims %+v", claims)
+		}
+	})
+}
+
+// After the provider rotates its key, tokens with the new kid are accepted
+// once the key set is fetched again.
+func TestExchangeFollowsKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+	m.answer(m.sign(t, m.claims("n")))
+	if _, err := p.Exchange(context.Background(), "code", "verifier", "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.key, m.kid = key, "key-2"
+	m.mu.Unlock()
+	m.answer(m.sign(t, m.claims("n")))
+	p.keysFetched = time.Time{}
+	if _, err := p.Exchange(context.Background(), "code", "verifier", "n"); err != nil {
+		t.Errorf("token of the rotated key: %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMustMatch(t *testing.T) {
+	m := newMockProvider(t)
+	r, err := NewRegistry(config.OIDCConfig{
+		RedirectURI: "https://app.example.com/oidc/callback",
+		Providers:   []config.OIDCProviderConfig{{Name: "mock", Issuer: m.srv.URL + "/", ClientID: testClientID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := r.Provider("mock")
+	if _, err := p.AuthorizationURL(context.Background(), AuthRequest{}); err == nil {
+		t.Error("discovery document of another issuer accepted")
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	base := config.OIDCProviderConfig{Issuer: "https://id.example.com", ClientID: "c"}
+	named := func(name string) config.OIDCProviderConfig {
+		pc := base
+		pc.Name = name
+		return pc
+	}
+	r, err := NewRegistry(config.OIDCConfig{RedirectURI: "https://app/cb", Providers: []config.OIDCProviderConfig{named("Zeta"), named("alpha")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := r.List(); len(list) != 2 || list[0].Name != "zeta" || list[1].DisplayName != "alpha" {
+		t.Errorf("list %+v", list)
+	}
+
+	for name, cfg := range map[string]config.OIDCConfig{
+		"no name":     {RedirectURI: "https://app/cb", Providers: []config.OIDCProviderConfig{base}},
+		"duplicate":   {RedirectURI: "https://app/cb", Providers: []config.OIDCProviderConfig{named("a"), named("A")}},
+		"no redirect": {Providers: []config.OIDCProviderConfig{named("a")}},
+		"no client":   {RedirectURI: "https://app/cb", Providers: []config.OIDCProviderConfig{{Name: "a", Issuer: "https://id"}}},
+	} {
+		if _, err := NewRegistry(cfg); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/db"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+type AccountTokenRepository interface {
+	CreateToken(token *model.AccountToken) error
+	GetTokenByHash(hash string) (*model.AccountToken, error)
+	UseToken(id uint, at time.Time) (bool, error)
+	InvalidateTokens(userID uint, purpose string) error
+	DeleteExpiredTokens(before time.Time) (int64, error)
+}
+
+type accountTokenRepository struct{}
+
+func NewAccountTokenRepository() AccountTokenRepository {
+	return &accountTokenRepository{}
+}
+
+// CreateToken stores a token and invalidates the user's earlier unused
+// tokens for the same purpose, so only the latest email link works.
+func (r *accountTokenRepository) CreateToken(token *model.AccountToken) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.AccountToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, token.Purpose).
+			Update("used_at", token.CreatedAt).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+func (r *accountTokenRepository) GetTokenByHash(hash string) (*model.AccountToken, error) {
+	var token model.AccountToken
+	if err := db.GetDB().Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UseToken marks a token as used. It reports false if it already was, so
+// that two requests with the same token cannot both succeed.
+func (r *accountTokenRepository) UseToken(id uint, at time.Time) (bool, error) {
+	res := db.GetDB().Model(&model.AccountToken{}).Where("id = ? AND used_at IS NULL", id).Update("used_at", at)
+	return res.RowsAffected == 1, res.Error
+}
+
+// InvalidateTokens marks all of the user's unused tokens for a purpose as used.
+func (r *accountTokenRepository) InvalidateTokens(userID uint, purpose string) error {
+	return db.GetDB().Model(&model.AccountToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+func (r *accountTokenRepository) DeleteExpiredTokens(before time.Time) (int64, error) {
+	res := db.GetDB().Where("expires_at < ?", before).Delete(&model.AccountToken{})
+	return res.RowsAffected, res.Error
+}
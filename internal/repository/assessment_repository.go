@@ -2,7 +2,10 @@ package repository
 
 import (
 	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
 	"inkwell-backend-V2.0/internal/db"
 	"inkwell-backend-V2.0/internal/model"
 )
@@ -12,15 +15,43 @@ type AssessmentRepository interface {
 	GetAssessments() ([]model.Assessment, error)
 	GetAssessmentBySessionID(sessionID string) (*model.Assessment, error)
 	SaveAnswer(answer *model.Answer) error
+	CountAttempts(assessmentID, questionID uint) (int, error)
+	GetAnswersByAssessmentID(assessmentID uint) ([]model.Answer, error)
 	GetRandomQuestions(topic string, limit int) ([]model.Question, error)
 	GetQuestionsByCategory(category string) ([]model.Question, error)
 	GetQuestionByID(questionID uint) (*model.Question, error)
 
 	CountAnswersByAssessmentID(assessmentID uint) (int, error)
-	MarkUserAssessmentCompleted(userID uint) error
+	CountScoredAnswersSince(userID uint, since time.Time) (int, error)
 	UpdateAssessment(assessment *model.Assessment) error
+	AddAssessmentQuestion(assessment *model.Assessment, question *model.Question) error
+	ExpireAssessments(cutoff time.Time) (int64, error)
+	AbandonIdleAssessments(idleSince time.Time) (int64, error)
+
+	GetOngoingAssessment(userID uint, kind string) (*model.Assessment, error)
+
+	GetUser(userID uint) (*model.User, error)
+	SetUserLevel(entry *model.LevelHistory) error
+	GetLevelHistory(userID uint) ([]model.LevelHistory, error)
+
+	GetTopics() ([]string, error)
+	GetSkillEstimates(userID uint) ([]model.SkillEstimate, error)
+	SaveSkillEstimate(estimate *model.SkillEstimate) error
+	UpdateQuestionDifficulty(questionID uint, difficulty float64, attempts int) error
+	GetQuestionAnswerStats() ([]QuestionAnswerStats, error)
 }
 
+// QuestionAnswerStats summarises how often a question has been answered correctly.
+type QuestionAnswerStats struct {
+	QuestionID uint
+	Total      int
+	Correct    int
+}
+
+// ErrDuplicateAnswer is returned by SaveAnswer when the same attempt at a
+// question has already been recorded, e.g. by a concurrent request.
+var ErrDuplicateAnswer = errors.New("answer already recorded")
+
 type assessmentRepository struct{}
 
 func NewAssessmentRepository() AssessmentRepository {
@@ -47,12 +78,31 @@ func (r *assessmentRepository) GetAssessmentBySessionID(sessionID string) (*mode
 }
 
 func (r *assessmentRepository) SaveAnswer(answer *model.Answer) error {
-	return db.GetDB().Create(answer).Error
+	err := db.GetDB().Create(answer).Error
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateAnswer
+	}
+	return err
+}
+
+// GetAnswersByAssessmentID returns an assessment's answers in the order given
+func (r *assessmentRepository) GetAnswersByAssessmentID(assessmentID uint) ([]model.Answer, error) {
+	var answers []model.Answer
+	err := db.GetDB().Where("assessment_id = ?", assessmentID).Order("created_at, id").Find(&answers).Error
+	return answers, err
+}
+
+// CountAttempts counts the answers given to a question within an assessment
+func (r *assessmentRepository) CountAttempts(assessmentID, questionID uint) (int, error) {
+	var count int64
+	err := db.GetDB().Model(&model.Answer{}).Where("assessment_id = ? AND question_id = ?", assessmentID, questionID).Count(&count).Error
+	return int(count), err
 }
 
 func (r *assessmentRepository) GetRandomQuestions(topic string, limit int) ([]model.Question, error) {
 	var questions []model.Question
-	err := db.GetDB().Raw(`SELECT * FROM questions WHERE category = ? ORDER BY RANDOM() LIMIT ?`, topic, limit).Scan(&questions).Error
+	err := db.GetDB().Raw(`SELECT * FROM questions WHERE category = ? AND active AND status = 'approved' ORDER BY RANDOM() LIMIT ?`, topic, limit).Scan(&questions).Error
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +111,7 @@ func (r *assessmentRepository) GetRandomQuestions(topic string, limit int) ([]mo
 
 func (r *assessmentRepository) GetQuestionsByCategory(category string) ([]model.Question, error) {
 	var questions []model.Question
-	err := db.GetDB().Where("category = ?", category).Find(&questions).Error
+	err := db.GetDB().Where("category = ? AND active = ? AND status = ?", category, true, "approved").Find(&questions).Error
 	return questions, err
 }
 
@@ -74,19 +124,125 @@ func (r *assessmentRepository) GetQuestionByID(questionID uint) (*model.Question
 	return &question, nil
 }
 
-// CountAnswersByAssessmentID Count the number of answered questions for an assessment
+// CountAnswersByAssessmentID Count the number of answered questions for an assessment; retries are not counted
 func (r *assessmentRepository) CountAnswersByAssessmentID(assessmentID uint) (int, error) {
 	var count int64
-	err := db.GetDB().Model(&model.Answer{}).Where("assessment_id = ?", assessmentID).Count(&count).Error
+	err := db.GetDB().Model(&model.Answer{}).Where("assessment_id = ? AND attempt = 1", assessmentID).Count(&count).Error
+	return int(count), err
+}
+
+// CountScoredAnswersSince counts a user's first-attempt answers given after since
+func (r *assessmentRepository) CountScoredAnswersSince(userID uint, since time.Time) (int, error) {
+	var count int64
+	err := db.GetDB().Model(&model.Answer{}).Where("user_id = ? AND attempt = 1 AND created_at > ?", userID, since).Count(&count).Error
 	return int(count), err
 }
 
-// MarkUserAssessmentCompleted Mark the user as having completed their assessment
-func (r *assessmentRepository) MarkUserAssessmentCompleted(userID uint) error {
-	return db.GetDB().Model(&model.User{}).Where("id = ?", userID).Update("initial_assessment_completed", true).Error
+// GetOngoingAssessment returns the user's open session of the given kind, or nil if there is none
+func (r *assessmentRepository) GetOngoingAssessment(userID uint, kind string) (*model.Assessment, error) {
+	var assessment model.Assessment
+	err := db.GetDB().Preload("Questions").
+		Where("user_id = ? AND kind = ? AND status = ?", userID, kind, "ongoing").
+		Order("created_at desc").First(&assessment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &assessment, nil
+}
+
+func (r *assessmentRepository) GetUser(userID uint) (*model.User, error) {
+	var user model.User
+	if err := db.GetDB().First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetUserLevel records a placement result: the user's level changes, the
+// initial assessment counts as done and the change is added to the history
+func (r *assessmentRepository) SetUserLevel(entry *model.LevelHistory) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.User{}).Where("id = ?", entry.UserID).Updates(map[string]interface{}{
+			"level":                        entry.Level,
+			"level_updated_at":             entry.CreatedAt,
+			"initial_assessment_completed": true,
+		}).Error
+	})
+}
+
+// GetLevelHistory returns a user's placement results, newest first
+func (r *assessmentRepository) GetLevelHistory(userID uint) ([]model.LevelHistory, error) {
+	var history []model.LevelHistory
+	err := db.GetDB().Where("user_id = ?", userID).Order("created_at desc, id desc").Find(&history).Error
+	return history, err
 }
 
 // UpdateAssessment Update assessment details
 func (r *assessmentRepository) UpdateAssessment(assessment *model.Assessment) error {
 	return db.GetDB().Save(assessment).Error
 }
+
+// AddAssessmentQuestion records that a question was served in an assessment
+func (r *assessmentRepository) AddAssessmentQuestion(assessment *model.Assessment, question *model.Question) error {
+	return db.GetDB().Model(assessment).Association("Questions").Append(question)
+}
+
+// ExpireAssessments marks ongoing sessions whose time limit ended before cutoff as expired
+func (r *assessmentRepository) ExpireAssessments(cutoff time.Time) (int64, error) {
+	res := db.GetDB().Model(&model.Assessment{}).
+		Where("status = ? AND expires_at < ?", "ongoing", cutoff).
+		Updates(map[string]interface{}{"status": "expired", "ended_at": gorm.Expr("expires_at"), "current_question_id": 0})
+	return res.RowsAffected, res.Error
+}
+
+// AbandonIdleAssessments marks ongoing sessions not touched since idleSince as abandoned
+func (r *assessmentRepository) AbandonIdleAssessments(idleSince time.Time) (int64, error) {
+	res := db.GetDB().Model(&model.Assessment{}).
+		Where("status = ? AND updated_at < ?", "ongoing", idleSince).
+		Updates(map[string]interface{}{"status": "abandoned", "ended_at": time.Now(), "current_question_id": 0})
+	return res.RowsAffected, res.Error
+}
+
+// GetTopics returns every active topic that has at least one active question
+func (r *assessmentRepository) GetTopics() ([]string, error) {
+	var topics []string
+	err := db.GetDB().Model(&model.Topic{}).
+		Where("active = ? AND EXISTS (SELECT 1 FROM questions WHERE questions.category = topics.name AND questions.active AND questions.status = 'approved')", true).
+		Order("name").
+		Pluck("name", &topics).Error
+	return topics, err
+}
+
+func (r *assessmentRepository) GetSkillEstimates(userID uint) ([]model.SkillEstimate, error) {
+	var estimates []model.SkillEstimate
+	err := db.GetDB().Where("user_id = ?", userID).Order("topic").Find(&estimates).Error
+	return estimates, err
+}
+
+func (r *assessmentRepository) SaveSkillEstimate(estimate *model.SkillEstimate) error {
+	return db.GetDB().Save(estimate).Error
+}
+
+func (r *assessmentRepository) UpdateQuestionDifficulty(questionID uint, difficulty float64, attempts int) error {
+	return db.GetDB().Model(&model.Question{}).Where("id = ?", questionID).
+		Updates(map[string]interface{}{"difficulty": difficulty, "attempts": attempts}).Error
+}
+
+// GetQuestionAnswerStats counts total and correct answers per question.
+// Only first attempts count, and answers that timed out or were not really
+// graded (the LLM fallback) are left out, so they do not skew difficulty.
+func (r *assessmentRepository) GetQuestionAnswerStats() ([]QuestionAnswerStats, error) {
+	var stats []QuestionAnswerStats
+	err := db.GetDB().Model(&model.Answer{}).
+		Select("question_id, COUNT(*) AS total, SUM(CASE WHEN is_correct THEN 1 ELSE 0 END) AS correct").
+		Where("attempt = 1 AND (graded_by IS NULL OR graded_by NOT IN ?)", []string{"timeout", "fallback"}).
+		Group("question_id").
+		Scan(&stats).Error
+	return stats, err
+}
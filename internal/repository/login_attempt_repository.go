@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"inkwell-backend-V2.0/internal/db"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// FailureStats summarises failed logins: how many there were and when the last one was.
+type FailureStats struct {
+	Count int64
+	Last  *time.Time
+}
+
+type LoginAttemptRepository interface {
+	CreateAttempt(attempt *model.LoginAttempt) error
+	GetEmailFailures(email string, since time.Time) (FailureStats, error)
+	GetIPFailures(ip string, since time.Time) (FailureStats, error)
+	ListAttempts(email, ip string, limit int) ([]model.LoginAttempt, error)
+	DeleteAttemptsBefore(before time.Time) (int64, error)
+	LockEmail(email string, fn func() error) error
+}
+
+type loginAttemptRepository struct{}
+
+func NewLoginAttemptRepository() LoginAttemptRepository {
+	return &loginAttemptRepository{}
+}
+
+func (r *loginAttemptRepository) CreateAttempt(attempt *model.LoginAttempt) error {
+	return db.GetDB().Create(attempt).Error
+}
+
+// GetEmailFailures counts wrong passwords and second factors for an email since the given
+// time, or since its last successful login if that was later.
+func (r *loginAttemptRepository) GetEmailFailures(email string, since time.Time) (FailureStats, error) {
+	var lastSuccess *time.Time
+	if err := db.GetDB().Model(&model.LoginAttempt{}).
+		Where("email = ? AND success AND created_at > ?", email, since).
+		Select("MAX(created_at)").Scan(&lastSuccess).Error; err != nil {
+		return FailureStats{}, err
+	}
+	if lastSuccess != nil {
+		since = *lastSuccess
+	}
+	return r.failures("email = ?", email, since)
+}
+
+// GetIPFailures counts wrong passwords and second factors from an IP address since the given time.
+func (r *loginAttemptRepository) GetIPFailures(ip string, since time.Time) (FailureStats, error) {
+	return r.failures("ip = ?", ip, since)
+}
+
+func (r *loginAttemptRepository) failures(cond string, value string, since time.Time) (FailureStats, error) {
+	var stats FailureStats
+	err := db.GetDB().Model(&model.LoginAttempt{}).
+		Where(cond, value).
+		Where("NOT success AND reason IN ? AND created_at > ?", []string{model.LoginFailedCredentials, model.LoginFailedMFA}, since).
+		Select("COUNT(*) AS count, MAX(created_at) AS last").Scan(&stats).Error
+	return stats, err
+}
+
+// ListAttempts returns the most recent attempts, optionally only for one email or IP address.
+func (r *loginAttemptRepository) ListAttempts(email, ip string, limit int) ([]model.LoginAttempt, error) {
+	query := db.GetDB().Order("created_at desc").Limit(limit)
+	if email != "" {
+		query = query.Where("email = ?", email)
+	}
+	if ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+	var attempts []model.LoginAttempt
+	err := query.Find(&attempts).Error
+	return attempts, err
+}
+
+func (r *loginAttemptRepository) DeleteAttemptsBefore(before time.Time) (int64, error) {
+	res := db.GetDB().Where("created_at < ?", before).Delete(&model.LoginAttempt{})
+	return res.RowsAffected, res.Error
+}
+
+// LockEmail runs fn while holding a transaction-scoped advisory lock on the
+// email, so that logins for one account are checked and recorded one at a
+// time across all instances.
+func (r *loginAttemptRepository) LockEmail(email string, fn func() error) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "login:"+email).Error; err != nil {
+			return err
+		}
+		return fn()
+	})
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/db"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+type MFARepository interface {
+	GetFactor(userID uint) (*model.TOTPFactor, error)
+	SaveFactor(factor *model.TOTPFactor) error
+	ConfirmFactor(userID uint, step int64, at time.Time, codeHashes []string) (bool, error)
+	UseStep(userID uint, step int64) (bool, error)
+	DeleteFactor(userID uint) error
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+	CountRecoveryCodes(userID uint) (int64, error)
+}
+
+type mfaRepository struct{}
+
+func NewMFARepository() MFARepository {
+	return &mfaRepository{}
+}
+
+// GetFactor returns the user's authenticator, or nil if there is none.
+func (r *mfaRepository) GetFactor(userID uint) (*model.TOTPFactor, error) {
+	var factor model.TOTPFactor
+	err := db.GetDB().Where("user_id = ?", userID).First(&factor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &factor, nil
+}
+
+// SaveFactor creates or replaces the user's authenticator.
+func (r *mfaRepository) SaveFactor(factor *model.TOTPFactor) error {
+	return db.GetDB().Save(factor).Error
+}
+
+// ConfirmFactor enables an unconfirmed authenticator with its first code
+// and stores the user's recovery codes. It reports false if the factor was
+// already confirmed or the code's step was used.
+func (r *mfaRepository) ConfirmFactor(userID uint, step int64, at time.Time, codeHashes []string) (bool, error) {
+	confirmed := false
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.TOTPFactor{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND last_used_step < ?", userID, step).
+			Updates(map[string]interface{}{"confirmed_at": at, "last_used_step": step})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		confirmed = true
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+	return confirmed, err
+}
+
+// UseStep records that a code of the given time step was accepted. It
+// reports false if that step, or a later one, was used already.
+func (r *mfaRepository) UseStep(userID uint, step int64) (bool, error) {
+	res := db.GetDB().Model(&model.TOTPFactor{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	return res.RowsAffected == 1, res.Error
+}
+
+// DeleteFactor removes the user's authenticator and recovery codes.
+func (r *mfaRepository) DeleteFactor(userID uint) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.TOTPFactor{}).Error
+	})
+}
+
+func (r *mfaRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]model.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, model.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// UseRecoveryCode marks one of the user's unused recovery codes as used,
+// reporting false if none matches.
+func (r *mfaRepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	res := db.GetDB().Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return res.RowsAffected > 0, res.Error
+}
+
+// CountRecoveryCodes returns how many of the user's recovery codes are unused.
+func (r *mfaRepository) CountRecoveryCodes(userID uint) (int64, error) {
+	var n int64
+	err := db.GetDB().Model(&model.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&n).Error
+	return n, err
+}
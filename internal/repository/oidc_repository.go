@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"time"
+
+	"inkwell-backend-V2.0/internal/db"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+type OIDCRepository interface {
+	SaveState(state *model.OIDCLoginState) error
+	ConsumeState(state string) (*model.OIDCLoginState, error)
+	DeleteExpiredStates(before time.Time) (int64, error)
+	GetIdentity(provider, subject string) (*model.UserIdentity, error)
+	GetUserIdentities(userID uint) ([]model.UserIdentity, error)
+	CreateIdentity(identity *model.UserIdentity) error
+	TouchIdentity(id uint, email string, at time.Time) error
+}
+
+type oidcRepository struct{}
+
+func NewOIDCRepository() OIDCRepository {
+	return &oidcRepository{}
+}
+
+func (r *oidcRepository) SaveState(state *model.OIDCLoginState) error {
+	return db.GetDB().Create(state).Error
+}
+
+// ConsumeState deletes and returns a login state. It returns nil if the
+// state is unknown or another request already used it.
+func (r *oidcRepository) ConsumeState(state string) (*model.OIDCLoginState, error) {
+	var st model.OIDCLoginState
+	if err := db.GetDB().Where("state = ?", state).First(&st).Error; err != nil {
+		return nil, err
+	}
+	res := db.GetDB().Where("state = ?", state).Delete(&model.OIDCLoginState{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, nil
+	}
+	return &st, nil
+}
+
+func (r *oidcRepository) DeleteExpiredStates(before time.Time) (int64, error) {
+	res := db.GetDB().Where("expires_at < ?", before).Delete(&model.OIDCLoginState{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *oidcRepository) GetIdentity(provider, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	if err := db.GetDB().Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *oidcRepository) GetUserIdentities(userID uint) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	err := db.GetDB().Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	return identities, err
+}
+
+func (r *oidcRepository) CreateIdentity(identity *model.UserIdentity) error {
+	return db.GetDB().Create(identity).Error
+}
+
+// TouchIdentity records a login, with the email address the provider sent this time.
+func (r *oidcRepository) TouchIdentity(id uint, email string, at time.Time) error {
+	return db.GetDB().Model(&model.UserIdentity{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "last_login_at": at}).Error
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/db"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// UserData is everything stored about one user, for a data export.
+type UserData struct {
+	User           *model.User
+	Identities     []model.UserIdentity
+	Sessions       []model.Session
+	LoginAttempts  []model.LoginAttempt
+	Assessments    []model.Assessment // with their answers
+	SkillEstimates []model.SkillEstimate
+	LevelHistory   []model.LevelHistory
+	ReviewCards    []model.ReviewCard
+	Stories        []model.Story
+	Sentences      []model.Sentence
+	Comics         []model.Comic // every version
+	Exports        []model.DataExport
+	Events         []model.PrivacyEvent
+}
+
+type PrivacyRepository interface {
+	GetUserData(userID uint) (*UserData, error)
+	CreateExport(export *model.DataExport) error
+	GetExport(userID uint, id string) (*model.DataExport, error)
+	ListExports(userID uint) ([]model.DataExport, error)
+	HasPendingExport(userID uint) (bool, error)
+	FinishExport(export *model.DataExport) error
+	FailPendingExports() (int64, error)
+	GetExpiredExports(now, failedBefore time.Time) ([]model.DataExport, error)
+	DeleteExport(id string) error
+	GetUsersDueForErasure(now time.Time) ([]uint, error)
+	CreateEvent(event *model.PrivacyEvent) error
+	ListEvents(userID uint, limit int) ([]model.PrivacyEvent, error)
+}
+
+type privacyRepository struct{}
+
+func NewPrivacyRepository() PrivacyRepository {
+	return &privacyRepository{}
+}
+
+func (r *privacyRepository) GetUserData(userID uint) (*UserData, error) {
+	d := &UserData{User: &model.User{}}
+	database := db.GetDB()
+	if err := database.First(d.User, userID).Error; err != nil {
+		return nil, err
+	}
+	byUser := database.Where("user_id = ?", userID).Session(&gorm.Session{})
+	for _, q := range []struct {
+		dest  interface{}
+		order string
+	}{
+		{&d.Identities, "id"}, {&d.Sessions, "created_at"}, {&d.LoginAttempts, "created_at"},
+		{&d.SkillEstimates, "topic"}, {&d.LevelHistory, "id"}, {&d.ReviewCards, "id"},
+		{&d.Stories, "id"}, {&d.Exports, "created_at"}, {&d.Events, "id"},
+	} {
+		if err := byUser.Order(q.order).Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := byUser.Preload("Answers").Order("id").Find(&d.Assessments).Error; err != nil {
+		return nil, err
+	}
+	stories := database.Model(&model.Story{}).Select("id").Where("user_id = ?", userID)
+	if err := database.Where("story_id IN (?)", stories).Order("id").Find(&d.Sentences).Error; err != nil {
+		return nil, err
+	}
+	if err := database.Where("user_id = ? OR story_id IN (?)", userID, stories).Order("story_id, version").Find(&d.Comics).Error; err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (r *privacyRepository) CreateExport(export *model.DataExport) error {
+	return db.GetDB().Create(export).Error
+}
+
+func (r *privacyRepository) GetExport(userID uint, id string) (*model.DataExport, error) {
+	var export model.DataExport
+	if err := db.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *privacyRepository) ListExports(userID uint) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := db.GetDB().Where("user_id = ?", userID).Order("created_at desc").Find(&exports).Error
+	return exports, err
+}
+
+func (r *privacyRepository) HasPendingExport(userID uint) (bool, error) {
+	var n int64
+	err := db.GetDB().Model(&model.DataExport{}).Where("user_id = ? AND status = ?", userID, model.ExportPending).Count(&n).Error
+	return n > 0, err
+}
+
+// FinishExport stores the outcome of a pending export.
+func (r *privacyRepository) FinishExport(export *model.DataExport) error {
+	return db.GetDB().Model(&model.DataExport{}).Where("id = ?", export.ID).Updates(map[string]interface{}{
+		"status":       export.Status,
+		"file_path":    export.FilePath,
+		"size":         export.Size,
+		"completed_at": export.CompletedAt,
+		"expires_at":   export.ExpiresAt,
+	}).Error
+}
+
+// FailPendingExports marks exports that a restart interrupted as failed.
+func (r *privacyRepository) FailPendingExports() (int64, error) {
+	res := db.GetDB().Model(&model.DataExport{}).Where("status = ?", model.ExportPending).
+		Updates(map[string]interface{}{"status": model.ExportFailed, "completed_at": time.Now()})
+	return res.RowsAffected, res.Error
+}
+
+// GetExpiredExports returns ready exports that expired before now, and
+// failed ones created before failedBefore.
+func (r *privacyRepository) GetExpiredExports(now, failedBefore time.Time) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := db.GetDB().Where("(status = ? AND expires_at < ?) OR (status = ? AND created_at < ?)",
+		model.ExportReady, now, model.ExportFailed, failedBefore).Find(&exports).Error
+	return exports, err
+}
+
+func (r *privacyRepository) DeleteExport(id string) error {
+	return db.GetDB().Where("id = ?", id).Delete(&model.DataExport{}).Error
+}
+
+func (r *privacyRepository) GetUsersDueForErasure(now time.Time) ([]uint, error) {
+	var ids []uint
+	err := db.GetDB().Model(&model.User{}).Where("deletion_scheduled_for <= ?", now).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *privacyRepository) CreateEvent(event *model.PrivacyEvent) error {
+	return db.GetDB().Create(event).Error
+}
+
+// ListEvents returns the newest events, for one user when userID is not 0.
+func (r *privacyRepository) ListEvents(userID uint, limit int) ([]model.PrivacyEvent, error) {
+	q := db.GetDB().Order("id desc").Limit(limit)
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	var events []model.PrivacyEvent
+	err := q.Find(&events).Error
+	return events, err
+}
@@ -8,6 +8,28 @@ import (
 type QuestionRepository interface {
 	CreateQuestion(question *model.Question) error
 	GetAllQuestions() ([]model.Question, error)
+	ListQuestions(filter QuestionFilter) ([]model.Question, error)
+	GetQuestionByID(id uint) (*model.Question, error)
+	UpdateQuestion(question *model.Question) error
+	SaveQuestions(created, updated []*model.Question) error
+	DeleteQuestion(id uint) error
+	CountAnswersForQuestion(id uint) (int64, error)
+
+	ListTopics() ([]model.Topic, error)
+	GetTopicByID(id uint) (*model.Topic, error)
+	GetTopicByName(name string) (*model.Topic, error)
+	CreateTopic(topic *model.Topic) error
+	UpdateTopic(topic *model.Topic, oldName string) error
+	DeleteTopic(id uint) error
+	CountQuestionsForTopic(name string) (int64, error)
+}
+
+// QuestionFilter narrows ListQuestions; zero values match everything.
+type QuestionFilter struct {
+	Topic  string
+	Tag    string
+	Active *bool
+	Status string
 }
 
 type questionRepository struct {
@@ -20,7 +42,39 @@ func NewQuestionRepository(db *gorm.DB) QuestionRepository {
 }
 
 func (r *questionRepository) CreateQuestion(question *model.Question) error {
-	return r.db.Create(question).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return createQuestion(tx, question)
+	})
+}
+
+func createQuestion(tx *gorm.DB, question *model.Question) error {
+	if err := tx.Create(question).Error; err != nil {
+		return err
+	}
+	// GORM skips zero values for columns with a default, so an inactive
+	// question has to be switched off after insert.
+	if !question.Active {
+		return tx.Model(question).Update("active", false).Error
+	}
+	return nil
+}
+
+// SaveQuestions creates and updates questions in one transaction, so either
+// all of them are written or none are.
+func (r *questionRepository) SaveQuestions(created, updated []*model.Question) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, question := range created {
+			if err := createQuestion(tx, question); err != nil {
+				return err
+			}
+		}
+		for _, question := range updated {
+			if err := tx.Save(question).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (r *questionRepository) GetAllQuestions() ([]model.Question, error) {
@@ -28,3 +82,114 @@ func (r *questionRepository) GetAllQuestions() ([]model.Question, error) {
 	err := r.db.Find(&questions).Error
 	return questions, err
 }
+
+func (r *questionRepository) ListQuestions(filter QuestionFilter) ([]model.Question, error) {
+	q := r.db.Order("category, id")
+	if filter.Topic != "" {
+		q = q.Where("category = ?", filter.Topic)
+	}
+	if filter.Tag != "" {
+		q = q.Where("(',' || tags || ',') LIKE ?", "%,"+filter.Tag+",%")
+	}
+	if filter.Active != nil {
+		q = q.Where("active = ?", *filter.Active)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	var questions []model.Question
+	err := q.Find(&questions).Error
+	return questions, err
+}
+
+func (r *questionRepository) GetQuestionByID(id uint) (*model.Question, error) {
+	var question model.Question
+	if err := r.db.First(&question, id).Error; err != nil {
+		return nil, err
+	}
+	return &question, nil
+}
+
+func (r *questionRepository) UpdateQuestion(question *model.Question) error {
+	return r.db.Save(question).Error
+}
+
+// DeleteQuestion removes a question and its links to past assessments
+func (r *questionRepository) DeleteQuestion(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM assessment_questions WHERE question_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Question{}, id).Error
+	})
+}
+
+func (r *questionRepository) CountAnswersForQuestion(id uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Answer{}).Where("question_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+func (r *questionRepository) ListTopics() ([]model.Topic, error) {
+	var topics []model.Topic
+	err := r.db.Order("name").Find(&topics).Error
+	return topics, err
+}
+
+func (r *questionRepository) GetTopicByID(id uint) (*model.Topic, error) {
+	var topic model.Topic
+	if err := r.db.First(&topic, id).Error; err != nil {
+		return nil, err
+	}
+	return &topic, nil
+}
+
+func (r *questionRepository) GetTopicByName(name string) (*model.Topic, error) {
+	var topic model.Topic
+	if err := r.db.Where("name = ?", name).First(&topic).Error; err != nil {
+		return nil, err
+	}
+	return &topic, nil
+}
+
+func (r *questionRepository) CreateTopic(topic *model.Topic) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(topic).Error; err != nil {
+			return err
+		}
+		if !topic.Active {
+			return tx.Model(topic).Update("active", false).Error
+		}
+		return nil
+	})
+}
+
+// UpdateTopic saves the topic and, if it was renamed, moves its questions
+// and past assessments to the new name
+func (r *questionRepository) UpdateTopic(topic *model.Topic, oldName string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(topic).Error; err != nil {
+			return err
+		}
+		if oldName == topic.Name {
+			return nil
+		}
+		if err := tx.Model(&model.Question{}).Where("category = ?", oldName).Update("category", topic.Name).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Assessment{}).Where("category = ?", oldName).Update("category", topic.Name).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.SkillEstimate{}).Where("topic = ?", oldName).Update("topic", topic.Name).Error
+	})
+}
+
+func (r *questionRepository) DeleteTopic(id uint) error {
+	return r.db.Delete(&model.Topic{}, id).Error
+}
+
+func (r *questionRepository) CountQuestionsForTopic(name string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Question{}).Where("category = ?", name).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/db"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+type ReviewRepository interface {
+	GetCard(userID, cardID uint) (*model.ReviewCard, error)
+	GetCardBySource(userID uint, sourceType, sourceKey string) (*model.ReviewCard, error)
+	SaveCard(card *model.ReviewCard) error
+	GetDueCards(userID uint, until time.Time, limit int) ([]model.ReviewCard, error)
+	CountDueCards(userID uint, until time.Time) (int, error)
+	IsQuestionInOpenSession(userID, questionID uint) (bool, error)
+}
+
+type reviewRepository struct{}
+
+func NewReviewRepository() ReviewRepository {
+	return &reviewRepository{}
+}
+
+// openSessionQuestion matches questions served in one of the user's
+// ongoing assessments.
+const openSessionQuestion = `EXISTS (SELECT 1 FROM assessment_questions aq
+	JOIN assessments a ON a.id = aq.assessment_id
+	WHERE aq.question_id = ? AND a.user_id = ? AND a.status = 'ongoing')`
+
+// dueCards selects the user's scheduled cards due by until, leaving out cards
+// for questions that have since been retired or that are part of an ongoing
+// assessment, whose answer must not be revealed yet.
+func dueCards(userID uint, until time.Time) *gorm.DB {
+	return db.GetDB().Model(&model.ReviewCard{}).
+		Joins("LEFT JOIN questions ON questions.id = review_cards.question_id").
+		Where("review_cards.user_id = ? AND review_cards.due_at IS NOT NULL AND review_cards.due_at <= ?", userID, until).
+		Where("review_cards.question_id IS NULL OR (questions.active AND NOT "+openSessionQuestion+")",
+			gorm.Expr("review_cards.question_id"), userID)
+}
+
+func (r *reviewRepository) GetCard(userID, cardID uint) (*model.ReviewCard, error) {
+	var card model.ReviewCard
+	err := db.GetDB().Preload("Question").Where("id = ? AND user_id = ?", cardID, userID).First(&card).Error
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// GetCardBySource returns the user's card for an item, or nil if there is none
+func (r *reviewRepository) GetCardBySource(userID uint, sourceType, sourceKey string) (*model.ReviewCard, error) {
+	var card model.ReviewCard
+	err := db.GetDB().Where("user_id = ? AND source_type = ? AND source_key = ?", userID, sourceType, sourceKey).First(&card).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+func (r *reviewRepository) SaveCard(card *model.ReviewCard) error {
+	return db.GetDB().Omit("Question").Save(card).Error
+}
+
+// GetDueCards returns up to limit due cards, most overdue first
+func (r *reviewRepository) GetDueCards(userID uint, until time.Time, limit int) ([]model.ReviewCard, error) {
+	var cards []model.ReviewCard
+	err := dueCards(userID, until).Preload("Question").
+		Order("review_cards.due_at asc, review_cards.id asc").Limit(limit).Find(&cards).Error
+	return cards, err
+}
+
+// IsQuestionInOpenSession reports whether the question was served in one of
+// the user's ongoing assessments.
+func (r *reviewRepository) IsQuestionInOpenSession(userID, questionID uint) (bool, error) {
+	var open bool
+	err := db.GetDB().Raw("SELECT "+openSessionQuestion, questionID, userID).Scan(&open).Error
+	return open, err
+}
+
+func (r *reviewRepository) CountDueCards(userID uint, until time.Time) (int, error) {
+	var count int64
+	err := dueCards(userID, until).Count(&count).Error
+	return int(count), err
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/db"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+type SessionRepository interface {
+	CreateSession(session *model.Session) error
+	GetSession(id string) (*model.Session, error)
+	IsSessionActive(familyID string) (bool, error)
+	RotateSession(oldID string, next *model.Session) (bool, error)
+	RevokeFamily(familyID, reason string) error
+	RevokeUserFamily(userID uint, familyID, reason string) (int64, error)
+	RevokeUserSessions(userID uint, reason string) error
+	RevokeOtherSessions(userID uint, keepFamilyID, reason string) error
+	GetActiveSessions(userID uint) ([]model.Session, error)
+	DeleteExpiredSessions(before time.Time) (int64, error)
+}
+
+type sessionRepository struct{}
+
+func NewSessionRepository() SessionRepository {
+	return &sessionRepository{}
+}
+
+func (r *sessionRepository) CreateSession(session *model.Session) error {
+	return db.GetDB().Create(session).Error
+}
+
+func (r *sessionRepository) GetSession(id string) (*model.Session, error) {
+	var session model.Session
+	if err := db.GetDB().Where("id = ?", id).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// IsSessionActive reports whether a login still has an unrevoked, unexpired token.
+func (r *sessionRepository) IsSessionActive(familyID string) (bool, error) {
+	var count int64
+	err := db.GetDB().Model(&model.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", familyID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// RotateSession revokes the session oldID as rotated and creates next in its
+// place. It reports false, creating nothing, if oldID was already revoked,
+// so that two refreshes racing with the same token cannot both succeed.
+func (r *sessionRepository) RotateSession(oldID string, next *model.Session) (bool, error) {
+	rotated := false
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Session{}).Where("id = ? AND revoked_at IS NULL", oldID).Updates(map[string]interface{}{
+			"revoked_at":     next.CreatedAt,
+			"revoked_reason": "rotated",
+			"replaced_by":    next.ID,
+		})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		rotated = true
+		return tx.Create(next).Error
+	})
+	return rotated, err
+}
+
+// RevokeFamily revokes every token of one login.
+func (r *sessionRepository) RevokeFamily(familyID, reason string) error {
+	return db.GetDB().Model(&model.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// RevokeUserFamily revokes one of the user's logins and reports how many tokens were revoked.
+func (r *sessionRepository) RevokeUserFamily(userID uint, familyID, reason string) (int64, error) {
+	res := db.GetDB().Model(&model.Session{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL", userID, familyID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason})
+	return res.RowsAffected, res.Error
+}
+
+// RevokeUserSessions revokes all of the user's logins.
+func (r *sessionRepository) RevokeUserSessions(userID uint, reason string) error {
+	return db.GetDB().Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// RevokeOtherSessions revokes all of the user's logins except one.
+func (r *sessionRepository) RevokeOtherSessions(userID uint, keepFamilyID, reason string) error {
+	return db.GetDB().Model(&model.Session{}).
+		Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, keepFamilyID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// GetActiveSessions returns the current token of each of the user's logins, most recently used first.
+func (r *sessionRepository) GetActiveSessions(userID uint) ([]model.Session, error) {
+	var sessions []model.Session
+	err := db.GetDB().Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// DeleteExpiredSessions removes tokens that expired before the given time;
+// they can no longer be presented, so they are not needed for reuse detection.
+func (r *sessionRepository) DeleteExpiredSessions(before time.Time) (int64, error) {
+	res := db.GetDB().Where("expires_at < ?", before).Delete(&model.Session{})
+	return res.RowsAffected, res.Error
+}
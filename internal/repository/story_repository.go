@@ -19,7 +19,11 @@ type StoryRepository interface {
 	GetSentencesByStory(storyID uint) ([]model.Sentence, error)
 	SaveComic(comic *model.Comic) error
 	GetComicsByUser(userID uint) ([]model.Comic, error)
-	GetAllStoriesWithoutComics() ([]model.Story, error)
+	GetLatestComic(storyID uint) (*model.Comic, error)
+	GetComicVersions(storyID uint) ([]model.Comic, error)
+	GetUnhashedLatestComics() ([]model.Comic, error)
+	SetComicContentHash(comicID uint, hash string) error
+	GetCompletedStories() ([]model.Story, error)
 	UpdateStoryAnalysis(storyID uint, analysis string, tips []string, perfScore int) error
 	GetCompletedStoriesWithAnalysis(userID uint) ([]model.Story, error)
 	GetStoriesWithoutAnalysis() ([]model.Story, error)
@@ -80,7 +84,7 @@ func (r *storyRepository) GetSentenceCount(storyID uint) (int, error) {
 
 func (r *storyRepository) GetSentencesByStory(storyID uint) ([]model.Sentence, error) {
 	var sentences []model.Sentence
-	err := db.GetDB().Where("story_id = ?", storyID).Find(&sentences).Error
+	err := db.GetDB().Where("story_id = ?", storyID).Order("created_at asc, id asc").Find(&sentences).Error
 	return sentences, err
 }
 
@@ -88,26 +92,52 @@ func (r *storyRepository) SaveComic(comic *model.Comic) error {
 	return db.GetDB().Create(comic).Error
 }
 
+// GetComicsByUser returns the latest comic version of each of the user's stories.
 func (r *storyRepository) GetComicsByUser(userID uint) ([]model.Comic, error) {
 	var comics []model.Comic
-	err := db.GetDB().Where("user_id = ?", userID).Find(&comics).Error
+	err := db.GetDB().
+		Where("user_id = ? AND version = (SELECT MAX(c2.version) FROM comics c2 WHERE c2.story_id = comics.story_id)", userID).
+		Order("done_on desc").
+		Find(&comics).Error
 	if err != nil {
 		return nil, err
 	}
 	return comics, nil
 }
-func (r *storyRepository) GetAllStoriesWithoutComics() ([]model.Story, error) {
-	var stories []model.Story
-	err := db.GetDB().Raw(`
-        SELECT * FROM stories 
-        WHERE id NOT IN (SELECT DISTINCT story_id FROM comics)
-    `).Scan(&stories).Error
 
+func (r *storyRepository) GetLatestComic(storyID uint) (*model.Comic, error) {
+	var comic model.Comic
+	err := db.GetDB().Where("story_id = ?", storyID).Order("version desc").First(&comic).Error
 	if err != nil {
 		return nil, err
 	}
+	return &comic, nil
+}
+
+func (r *storyRepository) GetComicVersions(storyID uint) ([]model.Comic, error) {
+	var comics []model.Comic
+	err := db.GetDB().Where("story_id = ?", storyID).Order("version desc").Find(&comics).Error
+	return comics, err
+}
+
+// GetUnhashedLatestComics returns the latest version of each story's comic
+// when it was created before comics were fingerprinted.
+func (r *storyRepository) GetUnhashedLatestComics() ([]model.Comic, error) {
+	var comics []model.Comic
+	err := db.GetDB().
+		Where("(content_hash IS NULL OR content_hash = '') AND version = (SELECT MAX(c2.version) FROM comics c2 WHERE c2.story_id = comics.story_id)").
+		Find(&comics).Error
+	return comics, err
+}
 
-	return stories, nil
+func (r *storyRepository) SetComicContentHash(comicID uint, hash string) error {
+	return db.GetDB().Model(&model.Comic{}).Where("id = ?", comicID).Update("content_hash", hash).Error
+}
+
+func (r *storyRepository) GetCompletedStories() ([]model.Story, error) {
+	var stories []model.Story
+	err := db.GetDB().Where("status = ?", "completed").Find(&stories).Error
+	return stories, err
 }
 
 func (r *storyRepository) UpdateStoryAnalysis(storyID uint, analysis string, tips []string, perfScore int) error {
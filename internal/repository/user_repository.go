@@ -1,6 +1,11 @@
 package repository
 
 import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
 	"inkwell-backend-V2.0/internal/db"
 	"inkwell-backend-V2.0/internal/model"
 )
@@ -8,7 +13,14 @@ import (
 type UserRepository interface {
 	CreateUser(user *model.User) error
 	GetUserByEmail(email string) (*model.User, error)
+	GetUserByID(userID uint) (*model.User, error)
 	GetAllUsers() ([]model.User, error)
+	UpdatePassword(userID uint, hash string) error
+	UpdateRole(userID uint, role string) error
+	MarkEmailVerified(userID uint, at time.Time) error
+	UpdateProfile(userID uint, fields map[string]interface{}) error
+	ChangeEmail(userID uint, email string, at time.Time) error
+	DeleteUser(userID uint) error
 }
 
 type userRepository struct{}
@@ -17,18 +29,101 @@ func NewUserRepository() UserRepository {
 	return &userRepository{}
 }
 
+// CreateUser stores the user with the email lowercased. A unique index on
+// LOWER(email) keeps case variants of an address from opening a second account.
 func (r *userRepository) CreateUser(user *model.User) error {
+	user.Email = normalizeEmail(user.Email)
 	return db.GetDB().Create(user).Error
 }
 
+// GetUserByEmail finds the user regardless of the case of the address.
 func (r *userRepository) GetUserByEmail(email string) (*model.User, error) {
 	var user model.User
-	err := db.GetDB().Where("email = ?", email).First(&user).Error
+	err := db.GetDB().Where("LOWER(email) = ?", normalizeEmail(email)).First(&user).Error
+	return &user, err
+}
+
+func (r *userRepository) GetUserByID(userID uint) (*model.User, error) {
+	var user model.User
+	err := db.GetDB().Where("id = ?", userID).First(&user).Error
 	return &user, err
 }
 
 func (r *userRepository) GetAllUsers() ([]model.User, error) {
 	var users []model.User
-	err := db.GetDB().Find(&users).Error
+	err := db.GetDB().Omit("password").Order("id").Find(&users).Error
 	return users, err
 }
+
+func (r *userRepository) UpdatePassword(userID uint, hash string) error {
+	return db.GetDB().Model(&model.User{}).Where("id = ?", userID).Update("password", hash).Error
+}
+
+func (r *userRepository) UpdateRole(userID uint, role string) error {
+	return db.GetDB().Model(&model.User{}).Where("id = ?", userID).Update("role", role).Error
+}
+
+// MarkEmailVerified records when the user verified their address, keeping the first time.
+func (r *userRepository) MarkEmailVerified(userID uint, at time.Time) error {
+	return db.GetDB().Model(&model.User{}).Where("id = ? AND email_verified_at IS NULL", userID).
+		Update("email_verified_at", at).Error
+}
+
+// UpdateProfile sets the given columns of the user.
+func (r *userRepository) UpdateProfile(userID uint, fields map[string]interface{}) error {
+	return db.GetDB().Model(&model.User{}).Where("id = ?", userID).Updates(fields).Error
+}
+
+// ChangeEmail makes the confirmed pending address the user's email.
+func (r *userRepository) ChangeEmail(userID uint, email string, at time.Time) error {
+	return db.GetDB().Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"email":             normalizeEmail(email),
+		"pending_email":     "",
+		"email_verified_at": at,
+	}).Error
+}
+
+// DeleteUser deletes the user and every row that belongs to them. Login
+// attempts are kept for throttling statistics, with the user ID, email,
+// IP address and user agent removed.
+func (r *userRepository) DeleteUser(userID uint) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		assessments := tx.Model(&model.Assessment{}).Select("id").Where("user_id = ?", userID)
+		stories := tx.Model(&model.Story{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Exec("DELETE FROM assessment_questions WHERE assessment_id IN (?)", assessments).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("assessment_id IN (?) OR user_id = ?", assessments, userID).Delete(&model.Answer{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("story_id IN (?)", stories).Delete(&model.Sentence{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("story_id IN (?)", stories).Delete(&model.Comic{}).Error; err != nil {
+			return err
+		}
+		for _, owned := range []interface{}{
+			&model.Assessment{}, &model.Comic{}, &model.Story{}, &model.SkillEstimate{}, &model.LevelHistory{},
+			&model.ReviewCard{}, &model.Session{}, &model.AccountToken{}, &model.RecoveryCode{},
+			&model.TOTPFactor{}, &model.UserIdentity{}, &model.DataExport{},
+		} {
+			if err := tx.Where("user_id = ?", userID).Delete(owned).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&model.LoginAttempt{}).
+			Where("user_id = ? OR email = ?", userID, normalizeEmail(user.Email)).
+			Updates(map[string]interface{}{"user_id": nil, "email": "", "ip": "", "user_agent": ""}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.User{}, userID).Error
+	})
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
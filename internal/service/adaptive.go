@@ -0,0 +1,162 @@
+package service
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+)
+
+// Adaptive assessments use a Rasch model: the chance of answering a question
+// correctly is logistic(ability - difficulty), both measured in logits. Each
+// user's ability per topic is tracked as a Gaussian estimate that narrows
+// with every answer; a session ends once the estimate is precise enough.
+// Abilities change as learners improve, so the estimate never gets more
+// precise than minStdError and widens again by abilityDriftPerDay (a
+// variance in logits²) for every day without answers.
+const (
+	priorAbility  = 0.0
+	priorStdError = 1.5
+
+	minStdError        = 0.35
+	abilityDriftPerDay = 0.01
+
+	// targetStdError ends a session once the ability estimate is this precise.
+	targetStdError   = 0.45
+	minSessionLength = 3
+	maxSessionLength = 12
+
+	// Difficulty updates shrink as a question collects attempts, so that
+	// well-established items move slowly.
+	itemLearningRate = 0.4
+	itemSettleCount  = 20
+
+	// minCalibrationAnswers is the answer count below which history-based
+	// calibration leaves a question's difficulty alone.
+	minCalibrationAnswers = 5
+)
+
+// probCorrect is the Rasch probability that a learner of the given ability
+// answers an item of the given difficulty correctly.
+func probCorrect(ability, difficulty float64) float64 {
+	return 1 / (1 + math.Exp(difficulty-ability))
+}
+
+// newSkillEstimate returns the prior for a topic the user has not been
+// assessed on, centred on the given ability.
+func newSkillEstimate(userID uint, topic string, ability float64) model.SkillEstimate {
+	return model.SkillEstimate{UserID: userID, Topic: topic, Ability: ability, StdError: priorStdError}
+}
+
+// updateAbility applies one answer given at now to the estimate with a
+// Laplace approximation: after ageing the estimate, the item's Fisher
+// information is added to the precision and the mean takes a Newton step
+// towards the observed outcome.
+func updateAbility(est *model.SkillEstimate, difficulty float64, correct bool, now time.Time) {
+	ageEstimate(est, now)
+	p := probCorrect(est.Ability, difficulty)
+	outcome := 0.0
+	if correct {
+		outcome = 1
+	}
+	precision := 1/(est.StdError*est.StdError) + p*(1-p)
+	precision = min(precision, 1/(minStdError*minStdError))
+	est.Ability += (outcome - p) / precision
+	est.StdError = 1 / math.Sqrt(precision)
+	est.Answers++
+}
+
+// ageEstimate widens the estimate by the drift since it was last updated,
+// up to the prior's uncertainty, and moves its update time to now so that
+// the drift is only added once.
+func ageEstimate(est *model.SkillEstimate, now time.Time) {
+	if est.UpdatedAt.IsZero() || !now.After(est.UpdatedAt) {
+		return
+	}
+	days := now.Sub(est.UpdatedAt).Hours() / 24
+	if est.StdError < priorStdError {
+		est.StdError = min(math.Sqrt(est.StdError*est.StdError+abilityDriftPerDay*days), priorStdError)
+	}
+	est.UpdatedAt = now
+}
+
+// updateDifficulty nudges an item's difficulty Elo-style: a correct answer
+// from a learner expected to fail makes the item look easier, and vice versa.
+func updateDifficulty(question *model.Question, ability float64, correct bool) {
+	p := probCorrect(ability, question.Difficulty)
+	outcome := 0.0
+	if correct {
+		outcome = 1
+	}
+	rate := itemLearningRate / (1 + float64(question.Attempts)/itemSettleCount)
+	question.Difficulty += rate * (p - outcome)
+	question.Attempts++
+}
+
+// pickTopic returns the topic whose ability estimate is least certain, so
+// each session is spent where it teaches us the most.
+func pickTopic(topics []string, estimates map[string]model.SkillEstimate) string {
+	best, bestSE := "", -1.0
+	for _, topic := range topics {
+		se := priorStdError
+		if est, ok := estimates[topic]; ok {
+			se = est.StdError
+		}
+		if se > bestSE {
+			best, bestSE = topic, se
+		}
+	}
+	return best
+}
+
+// pickQuestion returns the unused question carrying the most Fisher
+// information at the given ability, i.e. the one whose difficulty is
+// closest to it. It returns nil when every question has been used.
+func pickQuestion(questions []model.Question, used map[uint]bool, ability float64) *model.Question {
+	var best *model.Question
+	bestInfo := -1.0
+	for i := range questions {
+		if used[questions[i].ID] {
+			continue
+		}
+		p := probCorrect(ability, questions[i].Difficulty)
+		if info := p * (1 - p); info > bestInfo {
+			best, bestInfo = &questions[i], info
+		}
+	}
+	return best
+}
+
+// sessionDone reports whether an assessment has gathered enough answers.
+func sessionDone(answered int, est model.SkillEstimate) bool {
+	if answered >= maxSessionLength {
+		return true
+	}
+	return answered >= minSessionLength && est.StdError <= targetStdError
+}
+
+// CalibrateQuestionDifficulties sets each question's difficulty from the
+// share of correct answers it has received, once it has enough answers.
+func CalibrateQuestionDifficulties(assessmentRepo repository.AssessmentRepository) error {
+	stats, err := assessmentRepo.GetQuestionAnswerStats()
+	if err != nil {
+		return err
+	}
+	calibrated := 0
+	for _, st := range stats {
+		if st.Total < minCalibrationAnswers {
+			continue
+		}
+		// Smoothed logit of the failure rate, so 0% and 100% stay finite.
+		p := (float64(st.Correct) + 0.5) / (float64(st.Total) + 1)
+		difficulty := math.Log((1 - p) / p)
+		if err := assessmentRepo.UpdateQuestionDifficulty(st.QuestionID, difficulty, st.Total); err != nil {
+			return err
+		}
+		calibrated++
+	}
+	log.Printf("Calibrated difficulty for %d questions", calibrated)
+	return nil
+}
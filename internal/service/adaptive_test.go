@@ -0,0 +1,110 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"inkwell-backend-V2.0/internal/model"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestProbCorrect(t *testing.T) {
+	if p := probCorrect(1, 1); !near(p, 0.5) {
+		t.Errorf("equal ability and difficulty: p = %v, want 0.5", p)
+	}
+	if p := probCorrect(2, 0); !near(p, 1/(1+math.Exp(-2))) {
+		t.Errorf("p = %v", p)
+	}
+}
+
+func TestUpdateAbilityFirstAnswer(t *testing.T) {
+	now := time.Now()
+	est := newSkillEstimate(1, "tenses", 0)
+
+	// From the prior (variance 2.25) an item at the learner's ability adds
+	// information 0.25, and the mean moves by (1 - 0.5) / precision.
+	updateAbility(&est, 0, true, now)
+	precision := 1/2.25 + 0.25
+	if !near(est.Ability, 0.5/precision) || !near(est.StdError, 1/math.Sqrt(precision)) {
+		t.Errorf("got ability %v ± %v, want %v ± %v", est.Ability, est.StdError, 0.5/precision, 1/math.Sqrt(precision))
+	}
+	if est.Answers != 1 {
+		t.Errorf("answers = %d, want 1", est.Answers)
+	}
+
+	wrong := newSkillEstimate(1, "tenses", 0)
+	updateAbility(&wrong, 0, false, now)
+	if !near(wrong.Ability, -est.Ability) || !near(wrong.StdError, est.StdError) {
+		t.Errorf("a wrong answer should mirror a correct one: %v ± %v", wrong.Ability, wrong.StdError)
+	}
+}
+
+func TestUpdateAbilityKeepsMoving(t *testing.T) {
+	now := time.Now()
+	est := newSkillEstimate(1, "tenses", 0)
+	for i := 0; i < 200; i++ {
+		updateAbility(&est, est.Ability, i%2 == 0, now)
+	}
+	if est.StdError < minStdError-1e-9 {
+		t.Fatalf("std error %v fell below the floor %v", est.StdError, minStdError)
+	}
+
+	// A learner who has improved must still be able to move the estimate.
+	before := est.Ability
+	for i := 0; i < 10; i++ {
+		updateAbility(&est, est.Ability, true, now)
+	}
+	if gain := est.Ability - before; gain < 0.5 {
+		t.Errorf("ten correct answers moved the ability by only %v", gain)
+	}
+}
+
+func TestAgeEstimate(t *testing.T) {
+	now := time.Now()
+	est := model.SkillEstimate{Ability: 1, StdError: minStdError, UpdatedAt: now.Add(-30 * 24 * time.Hour)}
+	ageEstimate(&est, now)
+	want := math.Sqrt(minStdError*minStdError + 30*abilityDriftPerDay)
+	if !near(est.StdError, want) || !est.UpdatedAt.Equal(now) {
+		t.Errorf("after 30 days: std error %v at %v, want %v at %v", est.StdError, est.UpdatedAt, want, now)
+	}
+	if est.Ability != 1 {
+		t.Errorf("ageing changed the ability to %v", est.Ability)
+	}
+
+	// Ageing twice at the same time adds the drift once.
+	ageEstimate(&est, now)
+	if !near(est.StdError, want) {
+		t.Errorf("second ageing changed std error to %v", est.StdError)
+	}
+
+	old := model.SkillEstimate{StdError: 0.5, UpdatedAt: now.Add(-10 * 365 * 24 * time.Hour)}
+	ageEstimate(&old, now)
+	if old.StdError != priorStdError {
+		t.Errorf("std error %v exceeds the prior %v", old.StdError, priorStdError)
+	}
+}
+
+func TestUpdateDifficulty(t *testing.T) {
+	q := &model.Question{Difficulty: 0}
+	updateDifficulty(q, 0, true)
+	if !near(q.Difficulty, -itemLearningRate*0.5) || q.Attempts != 1 {
+		t.Errorf("difficulty %v after %d attempts", q.Difficulty, q.Attempts)
+	}
+}
+
+func TestSessionDone(t *testing.T) {
+	precise := model.SkillEstimate{StdError: targetStdError}
+	if sessionDone(minSessionLength-1, precise) {
+		t.Error("done before the minimum length")
+	}
+	if !sessionDone(minSessionLength, precise) {
+		t.Error("not done with a precise estimate")
+	}
+	if !sessionDone(maxSessionLength, model.SkillEstimate{StdError: priorStdError}) {
+		t.Error("not done at the maximum length")
+	}
+}
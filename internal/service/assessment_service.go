@@ -1,20 +1,27 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"inkwell-backend-V2.0/internal/llm"
 	"inkwell-backend-V2.0/internal/model"
 	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/pkg/event_bus"
 )
 
 type AssessmentService interface {
-	CreateAssessment(c *gin.Context, topic string) (*model.Assessment, []model.Question, error)
+	CreateAssessment(userID uint) (*model.Assessment, *model.LearnerQuestion, error)
 	GetAssessments() ([]model.Assessment, error)
-	GetAssessmentBySessionID(sessionID string) (*model.Assessment, error)
-	SaveAnswer(answer *model.Answer) (*model.AnswerResponse, error)
+	GetAssessmentBySessionID(userID uint, sessionID string) (*model.AssessmentView, error)
+	GetAssessmentReview(userID uint, sessionID string) (*model.AssessmentReview, error)
+	SubmitAnswer(userID uint, sessionID string, questionID uint, answer string) (*model.AnswerResponse, error)
+	AbandonAssessment(userID uint, sessionID string) (*model.Assessment, error)
+	GetPlacementStatus(userID uint) (*PlacementStatus, error)
+	StartPlacement(userID uint) (*model.Assessment, *model.LearnerQuestion, error)
+	GetSkillEstimates(userID uint) ([]model.SkillEstimate, error)
 }
 
 type assessmentService struct {
@@ -29,37 +36,60 @@ func NewAssessmentService(assessmentRepo repository.AssessmentRepository, ollama
 	}
 }
 
-func (s *assessmentService) CreateAssessment(c *gin.Context, topic string) (*model.Assessment, []model.Question, error) {
+// CreateAssessment starts an adaptive session on the topic the user's skill
+// is least certain in and returns its first question.
+func (s *assessmentService) CreateAssessment(userID uint) (*model.Assessment, *model.LearnerQuestion, error) {
 	sessionID := uuid.New().String()
 
-	// Retrieve user ID from context
-	userID, exists := c.Get("user_id")
-	if !exists {
-		return nil, nil, fmt.Errorf("user ID not found in token")
+	topics, err := s.assessmentRepo.GetTopics()
+	if err != nil {
+		return nil, nil, err
 	}
-
-	// Convert userID to the expected type (uint)
-	userIDUint, ok := userID.(uint)
+	if len(topics) == 0 {
+		return nil, nil, fmt.Errorf("no assessment questions available")
+	}
+	estimates, err := s.skillEstimatesByTopic(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	topic := pickTopic(topics, estimates)
+	estimate, ok := estimates[topic]
 	if !ok {
-		return nil, nil, fmt.Errorf("invalid user ID format")
+		prior, err := s.userPrior(userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		estimate = newSkillEstimate(userID, topic, prior)
 	}
 
 	// Fetch questions based on topic
-	questions, err := s.assessmentRepo.GetRandomQuestions(topic, 5)
+	questions, err := s.assessmentRepo.GetQuestionsByCategory(topic)
 	if err != nil {
 		return nil, nil, err
 	}
+	question := pickQuestion(questions, nil, estimate.Ability)
+	if question == nil {
+		return nil, nil, fmt.Errorf("no questions available for topic %s", topic)
+	}
 
 	// Create assessment object
+	now := time.Now()
+	limits := assessmentLimits()
 	assessment := model.Assessment{
-		UserID:      userIDUint, // Assign user ID
+		UserID:      userID,
 		SessionID:   sessionID,
 		Title:       fmt.Sprintf("%s Assessment", topic),
 		Description: fmt.Sprintf("Assessment on %s", topic),
-		Status:      "ongoing",
+		Status:      AssessmentOngoing,
 		Category:    topic,
-		Questions:   questions,
+		Kind:        AssessmentPractice,
+		Questions:   []model.Question{*question},
+	}
+	if limits.SessionTimeLimit > 0 {
+		expires := now.Add(seconds(limits.SessionTimeLimit))
+		assessment.ExpiresAt = &expires
 	}
+	serveQuestion(&assessment, question, now, limits)
 
 	// Save assessment and questions relation in DB
 	err = s.assessmentRepo.CreateAssessment(&assessment)
@@ -67,7 +97,27 @@ func (s *assessmentService) CreateAssessment(c *gin.Context, topic string) (*mod
 		return nil, nil, err
 	}
 
-	return &assessment, questions, nil
+	return &assessment, toLearnerQuestion(question), nil
+}
+
+// GetSkillEstimates returns the user's ability estimate for every topic they have been assessed on.
+func (s *assessmentService) GetSkillEstimates(userID uint) ([]model.SkillEstimate, error) {
+	return s.assessmentRepo.GetSkillEstimates(userID)
+}
+
+// skillEstimatesByTopic returns the user's estimates, aged to the present.
+func (s *assessmentService) skillEstimatesByTopic(userID uint) (map[string]model.SkillEstimate, error) {
+	list, err := s.assessmentRepo.GetSkillEstimates(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	estimates := make(map[string]model.SkillEstimate, len(list))
+	for _, est := range list {
+		ageEstimate(&est, now)
+		estimates[est.Topic] = est
+	}
+	return estimates, nil
 }
 
 // GetAssessments - Fetch all assessments
@@ -75,68 +125,183 @@ func (s *assessmentService) GetAssessments() ([]model.Assessment, error) {
 	return s.assessmentRepo.GetAssessments()
 }
 
-// GetAssessmentBySessionID - Fetch a specific assessment by session ID
-func (s *assessmentService) GetAssessmentBySessionID(sessionID string) (*model.Assessment, error) {
-	return s.assessmentRepo.GetAssessmentBySessionID(sessionID)
+// GetAssessmentBySessionID - Fetch the learner's view of one of their assessments
+func (s *assessmentService) GetAssessmentBySessionID(userID uint, sessionID string) (*model.AssessmentView, error) {
+	assessment, err := s.ownAssessment(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	answers, err := s.assessmentRepo.GetAnswersByAssessmentID(assessment.ID)
+	if err != nil {
+		return nil, err
+	}
+	return toAssessmentView(assessment, answers), nil
 }
 
-func (s *assessmentService) SaveAnswer(answer *model.Answer) (*model.AnswerResponse, error) {
-	// Fetch the assessment
-	assessment, err := s.assessmentRepo.GetAssessmentBySessionID(answer.SessionID)
+// SubmitAnswer grades an answer to the session's current question. Each
+// question takes one scored answer; with MAX_RETRIES set, a wrong answer may
+// be followed by further attempts that get feedback but are not scored.
+func (s *assessmentService) SubmitAnswer(userID uint, sessionID string, questionID uint, text string) (*model.AnswerResponse, error) {
+	now := time.Now()
+	assessment, err := s.ownAssessment(userID, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("assessment not found")
+		return nil, err
+	}
+	switch assessment.Status {
+	case AssessmentOngoing:
+	case AssessmentExpired:
+		return nil, ErrAssessmentExpired
+	default:
+		return nil, ErrAssessmentClosed
+	}
+	if questionID != assessment.CurrentQuestionID {
+		for _, q := range assessment.Questions {
+			if q.ID == questionID {
+				return nil, ErrAlreadyAnswered
+			}
+		}
+		return nil, ErrNotCurrentQuestion
 	}
 
 	// Fetch the question
-	question, err := s.assessmentRepo.GetQuestionByID(answer.QuestionID)
+	question, err := s.assessmentRepo.GetQuestionByID(questionID)
 	if err != nil {
 		return nil, fmt.Errorf("question not found")
 	}
-
-	// Extract question text based on type
-	var questionText string
-	if question.QuestionType == "masked" {
-		questionText = question.MaskedSentence
-	} else if question.QuestionType == "error_correction" {
-		questionText = question.ErrorSentence
-	} else {
-		return nil, fmt.Errorf("unknown question type: %s", question.QuestionType)
+	attempts, err := s.assessmentRepo.CountAttempts(assessment.ID, questionID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Evaluate the answer using LLM
-	isCorrect, feedback, err := s.ollamaClient.EvaluateAnswer(questionText, answer.Answer, question.CorrectAnswer)
-	if err != nil {
+	// Grade the answer with the strategy for the question's type, unless
+	// the question's time limit has run out
+	limits := assessmentLimits()
+	var result GradeResult
+	if due := assessment.QuestionDueAt; due != nil && now.After(due.Add(timeGrace)) {
+		result = incorrectResult(question.CorrectAnswer, GradedTimeout,
+			fmt.Sprintf("answered %s after the question was served", now.Sub(assessment.QuestionServedAt).Round(time.Second)))
+		result.Feedback = "Time is up. " + result.Feedback
+	} else if result, err = gradeAnswer(s.ollamaClient, question, text); err != nil {
 		return nil, err
 	}
+	isCorrect, feedback := result.Correct, result.Feedback
 
 	// Save the answer result
-	answer.IsCorrect = isCorrect
-	answer.Feedback = feedback
-	err = s.assessmentRepo.SaveAnswer(answer)
+	answer := &model.Answer{
+		AssessmentID: assessment.ID,
+		SessionID:    assessment.SessionID,
+		QuestionID:   questionID,
+		UserID:       assessment.UserID,
+		Answer:       text,
+		Attempt:      attempts + 1,
+		IsCorrect:    isCorrect,
+		Score:        result.Score,
+		Feedback:     feedback,
+		GradedBy:     result.GradedBy,
+		GradeReason:  result.Reason,
+		ServedAt:     assessment.QuestionServedAt,
+	}
+	if err := s.assessmentRepo.SaveAnswer(answer); err != nil {
+		if errors.Is(err, repository.ErrDuplicateAnswer) {
+			return nil, ErrAlreadyAnswered
+		}
+		return nil, err
+	}
+	// A missed question becomes a spaced-repetition review card.
+	if answer.Attempt == 1 && !isCorrect && result.GradedBy != GradedFallback {
+		event_bus.GlobalEventBus.Publish("answer_incorrect", *answer)
+	}
+
+	estimates, err := s.skillEstimatesByTopic(assessment.UserID)
 	if err != nil {
 		return nil, err
 	}
+	// Estimates are kept per topic; placement sessions span several topics.
+	estimate, ok := estimates[question.Category]
+	if !ok {
+		prior, err := s.userPrior(assessment.UserID)
+		if err != nil {
+			return nil, err
+		}
+		estimate = newSkillEstimate(assessment.UserID, question.Category, prior)
+	}
+
+	// Only the first attempt is scored. It updates the skill estimate and
+	// the question's difficulty, each from the other's value before this
+	// answer. A fallback verdict says nothing about either, so it is left out.
+	if answer.Attempt == 1 {
+		if isCorrect {
+			assessment.Score += 1 // Increment score for correct answers
+		}
+		if result.GradedBy != GradedFallback {
+			difficulty := question.Difficulty
+			updateDifficulty(question, estimate.Ability, isCorrect)
+			updateAbility(&estimate, difficulty, isCorrect, time.Now())
+			if err := s.assessmentRepo.SaveSkillEstimate(&estimate); err != nil {
+				return nil, err
+			}
+			if err := s.assessmentRepo.UpdateQuestionDifficulty(question.ID, question.Difficulty, question.Attempts); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	// Update assessment score
-	if isCorrect {
-		assessment.Score += 1 // Increment score for correct answers
+	response := &model.AnswerResponse{
+		IsCorrect: isCorrect,
+		Score:     result.Score,
+		Feedback:  feedback,
+		GradedBy:  result.GradedBy,
+		Attempt:   answer.Attempt,
+		Ability:   estimate.Ability,
+		StdError:  estimate.StdError,
+	}
+	if !isCorrect && result.GradedBy != GradedTimeout {
+		response.AttemptsLeft = max(limits.MaxRetries+1-answer.Attempt, 0)
+	}
+	if response.AttemptsLeft > 0 {
+		// The same question stays current, and its clock keeps running.
+		withholdFeedback(response)
+		return response, s.assessmentRepo.UpdateAssessment(assessment)
 	}
 
-	// Check if all questions have been answered
 	answeredCount, err := s.assessmentRepo.CountAnswersByAssessmentID(assessment.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	// If all questions are answered, mark assessment as completed
-	if answeredCount >= len(assessment.Questions) {
-		assessment.Status = "completed"
-
-		// Mark user as having completed assessment
-		err = s.assessmentRepo.MarkUserAssessmentCompleted(assessment.UserID)
+	// Serve the most informative remaining question, or finish once the
+	// estimate is precise enough or the topic has run out of questions.
+	// Placement tests instead cover every topic in turn.
+	var next *model.Question
+	if assessment.Kind == AssessmentPlacement {
+		estimates[question.Category] = estimate
+		if next, err = s.nextPlacementQuestion(assessment, estimates, placementPrior(estimates)); err != nil {
+			return nil, err
+		}
+	} else if !sessionDone(answeredCount, estimate) {
+		questions, err := s.assessmentRepo.GetQuestionsByCategory(assessment.Category)
 		if err != nil {
 			return nil, err
 		}
+		used := make(map[uint]bool, len(assessment.Questions))
+		for _, q := range assessment.Questions {
+			used[q.ID] = true
+		}
+		next = pickQuestion(questions, used, estimate.Ability)
+	}
+	assessment.CurrentQuestionIndex++
+	if next != nil {
+		if err := s.assessmentRepo.AddAssessmentQuestion(assessment, next); err != nil {
+			return nil, err
+		}
+		serveQuestion(assessment, next, now, limits)
+	} else {
+		endAssessment(assessment, AssessmentCompleted, now)
+		if assessment.Kind == AssessmentPlacement {
+			if response.Level, err = s.completePlacement(assessment, now); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Save updated assessment
@@ -145,8 +310,25 @@ func (s *assessmentService) SaveAnswer(answer *model.Answer) (*model.AnswerRespo
 		return nil, err
 	}
 
-	return &model.AnswerResponse{
-		IsCorrect: isCorrect,
-		Feedback:  feedback,
-	}, nil
+	response.Completed = next == nil
+	response.NextQuestion = toLearnerQuestion(next)
+	if !response.Completed {
+		withholdFeedback(response)
+	}
+	return response, nil
+}
+
+// withholdFeedback replaces feedback on a wrong answer, which may name the
+// correct answer, while the session is open. It is shown in the review.
+func withholdFeedback(response *model.AnswerResponse) {
+	if response.IsCorrect || response.GradedBy == GradedLength {
+		return
+	}
+	response.Feedback = "Incorrect."
+	if response.GradedBy == GradedTimeout {
+		response.Feedback = "Time is up."
+	}
+	if response.AttemptsLeft > 0 {
+		response.Feedback += " Try again."
+	}
 }
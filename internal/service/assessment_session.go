@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+)
+
+// Assessment session states.
+const (
+	AssessmentOngoing   = "ongoing"
+	AssessmentCompleted = "completed"
+	AssessmentAbandoned = "abandoned"
+	AssessmentExpired   = "expired"
+)
+
+var (
+	ErrAssessmentNotFound = errors.New("assessment not found")
+	ErrAssessmentClosed   = errors.New("assessment is no longer open")
+	ErrAssessmentExpired  = errors.New("assessment time limit has passed")
+	ErrNotCurrentQuestion = errors.New("question is not the current question of this assessment")
+	ErrAlreadyAnswered    = errors.New("question has already been answered")
+)
+
+// timeGrace allows for network latency when enforcing time limits.
+const timeGrace = 5 * time.Second
+
+// assessmentLimits returns the configured time limits and retry policy.
+func assessmentLimits() config.AssessmentConfig {
+	if cfg := config.GetConfig(); cfg != nil {
+		return cfg.Assessment
+	}
+	return config.AssessmentConfig{}
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// serveQuestion makes q the question to be answered next and starts its clock.
+func serveQuestion(a *model.Assessment, q *model.Question, now time.Time, limits config.AssessmentConfig) {
+	a.CurrentQuestionID = q.ID
+	a.QuestionServedAt = now
+	a.QuestionDueAt = nil
+	if limits.QuestionTimeLimit > 0 {
+		due := now.Add(seconds(limits.QuestionTimeLimit))
+		if a.ExpiresAt != nil && a.ExpiresAt.Before(due) {
+			due = *a.ExpiresAt
+		}
+		a.QuestionDueAt = &due
+	}
+}
+
+// endAssessment closes a session in the given state.
+func endAssessment(a *model.Assessment, status string, now time.Time) {
+	a.Status = status
+	a.EndedAt = &now
+	a.CurrentQuestionID = 0
+	a.QuestionDueAt = nil
+}
+
+// ownAssessment loads a session belonging to the user. Sessions of other
+// users are reported as not found.
+func (s *assessmentService) ownAssessment(userID uint, sessionID string) (*model.Assessment, error) {
+	assessment, err := s.assessmentRepo.GetAssessmentBySessionID(sessionID)
+	if err != nil || assessment.UserID != userID {
+		return nil, ErrAssessmentNotFound
+	}
+	return assessment, s.closeIfExpired(assessment, time.Now())
+}
+
+// closeIfExpired marks an ongoing session as expired once its time limit
+// has passed, without waiting for the sweeper.
+func (s *assessmentService) closeIfExpired(a *model.Assessment, now time.Time) error {
+	if a.Status != AssessmentOngoing || a.ExpiresAt == nil || !now.After(a.ExpiresAt.Add(timeGrace)) {
+		return nil
+	}
+	endAssessment(a, AssessmentExpired, *a.ExpiresAt)
+	return s.assessmentRepo.UpdateAssessment(a)
+}
+
+// AbandonAssessment lets the user end an ongoing session early.
+func (s *assessmentService) AbandonAssessment(userID uint, sessionID string) (*model.Assessment, error) {
+	assessment, err := s.ownAssessment(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	switch assessment.Status {
+	case AssessmentOngoing:
+	case AssessmentExpired:
+		return nil, ErrAssessmentExpired
+	default:
+		return nil, ErrAssessmentClosed
+	}
+	endAssessment(assessment, AssessmentAbandoned, time.Now())
+	if err := s.assessmentRepo.UpdateAssessment(assessment); err != nil {
+		return nil, err
+	}
+	return assessment, nil
+}
+
+// StartAssessmentSweeper periodically expires sessions past their time
+// limit and abandons sessions left idle for longer than ABANDON_AFTER.
+func StartAssessmentSweeper(assessmentRepo repository.AssessmentRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			sweepAssessments(assessmentRepo, now)
+		}
+	}()
+}
+
+func sweepAssessments(assessmentRepo repository.AssessmentRepository, now time.Time) {
+	if n, err := assessmentRepo.ExpireAssessments(now.Add(-timeGrace)); err != nil {
+		log.Printf("Failed to expire assessments: %v", err)
+	} else if n > 0 {
+		log.Printf("Expired %d assessment sessions", n)
+	}
+	after := assessmentLimits().AbandonAfter
+	if after <= 0 {
+		return
+	}
+	if n, err := assessmentRepo.AbandonIdleAssessments(now.Add(-seconds(after))); err != nil {
+		log.Printf("Failed to abandon idle assessments: %v", err)
+	} else if n > 0 {
+		log.Printf("Abandoned %d idle assessment sessions", n)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"sort"
+
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// ErrReviewUnavailable is returned when reviewing a session that has not been completed.
+var ErrReviewUnavailable = errors.New("review is available once the assessment is completed")
+
+// GetAssessmentReview lists each question of a completed session with its
+// correct answer and the user's answers and feedback.
+func (s *assessmentService) GetAssessmentReview(userID uint, sessionID string) (*model.AssessmentReview, error) {
+	assessment, err := s.ownAssessment(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if assessment.Status != AssessmentCompleted {
+		return nil, ErrReviewUnavailable
+	}
+	answers, err := s.assessmentRepo.GetAnswersByAssessmentID(assessment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make(map[uint][]model.ReviewAttempt)
+	for _, a := range answers {
+		attempts[a.QuestionID] = append(attempts[a.QuestionID], model.ReviewAttempt{
+			Attempt:   a.Attempt,
+			Answer:    a.Answer,
+			IsCorrect: a.IsCorrect,
+			Score:     a.Score,
+			Feedback:  a.Feedback,
+			GradedBy:  a.GradedBy,
+			CreatedAt: a.CreatedAt,
+		})
+	}
+	review := &model.AssessmentReview{
+		SessionID: assessment.SessionID,
+		Title:     assessment.Title,
+		Category:  assessment.Category,
+		Score:     assessment.Score,
+		Total:     len(assessment.Questions),
+		EndedAt:   assessment.EndedAt,
+		Items:     make([]model.ReviewItem, 0, len(assessment.Questions)),
+	}
+	for _, q := range servedOrder(assessment.Questions, answers) {
+		review.Items = append(review.Items, model.ReviewItem{
+			Question:      *toLearnerQuestion(&q),
+			CorrectAnswer: q.CorrectAnswer,
+			Alternatives:  questionAlternatives(&q),
+			Attempts:      attempts[q.ID],
+		})
+	}
+	return review, nil
+}
+
+// toAssessmentView builds the learner's view of a session.
+func toAssessmentView(a *model.Assessment, answers []model.Answer) *model.AssessmentView {
+	view := &model.AssessmentView{
+		SessionID:            a.SessionID,
+		Title:                a.Title,
+		Description:          a.Description,
+		Category:             a.Category,
+		Kind:                 a.Kind,
+		Status:               a.Status,
+		Score:                a.Score,
+		CurrentQuestionIndex: a.CurrentQuestionIndex,
+		QuestionDueAt:        a.QuestionDueAt,
+		ExpiresAt:            a.ExpiresAt,
+		EndedAt:              a.EndedAt,
+		ReviewAvailable:      a.Status == AssessmentCompleted,
+		Questions:            make([]model.LearnerQuestion, 0, len(a.Questions)),
+		Answers:              make([]model.LearnerAnswer, 0, len(answers)),
+		CreatedAt:            a.CreatedAt,
+	}
+	for _, q := range servedOrder(a.Questions, answers) {
+		lq := toLearnerQuestion(&q)
+		view.Questions = append(view.Questions, *lq)
+		if q.ID == a.CurrentQuestionID {
+			view.CurrentQuestion = lq
+		}
+	}
+	for _, ans := range answers {
+		view.Answers = append(view.Answers, model.LearnerAnswer{
+			QuestionID: ans.QuestionID,
+			Attempt:    ans.Attempt,
+			Answer:     ans.Answer,
+			IsCorrect:  ans.IsCorrect,
+			Score:      ans.Score,
+			CreatedAt:  ans.CreatedAt,
+		})
+	}
+	return view
+}
+
+// servedOrder sorts a session's questions by when they were first answered,
+// which is the order they were served in; unanswered ones come last.
+func servedOrder(questions []model.Question, answers []model.Answer) []model.Question {
+	first := make(map[uint]int, len(answers))
+	for i, a := range answers {
+		if _, ok := first[a.QuestionID]; !ok {
+			first[a.QuestionID] = i
+		}
+	}
+	ordered := append([]model.Question(nil), questions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		fi, oki := first[ordered[i].ID]
+		fj, okj := first[ordered[j].ID]
+		if oki != okj {
+			return oki
+		}
+		return fi < fj
+	})
+	return ordered
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"testing"
+
+	"inkwell-backend-V2.0/internal/model"
+)
+
+func TestAssessmentViewKind(t *testing.T) {
+	for _, kind := range []string{AssessmentPractice, AssessmentPlacement} {
+		view := toAssessmentView(&model.Assessment{Kind: kind}, nil)
+		if view.Kind != kind {
+			t.Errorf("view kind = %q, want %q", view.Kind, kind)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+const (
+	recoveryCodeCount   = 10
+	defaultChallengeTTL = 5 * time.Minute
+	defaultMFAIssuer    = "Inkwell"
+)
+
+var (
+	ErrInvalidMFAToken   = errors.New("invalid or expired MFA token")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+	ErrMFANotEnrolled    = errors.New("two-factor authentication is not set up")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFARequired       = errors.New("two-factor authentication is required for your role")
+)
+
+// MFACodeInput is the second factor: a code from the authenticator app or a recovery code.
+type MFACodeInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MFASetup is what the user adds to their authenticator app, usually by
+// scanning the URI as a QR code.
+type MFASetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFAStatus describes a user's two-factor setup.
+type MFAStatus struct {
+	Enabled           bool  `json:"enabled"`
+	Required          bool  `json:"required"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+func mfaConfig() config.MFAConfig {
+	if cfg := config.GetConfig(); cfg != nil {
+		return cfg.Authentication.MFA
+	}
+	return config.MFAConfig{}
+}
+
+// mfaRequiredFor reports whether users with the role must use two-factor authentication.
+func mfaRequiredFor(role string) bool {
+	for _, required := range mfaConfig().RequiredRoles {
+		if strings.EqualFold(strings.TrimSpace(required), role) {
+			return true
+		}
+	}
+	return false
+}
+
+func challengeTTL() time.Duration {
+	if m := mfaConfig().ChallengeMinutes; m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return defaultChallengeTTL
+}
+
+// mfaChallenge returns the response for a login that still needs its
+// second factor, or nil if the user does not use two-factor authentication.
+// Users whose role requires it but who have not enrolled are asked to enrol.
+func (s *authService) mfaChallenge(user *model.User) (*LoginResponse, error) {
+	factor, err := s.mfaRepo.GetFactor(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	enabled := factor != nil && factor.ConfirmedAt != nil
+	if !enabled && !mfaRequiredFor(user.Role) {
+		return nil, nil
+	}
+	token, err := utilities.GenerateMFAToken(user, challengeTTL())
+	if err != nil {
+		return nil, errors.New("failed to generate tokens")
+	}
+	return &LoginResponse{MFARequired: true, MFAEnrollmentRequired: !enabled, MFAToken: token}, nil
+}
+
+func (s *authService) challengeUser(mfaToken string) (*model.User, error) {
+	claims, err := utilities.ValidateMFAToken(mfaToken)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	user, err := s.userRepo.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	return user, nil
+}
+
+// VerifyMFA completes a login with the second factor. For a user enrolling
+// during login, the code confirms the new authenticator and the response
+// carries the recovery codes.
+func (s *authService) VerifyMFA(mfaToken string, input MFACodeInput, client ClientInfo) (*LoginResponse, error) {
+	user, err := s.challengeUser(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	factor, err := s.mfaRepo.GetFactor(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if factor == nil {
+		return nil, ErrMFANotEnrolled
+	}
+
+	var recoveryCodes []string
+	if factor.ConfirmedAt == nil {
+		recoveryCodes, err = s.confirmFactor(user, factor, input.Code, client)
+	} else {
+		err = s.checkSecondFactor(user, factor, input, client)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.startSession(user, client)
+	if err != nil {
+		return nil, err
+	}
+	s.recordLoginAttempt(normalizeEmail(user.Email), user, client, "")
+	response.RecoveryCodes = recoveryCodes
+	return response, nil
+}
+
+// StartMFAEnrollment creates an authenticator for a user whose role
+// requires two-factor authentication, during login.
+func (s *authService) StartMFAEnrollment(mfaToken string) (*MFASetup, error) {
+	user, err := s.challengeUser(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.newFactor(user)
+}
+
+// SetupMFA creates an authenticator for a logged-in user. It stays
+// inactive until confirmed with a code.
+func (s *authService) SetupMFA(userID uint) (*MFASetup, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.newFactor(user)
+}
+
+func (s *authService) newFactor(user *model.User) (*MFASetup, error) {
+	factor, err := s.mfaRepo.GetFactor(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if factor != nil && factor.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := utilities.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := utilities.SealSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.SaveFactor(&model.TOTPFactor{UserID: user.ID, Secret: sealed, CreatedAt: time.Now()}); err != nil {
+		return nil, err
+	}
+	issuer := mfaConfig().Issuer
+	if issuer == "" {
+		issuer = defaultMFAIssuer
+	}
+	return &MFASetup{Secret: secret, URI: utilities.TOTPURI(issuer, user.Email, secret)}, nil
+}
+
+// ConfirmMFA enables the user's new authenticator with a first code and
+// returns their recovery codes, which are shown only once.
+func (s *authService) ConfirmMFA(userID uint, code string, client ClientInfo) ([]string, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	factor, err := s.mfaRepo.GetFactor(userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor == nil {
+		return nil, ErrMFANotEnrolled
+	}
+	if factor.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	return s.confirmFactor(user, factor, code, client)
+}
+
+func (s *authService) confirmFactor(user *model.User, factor *model.TOTPFactor, code string, client ClientInfo) ([]string, error) {
+	key := normalizeEmail(user.Email)
+	var step int64
+	err := s.serializeLogin(key, func() error {
+		if err := s.checkLoginThrottle(key, client.IP, time.Now()); err != nil {
+			return err
+		}
+		secret, err := utilities.OpenSecret(factor.Secret)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if step, ok = utilities.ValidateTOTP(secret, code, time.Now()); !ok {
+			s.recordLoginAttempt(key, user, client, model.LoginFailedMFA)
+			return ErrInvalidMFACode
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	confirmed, err := s.mfaRepo.ConfirmFactor(user.ID, step, time.Now(), hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		return nil, ErrInvalidMFACode
+	}
+	log.Printf("User %d enabled two-factor authentication", user.ID)
+	return codes, nil
+}
+
+// checkSecondFactor verifies a code from the authenticator, which may not
+// be reused, or spends a recovery code. Wrong codes count as failed logins.
+func (s *authService) checkSecondFactor(user *model.User, factor *model.TOTPFactor, input MFACodeInput, client ClientInfo) error {
+	key := normalizeEmail(user.Email)
+	return s.serializeLogin(key, func() error {
+		if err := s.checkLoginThrottle(key, client.IP, time.Now()); err != nil {
+			return err
+		}
+		ok, err := s.matchSecondFactor(user, factor, input)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			s.recordLoginAttempt(key, user, client, model.LoginFailedMFA)
+			return ErrInvalidMFACode
+		}
+		return nil
+	})
+}
+
+func (s *authService) matchSecondFactor(user *model.User, factor *model.TOTPFactor, input MFACodeInput) (bool, error) {
+	if input.RecoveryCode != "" {
+		used, err := s.mfaRepo.UseRecoveryCode(user.ID, utilities.HashOpaqueToken(normalizeRecoveryCode(input.RecoveryCode)))
+		if used {
+			log.Printf("User %d logged in with a recovery code", user.ID)
+		}
+		return used, err
+	}
+	secret, err := utilities.OpenSecret(factor.Secret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := utilities.ValidateTOTP(secret, input.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.mfaRepo.UseStep(user.ID, step)
+}
+
+// DisableMFA removes the user's authenticator after checking a code. It is
+// refused for roles that require two-factor authentication.
+func (s *authService) DisableMFA(userID uint, input MFACodeInput, client ClientInfo) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if mfaRequiredFor(user.Role) {
+		return ErrMFARequired
+	}
+	factor, err := s.mfaRepo.GetFactor(userID)
+	if err != nil {
+		return err
+	}
+	if factor == nil {
+		return ErrMFANotEnrolled
+	}
+	if factor.ConfirmedAt != nil {
+		if err := s.checkSecondFactor(user, factor, input, client); err != nil {
+			return err
+		}
+	}
+	log.Printf("User %d disabled two-factor authentication", userID)
+	return s.mfaRepo.DeleteFactor(userID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after
+// checking a code from the authenticator.
+func (s *authService) RegenerateRecoveryCodes(userID uint, code string, client ClientInfo) ([]string, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	factor, err := s.mfaRepo.GetFactor(userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor == nil || factor.ConfirmedAt == nil {
+		return nil, ErrMFANotEnrolled
+	}
+	if err := s.checkSecondFactor(user, factor, MFACodeInput{Code: code}, client); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *authService) GetMFAStatus(userID uint) (*MFAStatus, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	factor, err := s.mfaRepo.GetFactor(userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{Enabled: factor != nil && factor.ConfirmedAt != nil, Required: mfaRequiredFor(user.Role)}
+	if status.Enabled {
+		if status.RecoveryCodesLeft, err = s.mfaRepo.CountRecoveryCodes(userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns fresh recovery codes, formatted as
+// xxxx-xxxx-xxxx-xxxx, and the hashes to store.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+		hashes = append(hashes, utilities.HashOpaqueToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes with or without dashes and in any case.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+// memMFARepo keeps one user's factor and recovery codes in memory, with the
+// same replay rules as the database repository.
+type memMFARepo struct {
+	repository.MFARepository
+	factor *model.TOTPFactor
+	codes  []model.RecoveryCode
+}
+
+func (r *memMFARepo) UseStep(userID uint, step int64) (bool, error) {
+	if r.factor.LastUsedStep >= step {
+		return false, nil
+	}
+	r.factor.LastUsedStep = step
+	return true, nil
+}
+
+func (r *memMFARepo) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	for i := range r.codes {
+		if r.codes[i].CodeHash == codeHash && r.codes[i].UsedAt == nil {
+			now := time.Now()
+			r.codes[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// totpAt computes the code for a time step independently of utilities.
+func totpAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1000000)
+}
+
+func newMFATestService(t *testing.T) (*authService, *memMFARepo, string) {
+	t.Helper()
+	initTestAuth(t)
+	secret, err := utilities.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	repo := &memMFARepo{factor: &model.TOTPFactor{UserID: 1, Secret: secret, ConfirmedAt: &now}}
+	return &authService{mfaRepo: repo}, repo, secret
+}
+
+// A code is accepted once; neither it nor a code of an earlier step works again.
+func TestMatchSecondFactorRejectsReplay(t *testing.T) {
+	s, repo, secret := newMFATestService(t)
+	user := &model.User{ID: 1}
+	step := time.Now().Unix() / 30
+	previous, current := totpAt(t, secret, step-1), totpAt(t, secret, step)
+
+	if ok, err := s.matchSecondFactor(user, repo.factor, MFACodeInput{Code: current}); !ok || err != nil {
+		t.Fatalf("fresh code: %v, %v", ok, err)
+	}
+	if repo.factor.LastUsedStep != step {
+		t.Errorf("last used step %d, want %d", repo.factor.LastUsedStep, step)
+	}
+	if ok, _ := s.matchSecondFactor(user, repo.factor, MFACodeInput{Code: current}); ok {
+		t.Error("replayed code accepted")
+	}
+	if ok, _ := s.matchSecondFactor(user, repo.factor, MFACodeInput{Code: previous}); ok {
+		t.Error("code of an earlier step accepted after a later one")
+	}
+	if ok, _ := s.matchSecondFactor(user, repo.factor, MFACodeInput{Code: totpAt(t, secret, step+5)}); ok {
+		t.Error("code far in the future accepted")
+	}
+}
+
+var recoveryCodeFormat = regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`)
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	s, repo, _ := newMFATestService(t)
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("%d codes, %d hashes", len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if !recoveryCodeFormat.MatchString(code) || seen[code] {
+			t.Errorf("code %q is malformed or repeated", code)
+		}
+		seen[code] = true
+		if hashes[i] != utilities.HashOpaqueToken(normalizeRecoveryCode(code)) {
+			t.Errorf("hash of code %d does not match", i)
+		}
+		repo.codes = append(repo.codes, model.RecoveryCode{UserID: 1, CodeHash: hashes[i]})
+	}
+
+	user := &model.User{ID: 1}
+	typed := " " + strings.ToUpper(strings.ReplaceAll(codes[0], "-", "")) + " "
+	if ok, err := s.matchSecondFactor(user, repo.factor, MFACodeInput{RecoveryCode: typed}); !ok || err != nil {
+		t.Fatalf("recovery code typed without dashes in capitals: %v, %v", ok, err)
+	}
+	if ok, _ := s.matchSecondFactor(user, repo.factor, MFACodeInput{RecoveryCode: codes[0]}); ok {
+		t.Error("recovery code accepted twice")
+	}
+	if ok, _ := s.matchSecondFactor(user, repo.factor, MFACodeInput{RecoveryCode: "aaaa-bbbb-cccc-dddd"}); ok {
+		t.Error("made-up recovery code accepted")
+	}
+	if ok, _ := s.matchSecondFactor(user, repo.factor, MFACodeInput{RecoveryCode: codes[1]}); !ok {
+		t.Error("second recovery code rejected")
+	}
+}
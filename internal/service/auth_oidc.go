@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/oidc"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider      = errors.New("unknown login provider")
+	ErrInvalidOIDCState     = errors.New("invalid or expired login state; start the login again")
+	ErrOIDCLoginFailed      = errors.New("login with the provider failed")
+	ErrOIDCEmailMissing     = errors.New("the provider did not share an email address")
+	ErrOIDCEmailUnverified  = errors.New("the provider has not verified this email address")
+	ErrOIDCDomainNotAllowed = errors.New("email addresses from this domain cannot log in with this provider")
+	ErrOIDCSignupDisabled   = errors.New("no account exists for this email address")
+)
+
+// ListOIDCProviders returns the providers users can log in with.
+func (s *authService) ListOIDCProviders() []oidc.ProviderInfo {
+	return s.oidc.List()
+}
+
+// StartOIDCLogin stores a login state and returns the provider URL to send
+// the user to. The state, nonce and PKCE verifier stay on the server. The
+// returned binding stays in the browser that started the login and must be
+// presented to complete it, so that a victim cannot be logged in to an
+// account with a code and state from someone else's login.
+func (s *authService) StartOIDCLogin(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := s.oidc.Provider(providerName)
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err := provider.AuthorizationURL(ctx, req)
+	if err != nil {
+		log.Printf("OIDC provider %s unavailable: %v", provider.Name(), err)
+		return "", "", ErrOIDCLoginFailed
+	}
+	binding, bindingHash, err := utilities.NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	state := &model.OIDCLoginState{
+		State:        req.State,
+		Provider:     provider.Name(),
+		Nonce:        req.Nonce,
+		CodeVerifier: req.CodeVerifier,
+		BindingHash:  bindingHash,
+		ExpiresAt:    now.Add(oidcStateTTL),
+	}
+	if err := s.oidcRepo.SaveState(state); err != nil {
+		return "", "", err
+	}
+	if _, err := s.oidcRepo.DeleteExpiredStates(now); err != nil {
+		log.Printf("Failed to delete expired OIDC login states: %v", err)
+	}
+	return authURL, binding, nil
+}
+
+// CompleteOIDCLogin finishes a login when the provider sends the user back
+// with a code. The user is found by their linked identity, else linked by
+// verified email address, else created when the provider allows signup.
+func (s *authService) CompleteOIDCLogin(ctx context.Context, code, state, binding string, client ClientInfo) (*LoginResponse, error) {
+	st, err := s.oidcRepo.ConsumeState(state)
+	if err != nil || st == nil || time.Now().After(st.ExpiresAt) || !oidcBindingMatches(st, binding) {
+		return nil, ErrInvalidOIDCState
+	}
+	provider, ok := s.oidc.Provider(st.Provider)
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	claims, err := provider.Exchange(ctx, code, st.CodeVerifier, st.Nonce)
+	if err != nil {
+		log.Printf("OIDC login with %s failed: %v", provider.Name(), err)
+		return nil, ErrOIDCLoginFailed
+	}
+
+	key := normalizeEmail(claims.Email)
+	user, err := s.oidcUser(provider, claims)
+	if err != nil {
+		if key != "" {
+			s.recordLoginAttempt(key, nil, client, model.LoginFailedOIDC)
+		}
+		return nil, err
+	}
+	challenge, err := s.mfaChallenge(user)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		s.recordLoginAttempt(key, user, client, model.LoginMFAPending)
+		return challenge, nil
+	}
+	response, err := s.startSession(user, client)
+	if err == nil {
+		s.recordLoginAttempt(key, user, client, "")
+	}
+	return response, err
+}
+
+// oidcBindingMatches reports whether binding is the secret the login was
+// started with. States saved without one never match.
+func oidcBindingMatches(st *model.OIDCLoginState, binding string) bool {
+	if binding == "" || st.BindingHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(utilities.HashOpaqueToken(binding)), []byte(st.BindingHash)) == 1
+}
+
+// oidcUser returns the user for a provider login, linking or creating the
+// account on first use.
+func (s *authService) oidcUser(provider *oidc.Provider, claims *oidc.Claims) (*model.User, error) {
+	email := normalizeEmail(claims.Email)
+	if email == "" {
+		return nil, ErrOIDCEmailMissing
+	}
+	if !emailDomainAllowed(email, provider.AllowedDomains()) {
+		return nil, ErrOIDCDomainNotAllowed
+	}
+	now := time.Now()
+
+	if identity, err := s.oidcRepo.GetIdentity(provider.Name(), claims.Subject); err == nil {
+		user, err := s.userRepo.GetUserByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.oidcRepo.TouchIdentity(identity.ID, email, now); err != nil {
+			log.Printf("Failed to update identity %d: %v", identity.ID, err)
+		}
+		return user, nil
+	}
+
+	// Linking or creating an account by email is only safe when the
+	// provider vouches for the address.
+	verified := provider.TrustEmail()
+	if claims.EmailVerified != nil {
+		verified = *claims.EmailVerified
+	}
+	if !verified {
+		return nil, ErrOIDCEmailUnverified
+	}
+
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil {
+		if !provider.AllowSignup() {
+			return nil, ErrOIDCSignupDisabled
+		}
+		user = &model.User{
+			Username:        oidcUsername(claims, email),
+			Email:           email,
+			FirstName:       claims.GivenName,
+			LastName:        claims.FamilyName,
+			Role:            model.RoleLearner,
+			EmailVerifiedAt: &now,
+		}
+		if err := s.userRepo.CreateUser(user); err != nil {
+			return nil, err
+		}
+		log.Printf("Created user %d from %s login", user.ID, provider.Name())
+	} else if user.EmailVerifiedAt == nil {
+		if err := s.userRepo.MarkEmailVerified(user.ID, now); err != nil {
+			return nil, err
+		}
+		user.EmailVerifiedAt = &now
+	}
+	promoteConfiguredAdmin(s.userRepo, user)
+
+	identity := &model.UserIdentity{
+		UserID:      user.ID,
+		Provider:    provider.Name(),
+		Subject:     claims.Subject,
+		Email:       email,
+		LastLoginAt: now,
+	}
+	if err := s.oidcRepo.CreateIdentity(identity); err != nil {
+		return nil, err
+	}
+	log.Printf("Linked %s identity to user %d", provider.Name(), user.ID)
+	return user, nil
+}
+
+// emailDomainAllowed reports whether the email's domain is in domains, or
+// domains is empty.
+func emailDomainAllowed(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, allowed := range domains {
+		if strings.EqualFold(strings.TrimSpace(allowed), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcUsername picks a username for an account created from a provider login.
+func oidcUsername(claims *oidc.Claims, email string) string {
+	if claims.PreferredUsername != "" && !strings.Contains(claims.PreferredUsername, "@") {
+		return claims.PreferredUsername
+	}
+	if claims.Name != "" {
+		return claims.Name
+	}
+	if at := strings.LastIndex(email, "@"); at > 0 {
+		return email[:at]
+	}
+	return email
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/oidc"
+	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+// memOIDCRepo keeps login states in memory.
+type memOIDCRepo struct {
+	repository.OIDCRepository
+	states map[string]*model.OIDCLoginState
+}
+
+func (r *memOIDCRepo) ConsumeState(state string) (*model.OIDCLoginState, error) {
+	st, ok := r.states[state]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	delete(r.states, state)
+	return st, nil
+}
+
+// A code and state can only complete the login in the browser that started
+// it, which holds the binding.
+func TestCompleteOIDCLoginRequiresBinding(t *testing.T) {
+	binding, hash, err := utilities.NewOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers, err := oidc.NewRegistry(config.OIDCConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newState := func(bindingHash string) *model.OIDCLoginState {
+		return &model.OIDCLoginState{State: "state", Provider: "gone", BindingHash: bindingHash, ExpiresAt: time.Now().Add(time.Minute)}
+	}
+	tests := []struct {
+		name    string
+		state   *model.OIDCLoginState
+		binding string
+		want    error
+	}{
+		{"no binding", newState(hash), "", ErrInvalidOIDCState},
+		{"other binding", newState(hash), "attacker-binding", ErrInvalidOIDCState},
+		{"state without binding", newState(""), binding, ErrInvalidOIDCState},
+		// Past the state check, the login fails on the provider.
+		{"right binding", newState(hash), binding, ErrUnknownProvider},
+	}
+	for _, tt := range tests {
+		repo := &memOIDCRepo{states: map[string]*model.OIDCLoginState{"state": tt.state}}
+		s := &authService{oidcRepo: repo, oidc: providers}
+		if _, err := s.CompleteOIDCLogin(context.Background(), "code", "state", tt.binding, ClientInfo{}); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		if len(repo.states) != 0 {
+			t.Errorf("%s: state not used up", tt.name)
+		}
+	}
+}
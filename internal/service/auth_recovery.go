@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/mailer"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+// RevokedPasswordReset is the reason sessions end when the password is reset.
+const RevokedPasswordReset = "password_reset"
+
+const (
+	defaultVerifyTokenTTL = 48 * time.Hour
+	defaultResetTokenTTL  = time.Hour
+	defaultLinkBaseURL    = "http://localhost:3000"
+)
+
+var (
+	ErrInvalidAccountToken = errors.New("invalid or expired link")
+	ErrEmailNotVerified    = errors.New("email address not verified")
+	ErrEmptyPassword       = errors.New("password cannot be empty")
+)
+
+func mailConfig() config.MailConfig {
+	if cfg := config.GetConfig(); cfg != nil {
+		return cfg.Mail
+	}
+	return config.MailConfig{}
+}
+
+func verifyTokenTTL() time.Duration {
+	if h := mailConfig().VerifyTokenHours; h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return defaultVerifyTokenTTL
+}
+
+func resetTokenTTL() time.Duration {
+	if m := mailConfig().ResetTokenMinutes; m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return defaultResetTokenTTL
+}
+
+// accountLink builds the frontend link an emailed token is sent with.
+func accountLink(path, token string) string {
+	base := strings.TrimRight(mailConfig().LinkBaseURL, "/")
+	if base == "" {
+		base = defaultLinkBaseURL
+	}
+	return base + path + "?token=" + url.QueryEscape(token)
+}
+
+// formatTTL describes a validity period for an email, such as "48 hours".
+func formatTTL(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0 && d > time.Hour:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d == time.Hour:
+		return "1 hour"
+	default:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	}
+}
+
+func displayName(user *model.User) string {
+	if user.FirstName != "" {
+		return user.FirstName
+	}
+	if user.Username != "" {
+		return user.Username
+	}
+	return "there"
+}
+
+// checkEmailVerified refuses logins from unverified accounts when REQUIRE_VERIFIED_EMAIL is set.
+func checkEmailVerified(user *model.User) error {
+	if mailConfig().RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// sendAccountToken creates a token for the user and emails its link. The
+// mail is sent in the background so that the response time does not reveal
+// whether the account exists.
+func (s *authService) sendAccountToken(user *model.User, purpose string) error {
+	return sendAccountToken(s.tokenRepo, s.mailer, user, purpose, user.Email)
+}
+
+// sendAccountToken emails a token link for the purpose to the address to,
+// which is the user's own address except when changing it.
+func sendAccountToken(tokenRepo repository.AccountTokenRepository, mail mailer.Mailer, user *model.User, purpose, to string) error {
+	ttl, path, tmpl := verifyTokenTTL(), "/verify-email", mailer.TemplateVerifyEmail
+	switch purpose {
+	case model.TokenPurposeResetPassword:
+		ttl, path, tmpl = resetTokenTTL(), "/reset-password", mailer.TemplateResetPassword
+	case model.TokenPurposeChangeEmail:
+		path, tmpl = "/confirm-email", mailer.TemplateChangeEmail
+	}
+	token, hash, err := utilities.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := tokenRepo.CreateToken(&model.AccountToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+	msg, err := mailer.Render(tmpl, to, mailer.TemplateData{
+		Name:      displayName(user),
+		Link:      accountLink(path, token),
+		ExpiresIn: formatTTL(ttl),
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := mail.Send(msg); err != nil {
+			log.Printf("Failed to send %s email to user %d: %v", purpose, user.ID, err)
+		}
+	}()
+	return nil
+}
+
+// useAccountToken checks an emailed token and marks it as used.
+func (s *authService) useAccountToken(token, purpose string) (*model.AccountToken, error) {
+	return useAccountToken(s.tokenRepo, token, purpose)
+}
+
+func useAccountToken(tokenRepo repository.AccountTokenRepository, token, purpose string) (*model.AccountToken, error) {
+	if token == "" {
+		return nil, ErrInvalidAccountToken
+	}
+	stored, err := tokenRepo.GetTokenByHash(utilities.HashOpaqueToken(token))
+	if err != nil || stored.Purpose != purpose || stored.UsedAt != nil {
+		return nil, ErrInvalidAccountToken
+	}
+	now := time.Now()
+	if !now.Before(stored.ExpiresAt) {
+		return nil, ErrInvalidAccountToken
+	}
+	used, err := tokenRepo.UseToken(stored.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidAccountToken
+	}
+	return stored, nil
+}
+
+// RequestEmailVerification emails a new verification link. Unknown and
+// already verified addresses are ignored without an error, so the
+// response does not reveal which accounts exist.
+func (s *authService) RequestEmailVerification(email string) error {
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendAccountToken(user, model.TokenPurposeVerifyEmail)
+}
+
+// VerifyEmail confirms the address of the account a verification link was sent to.
+func (s *authService) VerifyEmail(token string) error {
+	stored, err := s.useAccountToken(token, model.TokenPurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.MarkEmailVerified(stored.UserID, time.Now()); err != nil {
+		return err
+	}
+	user, err := s.userRepo.GetUserByID(stored.UserID)
+	if err != nil {
+		return err
+	}
+	promoteConfiguredAdmin(s.userRepo, user)
+	return nil
+}
+
+// RequestPasswordReset emails a password reset link. Unknown addresses are
+// ignored without an error.
+func (s *authService) RequestPasswordReset(email string) error {
+	user, err := s.userRepo.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+	return s.sendAccountToken(user, model.TokenPurposeResetPassword)
+}
+
+// ResetPassword sets a new password with a reset link and ends all of the
+// user's sessions. Receiving the link also proves the email address.
+func (s *authService) ResetPassword(token, password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+	stored, err := s.useAccountToken(token, model.TokenPurposeResetPassword)
+	if err != nil {
+		return err
+	}
+	hash, err := utilities.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(stored.UserID, hash); err != nil {
+		return err
+	}
+	if err := s.userRepo.MarkEmailVerified(stored.UserID, time.Now()); err != nil {
+		log.Printf("Failed to mark email of user %d verified: %v", stored.UserID, err)
+	}
+	if err := s.tokenRepo.InvalidateTokens(stored.UserID, model.TokenPurposeResetPassword); err != nil {
+		log.Printf("Failed to invalidate reset tokens of user %d: %v", stored.UserID, err)
+	}
+	return s.sessionRepo.RevokeUserSessions(stored.UserID, RevokedPasswordReset)
+}
+
+// StartAccountTokenCleanup periodically deletes expired verification and reset tokens.
+func StartAccountTokenCleanup(tokenRepo repository.AccountTokenRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if n, err := tokenRepo.DeleteExpiredTokens(now); err != nil {
+				log.Printf("Failed to delete expired account tokens: %v", err)
+			} else if n > 0 {
+				log.Printf("Deleted %d expired account tokens", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"inkwell-backend-V2.0/internal/mailer"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+// memTokenRepo keeps account tokens in memory.
+type memTokenRepo struct {
+	repository.AccountTokenRepository
+	tokens []*model.AccountToken
+}
+
+func (r *memTokenRepo) CreateToken(token *model.AccountToken) error {
+	token.ID = uint(len(r.tokens) + 1)
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memTokenRepo) GetTokenByHash(hash string) (*model.AccountToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == hash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *memTokenRepo) UseToken(id uint, at time.Time) (bool, error) {
+	token := r.tokens[id-1]
+	if token.UsedAt != nil {
+		return false, nil
+	}
+	token.UsedAt = &at
+	return true, nil
+}
+
+// chanMailer hands sent messages to the test.
+type chanMailer chan mailer.Message
+
+func (m chanMailer) Send(msg mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=([A-Za-z0-9_%-]+)`)
+
+// The emailed token is stored only as its hash, and works once.
+func TestAccountTokenRoundTrip(t *testing.T) {
+	repo, mail := &memTokenRepo{}, make(chanMailer, 1)
+	user := &model.User{ID: 3, Email: "ann@example.com", Username: "ann"}
+	if err := sendAccountToken(repo, mail, user, model.TokenPurposeResetPassword, user.Email); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-mail
+	match := linkToken.FindStringSubmatch(msg.Text)
+	if msg.To != user.Email || match == nil {
+		t.Fatalf("mail to %s without a link: %q", msg.To, msg.Text)
+	}
+	token, _ := url.QueryUnescape(match[1])
+	if !strings.Contains(msg.Text, "/reset-password?token=") {
+		t.Errorf("link is not for a password reset: %q", msg.Text)
+	}
+
+	stored := repo.tokens[0]
+	if stored.TokenHash != utilities.HashOpaqueToken(token) || strings.Contains(stored.TokenHash, token) {
+		t.Errorf("stored %q for token %q", stored.TokenHash, token)
+	}
+	if ttl := stored.ExpiresAt.Sub(stored.CreatedAt); ttl != defaultResetTokenTTL {
+		t.Errorf("reset token valid for %v, want %v", ttl, defaultResetTokenTTL)
+	}
+
+	if _, err := useAccountToken(repo, token, model.TokenPurposeVerifyEmail); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("wrong purpose: %v", err)
+	}
+	used, err := useAccountToken(repo, token, model.TokenPurposeResetPassword)
+	if err != nil || used.UserID != user.ID {
+		t.Fatalf("first use: %+v, %v", used, err)
+	}
+	if _, err := useAccountToken(repo, token, model.TokenPurposeResetPassword); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Errorf("second use: %v", err)
+	}
+}
+
+func TestUseAccountTokenRejectsExpiredAndUnknown(t *testing.T) {
+	repo := &memTokenRepo{}
+	token, hash, _ := utilities.NewOpaqueToken()
+	_ = repo.CreateToken(&model.AccountToken{UserID: 1, Purpose: model.TokenPurposeVerifyEmail, TokenHash: hash,
+		ExpiresAt: time.Now().Add(-time.Second)})
+
+	for name, presented := range map[string]string{"expired": token, "unknown": "made-up", "empty": ""} {
+		if _, err := useAccountToken(repo, presented, model.TokenPurposeVerifyEmail); !errors.Is(err, ErrInvalidAccountToken) {
+			t.Errorf("%s token: %v", name, err)
+		}
+	}
+	if repo.tokens[0].UsedAt != nil {
+		t.Error("expired token was marked as used")
+	}
+}
@@ -1,130 +1,239 @@
 package service
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/mailer"
 	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/oidc"
 	"inkwell-backend-V2.0/internal/repository"
 	"inkwell-backend-V2.0/internal/utilities"
 )
 
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAuthHashDisabled   = errors.New("authhash login is disabled; send the password instead")
+)
+
 // AuthService interface
 type AuthService interface {
 	Register(user *model.User) error
-	Login(username, authhash string) (*LoginResponse, error)
-	RefreshTokens(refreshToken string) (*TokenResponse, error)
+	Login(email, password string, client ClientInfo) (*LoginResponse, error)
+	LoginWithAuthHash(email, authhash string, client ClientInfo) (*LoginResponse, error)
+	RefreshTokens(refreshToken string, client ClientInfo) (*TokenResponse, error)
+	Logout(userID uint, sessionID string) error
+	LogoutAll(userID uint) error
+	ListSessions(userID uint, currentSessionID string) ([]SessionInfo, error)
+	RevokeSession(userID uint, sessionID string) error
+	RequestEmailVerification(email string) error
+	VerifyEmail(token string) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, password string) error
+	VerifyMFA(mfaToken string, input MFACodeInput, client ClientInfo) (*LoginResponse, error)
+	StartMFAEnrollment(mfaToken string) (*MFASetup, error)
+	SetupMFA(userID uint) (*MFASetup, error)
+	ConfirmMFA(userID uint, code string, client ClientInfo) ([]string, error)
+	DisableMFA(userID uint, input MFACodeInput, client ClientInfo) error
+	RegenerateRecoveryCodes(userID uint, code string, client ClientInfo) ([]string, error)
+	GetMFAStatus(userID uint) (*MFAStatus, error)
+	ListOIDCProviders() []oidc.ProviderInfo
+	StartOIDCLogin(ctx context.Context, provider string) (authURL, binding string, err error)
+	CompleteOIDCLogin(ctx context.Context, code, state, binding string, client ClientInfo) (*LoginResponse, error)
 }
 
 type authService struct {
-	userRepo repository.UserRepository
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	tokenRepo   repository.AccountTokenRepository
+	attemptRepo repository.LoginAttemptRepository
+	mfaRepo     repository.MFARepository
+	oidcRepo    repository.OIDCRepository
+	oidc        *oidc.Registry
+	mailer      mailer.Mailer
 }
 
 // NewAuthService initializes authentication service
-func NewAuthService(userRepo repository.UserRepository) AuthService {
-	return &authService{userRepo: userRepo}
+func NewAuthService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, tokenRepo repository.AccountTokenRepository, attemptRepo repository.LoginAttemptRepository, mfaRepo repository.MFARepository, oidcRepo repository.OIDCRepository, providers *oidc.Registry, mail mailer.Mailer) AuthService {
+	return &authService{userRepo: userRepo, sessionRepo: sessionRepo, tokenRepo: tokenRepo, attemptRepo: attemptRepo, mfaRepo: mfaRepo, oidcRepo: oidcRepo, oidc: providers, mailer: mail}
 }
 
-// hash256encode hashes a password using SHA-256
-func hash256encode(password string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(password))
-	return hex.EncodeToString(hasher.Sum(nil))
+// dummyPasswordHash is verified against when the email is unknown, so that
+// the response time does not reveal which accounts exist.
+var dummyPasswordHash, _ = utilities.HashPassword("inkwell-dummy-password")
+
+// dummyLegacyPasswordHash stands in for an account's SHA-256 hash in the
+// legacy authhash login.
+var dummyLegacyPasswordHash = fmt.Sprintf("%x", sha256.Sum256([]byte("inkwell-dummy-password")))
+
+// legacyAuthHashEnabled reports whether the old authhash login is still accepted.
+func legacyAuthHashEnabled() bool {
+	cfg := config.GetConfig()
+	return cfg != nil && cfg.Authentication.LegacyAuthHash
 }
 
 func (s *authService) Register(user *model.User) error {
+	user.Email = normalizeEmail(user.Email)
 	existingUser, err := s.userRepo.GetUserByEmail(user.Email)
 	if err == nil && existingUser != nil {
 		return errors.New("email already in use")
 	}
 
 	if user.Password == "" {
-		return errors.New("password cannot be empty")
+		return ErrEmptyPassword
 	}
 
-	// First, apply SHA-256 hashing
-	hashedPassword := hash256encode(user.Password)
-
-	// Store only the SHA-256 hash
+	hashedPassword, err := utilities.HashPassword(user.Password)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
 	user.Password = hashedPassword
 
+	// Everyone starts as a learner; admins listed in the config are promoted
+	// once they have verified the address.
+	user.Role = model.RoleLearner
+
 	// Save user to DB
 	err = s.userRepo.CreateUser(user)
 	if err != nil {
 		return errors.New("failed to create user")
 	}
 
+	if err := s.sendAccountToken(user, model.TokenPurposeVerifyEmail); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	return nil
 }
 
-// LoginResponse struct
+// LoginResponse struct. When a second factor is needed, only the MFA
+// fields are set and the login continues with MFAToken.
 type LoginResponse struct {
-	User    *model.User `json:"user"`
-	Access  string      `json:"access"`
-	Refresh string      `json:"refresh"`
+	User    *model.User `json:"user,omitempty"`
+	Access  string      `json:"access,omitempty"`
+	Refresh string      `json:"refresh,omitempty"`
+
+	MFARequired           bool     `json:"mfa_required,omitempty"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"`
+	MFAToken              string   `json:"mfa_token,omitempty"`
+	RecoveryCodes         []string `json:"recovery_codes,omitempty"` // after enrolling during login
 }
 
-// Login function to authenticate user
-func (s *authService) Login(username, authhash string) (*LoginResponse, error) {
-	// Step 1: Retrieve user from database (already stored as SHA-256 hash)
-	user, err := s.userRepo.GetUserByEmail(username)
-	if err != nil {
-		return nil, errors.New("user not found")
-	}
-
-	// Step 2: Concatenate email with stored SHA-256 hashed password
-	concatenatedString := username + "::" + user.Password
+// Login authenticates a user by password. Passwords stored as legacy
+// SHA-256 digests, or with outdated argon2id parameters, are rehashed.
+func (s *authService) Login(email, password string, client ClientInfo) (*LoginResponse, error) {
+	return s.throttledLogin(email, client, func() (*model.User, error) {
+		user, err := s.userRepo.GetUserByEmail(email)
+		if err != nil {
+			_, _, _ = utilities.VerifyPassword(password, dummyPasswordHash)
+			return nil, ErrInvalidCredentials
+		}
+		if user.Password == "" {
+			// Created through an OpenID Connect login and never given a password.
+			_, _, _ = utilities.VerifyPassword(password, dummyPasswordHash)
+			return user, ErrInvalidCredentials
+		}
+		ok, needsRehash, err := utilities.VerifyPassword(password, user.Password)
+		if err != nil {
+			log.Printf("Unreadable password hash for user %d: %v", user.ID, err)
+			return user, ErrInvalidCredentials
+		}
+		if !ok {
+			return user, ErrInvalidCredentials
+		}
+		if needsRehash {
+			if hash, err := utilities.HashPassword(password); err != nil {
+				log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+			} else if err := s.userRepo.UpdatePassword(user.ID, hash); err != nil {
+				log.Printf("Failed to store rehashed password for user %d: %v", user.ID, err)
+			}
+		}
+		return user, nil
+	})
+}
 
-	// Step 3: Decode Base64 `authhash` received from frontend
-	bcryptEncryptedBytes, err := base64.StdEncoding.DecodeString(authhash)
-	if err != nil {
-		return nil, errors.New("invalid authhash format")
+// LoginWithAuthHash is the legacy login, where the client sends a base64
+// bcrypt of "email::sha256(password)". It only works while
+// LEGACY_AUTHHASH is enabled and the account still has a SHA-256 hash;
+// accounts upgraded to argon2id must log in with the password.
+func (s *authService) LoginWithAuthHash(email, authhash string, client ClientInfo) (*LoginResponse, error) {
+	if !legacyAuthHashEnabled() {
+		return nil, ErrAuthHashDisabled
 	}
-	bcryptEncrypted := string(bcryptEncryptedBytes)
+	return s.throttledLogin(email, client, func() (*model.User, error) {
+		return s.checkAuthHash(email, authhash)
+	})
+}
 
-	// Step 4: Compare bcrypt hash with concatenated string
-	err = bcrypt.CompareHashAndPassword([]byte(bcryptEncrypted), []byte(concatenatedString))
-	if err != nil {
-		fmt.Println("Bcrypt Comparison Failed:", err)
-		return nil, errors.New("invalid credentials")
+// checkAuthHash verifies a legacy authhash. Unknown emails and accounts
+// without a SHA-256 hash are compared against a dummy digest, so that they
+// cost the same bcrypt work and the response time does not reveal them.
+func (s *authService) checkAuthHash(email, authhash string) (*model.User, error) {
+	user, err := s.userRepo.GetUserByEmail(email)
+	known := err == nil && utilities.IsLegacyPasswordHash(user.Password)
+	digest := dummyLegacyPasswordHash
+	if known {
+		digest = user.Password
+	} else {
+		user = nil
 	}
-
-	// Step 5: Remove password before returning user data
-	user.Password = ""
-
-	// Step 6: Generate access and refresh tokens
-	accessToken, refreshToken, err := utilities.GenerateTokens(user)
+	bcryptEncrypted, err := base64.StdEncoding.DecodeString(authhash)
 	if err != nil {
-		return nil, errors.New("failed to generate tokens")
+		return user, ErrInvalidCredentials
 	}
-
-	// Step 7: Return response in expected format
-	return &LoginResponse{
-		User:    user,
-		Access:  accessToken,
-		Refresh: refreshToken,
-	}, nil
-}
-
-// TokenResponse struct for refresh tokens
-type TokenResponse struct {
-	Access  string `json:"access"`
-	Refresh string `json:"refresh"`
+	if err := bcrypt.CompareHashAndPassword(bcryptEncrypted, []byte(email+"::"+digest)); err != nil || !known {
+		return user, ErrInvalidCredentials
+	}
+	return user, nil
 }
 
-// RefreshTokens function to refresh both access and refresh tokens
-func (s *authService) RefreshTokens(refreshToken string) (*TokenResponse, error) {
-	newAccessToken, newRefreshToken, err := utilities.RefreshTokens(refreshToken)
+// throttledLogin runs a credential check unless failed attempts for the
+// email or IP address require a wait, starts a session or an MFA challenge
+// when it passes, and records the attempt. Every wrong email or password gives the same
+// ErrInvalidCredentials.
+func (s *authService) throttledLogin(email string, client ClientInfo, verify func() (*model.User, error)) (*LoginResponse, error) {
+	key := normalizeEmail(email)
+	var user *model.User
+	err := s.serializeLogin(key, func() error {
+		if err := s.checkLoginThrottle(key, client.IP, time.Now()); err != nil {
+			if _, throttled := err.(*LoginThrottledError); throttled {
+				s.recordLoginAttempt(key, nil, client, model.LoginFailedThrottled)
+			}
+			return err
+		}
+		var err error
+		if user, err = verify(); err != nil {
+			s.recordLoginAttempt(key, user, client, model.LoginFailedCredentials)
+		}
+		return err
+	})
 	if err != nil {
-		return nil, errors.New("invalid or expired refresh token")
+		return nil, err
 	}
-
-	return &TokenResponse{
-		Access:  newAccessToken,
-		Refresh: newRefreshToken,
-	}, nil
+	if err := checkEmailVerified(user); err != nil {
+		s.recordLoginAttempt(key, user, client, model.LoginFailedUnverified)
+		return nil, err
+	}
+	challenge, err := s.mfaChallenge(user)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		// Not a success yet: it must not reset the failure count that
+		// limits guessing the second factor.
+		s.recordLoginAttempt(key, user, client, model.LoginMFAPending)
+		return challenge, nil
+	}
+	response, err := s.startSession(user, client)
+	if err == nil {
+		s.recordLoginAttempt(key, user, client, "")
+	}
+	return response, err
 }
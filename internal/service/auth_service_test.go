@@ -0,0 +1,113 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// authHash builds a legacy authhash the way clients do. Their bcrypt
+// libraries only use the first 72 bytes, as CompareHashAndPassword does.
+func authHash(t *testing.T, email, digest string) string {
+	t.Helper()
+	input := []byte(email + "::" + digest)
+	hash, err := bcrypt.GenerateFromPassword(input[:min(len(input), 72)], bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(hash)
+}
+
+func TestCheckAuthHash(t *testing.T) {
+	legacy := fmt.Sprintf("%x", []byte("0123456789abcdef0123456789abcdef"))
+	users := &memUserRepo{users: map[uint]*model.User{
+		1: {ID: 1, Email: "ann@example.com", Password: legacy},
+		2: {ID: 2, Email: "bob@example.com", Password: "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA"},
+	}}
+	s := &authService{userRepo: users}
+
+	if user, err := s.checkAuthHash("ann@example.com", authHash(t, "ann@example.com", legacy)); err != nil || user.ID != 1 {
+		t.Errorf("right authhash: %+v, %v", user, err)
+	}
+	for name, tt := range map[string]struct{ email, authhash string }{
+		"wrong digest":     {"ann@example.com", authHash(t, "ann@example.com", dummyLegacyPasswordHash)},
+		"not base64":       {"ann@example.com", "%%%"},
+		"unknown email":    {"eve@example.com", authHash(t, "eve@example.com", dummyLegacyPasswordHash)},
+		"upgraded account": {"bob@example.com", authHash(t, "bob@example.com", dummyLegacyPasswordHash)},
+	} {
+		if _, err := s.checkAuthHash(tt.email, tt.authhash); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// An unknown email costs the same bcrypt work as a wrong authhash, so the
+// response time does not reveal which accounts exist.
+func TestCheckAuthHashUnknownEmailDoesBcryptWork(t *testing.T) {
+	legacy := fmt.Sprintf("%x", []byte("0123456789abcdef0123456789abcdef"))
+	s := &authService{userRepo: &memUserRepo{users: map[uint]*model.User{1: {ID: 1, Email: "ann@example.com", Password: legacy}}}}
+	wrong := authHash(t, "ann@example.com", "wrong")
+
+	timeIt := func(email string) time.Duration {
+		start := time.Now()
+		_, _ = s.checkAuthHash(email, wrong)
+		return time.Since(start)
+	}
+	known, unknown := timeIt("ann@example.com"), timeIt("eve@example.com")
+	if unknown < known/4 {
+		t.Errorf("unknown email took %v, known email %v", unknown, known)
+	}
+}
+
+func (r *memUserRepo) CreateUser(user *model.User) error {
+	user.ID = uint(len(r.users) + 1)
+	user.Email = strings.ToLower(user.Email)
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+// Registering never grants admin, and case variants of an address cannot
+// open a second account.
+func TestRegisterNormalizesEmailAndStartsAsLearner(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*model.User{1: {ID: 1, Email: "ann@example.com"}}}
+	s := &authService{userRepo: users, tokenRepo: &memTokenRepo{}, mailer: make(chanMailer, 1)}
+
+	if err := s.Register(&model.User{Email: " ANN@Example.com", Password: "secret"}); err == nil {
+		t.Error("case variant of an existing address registered")
+	}
+	user := &model.User{Email: "Root@Example.com ", Password: "secret", Role: model.RoleAdmin}
+	if err := s.Register(user); err != nil {
+		t.Fatal(err)
+	}
+	stored := users.users[user.ID]
+	if stored.Email != "root@example.com" || stored.Role != model.RoleLearner {
+		t.Errorf("registered as %q with role %q", stored.Email, stored.Role)
+	}
+}
+
+func TestEligibleAdmin(t *testing.T) {
+	verified := time.Now()
+	tests := []struct {
+		name   string
+		user   model.User
+		listed bool
+		want   bool
+	}{
+		{"listed and verified", model.User{Role: model.RoleLearner, EmailVerifiedAt: &verified}, true, true},
+		{"listed but unverified", model.User{Role: model.RoleLearner}, true, false},
+		{"not listed", model.User{Role: model.RoleLearner, EmailVerifiedAt: &verified}, false, false},
+		{"already admin", model.User{Role: model.RoleAdmin, EmailVerifiedAt: &verified}, true, false},
+	}
+	for _, tt := range tests {
+		if got := eligibleAdmin(&tt.user, tt.listed); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+// Reasons a session token was revoked.
+const (
+	RevokedRotated       = "rotated"
+	RevokedLogout        = "logout"
+	RevokedLogoutAll     = "logout_all"
+	RevokedSingleSession = "single_session"
+	RevokedReuse         = "reuse_detected"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used; the session has been revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// ClientInfo describes the device a login comes from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// TokenResponse struct for refresh tokens
+type TokenResponse struct {
+	Access  string `json:"access"`
+	Refresh string `json:"refresh"`
+}
+
+// SessionInfo is one of a user's active logins.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// multipleSessionsAllowed reports whether a user may be logged in on several devices at once.
+func multipleSessionsAllowed() bool {
+	cfg := config.GetConfig()
+	return cfg == nil || cfg.Authentication.MultipleSameUserSessions
+}
+
+// startSession records a new login and issues its tokens. Unless
+// MULTIPLE_SAME_USER_SESSIONS is set, the user's other logins are revoked.
+func (s *authService) startSession(user *model.User, client ClientInfo) (*LoginResponse, error) {
+	if err := checkEmailVerified(user); err != nil {
+		return nil, err
+	}
+	if !multipleSessionsAllowed() {
+		if err := s.sessionRepo.RevokeUserSessions(user.ID, RevokedSingleSession); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	id := uuid.New().String()
+	session := &model.Session{
+		ID:        id,
+		FamilyID:  id,
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		StartedAt: now,
+		CreatedAt: now,
+		ExpiresAt: now.Add(utilities.RefreshExpiry()),
+	}
+	if err := s.sessionRepo.CreateSession(session); err != nil {
+		return nil, err
+	}
+
+	// Remove password before returning user data
+	user.Password = ""
+
+	accessToken, refreshToken, err := utilities.GenerateTokens(user, session.FamilyID, session.ID)
+	if err != nil {
+		return nil, errors.New("failed to generate tokens")
+	}
+	return &LoginResponse{
+		User:    user,
+		Access:  accessToken,
+		Refresh: refreshToken,
+	}, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new pair and retires it.
+// A refresh token that was already exchanged is a sign it was stolen, so
+// presenting it again revokes every token of that login.
+func (s *authService) RefreshTokens(refreshToken string, client ClientInfo) (*TokenResponse, error) {
+	claims, err := utilities.ValidateToken(refreshToken, true)
+	if err != nil || claims.ID == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	session, err := s.sessionRepo.GetSession(claims.ID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if session.RevokedAt != nil {
+		if session.RevokedReason == RevokedRotated {
+			return nil, s.revokeReusedFamily(session)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	now := time.Now()
+	if !now.Before(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	user, err := s.userRepo.GetUserByID(session.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	next := &model.Session{
+		ID:        uuid.New().String(),
+		FamilyID:  session.FamilyID,
+		UserID:    session.UserID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		StartedAt: session.StartedAt,
+		CreatedAt: now,
+		ExpiresAt: now.Add(utilities.RefreshExpiry()),
+	}
+	rotated, err := s.sessionRepo.RotateSession(session.ID, next)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another request exchanged the same token first.
+		return nil, s.revokeReusedFamily(session)
+	}
+
+	accessToken, newRefreshToken, err := utilities.GenerateTokens(user, next.FamilyID, next.ID)
+	if err != nil {
+		return nil, errors.New("failed to generate new tokens")
+	}
+	return &TokenResponse{
+		Access:  accessToken,
+		Refresh: newRefreshToken,
+	}, nil
+}
+
+func (s *authService) revokeReusedFamily(session *model.Session) error {
+	log.Printf("Refresh token reuse detected for user %d, revoking session %s", session.UserID, session.FamilyID)
+	if err := s.sessionRepo.RevokeFamily(session.FamilyID, RevokedReuse); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Logout ends the session the request was made with.
+func (s *authService) Logout(userID uint, sessionID string) error {
+	if sessionID == "" {
+		return ErrSessionNotFound
+	}
+	_, err := s.sessionRepo.RevokeUserFamily(userID, sessionID, RevokedLogout)
+	return err
+}
+
+// LogoutAll ends all of the user's sessions, on every device.
+func (s *authService) LogoutAll(userID uint) error {
+	return s.sessionRepo.RevokeUserSessions(userID, RevokedLogoutAll)
+}
+
+// ListSessions returns the user's active logins, marking the one the request was made with.
+func (s *authService) ListSessions(userID uint, currentSessionID string) ([]SessionInfo, error) {
+	sessions, err := s.sessionRepo.GetActiveSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		list = append(list, SessionInfo{
+			ID:         session.FamilyID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			StartedAt:  session.StartedAt,
+			LastUsedAt: session.CreatedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.FamilyID == currentSessionID,
+		})
+	}
+	return list, nil
+}
+
+// RevokeSession ends one of the user's sessions, such as a lost device.
+func (s *authService) RevokeSession(userID uint, sessionID string) error {
+	n, err := s.sessionRepo.RevokeUserFamily(userID, sessionID, RevokedLogout)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// StartSessionCleanup periodically deletes expired session records.
+func StartSessionCleanup(sessionRepo repository.SessionRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if n, err := sessionRepo.DeleteExpiredSessions(now); err != nil {
+				log.Printf("Failed to delete expired sessions: %v", err)
+			} else if n > 0 {
+				log.Printf("Deleted %d expired sessions", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+// initTestAuth configures HS256 tokens with test secrets.
+func initTestAuth(t *testing.T) {
+	t.Helper()
+	utilities.InitAuthConfig(&config.APIConfig{Authentication: config.AuthenticationConfig{
+		SecretKeys:      map[string]string{"ACCESS": "test-access", "REFRESH": "test-refresh"},
+		SessionTimeouts: map[string]int{"ACCESS": 15, "REFRESH": 24},
+		TimeUnits:       map[string]string{"ACCESS": "MINUTES", "REFRESH": "HOURS"},
+	}})
+}
+
+// memSessionRepo keeps sessions in memory, with the same rotation and
+// revocation rules as the database repository.
+type memSessionRepo struct {
+	repository.SessionRepository
+	sessions map[string]*model.Session
+}
+
+func newMemSessionRepo() *memSessionRepo {
+	return &memSessionRepo{sessions: map[string]*model.Session{}}
+}
+
+func (r *memSessionRepo) CreateSession(session *model.Session) error {
+	copied := *session
+	r.sessions[session.ID] = &copied
+	return nil
+}
+
+func (r *memSessionRepo) GetSession(id string) (*model.Session, error) {
+	if session, ok := r.sessions[id]; ok {
+		copied := *session
+		return &copied, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *memSessionRepo) RotateSession(oldID string, next *model.Session) (bool, error) {
+	old, ok := r.sessions[oldID]
+	if !ok || old.RevokedAt != nil {
+		return false, nil
+	}
+	at := next.CreatedAt
+	old.RevokedAt, old.RevokedReason, old.ReplacedBy = &at, RevokedRotated, next.ID
+	return true, r.CreateSession(next)
+}
+
+func (r *memSessionRepo) RevokeFamily(familyID, reason string) error {
+	now := time.Now()
+	for _, session := range r.sessions {
+		if session.FamilyID == familyID && session.RevokedAt == nil {
+			session.RevokedAt, session.RevokedReason = &now, reason
+		}
+	}
+	return nil
+}
+
+func (r *memSessionRepo) RevokeUserSessions(userID uint, reason string) error {
+	now := time.Now()
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt, session.RevokedReason = &now, reason
+		}
+	}
+	return nil
+}
+
+// memUserRepo serves users from a map.
+type memUserRepo struct {
+	repository.UserRepository
+	users map[uint]*model.User
+}
+
+func (r *memUserRepo) GetUserByID(userID uint) (*model.User, error) {
+	if user, ok := r.users[userID]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *memUserRepo) GetUserByEmail(email string) (*model.User, error) {
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func newTestAuthService(t *testing.T) (*authService, *memSessionRepo) {
+	t.Helper()
+	initTestAuth(t)
+	sessions := newMemSessionRepo()
+	users := &memUserRepo{users: map[uint]*model.User{1: {ID: 1, Email: "ann@example.com", Username: "ann", Role: "student"}}}
+	return &authService{userRepo: users, sessionRepo: sessions}, sessions
+}
+
+func TestRefreshTokensRotates(t *testing.T) {
+	s, sessions := newTestAuthService(t)
+	login, err := s.startSession(&model.User{ID: 1, Email: "ann@example.com", Role: "student"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := utilities.ValidateToken(login.Refresh, true)
+
+	pair, err := s.RefreshTokens(login.Refresh, ClientInfo{UserAgent: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := utilities.ValidateToken(pair.Refresh, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID == first.ID || next.SessionID != first.SessionID {
+		t.Errorf("rotated token: jti %s sid %s, was jti %s sid %s", next.ID, next.SessionID, first.ID, first.SessionID)
+	}
+	old := sessions.sessions[first.ID]
+	if old.RevokedAt == nil || old.RevokedReason != RevokedRotated || old.ReplacedBy != next.ID {
+		t.Errorf("old token not retired: %+v", old)
+	}
+
+	// The new token can be exchanged in turn.
+	if _, err := s.RefreshTokens(pair.Refresh, ClientInfo{}); err != nil {
+		t.Errorf("second rotation: %v", err)
+	}
+}
+
+// Presenting a refresh token that was already exchanged revokes the whole
+// login, including the token it was exchanged for.
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	s, sessions := newTestAuthService(t)
+	login, err := s.startSession(&model.User{ID: 1, Email: "ann@example.com", Role: "student"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := s.RefreshTokens(login.Refresh, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RefreshTokens(login.Refresh, ClientInfo{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused token: got %v, want %v", err, ErrRefreshTokenReused)
+	}
+	for id, session := range sessions.sessions {
+		if session.RevokedAt == nil {
+			t.Errorf("session %s still active after reuse", id)
+		}
+	}
+	if _, err := s.RefreshTokens(pair.Refresh, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("descendant token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestRefreshTokensRejectsOtherTokens(t *testing.T) {
+	s, sessions := newTestAuthService(t)
+	login, err := s.startSession(&model.User{ID: 1, Email: "ann@example.com", Role: "student"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RefreshTokens(login.Access, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("access token: got %v", err)
+	}
+
+	claims, _ := utilities.ValidateToken(login.Refresh, true)
+	sessions.sessions[claims.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := s.RefreshTokens(login.Refresh, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expired session: got %v", err)
+	}
+
+	// A logged-out token is refused without treating it as reuse.
+	sessions.sessions[claims.ID].ExpiresAt = time.Now().Add(time.Hour)
+	_ = sessions.RevokeFamily(claims.SessionID, RevokedLogout)
+	if _, err := s.RefreshTokens(login.Refresh, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("logged out: got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+const (
+	avatarDir         = "avatars" // under working/
+	avatarSize        = 256
+	defaultAvatarKB   = 5 * 1024
+	maxAvatarPixels   = 40_000_000 // refuse to decode larger images
+	avatarJPEGQuality = 88
+)
+
+var (
+	ErrInvalidAvatar  = errors.New("avatar must be a PNG, JPEG or GIF image")
+	ErrAvatarTooLarge = errors.New("avatar image is too large")
+)
+
+// MaxAvatarBytes is the largest avatar upload accepted, before resizing.
+func MaxAvatarBytes() int64 {
+	kb := profileConfig().AvatarMaxKB
+	if kb <= 0 {
+		kb = defaultAvatarKB
+	}
+	return int64(kb) * 1024
+}
+
+// processAvatar crops an uploaded image to a centred square and scales it
+// to avatarSize. Re-encoding also drops metadata such as EXIF locations.
+// JPEGs stay JPEG; PNGs and GIFs become PNG to keep transparency.
+func processAvatar(data []byte) ([]byte, string, error) {
+	if int64(len(data)) > MaxAvatarBytes() {
+		return nil, "", ErrAvatarTooLarge
+	}
+	info, err := detectImage(data)
+	if err != nil {
+		return nil, "", ErrInvalidAvatar
+	}
+	if info.Width*info.Height > maxAvatarPixels {
+		return nil, "", ErrAvatarTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrInvalidAvatar
+	}
+
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(b.Min).Add(image.Pt((b.Dx()-side)/2, (b.Dy()-side)/2))
+	size := min(side, avatarSize)
+	canvas := image.NewRGBA(image.Rect(0, 0, size, size))
+	scaleBilinear(canvas, canvas.Bounds(), subImage(src, crop))
+
+	var buf bytes.Buffer
+	if info.MimeType == "image/jpeg" {
+		err = jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: avatarJPEGQuality})
+		return buf.Bytes(), ".jpg", err
+	}
+	err = png.Encode(&buf, canvas)
+	return buf.Bytes(), ".png", err
+}
+
+// subImage returns the part of img inside r, sharing its pixels when the
+// image type allows it.
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			canvas.Set(x, y, img.At(r.Min.X+x, r.Min.Y+y))
+		}
+	}
+	return canvas
+}
+
+// saveAvatar stores a processed avatar under working/avatars and returns
+// its media path.
+func saveAvatar(data []byte, ext string) (string, error) {
+	dir := resolveWorkingPath(avatarDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := uuid.New().String() + ext
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		return "", err
+	}
+	return avatarDir + "/" + name, nil
+}
+
+// removeAvatar deletes an avatar file; paths outside working/avatars are ignored.
+func removeAvatar(path string) error {
+	if path == "" || filepath.Dir(filepath.Clean(path)) != avatarDir {
+		return nil
+	}
+	err := os.Remove(resolveWorkingPath(path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
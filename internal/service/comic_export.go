@@ -0,0 +1,566 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ComicDocument is everything an exporter needs to produce one comic file.
+type ComicDocument struct {
+	Cover  ComicCover
+	Panels []ComicPanel
+}
+
+// ComicFormat describes one downloadable representation of a comic.
+type ComicFormat struct {
+	Name        string
+	Extension   string
+	ContentType string
+	Inline      bool // served for viewing in the browser rather than as an attachment
+	Export      func(path string, doc ComicDocument) error
+}
+
+// ComicFormats lists every format produced for a comic, in the order they
+// are generated. The PDF comes first since it is the canonical download.
+var ComicFormats = []ComicFormat{
+	{Name: "pdf", Extension: ".pdf", ContentType: "application/pdf", Export: exportComicPDF},
+	{Name: "cbz", Extension: ".cbz", ContentType: "application/vnd.comicbook+zip", Export: exportComicCBZ},
+	{Name: "epub", Extension: ".epub", ContentType: "application/epub+zip", Export: exportComicEPUB},
+	{Name: "html", Extension: ".html", ContentType: "text/html; charset=utf-8", Inline: true, Export: exportComicHTML},
+}
+
+// ComicFormatByExtension looks up a format from a file extension such as ".cbz".
+func ComicFormatByExtension(ext string) (ComicFormat, bool) {
+	for _, f := range ComicFormats {
+		if strings.EqualFold(f.Extension, ext) {
+			return f, true
+		}
+	}
+	return ComicFormat{}, false
+}
+
+const (
+	panelImageWidth  = 1200
+	panelImageHeight = 900
+	panelImageBorder = 6
+	panelImagePad    = 24
+)
+
+func exportComicPDF(path string, doc ComicDocument) error {
+	renderer := newComicRenderer(ChooseComicLayout(len(doc.Panels)))
+	renderer.DrawCover(doc.Cover)
+	renderer.DrawPanels(doc.Panels)
+	return renderer.Output(path)
+}
+
+// renderedPage is a panel (or the cover) rasterised to a JPEG.
+type renderedPage struct {
+	Name string
+	Alt  string
+	Data []byte
+}
+
+// renderComicPages rasterises the cover and every panel into fixed-size
+// frames so that image-based formats have uniform pages.
+func renderComicPages(doc ComicDocument) ([]renderedPage, error) {
+	pages := make([]renderedPage, 0, len(doc.Panels)+1)
+
+	cover, err := renderPanelImage(doc.Cover.Thumbnail)
+	if err != nil {
+		return nil, err
+	}
+	pages = append(pages, renderedPage{Name: "000_cover.jpg", Alt: doc.Cover.Title, Data: cover})
+
+	for i, panel := range doc.Panels {
+		data, err := renderPanelImage(panel.ImagePath)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, renderedPage{
+			Name: fmt.Sprintf("%03d_panel.jpg", i+1),
+			Alt:  panel.Text,
+			Data: data,
+		})
+	}
+	return pages, nil
+}
+
+// renderPanelImage draws the panel illustration, scaled to fit with its
+// aspect ratio preserved, inside a bordered white frame. Missing or
+// unreadable images produce an empty frame.
+func renderPanelImage(imagePath string) ([]byte, error) {
+	canvas := image.NewRGBA(image.Rect(0, 0, panelImageWidth, panelImageHeight))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	inner := canvas.Bounds().Inset(panelImageBorder)
+	draw.Draw(canvas, inner, image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	area := inner.Inset(panelImagePad)
+	if src := loadPanelSource(imagePath); src != nil {
+		b := src.Bounds()
+		x, y, w, h := fitRect(float64(b.Dx()), float64(b.Dy()),
+			float64(area.Min.X), float64(area.Min.Y), float64(area.Dx()), float64(area.Dy()))
+		dst := image.Rect(int(x), int(y), int(x+w), int(y+h))
+		scaleBilinear(canvas, dst, src)
+	} else {
+		draw.Draw(canvas, area, image.NewUniform(color.Gray{Y: 235}), image.Point{}, draw.Src)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: 88}); err != nil {
+		return nil, fmt.Errorf("failed to encode panel image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func loadPanelSource(imagePath string) image.Image {
+	if imagePath == "" {
+		return nil
+	}
+	f, err := os.Open(resolveWorkingPath(imagePath))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// scaleBilinear resamples src into the dst rectangle of canvas.
+func scaleBilinear(canvas *image.RGBA, dst image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	if dst.Dx() <= 0 || dst.Dy() <= 0 || sb.Dx() == 0 || sb.Dy() == 0 {
+		return
+	}
+	sx := float64(sb.Dx()) / float64(dst.Dx())
+	sy := float64(sb.Dy()) / float64(dst.Dy())
+	for y := dst.Min.Y; y < dst.Max.Y; y++ {
+		fy := (float64(y-dst.Min.Y)+0.5)*sy - 0.5
+		y0 := clampInt(int(fy), 0, sb.Dy()-1)
+		y1 := clampInt(y0+1, 0, sb.Dy()-1)
+		wy := fy - float64(y0)
+		if wy < 0 {
+			wy = 0
+		}
+		for x := dst.Min.X; x < dst.Max.X; x++ {
+			fx := (float64(x-dst.Min.X)+0.5)*sx - 0.5
+			x0 := clampInt(int(fx), 0, sb.Dx()-1)
+			x1 := clampInt(x0+1, 0, sb.Dx()-1)
+			wx := fx - float64(x0)
+			if wx < 0 {
+				wx = 0
+			}
+			c00 := color.RGBAModel.Convert(src.At(sb.Min.X+x0, sb.Min.Y+y0)).(color.RGBA)
+			c10 := color.RGBAModel.Convert(src.At(sb.Min.X+x1, sb.Min.Y+y0)).(color.RGBA)
+			c01 := color.RGBAModel.Convert(src.At(sb.Min.X+x0, sb.Min.Y+y1)).(color.RGBA)
+			c11 := color.RGBAModel.Convert(src.At(sb.Min.X+x1, sb.Min.Y+y1)).(color.RGBA)
+			canvas.SetRGBA(x, y, color.RGBA{
+				R: lerp2(c00.R, c10.R, c01.R, c11.R, wx, wy),
+				G: lerp2(c00.G, c10.G, c01.G, c11.G, wx, wy),
+				B: lerp2(c00.B, c10.B, c01.B, c11.B, wx, wy),
+				A: 255,
+			})
+		}
+	}
+}
+
+func lerp2(c00, c10, c01, c11 uint8, wx, wy float64) uint8 {
+	top := float64(c00)*(1-wx) + float64(c10)*wx
+	bottom := float64(c01)*(1-wx) + float64(c11)*wx
+	return uint8(top*(1-wy) + bottom*wy + 0.5)
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// comicInfo is the ComicInfo.xml metadata understood by most CBZ readers.
+type comicInfo struct {
+	XMLName   xml.Name        `xml:"ComicInfo"`
+	Title     string          `xml:"Title"`
+	Summary   string          `xml:"Summary"`
+	Writer    string          `xml:"Writer,omitempty"`
+	Year      int             `xml:"Year,omitempty"`
+	Month     int             `xml:"Month,omitempty"`
+	Day       int             `xml:"Day,omitempty"`
+	PageCount int             `xml:"PageCount"`
+	Pages     []comicInfoPage `xml:"Pages>Page"`
+}
+
+type comicInfoPage struct {
+	Image       int    `xml:"Image,attr"`
+	Type        string `xml:"Type,attr,omitempty"`
+	ImageWidth  int    `xml:"ImageWidth,attr"`
+	ImageHeight int    `xml:"ImageHeight,attr"`
+}
+
+// exportComicCBZ writes a comic book archive of the rendered panel images.
+// The panel text travels in ComicInfo.xml since CBZ has no text layer.
+func exportComicCBZ(path string, doc ComicDocument) error {
+	pages, err := renderComicPages(doc)
+	if err != nil {
+		return err
+	}
+
+	info := comicInfo{
+		Title:     doc.Cover.Title,
+		Writer:    doc.Cover.Author,
+		Summary:   comicSummary(doc.Panels),
+		PageCount: len(pages),
+	}
+	if !doc.Cover.Date.IsZero() {
+		info.Year, info.Month, info.Day = doc.Cover.Date.Year(), int(doc.Cover.Date.Month()), doc.Cover.Date.Day()
+	}
+	for i := range pages {
+		page := comicInfoPage{Image: i, ImageWidth: panelImageWidth, ImageHeight: panelImageHeight}
+		if i == 0 {
+			page.Type = "FrontCover"
+		}
+		info.Pages = append(info.Pages, page)
+	}
+	infoXML, err := xml.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode ComicInfo.xml: %w", err)
+	}
+
+	return writeZip(path, func(zw *zip.Writer) error {
+		for _, page := range pages {
+			if err := writeZipEntry(zw, page.Name, page.Data, zip.Store); err != nil {
+				return err
+			}
+		}
+		return writeZipEntry(zw, "ComicInfo.xml", append([]byte(xml.Header), infoXML...), zip.Deflate)
+	})
+}
+
+func comicSummary(panels []ComicPanel) string {
+	lines := make([]string, 0, len(panels))
+	for i, panel := range panels {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, panel.Text))
+	}
+	return strings.Join(lines, "\n")
+}
+
+var epubTemplates = template.Must(template.New("epub").Funcs(template.FuncMap{
+	"esc": html.EscapeString,
+}).Parse(`
+{{define "container"}}<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/package.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+{{end}}
+{{define "opf"}}<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">urn:uuid:{{.ID}}</dc:identifier>
+    <dc:title>{{esc .Title}}</dc:title>
+    {{if .Author}}<dc:creator>{{esc .Author}}</dc:creator>{{end}}
+    <dc:language>{{.Language}}</dc:language>
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:orientation">landscape</meta>
+    <meta property="rendition:spread">none</meta>
+    <meta property="schema:accessMode">visual</meta>
+    <meta property="schema:accessMode">textual</meta>
+    <meta property="schema:accessibilityFeature">alternativeText</meta>
+    <meta property="schema:accessibilitySummary">Every illustrated panel carries its story sentence as alternative text.</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+    {{range $i, $p := .Pages}}<item id="img{{$i}}" href="images/{{$p.Image}}" media-type="image/jpeg"{{if eq $i 0}} properties="cover-image"{{end}}/>
+    <item id="page{{$i}}" href="{{$p.Href}}" media-type="application/xhtml+xml"/>
+    {{end}}
+  </manifest>
+  <spine>
+    {{range $i, $p := .Pages}}<itemref idref="page{{$i}}"/>
+    {{end}}
+  </spine>
+</package>
+{{end}}
+{{define "page"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}" lang="{{.Language}}">
+<head>
+  <meta charset="UTF-8"/>
+  <meta name="viewport" content="width={{.Width}}, height={{.Height}}"/>
+  <title>{{esc .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <figure>
+    <img src="images/{{.Image}}" alt="{{esc .Alt}}" width="{{.Width}}" height="{{.Height}}"/>
+    {{if .Caption}}<figcaption dir="auto">{{esc .Caption}}</figcaption>{{end}}
+  </figure>
+</body>
+</html>
+{{end}}
+{{define "nav"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}" lang="{{.Language}}">
+<head><meta charset="UTF-8"/><title>{{esc .Title}}</title></head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <ol>
+      {{range $i, $p := .Pages}}<li><a href="{{$p.Href}}">{{if eq $i 0}}Cover{{else}}Panel {{$i}}{{end}}</a></li>
+      {{end}}
+    </ol>
+  </nav>
+</body>
+</html>
+{{end}}`))
+
+const epubStyle = `html, body { margin: 0; padding: 0; }
+figure { margin: 0; position: relative; width: 100%; height: 100%; }
+img { display: block; width: 100%; height: 100%; }
+figcaption { position: absolute; left: 4%; right: 4%; bottom: 4%; padding: 0.6em 0.9em;
+  background: #fff4c4; border: 2px solid #000; font-family: sans-serif; font-size: 28px; }
+`
+
+type epubPage struct {
+	Href    string
+	Image   string
+	Alt     string
+	Caption string
+}
+
+// exportComicEPUB writes a fixed-layout EPUB 3 with one page per panel. The
+// corrected sentence is both the image alt text and a visible caption.
+func exportComicEPUB(path string, doc ComicDocument) error {
+	pages, err := renderComicPages(doc)
+	if err != nil {
+		return err
+	}
+
+	language := "en"
+	epPages := make([]epubPage, len(pages))
+	for i, page := range pages {
+		epPages[i] = epubPage{
+			Href:  fmt.Sprintf("page_%03d.xhtml", i),
+			Image: page.Name,
+			Alt:   page.Alt,
+		}
+		if i > 0 {
+			epPages[i].Caption = page.Alt
+		} else if doc.Cover.Author != "" {
+			epPages[i].Alt = doc.Cover.Title + " by " + doc.Cover.Author
+		}
+	}
+
+	render := func(name string, data interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := epubTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", name, err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	meta := map[string]interface{}{
+		"ID":       uuid.New().String(),
+		"Title":    doc.Cover.Title,
+		"Author":   doc.Cover.Author,
+		"Language": language,
+		"Modified": time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		"Pages":    epPages,
+	}
+
+	return writeZip(path, func(zw *zip.Writer) error {
+		// The mimetype entry must come first and be stored uncompressed.
+		if err := writeZipEntry(zw, "mimetype", []byte("application/epub+zip"), zip.Store); err != nil {
+			return err
+		}
+		container, err := render("container", nil)
+		if err != nil {
+			return err
+		}
+		if err := writeZipEntry(zw, "META-INF/container.xml", container, zip.Deflate); err != nil {
+			return err
+		}
+		opf, err := render("opf", meta)
+		if err != nil {
+			return err
+		}
+		if err := writeZipEntry(zw, "OEBPS/package.opf", opf, zip.Deflate); err != nil {
+			return err
+		}
+		nav, err := render("nav", meta)
+		if err != nil {
+			return err
+		}
+		if err := writeZipEntry(zw, "OEBPS/nav.xhtml", nav, zip.Deflate); err != nil {
+			return err
+		}
+		if err := writeZipEntry(zw, "OEBPS/style.css", []byte(epubStyle), zip.Deflate); err != nil {
+			return err
+		}
+		for i, page := range pages {
+			xhtml, err := render("page", map[string]interface{}{
+				"Language": language,
+				"Title":    doc.Cover.Title,
+				"Image":    page.Name,
+				"Alt":      epPages[i].Alt,
+				"Caption":  epPages[i].Caption,
+				"Width":    panelImageWidth,
+				"Height":   panelImageHeight,
+			})
+			if err != nil {
+				return err
+			}
+			if err := writeZipEntry(zw, "OEBPS/"+epPages[i].Href, xhtml, zip.Deflate); err != nil {
+				return err
+			}
+			if err := writeZipEntry(zw, "OEBPS/images/"+page.Name, page.Data, zip.Store); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+var comicViewerTemplate = htmltemplate.Must(htmltemplate.New("viewer").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+  * { box-sizing: border-box; }
+  body { margin: 0; font-family: system-ui, sans-serif; background: #1d1d1f; color: #111; }
+  header { text-align: center; color: #fff; padding: 2rem 1rem 1rem; }
+  header h1 { margin: 0 0 .25rem; font-size: clamp(1.6rem, 5vw, 3rem); }
+  header p { margin: 0; opacity: .8; }
+  main { display: grid; gap: 1rem; padding: 1rem; max-width: 1400px; margin: 0 auto;
+         grid-template-columns: repeat(auto-fit, minmax(min(100%, 420px), 1fr)); }
+  figure { margin: 0; background: #fff; border: 3px solid #000; display: flex; flex-direction: column; }
+  figure img { width: 100%; height: auto; display: block; }
+  figure .empty { aspect-ratio: 4 / 3; background: #ebebeb; }
+  figcaption { padding: .75rem 1rem; background: #fff4c4; border-top: 3px solid #000; line-height: 1.4; }
+  figure.speech figcaption { background: #fff; border-radius: 1rem; margin: .5rem; border: 2px solid #000; }
+  footer { text-align: center; color: #aaa; padding: 1rem; font-size: .85rem; }
+</style>
+</head>
+<body>
+<header>
+  <h1 dir="auto">{{.Title}}</h1>
+  {{if .Author}}<p>by <span dir="auto">{{.Author}}</span></p>{{end}}
+</header>
+<main>
+{{range .Panels}}  <figure{{if .Speech}} class="speech"{{end}}>
+    {{if .Image}}<img src="{{.Image}}" alt="{{.Text}}" loading="lazy">{{else}}<div class="empty" role="img" aria-label="{{.Text}}"></div>{{end}}
+    <figcaption dir="auto">{{.Text}}</figcaption>
+  </figure>
+{{end}}</main>
+<footer>{{if .Date}}{{.Date}} · {{end}}Made with Inkwell</footer>
+</body>
+</html>
+`))
+
+type htmlPanel struct {
+	Text   string
+	Image  htmltemplate.URL
+	Speech bool
+}
+
+// exportComicHTML writes a self-contained responsive viewer with the panel
+// images embedded as data URIs.
+func exportComicHTML(path string, doc ComicDocument) error {
+	panels := make([]htmlPanel, 0, len(doc.Panels))
+	for _, panel := range doc.Panels {
+		hp := htmlPanel{Text: panel.Text, Speech: isDialogue(panel.Text)}
+		if uri := imageDataURI(panel.ImagePath); uri != "" {
+			hp.Image = htmltemplate.URL(uri)
+		}
+		panels = append(panels, hp)
+	}
+
+	data := map[string]interface{}{
+		"Title":  doc.Cover.Title,
+		"Author": doc.Cover.Author,
+		"Panels": panels,
+		"Date":   "",
+	}
+	if !doc.Cover.Date.IsZero() {
+		data["Date"] = doc.Cover.Date.Format("2 January 2006")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := comicViewerTemplate.Execute(f, data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to render HTML viewer: %w", err)
+	}
+	return f.Close()
+}
+
+func imageDataURI(imagePath string) string {
+	if imagePath == "" {
+		return ""
+	}
+	data, err := os.ReadFile(resolveWorkingPath(imagePath))
+	if err != nil {
+		return ""
+	}
+	info, err := detectImage(data)
+	if err != nil {
+		return ""
+	}
+	return "data:" + info.MimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// writeZip creates the archive at path, removing it again if fill fails.
+func writeZip(path string, fill func(zw *zip.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	err = fill(zw)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+func writeZipEntry(zw *zip.Writer, name string, data []byte, method uint16) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: filepath.ToSlash(name), Method: method, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, bytes.NewReader(data))
+	return err
+}
@@ -0,0 +1,400 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// ComicLayout describes how panels are arranged on a single comic page.
+type ComicLayout struct {
+	Name        string
+	Orientation string // "P" or "L"
+	Rows        int
+	Cols        int
+}
+
+// PanelsPerPage returns the number of panels that fit on one page.
+func (l ComicLayout) PanelsPerPage() int {
+	return l.Rows * l.Cols
+}
+
+var (
+	// LayoutGrid2x2 places four panels per portrait page.
+	LayoutGrid2x2 = ComicLayout{Name: "grid_2x2", Orientation: "P", Rows: 2, Cols: 2}
+	// LayoutStrip3 places a classic three-panel strip on a landscape page.
+	LayoutStrip3 = ComicLayout{Name: "strip_3", Orientation: "L", Rows: 1, Cols: 3}
+)
+
+// ChooseComicLayout picks a layout for the given number of panels. Short
+// stories read best as a single strip; anything longer is laid out in grids.
+func ChooseComicLayout(panelCount int) ComicLayout {
+	if panelCount <= LayoutStrip3.PanelsPerPage() {
+		return LayoutStrip3
+	}
+	return LayoutGrid2x2
+}
+
+// ComicPanel is a single illustrated sentence.
+type ComicPanel struct {
+	Text      string
+	ImagePath string
+}
+
+// ComicCover holds the details printed on the cover page.
+type ComicCover struct {
+	Title     string
+	Author    string
+	Thumbnail string
+	Date      time.Time
+}
+
+const (
+	comicMargin       = 12.0
+	comicGutter       = 6.0
+	comicFooterHeight = 8.0
+	comicPanelPadding = 2.5
+	comicTextMaxRatio = 0.4
+	comicFontSize     = 11.0
+	comicMinFontSize  = 7.0
+	comicLineHeight   = 1.25
+)
+
+// comicRenderer draws panels onto a gofpdf document according to a layout.
+type comicRenderer struct {
+	pdf        *gofpdf.Fpdf
+	fontFamily string
+	layout     ComicLayout
+	// panelPages is the number of numbered pages, which excludes the cover.
+	panelPages int
+}
+
+func newComicRenderer(layout ComicLayout) *comicRenderer {
+	pdf, family := newUnicodePDF(layout.Orientation)
+	pdf.SetAutoPageBreak(false, 0)
+	r := &comicRenderer{pdf: pdf, fontFamily: family, layout: layout}
+	pdf.SetFooterFunc(r.drawFooter)
+	return r
+}
+
+// text prepares a string for output and switches the document into the
+// matching writing direction.
+func (r *comicRenderer) text(s string) string {
+	prepared, rtl := prepareUnicodeText(s)
+	r.setDirection(rtl)
+	return prepared
+}
+
+func (r *comicRenderer) setDirection(rtl bool) {
+	if rtl {
+		r.pdf.RTL()
+	} else {
+		r.pdf.LTR()
+	}
+}
+
+func (r *comicRenderer) setFont(style string, size float64) {
+	r.pdf.SetFont(r.fontFamily, style, size)
+}
+
+// drawFooter prints page numbers on every page except the cover, which is
+// not counted either.
+func (r *comicRenderer) drawFooter() {
+	if r.pdf.PageNo() == 1 {
+		return
+	}
+	pageW, pageH := r.pdf.GetPageSize()
+	r.setFont("I", 8)
+	r.pdf.SetTextColor(110, 110, 110)
+	r.pdf.SetXY(comicMargin, pageH-comicMargin)
+	r.setDirection(false)
+	r.pdf.CellFormat(pageW-2*comicMargin, comicFooterHeight/2,
+		fmt.Sprintf("Page %d of %d", r.pdf.PageNo()-1, r.panelPages), "", 0, "C", false, 0, "")
+	r.pdf.SetTextColor(0, 0, 0)
+}
+
+// DrawCover renders the title page with the story title, author and thumbnail.
+func (r *comicRenderer) DrawCover(cover ComicCover) {
+	r.pdf.AddPageFormat("P", r.pdf.GetPageSizeStr("A4"))
+	pageW, pageH := r.pdf.GetPageSize()
+	contentW := pageW - 2*comicMargin
+
+	r.setFont("B", 28)
+	r.pdf.SetXY(comicMargin, comicMargin+15)
+	r.pdf.MultiCell(contentW, 12, r.text(cover.Title), "", "C", false)
+
+	if cover.Author != "" {
+		r.setFont("I", 14)
+		r.pdf.SetX(comicMargin)
+		r.pdf.MultiCell(contentW, 8, r.text("by "+cover.Author), "", "C", false)
+	}
+
+	boxY := r.pdf.GetY() + 10
+	boxH := pageH - boxY - comicMargin - 20
+	if cover.Thumbnail != "" {
+		if !r.drawImage(cover.Thumbnail, comicMargin, boxY, contentW, boxH) {
+			r.drawPlaceholder(comicMargin, boxY, contentW, boxH)
+		}
+	}
+
+	if !cover.Date.IsZero() {
+		r.setFont("", 10)
+		r.pdf.SetXY(comicMargin, pageH-comicMargin-10)
+		r.setDirection(false)
+		r.pdf.CellFormat(contentW, 6, cover.Date.Format("2 January 2006"), "", 0, "C", false, 0, "")
+	}
+}
+
+// DrawPanels lays the panels out page by page according to the layout.
+func (r *comicRenderer) DrawPanels(panels []ComicPanel) {
+	perPage := r.layout.PanelsPerPage()
+	r.panelPages = (len(panels) + perPage - 1) / perPage
+	for start := 0; start < len(panels); start += perPage {
+		end := start + perPage
+		if end > len(panels) {
+			end = len(panels)
+		}
+		r.drawPage(panels[start:end])
+	}
+}
+
+func (r *comicRenderer) drawPage(panels []ComicPanel) {
+	r.pdf.AddPageFormat(r.layout.Orientation, r.pdf.GetPageSizeStr("A4"))
+	pageW, pageH := r.pdf.GetPageSize()
+
+	areaW := pageW - 2*comicMargin
+	areaH := pageH - 2*comicMargin - comicFooterHeight
+	cellW := (areaW - float64(r.layout.Cols-1)*comicGutter) / float64(r.layout.Cols)
+	cellH := (areaH - float64(r.layout.Rows-1)*comicGutter) / float64(r.layout.Rows)
+
+	for i, panel := range panels {
+		row := i / r.layout.Cols
+		col := i % r.layout.Cols
+		x := comicMargin + float64(col)*(cellW+comicGutter)
+		y := comicMargin + float64(row)*(cellH+comicGutter)
+		r.drawPanel(panel, x, y, cellW, cellH)
+	}
+}
+
+// drawPanel renders a bordered panel: the illustration fills the space left
+// over once the speech bubble or caption box has been sized to its text.
+func (r *comicRenderer) drawPanel(panel ComicPanel, x, y, w, h float64) {
+	r.pdf.SetLineWidth(0.6)
+	r.pdf.SetDrawColor(0, 0, 0)
+	r.pdf.Rect(x, y, w, h, "D")
+
+	innerX, innerY := x+comicPanelPadding, y+comicPanelPadding
+	innerW, innerH := w-2*comicPanelPadding, h-2*comicPanelPadding
+
+	text := strings.TrimSpace(panel.Text)
+	speech := isDialogue(text)
+
+	var boxH float64
+	var lines []string
+	var fontSize float64
+	var rtl bool
+	if text != "" {
+		lines, fontSize, boxH, rtl = r.fitText(text, innerW-4, innerH*comicTextMaxRatio)
+	}
+
+	imgY, imgH := innerY, innerH
+	if boxH > 0 {
+		imgH = innerH - boxH - comicPanelPadding
+		if speech {
+			imgY = innerY + boxH + comicPanelPadding
+		}
+	}
+
+	if panel.ImagePath == "" || !r.drawImage(panel.ImagePath, innerX, imgY, innerW, imgH) {
+		r.drawPlaceholder(innerX, imgY, innerW, imgH)
+	}
+
+	if boxH == 0 {
+		return
+	}
+	if speech {
+		r.drawSpeechBubble(lines, fontSize, rtl, innerX, innerY, innerW, boxH)
+	} else {
+		r.drawCaption(lines, fontSize, rtl, innerX, innerY+innerH-boxH, innerW, boxH)
+	}
+}
+
+// fitText wraps text to width, shrinking the font until it fits within
+// maxH. If even the smallest size overflows, the text is truncated.
+func (r *comicRenderer) fitText(text string, width, maxH float64) ([]string, float64, float64, bool) {
+	prepared, rtl := prepareUnicodeText(text)
+	for size := comicFontSize; ; size-- {
+		r.setFont("", size)
+		lineH := r.lineHeight(size)
+		lines := r.pdf.SplitText(prepared, width)
+		boxH := float64(len(lines))*lineH + 4
+		if boxH <= maxH {
+			return lines, size, boxH, rtl
+		}
+		if size <= comicMinFontSize {
+			maxLines := int((maxH - 4) / lineH)
+			if maxLines < 1 {
+				maxLines = 1
+			}
+			if len(lines) > maxLines {
+				lines = lines[:maxLines]
+				lines[maxLines-1] = strings.TrimRight(lines[maxLines-1], " .") + "..."
+			}
+			return lines, size, float64(len(lines))*lineH + 4, rtl
+		}
+	}
+}
+
+func (r *comicRenderer) lineHeight(fontSize float64) float64 {
+	return fontSize * 0.3528 * comicLineHeight
+}
+
+func (r *comicRenderer) drawCaption(lines []string, fontSize float64, rtl bool, x, y, w, h float64) {
+	r.pdf.SetFillColor(255, 244, 196)
+	r.pdf.SetLineWidth(0.4)
+	r.pdf.Rect(x, y, w, h, "FD")
+	align := "L"
+	if rtl {
+		align = "R"
+	}
+	r.writeLines(lines, fontSize, rtl, x+2, y+2, w-4, align)
+}
+
+// drawSpeechBubble draws a rounded bubble with a tail pointing down into the
+// illustration.
+func (r *comicRenderer) drawSpeechBubble(lines []string, fontSize float64, rtl bool, x, y, w, h float64) {
+	r.pdf.SetFillColor(255, 255, 255)
+	r.pdf.SetLineWidth(0.4)
+	r.pdf.RoundedRect(x, y, w, h, 3, "1234", "FD")
+
+	tailX := x + w*0.25
+	r.pdf.Polygon([]gofpdf.PointType{
+		{X: tailX, Y: y + h - 0.3},
+		{X: tailX + 6, Y: y + h - 0.3},
+		{X: tailX + 1, Y: y + h + comicPanelPadding + 2},
+	}, "FD")
+	// Cover the bubble outline where the tail joins it.
+	r.pdf.SetDrawColor(255, 255, 255)
+	r.pdf.Line(tailX+0.4, y+h-0.3, tailX+5.6, y+h-0.3)
+	r.pdf.SetDrawColor(0, 0, 0)
+
+	r.writeLines(lines, fontSize, rtl, x+2, y+2, w-4, "C")
+}
+
+func (r *comicRenderer) writeLines(lines []string, fontSize float64, rtl bool, x, y, w float64, align string) {
+	r.setFont("", fontSize)
+	r.setDirection(rtl)
+	lineH := r.lineHeight(fontSize)
+	for i, line := range lines {
+		r.pdf.SetXY(x, y+float64(i)*lineH)
+		r.pdf.CellFormat(w, lineH, line, "", 0, align, false, 0, "")
+	}
+}
+
+func (r *comicRenderer) drawPlaceholder(x, y, w, h float64) {
+	r.pdf.SetFillColor(235, 235, 235)
+	r.pdf.SetLineWidth(0.2)
+	r.pdf.Rect(x, y, w, h, "F")
+}
+
+// drawImage registers the image under its detected type and draws it inside
+// the box, preserving its aspect ratio. It reports whether anything was drawn.
+func (r *comicRenderer) drawImage(path string, x, y, w, h float64) bool {
+	if w <= 0 || h <= 0 {
+		return false
+	}
+	imgPath := resolveWorkingPath(path)
+	data, err := os.ReadFile(imgPath)
+	if err != nil {
+		return false
+	}
+	info, err := detectImage(data)
+	if err != nil {
+		return false
+	}
+
+	opts := gofpdf.ImageOptions{ImageType: info.PDFType, ReadDpi: false}
+	r.pdf.RegisterImageOptionsReader(imgPath, opts, bytes.NewReader(data))
+	if !r.pdf.Ok() {
+		// A corrupt image must not poison the rest of the document.
+		r.pdf.ClearError()
+		return false
+	}
+
+	fx, fy, fw, fh := fitRect(float64(info.Width), float64(info.Height), x, y, w, h)
+	r.pdf.ImageOptions(imgPath, fx, fy, fw, fh, false, opts, 0, "")
+	return true
+}
+
+// imageInfo describes an image file's real format and pixel dimensions.
+type imageInfo struct {
+	MimeType string
+	PDFType  string
+	Width    int
+	Height   int
+}
+
+// detectImage sniffs the image format from its content rather than trusting
+// the file extension.
+func detectImage(data []byte) (*imageInfo, error) {
+	mimeType := http.DetectContentType(data)
+	var pdfType string
+	switch mimeType {
+	case "image/png":
+		pdfType = "PNG"
+	case "image/jpeg":
+		pdfType = "JPG"
+	case "image/gif":
+		pdfType = "GIF"
+	default:
+		return nil, fmt.Errorf("unsupported image type: %s", mimeType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image header: %w", err)
+	}
+	if cfg.Width == 0 || cfg.Height == 0 {
+		return nil, fmt.Errorf("image has no dimensions")
+	}
+
+	return &imageInfo{MimeType: mimeType, PDFType: pdfType, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// fitRect scales an image of imgW x imgH to fit inside the box while
+// preserving its aspect ratio, centring it in the leftover space.
+func fitRect(imgW, imgH, boxX, boxY, boxW, boxH float64) (x, y, w, h float64) {
+	scale := boxW / imgW
+	if imgH*scale > boxH {
+		scale = boxH / imgH
+	}
+	w, h = imgW*scale, imgH*scale
+	return boxX + (boxW-w)/2, boxY + (boxH-h)/2, w, h
+}
+
+// isDialogue reports whether a sentence is spoken by a character, in which
+// case it is drawn as a speech bubble instead of a caption.
+func isDialogue(text string) bool {
+	for _, r := range text {
+		if r == '"' || r == '“' || r == '”' {
+			return true
+		}
+	}
+	trimmed := strings.TrimFunc(text, unicode.IsSpace)
+	return strings.HasPrefix(trimmed, "'") && strings.Count(trimmed, "'") >= 2
+}
+
+// Output writes the finished document to the given path.
+func (r *comicRenderer) Output(path string) error {
+	return r.pdf.OutputFileAndClose(path)
+}
@@ -1,9 +1,13 @@
 package service
 
 import (
-	"encoding/base64"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 
+	"gorm.io/gorm"
 	"inkwell-backend-V2.0/internal/model"
 	"inkwell-backend-V2.0/internal/repository"
 	"inkwell-backend-V2.0/pkg/event_bus"
@@ -12,24 +16,45 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/jung-kurt/gofpdf"
 )
 
+// ErrStoryNotFound is returned when a story does not exist or belongs to another user.
+var ErrStoryNotFound = errors.New("story not found")
+
+// ErrStoryNotCompleted is returned when a comic is requested for an unfinished story.
+var ErrStoryNotCompleted = errors.New("story is not completed")
+
 type ComicService interface {
 	GenerateComic(storyID uint) error
+	RebuildComic(userID, storyID uint) (*model.Comic, error)
+	GetComicVersions(userID, storyID uint) ([]model.Comic, error)
 }
 
 type comicService struct {
 	storyRepo repository.StoryRepository
+	userRepo  repository.UserRepository
 }
 
-func NewComicService(storyRepo repository.StoryRepository) ComicService {
-	return &comicService{storyRepo: storyRepo}
+func NewComicService(storyRepo repository.StoryRepository, userRepo repository.UserRepository) ComicService {
+	return &comicService{storyRepo: storyRepo, userRepo: userRepo}
 }
 
-func InitComicEventListeners(storyRepo repository.StoryRepository) {
+// comicLocks serialises generation per story so the completion event and
+// the startup sync cannot race each other into the same version number.
+// Stories share a fixed set of locks, so the set does not grow with them.
+var comicLocks [comicLockStripes]sync.Mutex
+
+const comicLockStripes = 64
+
+func lockComic(storyID uint) func() {
+	mu := &comicLocks[storyID%comicLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+func InitComicEventListeners(storyRepo repository.StoryRepository, userRepo repository.UserRepository) {
 	event_bus.GlobalEventBus.Subscribe("story_completed", func(data interface{}) {
 		storyID, ok := data.(uint)
 		if !ok {
@@ -38,7 +63,7 @@ func InitComicEventListeners(storyRepo repository.StoryRepository) {
 		}
 
 		log.Printf("[Event] Story completed: Generating comic for story ID %d", storyID)
-		comicService := NewComicService(storyRepo)
+		comicService := NewComicService(storyRepo, userRepo)
 		err := comicService.GenerateComic(storyID)
 		if err != nil {
 			log.Printf("Error generating comic for story %d: %v", storyID, err)
@@ -46,102 +71,215 @@ func InitComicEventListeners(storyRepo repository.StoryRepository) {
 	})
 }
 
-func encodeImageToBase64(imgPath string) (string, error) {
-	imgData, err := os.ReadFile(imgPath)
-	if err != nil {
-		return "", err
+// resolveWorkingPath maps a stored media path (relative to working/) to a path on disk.
+func resolveWorkingPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
 	}
-	return base64.StdEncoding.EncodeToString(imgData), nil
+	return filepath.Join("working", path)
 }
 
+// GenerateComic builds a new comic version for the story if its sentences or
+// images have changed since the latest version; otherwise it does nothing.
 func (s *comicService) GenerateComic(storyID uint) error {
+	_, err := s.generate(storyID, false)
+	return err
+}
+
+// RebuildComic forces a new comic version for one of the user's stories,
+// even if the content is unchanged.
+func (s *comicService) RebuildComic(userID, storyID uint) (*model.Comic, error) {
+	story, err := s.ownedStory(userID, storyID)
+	if err != nil {
+		return nil, err
+	}
+	if story.Status != "completed" {
+		return nil, ErrStoryNotCompleted
+	}
+	return s.generate(storyID, true)
+}
+
+// GetComicVersions lists every comic version of one of the user's stories, newest first.
+func (s *comicService) GetComicVersions(userID, storyID uint) ([]model.Comic, error) {
+	if _, err := s.ownedStory(userID, storyID); err != nil {
+		return nil, err
+	}
+	return s.storyRepo.GetComicVersions(storyID)
+}
+
+func (s *comicService) ownedStory(userID, storyID uint) (*model.Story, error) {
+	story, err := s.storyRepo.GetStoryByID(storyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrStoryNotFound
+		}
+		return nil, err
+	}
+	if story.UserID != userID {
+		return nil, ErrStoryNotFound
+	}
+	return story, nil
+}
+
+func (s *comicService) generate(storyID uint, force bool) (*model.Comic, error) {
+	unlock := lockComic(storyID)
+	defer unlock()
+
 	log.Printf("[Start] Generating comic for story ID %d", storyID)
 
 	story, err := s.storyRepo.GetStoryByID(storyID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch story: %w", err)
+		return nil, fmt.Errorf("failed to fetch story: %w", err)
 	}
 	log.Printf("Fetched story: ID %d, Title: %s", story.ID, story.Title)
 
 	sentences, err := s.storyRepo.GetSentencesByStory(storyID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch sentences: %w", err)
+		return nil, fmt.Errorf("failed to fetch sentences: %w", err)
 	}
 	log.Printf("Fetched %d sentences for story ID %d", len(sentences), storyID)
 
+	hash := comicContentHash(story, sentences)
+	version := 1
+	latest, err := s.storyRepo.GetLatestComic(storyID)
+	switch {
+	case err == nil:
+		if latest.ContentHash == hash && !force {
+			log.Printf("Comic for story ID %d is up to date (version %d)", storyID, latest.Version)
+			return latest, nil
+		}
+		version = latest.Version + 1
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, fmt.Errorf("failed to fetch latest comic: %w", err)
+	}
+
 	if _, err := os.Stat("working/comics"); os.IsNotExist(err) {
 		log.Println("Creating missing directory: working/comics")
 		err := os.MkdirAll("working/comics", os.ModePerm)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.SetFont("Arial", "B", 16)
-	pdf.AddPage()
-	pdf.Cell(40, 10, story.Title)
-	pdf.Ln(20)
-
+	panels := make([]ComicPanel, 0, len(sentences))
 	for _, sentence := range sentences {
-		pdf.SetFont("Arial", "", 12)
-		imgPath := sentence.ImageURL
-		if !filepath.IsAbs(imgPath) {
-			imgPath = filepath.Join("working", imgPath)
+		text := sentence.CorrectedText
+		if text == "" {
+			text = sentence.OriginalText
 		}
+		panels = append(panels, ComicPanel{Text: text, ImagePath: sentence.ImageURL})
+	}
 
-		log.Printf("Processing image: %s", imgPath)
-		if sentence.ImageURL != "" {
-			if _, err := os.Stat(imgPath); err == nil {
-				log.Printf("Image found: %s", imgPath)
-				base64Img, err := encodeImageToBase64(imgPath)
-				if err == nil {
-					pdf.RegisterImageOptionsReader(imgPath, gofpdf.ImageOptions{ImageType: "JPG"}, base64.NewDecoder(base64.StdEncoding, strings.NewReader(base64Img)))
-					pdf.Image(imgPath, 10, pdf.GetY(), 180, 100, false, "", 0, "")
-				} else {
-					log.Printf("Error encoding image to Base64: %v", err)
-				}
-				pdf.Ln(105)
-			} else {
-				log.Printf("Image not found: %s, adding empty box", imgPath)
-				pdf.Rect(10, pdf.GetY(), 180, 100, "D")
-				pdf.Ln(105)
-			}
-		} else {
-			log.Println("No image URL found, adding empty box")
-			pdf.Rect(10, pdf.GetY(), 180, 100, "D")
-			pdf.Ln(105)
-		}
-		pdf.MultiCell(0, 10, sentence.CorrectedText, "", "L", false)
-		pdf.Ln(10)
+	thumbnail := generateThumbnail(sentences)
+	doc := ComicDocument{
+		Cover: ComicCover{
+			Title:     story.Title,
+			Author:    s.authorName(story.UserID),
+			Thumbnail: thumbnail,
+			Date:      story.UpdatedAt,
+		},
+		Panels: panels,
 	}
 
-	outputPath := filepath.Join("working/comics", fmt.Sprintf("comic_%d.pdf", storyID))
-	log.Printf("Saving comic to: %s", outputPath)
-	err = pdf.OutputFileAndClose(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to save PDF: %w", err)
+	baseName := fmt.Sprintf("comic_%d_v%d", storyID, version)
+	var formats []string
+	for _, format := range ComicFormats {
+		outputPath := filepath.Join("working/comics", baseName+format.Extension)
+		log.Printf("Saving %s comic to: %s", format.Name, outputPath)
+		if err := format.Export(outputPath, doc); err != nil {
+			// The PDF is the primary artefact; the other formats are best effort.
+			if format.Name == "pdf" {
+				return nil, fmt.Errorf("failed to save PDF: %w", err)
+			}
+			log.Printf("Failed to export %s comic for story ID %d: %v", format.Name, storyID, err)
+			continue
+		}
+		formats = append(formats, format.Name)
 	}
 
 	comic := model.Comic{
 		UserID:      story.UserID,
 		Title:       story.Title,
 		StoryID:     story.ID,
-		Thumbnail:   generateThumbnail(sentences),
-		ViewURL:     filepath.Join("comics", fmt.Sprintf("comic_%d.pdf", storyID)),
-		DownloadURL: filepath.Join("comics", fmt.Sprintf("comic_%d.pdf", storyID)),
+		Version:     version,
+		ContentHash: hash,
+		Thumbnail:   thumbnail,
+		ViewURL:     filepath.Join("comics", baseName+".pdf"),
+		DownloadURL: filepath.Join("comics", baseName+".pdf"),
+		Formats:     strings.Join(formats, ","),
 		DoneOn:      time.Now(),
 	}
 
 	err = s.storyRepo.SaveComic(&comic)
 	if err != nil {
-		return fmt.Errorf("failed to save comic record: %w", err)
+		return nil, fmt.Errorf("failed to save comic record: %w", err)
 	}
 
-	log.Printf("Successfully generated and saved comic for story ID %d", storyID)
+	log.Printf("Successfully generated and saved comic version %d for story ID %d", version, storyID)
+	return &comic, nil
+}
+
+// comicContentHash fingerprints everything that ends up in the comic: the
+// title, each sentence's text and the bytes of its image.
+func comicContentHash(story *model.Story, sentences []model.Sentence) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "title:%s\n", story.Title)
+	for _, sentence := range sentences {
+		fmt.Fprintf(h, "sentence:%d\ntext:%s\ncorrected:%s\nimage:%s\n",
+			sentence.ID, sentence.OriginalText, sentence.CorrectedText, sentence.ImageURL)
+		if sentence.ImageURL == "" {
+			continue
+		}
+		if f, err := os.Open(resolveWorkingPath(sentence.ImageURL)); err == nil {
+			_, _ = io.Copy(h, f)
+			f.Close()
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// BackfillComicHashes fingerprints the latest comic of each story made
+// before comics were versioned, from the story's current content. Without a
+// hash every such comic would look stale and be rebuilt on the next start.
+func BackfillComicHashes(storyRepo repository.StoryRepository) error {
+	comics, err := storyRepo.GetUnhashedLatestComics()
+	if err != nil {
+		return err
+	}
+	for _, comic := range comics {
+		story, err := storyRepo.GetStoryByID(comic.StoryID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sentences, err := storyRepo.GetSentencesByStory(comic.StoryID)
+		if err != nil {
+			return err
+		}
+		if err := storyRepo.SetComicContentHash(comic.ID, comicContentHash(story, sentences)); err != nil {
+			return err
+		}
+	}
+	if len(comics) > 0 {
+		log.Printf("Fingerprinted %d comics made before versioning", len(comics))
+	}
 	return nil
 }
 
+// authorName returns the name printed on the comic cover. It is the
+// username rather than the learner's real name, since comic files are
+// served without authentication.
+func (s *comicService) authorName(userID uint) string {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Could not load author for user ID %d: %v", userID, err)
+		return ""
+	}
+	return user.Username
+}
+
 func generateThumbnail(sentences []model.Sentence) string {
 	for _, sentence := range sentences {
 		if sentence.ImageURL != "" {
@@ -153,29 +291,24 @@ func generateThumbnail(sentences []model.Sentence) string {
 	return ""
 }
 
-func GenerateMissingComics(storyRepo repository.StoryRepository) {
-	stories, err := storyRepo.GetAllStoriesWithoutComics()
+// GenerateMissingComics brings every completed story's comic up to date,
+// generating a first version where none exists and a new version where the
+// story has changed since its comic was built.
+func GenerateMissingComics(storyRepo repository.StoryRepository, userRepo repository.UserRepository) {
+	stories, err := storyRepo.GetCompletedStories()
 	if err != nil {
-		log.Printf("Error fetching stories without comics: %v", err)
+		log.Printf("Error fetching completed stories: %v", err)
 		return
 	}
 
-	log.Printf("Found %d stories without comics", len(stories))
-
-	if len(stories) == 0 {
-		log.Println("All stories already have comics.")
-		return
-	}
+	log.Printf("Checking comics for %d completed stories", len(stories))
 
-	comicService := NewComicService(storyRepo)
+	comicService := NewComicService(storyRepo, userRepo)
 
 	for _, story := range stories {
-		log.Printf("Generating comic for story ID: %d, Title: %s", story.ID, story.Title)
 		err := comicService.GenerateComic(story.ID)
 		if err != nil {
 			log.Printf("Failed to generate comic for story ID %d: %v", story.ID, err)
-		} else {
-			log.Printf("Successfully generated comic for story ID %d", story.ID)
 		}
 	}
 }
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"inkwell-backend-V2.0/internal/model"
+)
+
+const exportReadme = `This archive holds the data Inkwell stores about your account.
+
+profile.json          your account, linked logins, sessions and login attempts
+assessments.json      assessments with your answers
+skill_estimates.json  your estimated skill per topic
+level_history.json    changes of your level
+review_cards.json     your spaced-repetition cards
+stories.json          your stories with their sentences and feedback
+comics.json           every comic version of your stories
+privacy_events.json   exports and deletion requests on your account
+avatar/, images/, comics/, reports/
+                      your avatar, story images, comic files and progress reports
+
+Chat messages are not stored, so they are not part of the export.
+`
+
+// buildExport writes a ZIP archive of the user's data to zipPath and returns
+// its size. Files missing from disk are skipped.
+func (s *privacyService) buildExport(userID uint, zipPath string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(zipPath), 0o700); err != nil {
+		return 0, err
+	}
+	data, err := s.privacyRepo.GetUserData(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	sentences := make(map[uint][]model.Sentence)
+	for _, sentence := range data.Sentences {
+		sentences[sentence.StoryID] = append(sentences[sentence.StoryID], sentence)
+	}
+	type storyExport struct {
+		model.Story
+		Sentences []model.Sentence `json:"sentences"`
+	}
+	stories := make([]storyExport, 0, len(data.Stories))
+	for _, story := range data.Stories {
+		stories = append(stories, storyExport{Story: story, Sentences: sentences[story.ID]})
+	}
+
+	documents := []struct {
+		name  string
+		value interface{}
+	}{
+		{"profile.json", map[string]interface{}{
+			"user":           data.User,
+			"identities":     data.Identities,
+			"sessions":       data.Sessions,
+			"login_attempts": data.LoginAttempts,
+		}},
+		{"assessments.json", data.Assessments},
+		{"skill_estimates.json", data.SkillEstimates},
+		{"level_history.json", data.LevelHistory},
+		{"review_cards.json", data.ReviewCards},
+		{"stories.json", stories},
+		{"comics.json", data.Comics},
+		{"privacy_events.json", data.Events},
+	}
+
+	err = writeZip(zipPath, func(zw *zip.Writer) error {
+		if err := writeZipEntry(zw, "README.txt", []byte(exportReadme), zip.Deflate); err != nil {
+			return err
+		}
+		for _, doc := range documents {
+			body, err := json.MarshalIndent(doc.value, "", "  ")
+			if err != nil {
+				return fmt.Errorf("%s: %w", doc.name, err)
+			}
+			if err := writeZipEntry(zw, doc.name, body, zip.Deflate); err != nil {
+				return err
+			}
+		}
+
+		addFile := func(name, diskPath string) error {
+			body, err := os.ReadFile(diskPath)
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return writeZipEntry(zw, name, body, zip.Store)
+		}
+		if data.User.AvatarPath != "" {
+			if err := addFile(path.Join("avatar", filepath.Base(data.User.AvatarPath)), resolveWorkingPath(data.User.AvatarPath)); err != nil {
+				return err
+			}
+		}
+		for _, sentence := range data.Sentences {
+			if sentence.ImageURL == "" {
+				continue
+			}
+			if err := addFile(path.Join("images", filepath.Base(sentence.ImageURL)), resolveWorkingPath(sentence.ImageURL)); err != nil {
+				return err
+			}
+		}
+		for _, comic := range data.Comics {
+			for _, file := range comicFiles(comic) {
+				if err := addFile(path.Join("comics", filepath.Base(file)), file); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, report := range []struct{ name, kind string }{
+			{"progress_report.pdf", ReportCurrent},
+			{"initial_progress_report.pdf", ReportInitial},
+		} {
+			pdf, err := s.progressReport(data.User, report.kind)
+			if err != nil {
+				log.Printf("Skipping %s report in export of user %d: %v", report.kind, userID, err)
+				continue
+			}
+			if err := writeZipEntry(zw, path.Join("reports", report.name), pdf, zip.Deflate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(zipPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s *privacyService) progressReport(user *model.User, kind string) ([]byte, error) {
+	report, err := BuildProgressReport(s.db, user, kind, ReportRange{})
+	if err != nil {
+		return nil, err
+	}
+	return RenderProgressReport(report)
+}
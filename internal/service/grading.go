@@ -0,0 +1,304 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"inkwell-backend-V2.0/internal/llm"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// Grading stages, recorded on each answer as GradedBy.
+const (
+	GradedExact        = "exact"
+	GradedNormalized   = "normalized"
+	GradedAlternative  = "alternative"
+	GradedEditDistance = "edit_distance"
+	GradedChoice       = "choice"
+	GradedLength       = "length"
+	GradedLLM          = "llm"
+	GradedRubric       = "rubric"
+	GradedFallback     = "fallback" // the LLM was needed but failed
+	GradedTimeout      = "timeout"  // answered after the question's time limit
+)
+
+// Answers less similar than farMissSimilarity to every accepted answer are
+// wrong without asking the LLM. A single-letter slip in a word of at least
+// typoMinWordLength letters is accepted as a typo. Answers much longer than
+// every accepted answer are not sent to the LLM either: they are rejected
+// once longer than llmLengthFactor times the longest accepted answer plus
+// llmLengthSlack runes, or than maxLLMAnswerRunes.
+const (
+	farMissSimilarity = 0.5
+	typoMinWordLength = 6
+	llmLengthFactor   = 2
+	llmLengthSlack    = 20
+	maxLLMAnswerRunes = 500
+)
+
+// inflectionSuffixes are the endings whose misuse is a grammar mistake
+// rather than a typo, longest first.
+var inflectionSuffixes = []string{"ing", "ed", "en", "es", "s", "d", "n"}
+
+// alternativeSeparator joins a question's alternative answers in the database and in CSV.
+const alternativeSeparator = "|"
+
+// matchPolicy selects the grading stages a question type uses after the
+// exact, normalised and alternative matches.
+type matchPolicy struct {
+	original string // the sentence to be corrected; repeating it is wrong
+	farMiss  bool   // reject answers far from every accepted answer
+	typos    bool   // accept a one-letter slip in a long word, unless it changes an inflection
+	llm      bool   // ask the LLM about answers no earlier stage decided
+}
+
+// gradeText grades a written answer in stages: exact match, normalised
+// match, accepted alternatives, edit distance and, only for answers still
+// undecided, the LLM. If the LLM fails the answer is marked incorrect as a
+// fallback rather than failing the submission.
+func gradeText(client *llm.OllamaClient, q *model.Question, task, answer string, alternatives []string, policy matchPolicy) GradeResult {
+	accepted := append([]string{q.CorrectAnswer}, alternatives...)
+	trimmed := strings.TrimSpace(answer)
+	for i, acc := range accepted {
+		if acc != "" && trimmed == strings.TrimSpace(acc) {
+			if i == 0 {
+				return correctResult(GradedExact, "matches the correct answer exactly")
+			}
+			return correctResult(GradedAlternative, fmt.Sprintf("matches accepted alternative %q", acc))
+		}
+	}
+
+	strict := punctuationSensitive(q.Category)
+	norm := normalizeAnswer
+	normalized := "case, spacing, quotes and punctuation"
+	if strict {
+		norm = normalizeSpacing
+		normalized = "spacing and quote style"
+	}
+	a := norm(answer)
+	for i, acc := range accepted {
+		if acc == "" || a != norm(acc) {
+			continue
+		}
+		if i == 0 {
+			return correctResult(GradedNormalized, "matches the correct answer ignoring "+normalized)
+		}
+		return correctResult(GradedAlternative, fmt.Sprintf("matches accepted alternative %q ignoring %s", acc, normalized))
+	}
+	if policy.original != "" && a == norm(policy.original) {
+		return incorrectResult(q.CorrectAnswer, GradedNormalized, "repeats the original sentence unchanged")
+	}
+
+	closest, similarity := "", -1.0
+	for _, acc := range accepted {
+		if acc == "" {
+			continue
+		}
+		if sim := similarityRatio(a, norm(acc)); sim > similarity {
+			closest, similarity = acc, sim
+		}
+	}
+	if policy.typos && !strict && !spellingSensitive(q.Category) && !grammarSensitive(q.Category) && isTypo(a, norm(closest)) {
+		res := correctResult(GradedEditDistance, fmt.Sprintf("one-letter slip from %q", closest))
+		res.Feedback = "Correct, but check the spelling: " + closest
+		return res
+	}
+	if policy.farMiss && similarity < farMissSimilarity {
+		return incorrectResult(q.CorrectAnswer, GradedEditDistance,
+			fmt.Sprintf("similarity %.2f to closest accepted answer %q", similarity, closest))
+	}
+	if !policy.llm {
+		return incorrectResult(q.CorrectAnswer, GradedNormalized, "does not match any accepted answer")
+	}
+	if n, limit := utf8.RuneCountInString(trimmed), llmAnswerLimit(accepted); n > limit {
+		res := incorrectResult(q.CorrectAnswer, GradedLength, fmt.Sprintf("%d runes, over the limit of %d", n, limit))
+		res.Feedback = "Your answer is much longer than expected; keep it to one sentence."
+		return res
+	}
+
+	correct, feedback, err := client.EvaluateAnswer(task, answer, q.CorrectAnswer)
+	if err != nil {
+		log.Printf("LLM grading failed for question %d, marking incorrect: %v", q.ID, err)
+		return incorrectResult(q.CorrectAnswer, GradedFallback, "LLM unavailable: "+err.Error())
+	}
+	res := GradeResult{Correct: correct, Feedback: feedback, GradedBy: GradedLLM,
+		Reason: fmt.Sprintf("ambiguous: similarity %.2f to closest accepted answer %q", similarity, closest)}
+	if correct {
+		res.Score = 1
+	}
+	if res.Feedback == "" {
+		res.Feedback = exactFeedback(correct, q.CorrectAnswer)
+	}
+	return res
+}
+
+func correctResult(stage, reason string) GradeResult {
+	return GradeResult{Correct: true, Score: 1, Feedback: "Correct", GradedBy: stage, Reason: reason}
+}
+
+func incorrectResult(expected, stage, reason string) GradeResult {
+	return GradeResult{Feedback: exactFeedback(false, expected), GradedBy: stage, Reason: reason}
+}
+
+func exactFeedback(correct bool, expected string) string {
+	if correct {
+		return "Correct"
+	}
+	return fmt.Sprintf("Incorrect. The correct answer is: %s", expected)
+}
+
+// questionAlternatives returns the other accepted answers stored on a question.
+func questionAlternatives(q *model.Question) []string {
+	return splitAlternatives(q.Alternatives)
+}
+
+func splitAlternatives(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, alternativeSeparator)
+}
+
+// punctuationSensitive reports whether a topic tests punctuation, in which
+// case punctuation and capitalisation are part of the answer.
+func punctuationSensitive(topic string) bool {
+	return strings.Contains(strings.ToLower(topic), "punctuation")
+}
+
+// spellingSensitive reports whether a topic tests spelling, in which case typos are wrong.
+func spellingSensitive(topic string) bool {
+	return strings.Contains(strings.ToLower(topic), "spelling")
+}
+
+// grammarSensitive reports whether a topic tests verb forms, where a
+// one-letter difference is usually the mistake being tested.
+func grammarSensitive(topic string) bool {
+	topic = strings.ToLower(topic)
+	return strings.Contains(topic, "verb") || strings.Contains(topic, "tense")
+}
+
+// llmAnswerLimit is the longest answer, in runes, worth sending to the LLM.
+func llmAnswerLimit(accepted []string) int {
+	longest := 0
+	for _, acc := range accepted {
+		longest = max(longest, utf8.RuneCountInString(strings.TrimSpace(acc)))
+	}
+	return min(longest*llmLengthFactor+llmLengthSlack, maxLLMAnswerRunes)
+}
+
+var quoteReplacer = strings.NewReplacer("‘", "'", "’", "'", "‚", "'", "“", `"`, "”", `"`, "„", `"`, "«", `"`, "»", `"`)
+
+// normalizeAnswer makes answers comparable regardless of case, spacing,
+// quote style and punctuation. Apostrophes inside words are kept, so
+// "its" and "it's" stay different.
+func normalizeAnswer(s string) string {
+	runes := []rune(strings.ToLower(quoteReplacer.Replace(s)))
+	for i, r := range runes {
+		if !unicode.IsPunct(r) && !unicode.IsSymbol(r) {
+			continue
+		}
+		if r == '\'' && i > 0 && i < len(runes)-1 && unicode.IsLetter(runes[i-1]) && unicode.IsLetter(runes[i+1]) {
+			continue
+		}
+		runes[i] = ' '
+	}
+	return strings.Join(strings.Fields(string(runes)), " ")
+}
+
+// normalizeSpacing only evens out whitespace and quote style, for topics
+// where punctuation and case are what is being tested.
+func normalizeSpacing(s string) string {
+	return strings.Join(strings.Fields(quoteReplacer.Replace(s)), " ")
+}
+
+// isTypo reports whether a and b differ by a single letter in one word
+// that is long enough for the slip to be a typo rather than a grammar error.
+// Words that only differ in an inflectional ending, such as "studies" for
+// "studied" or "chose" for "chosen", are not typos.
+func isTypo(a, b string) bool {
+	wa, wb := strings.Fields(a), strings.Fields(b)
+	if len(wa) != len(wb) {
+		return false
+	}
+	diff := -1
+	for i := range wa {
+		if wa[i] != wb[i] {
+			if diff >= 0 {
+				return false
+			}
+			diff = i
+		}
+	}
+	return diff >= 0 && utf8.RuneCountInString(wb[diff]) >= typoMinWordLength &&
+		levenshtein(wa[diff], wb[diff]) == 1 && !sameStem(wa[diff], wb[diff])
+}
+
+// sameStem reports whether two different words share a stem once an
+// inflectional ending is removed from either, treating a doubled final
+// consonant as single ("written" and "writen" both give "writ").
+func sameStem(a, b string) bool {
+	stems := make(map[string]bool)
+	for _, stem := range wordStems(a) {
+		stems[stem] = true
+	}
+	for _, stem := range wordStems(b) {
+		if stems[stem] {
+			return true
+		}
+	}
+	return false
+}
+
+// wordStems returns the word and every stem left by removing one
+// inflectional ending from it.
+func wordStems(word string) []string {
+	stems := []string{word}
+	for _, suffix := range inflectionSuffixes {
+		stem, ok := strings.CutSuffix(word, suffix)
+		if !ok || utf8.RuneCountInString(stem) < 2 {
+			continue
+		}
+		if r := []rune(stem); len(r) > 2 && r[len(r)-1] == r[len(r)-2] {
+			stem = string(r[:len(r)-1])
+		}
+		stems = append(stems, stem)
+	}
+	return stems
+}
+
+// similarityRatio is 1 minus the edit distance scaled by the longer string's length.
+func similarityRatio(a, b string) float64 {
+	n := utf8.RuneCountInString(a)
+	if m := utf8.RuneCountInString(b); m > n {
+		n = m
+	}
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(n)
+}
+
+// levenshtein counts the single-rune insertions, deletions and substitutions turning a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+)
+
+// Default login throttling, used for settings left at zero.
+var defaultLoginThrottle = config.LoginThrottleConfig{
+	WindowMinutes:      15,
+	FreeAttempts:       3,
+	MaxDelaySeconds:    30,
+	LockoutAttempts:    10,
+	IPLockoutAttempts:  50,
+	LockoutMinutes:     15,
+	AuditRetentionDays: 90,
+}
+
+// LoginThrottledError is returned while an account or IP address has to
+// wait before the next login attempt. It reads the same for unknown
+// accounts, so it does not reveal which accounts exist.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts; try again in %d seconds", e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds rounds the wait up to whole seconds, for the Retry-After header.
+func (e *LoginThrottledError) RetryAfterSeconds() int {
+	return int((e.RetryAfter + time.Second - 1) / time.Second)
+}
+
+func loginThrottleConfig() config.LoginThrottleConfig {
+	c := defaultLoginThrottle
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return c
+	}
+	t := cfg.Authentication.LoginThrottle
+	for _, v := range []struct{ value, def *int }{
+		{&t.WindowMinutes, &c.WindowMinutes},
+		{&t.FreeAttempts, &c.FreeAttempts},
+		{&t.MaxDelaySeconds, &c.MaxDelaySeconds},
+		{&t.LockoutAttempts, &c.LockoutAttempts},
+		{&t.IPLockoutAttempts, &c.IPLockoutAttempts},
+		{&t.LockoutMinutes, &c.LockoutMinutes},
+		{&t.AuditRetentionDays, &c.AuditRetentionDays},
+	} {
+		if *v.value > 0 {
+			*v.def = *v.value
+		}
+	}
+	return c
+}
+
+// normalizeEmail is the key failed logins are counted under.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginDelay is how long to wait after the last failure, given the number
+// of failures: nothing for the first FreeAttempts, then doubling from one
+// second up to MaxDelaySeconds.
+func loginDelay(failures int64, c config.LoginThrottleConfig) time.Duration {
+	over := failures - int64(c.FreeAttempts)
+	if over < 0 {
+		return 0
+	}
+	maxDelay := time.Duration(c.MaxDelaySeconds) * time.Second
+	if over >= 30 {
+		return maxDelay
+	}
+	return min(time.Second<<over, maxDelay)
+}
+
+// checkLoginThrottle refuses a login while the account or the IP address
+// is locked out, or the account's delay since its last failure has not passed.
+func (s *authService) checkLoginThrottle(email, ip string, now time.Time) error {
+	c := loginThrottleConfig()
+	since := now.Add(-time.Duration(c.WindowMinutes) * time.Minute)
+	lockout := time.Duration(c.LockoutMinutes) * time.Minute
+
+	retryAt := now
+	account, err := s.attemptRepo.GetEmailFailures(email, since)
+	if err != nil {
+		return err
+	}
+	if account.Last != nil {
+		if account.Count >= int64(c.LockoutAttempts) {
+			retryAt = account.Last.Add(lockout)
+		} else {
+			retryAt = account.Last.Add(loginDelay(account.Count, c))
+		}
+	}
+	byIP, err := s.attemptRepo.GetIPFailures(ip, since)
+	if err != nil {
+		return err
+	}
+	if byIP.Last != nil && byIP.Count >= int64(c.IPLockoutAttempts) {
+		retryAt = later(retryAt, byIP.Last.Add(lockout))
+	}
+	if retryAt.After(now) {
+		return &LoginThrottledError{RetryAfter: retryAt.Sub(now)}
+	}
+	return nil
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// loginLocks serialise the logins of one email within this instance, so
+// that at most one of them holds a database connection while it waits for
+// the email's advisory lock.
+var loginLocks [loginLockStripes]sync.Mutex
+
+const loginLockStripes = 64
+
+// serializeLogin runs fn, which checks the throttle, verifies a credential
+// and records a failure, while no other login for the email does. Without
+// it, concurrent guesses would all pass the check before any failure was
+// recorded.
+func (s *authService) serializeLogin(email string, fn func() error) error {
+	h := fnv.New32a()
+	h.Write([]byte(email))
+	mu := &loginLocks[h.Sum32()%loginLockStripes]
+	mu.Lock()
+	defer mu.Unlock()
+	return s.attemptRepo.LockEmail(email, fn)
+}
+
+// recordLoginAttempt stores the outcome of a login. reason is empty on success.
+func (s *authService) recordLoginAttempt(email string, user *model.User, client ClientInfo, reason string) {
+	attempt := &model.LoginAttempt{
+		Email:     email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Success:   reason == "",
+		Reason:    reason,
+	}
+	if user != nil {
+		attempt.UserID = &user.ID
+	}
+	if err := s.attemptRepo.CreateAttempt(attempt); err != nil {
+		log.Printf("Failed to record login attempt for %s: %v", email, err)
+	}
+	if reason == model.LoginFailedCredentials {
+		log.Printf("Failed login for %s from %s", email, client.IP)
+	}
+}
+
+// StartLoginAttemptCleanup periodically deletes login attempts older than AUDIT_RETENTION_DAYS.
+func StartLoginAttemptCleanup(attemptRepo repository.LoginAttemptRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			retention := time.Duration(loginThrottleConfig().AuditRetentionDays) * 24 * time.Hour
+			if n, err := attemptRepo.DeleteAttemptsBefore(now.Add(-retention)); err != nil {
+				log.Printf("Failed to delete old login attempts: %v", err)
+			} else if n > 0 {
+				log.Printf("Deleted %d old login attempts", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+)
+
+// memAttemptRepo keeps login attempts in memory. It is safe for concurrent use.
+type memAttemptRepo struct {
+	repository.LoginAttemptRepository
+	mu       sync.Mutex
+	attempts []model.LoginAttempt
+}
+
+func (r *memAttemptRepo) CreateAttempt(attempt *model.LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt.CreatedAt = time.Now()
+	r.attempts = append(r.attempts, *attempt)
+	return nil
+}
+
+func (r *memAttemptRepo) GetEmailFailures(email string, since time.Time) (repository.FailureStats, error) {
+	return r.failures(func(a model.LoginAttempt) bool { return a.Email == email }, since), nil
+}
+
+func (r *memAttemptRepo) GetIPFailures(ip string, since time.Time) (repository.FailureStats, error) {
+	return r.failures(func(a model.LoginAttempt) bool { return a.IP == ip }, since), nil
+}
+
+func (r *memAttemptRepo) failures(match func(model.LoginAttempt) bool, since time.Time) repository.FailureStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stats repository.FailureStats
+	for _, a := range r.attempts {
+		counted := a.Reason == model.LoginFailedCredentials || a.Reason == model.LoginFailedMFA
+		if match(a) && counted && a.CreatedAt.After(since) {
+			stats.Count++
+			at := a.CreatedAt
+			stats.Last = &at
+		}
+	}
+	return stats
+}
+
+func (r *memAttemptRepo) LockEmail(email string, fn func() error) error {
+	return fn()
+}
+
+// Concurrent guesses are checked one at a time, so no more passwords are
+// tried than the throttle allows before its first delay.
+func TestThrottledLoginSerializesGuesses(t *testing.T) {
+	attempts := &memAttemptRepo{}
+	s := &authService{attemptRepo: attempts}
+	var verified atomic.Int32
+	verify := func() (*model.User, error) {
+		verified.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return nil, ErrInvalidCredentials
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = s.throttledLogin("Ann@example.com", ClientInfo{IP: "192.0.2.1"}, verify)
+		}()
+	}
+	wg.Wait()
+
+	if n := verified.Load(); n != int32(defaultLoginThrottle.FreeAttempts) {
+		t.Errorf("%d passwords checked, want %d", n, defaultLoginThrottle.FreeAttempts)
+	}
+	throttled := 0
+	for _, a := range attempts.attempts {
+		if a.Email != "ann@example.com" {
+			t.Errorf("attempt recorded for %q", a.Email)
+		}
+		if a.Reason == model.LoginFailedThrottled {
+			throttled++
+		}
+	}
+	if want := 10 - defaultLoginThrottle.FreeAttempts; throttled != want {
+		t.Errorf("%d throttled attempts, want %d", throttled, want)
+	}
+}
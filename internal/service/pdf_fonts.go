@@ -0,0 +1,274 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+	"inkwell-backend-V2.0/internal/assets"
+	"inkwell-backend-V2.0/internal/config"
+)
+
+const bundledFontFamily = "DejaVuSansCondensed"
+
+// pdfFontSet is a TrueType family with one file per style ("", "B", "I", "BI").
+type pdfFontSet struct {
+	family string
+	styles map[string][]byte
+}
+
+var (
+	pdfFonts     *pdfFontSet
+	pdfFontsOnce sync.Once
+)
+
+// fontStyleSuffixes lists the file name suffixes tried for each style.
+var fontStyleSuffixes = map[string][]string{
+	"":   {"", "-Regular"},
+	"B":  {"-Bold"},
+	"I":  {"-Italic", "-Oblique"},
+	"BI": {"-BoldItalic", "-BoldOblique"},
+}
+
+// loadPDFFonts returns the font family used for generated PDFs: the family
+// configured under PDF/FONT_DIR if it can be loaded, else the bundled font.
+func loadPDFFonts() *pdfFontSet {
+	pdfFontsOnce.Do(func() {
+		if cfg := config.GetConfig(); cfg != nil && cfg.PDF.FontDir != "" {
+			set, err := loadFontDir(cfg.PDF.FontDir, cfg.PDF.FontFamily)
+			if err == nil {
+				pdfFonts = set
+				return
+			}
+			log.Printf("Failed to load PDF fonts from %s, using bundled font: %v", cfg.PDF.FontDir, err)
+		}
+		pdfFonts = loadBundledFonts()
+	})
+	return pdfFonts
+}
+
+func loadFontDir(dir, family string) (*pdfFontSet, error) {
+	if family == "" {
+		return nil, fmt.Errorf("FONT_FAMILY must be set when FONT_DIR is configured")
+	}
+	set := &pdfFontSet{family: family, styles: make(map[string][]byte)}
+	for style, suffixes := range fontStyleSuffixes {
+		for _, suffix := range suffixes {
+			data, err := os.ReadFile(filepath.Join(dir, family+suffix+".ttf"))
+			if err == nil {
+				set.styles[style] = data
+				break
+			}
+		}
+	}
+	if _, ok := set.styles[""]; !ok {
+		return nil, fmt.Errorf("no regular style found for font family %s", family)
+	}
+	return set, nil
+}
+
+func loadBundledFonts() *pdfFontSet {
+	set := &pdfFontSet{family: bundledFontFamily, styles: make(map[string][]byte)}
+	files := map[string]string{
+		"":   "fonts/DejaVuSansCondensed.ttf",
+		"B":  "fonts/DejaVuSansCondensed-Bold.ttf",
+		"I":  "fonts/DejaVuSansCondensed-Oblique.ttf",
+		"BI": "fonts/DejaVuSansCondensed-BoldOblique.ttf",
+	}
+	for style, name := range files {
+		data, err := assets.Fonts.ReadFile(name)
+		if err != nil {
+			log.Printf("Bundled font %s missing: %v", name, err)
+			continue
+		}
+		set.styles[style] = data
+	}
+	return set
+}
+
+// register adds every style of the family to the document. Styles missing
+// from the family fall back to the regular face so SetFont never fails.
+func (fs *pdfFontSet) register(pdf *gofpdf.Fpdf) {
+	regular := fs.styles[""]
+	for _, style := range []string{"", "B", "I", "BI"} {
+		data, ok := fs.styles[style]
+		if !ok {
+			data = regular
+		}
+		pdf.AddUTF8FontFromBytes(fs.family, style, data)
+	}
+}
+
+// newUnicodePDF creates a document with the Unicode font family registered
+// and returns it along with the family name to pass to SetFont.
+func newUnicodePDF(orientation string) (*gofpdf.Fpdf, string) {
+	pdf := gofpdf.New(orientation, "mm", "A4", "")
+	fonts := loadPDFFonts()
+	fonts.register(pdf)
+	return pdf, fonts.family
+}
+
+// isRTLText reports whether the first strong directional character of s
+// belongs to a right-to-left script.
+func isRTLText(s string) bool {
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko):
+			return true
+		case unicode.IsLetter(r):
+			return false
+		}
+	}
+	return false
+}
+
+// prepareUnicodeText normalises typographic characters the bundled font
+// lacks and shapes Arabic letters into their contextual forms. It reports
+// whether the text should be laid out right to left; gofpdf then reverses
+// each line when writing it.
+func prepareUnicodeText(s string) (string, bool) {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '\u00a0', '\u2009', '\u202f':
+			return ' '
+		case '\u200b', '\ufeff':
+			return -1
+		}
+		return r
+	}, s)
+	if !isRTLText(s) {
+		return s, false
+	}
+	return shapeArabic(s), true
+}
+
+// arabicForms maps a base Arabic letter to its isolated, final, initial and
+// medial presentation forms. Letters with zero initial/medial forms only
+// join to the preceding letter.
+var arabicForms = map[rune][4]rune{
+	'ء': {0xFE80, 0, 0, 0},
+	'آ': {0xFE81, 0xFE82, 0, 0},
+	'أ': {0xFE83, 0xFE84, 0, 0},
+	'ؤ': {0xFE85, 0xFE86, 0, 0},
+	'إ': {0xFE87, 0xFE88, 0, 0},
+	'ئ': {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	'ا': {0xFE8D, 0xFE8E, 0, 0},
+	'ب': {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	'ة': {0xFE93, 0xFE94, 0, 0},
+	'ت': {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	'ث': {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	'ج': {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	'ح': {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	'خ': {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	'د': {0xFEA9, 0xFEAA, 0, 0},
+	'ذ': {0xFEAB, 0xFEAC, 0, 0},
+	'ر': {0xFEAD, 0xFEAE, 0, 0},
+	'ز': {0xFEAF, 0xFEB0, 0, 0},
+	'س': {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	'ش': {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	'ص': {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	'ض': {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	'ط': {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	'ظ': {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	'ع': {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	'غ': {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	'ف': {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	'ق': {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	'ك': {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	'ل': {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	'م': {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	'ن': {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	'ه': {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	'و': {0xFEED, 0xFEEE, 0, 0},
+	'ى': {0xFEEF, 0xFEF0, 0, 0},
+	'ي': {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+}
+
+// lamAlef maps the alef that follows a lam to the combined ligature
+// (isolated, final).
+var lamAlef = map[rune][2]rune{
+	'آ': {0xFEF5, 0xFEF6},
+	'أ': {0xFEF7, 0xFEF8},
+	'إ': {0xFEF9, 0xFEFA},
+	'ا': {0xFEFB, 0xFEFC},
+}
+
+func joinsForward(r rune) bool {
+	forms, ok := arabicForms[r]
+	return ok && forms[2] != 0
+}
+
+// isArabicMark reports whether r is a diacritic that is transparent to joining.
+func isArabicMark(r rune) bool {
+	return unicode.Is(unicode.Mn, r) && unicode.Is(unicode.Arabic, r)
+}
+
+// shapeArabic replaces Arabic letters with their contextual presentation
+// forms so they join correctly without a shaping engine.
+func shapeArabic(s string) string {
+	runes := []rune(s)
+	out := make([]rune, 0, len(runes))
+
+	prevLetter := func(i int) rune {
+		for j := i - 1; j >= 0; j-- {
+			if !isArabicMark(runes[j]) {
+				return runes[j]
+			}
+		}
+		return 0
+	}
+	nextLetter := func(i int) (rune, int) {
+		for j := i + 1; j < len(runes); j++ {
+			if !isArabicMark(runes[j]) {
+				return runes[j], j
+			}
+		}
+		return 0, -1
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		forms, ok := arabicForms[r]
+		if !ok {
+			out = append(out, r)
+			continue
+		}
+		joinPrev := joinsForward(prevLetter(i))
+
+		if r == 'ل' {
+			if next, j := nextLetter(i); j >= 0 {
+				if lig, ok := lamAlef[next]; ok {
+					if joinPrev {
+						out = append(out, lig[1])
+					} else {
+						out = append(out, lig[0])
+					}
+					out = append(out, runes[i+1:j]...)
+					i = j
+					continue
+				}
+			}
+		}
+
+		next, _ := nextLetter(i)
+		_, nextIsArabic := arabicForms[next]
+		joinNext := forms[2] != 0 && nextIsArabic
+
+		switch {
+		case joinPrev && joinNext:
+			out = append(out, forms[3])
+		case joinPrev:
+			out = append(out, forms[1])
+		case joinNext:
+			out = append(out, forms[2])
+		default:
+			out = append(out, forms[0])
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// Kinds of assessment session.
+const (
+	AssessmentPractice  = "practice"
+	AssessmentPlacement = "placement"
+)
+
+// cefrLevels lists the CEFR levels from lowest to highest with the overall
+// ability, in logits, at which each begins.
+var cefrLevels = []struct {
+	Level      string
+	MinAbility float64
+}{
+	{"A1", math.Inf(-1)},
+	{"A2", -1.2},
+	{"B1", -0.4},
+	{"B2", 0.4},
+	{"C1", 1.2},
+	{"C2", 2.0},
+}
+
+const (
+	// placementQuestionsPerTopic is how many questions of each topic a
+	// placement test asks.
+	placementQuestionsPerTopic = 3
+
+	// levelDriftAnswers is how many practice answers since the last placement
+	// it takes before a different estimated level recommends an early re-test.
+	levelDriftAnswers = 20
+)
+
+var (
+	ErrPlacementNotDue     = errors.New("placement test is not due yet")
+	ErrPlacementInProgress = errors.New("a placement test is already in progress")
+)
+
+// levelForAbility maps an overall ability to a CEFR level.
+func levelForAbility(ability float64) string {
+	level := cefrLevels[0].Level
+	for _, l := range cefrLevels {
+		if ability >= l.MinAbility {
+			level = l.Level
+		}
+	}
+	return level
+}
+
+func levelIndex(level string) int {
+	for i, l := range cefrLevels {
+		if l.Level == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// levelPrior is the starting ability for a topic a user of the given level
+// has not been assessed on: the middle of the level's band.
+func levelPrior(level string) float64 {
+	i := levelIndex(level)
+	switch {
+	case i < 0:
+		return priorAbility
+	case i == 0:
+		return cefrLevels[1].MinAbility - 0.4
+	case i == len(cefrLevels)-1:
+		return cefrLevels[i].MinAbility + 0.4
+	default:
+		return (cefrLevels[i].MinAbility + cefrLevels[i+1].MinAbility) / 2
+	}
+}
+
+// LevelBand maps a CEFR level to beginner, intermediate or advanced, or "" if unknown.
+func LevelBand(level string) string {
+	if levelIndex(level) < 0 {
+		return ""
+	}
+	switch level[0] {
+	case 'A':
+		return "beginner"
+	case 'B':
+		return "intermediate"
+	default:
+		return "advanced"
+	}
+}
+
+// overallAbility is the precision-weighted mean of the per-topic abilities,
+// so that well-measured topics count for more.
+func overallAbility(estimates []model.SkillEstimate) (float64, bool) {
+	var sum, weights float64
+	for _, est := range estimates {
+		w := 1 / (est.StdError * est.StdError)
+		sum += w * est.Ability
+		weights += w
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return sum / weights, true
+}
+
+// placementPrior starts each new topic of a placement test at the overall
+// ability measured on the topics answered so far.
+func placementPrior(estimates map[string]model.SkillEstimate) float64 {
+	list := make([]model.SkillEstimate, 0, len(estimates))
+	for _, est := range estimates {
+		list = append(list, est)
+	}
+	if ability, ok := overallAbility(list); ok {
+		return ability
+	}
+	return priorAbility
+}
+
+// PlacementStatus describes a user's level and whether they may take the placement test.
+type PlacementStatus struct {
+	Level             string               `json:"level,omitempty"`
+	Band              string               `json:"band,omitempty"`
+	PlacedAt          *time.Time           `json:"placed_at,omitempty"`
+	EstimatedLevel    string               `json:"estimated_level,omitempty"` // implied by the current skill estimates
+	RetestAllowed     bool                 `json:"retest_allowed"`
+	RetestRecommended bool                 `json:"retest_recommended"`
+	Reason            string               `json:"reason"`
+	NextRetestAt      *time.Time           `json:"next_retest_at,omitempty"`
+	InProgress        string               `json:"in_progress,omitempty"` // session ID of an unfinished placement test
+	History           []model.LevelHistory `json:"history"`
+}
+
+// GetPlacementStatus applies the re-test rules: a user without a level may
+// always take the test; otherwise it may be retaken once
+// PLACEMENT_RETEST_DAYS have passed, or earlier when enough practice answers
+// put the user at a different level.
+func (s *assessmentService) GetPlacementStatus(userID uint) (*PlacementStatus, error) {
+	user, err := s.assessmentRepo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.assessmentRepo.GetLevelHistory(userID)
+	if err != nil {
+		return nil, err
+	}
+	estimates, err := s.assessmentRepo.GetSkillEstimates(userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &PlacementStatus{Level: user.Level, Band: LevelBand(user.Level), PlacedAt: user.LevelUpdatedAt, History: history}
+	if ability, ok := overallAbility(estimates); ok {
+		status.EstimatedLevel = levelForAbility(ability)
+	}
+	ongoing, err := s.assessmentRepo.GetOngoingAssessment(userID, AssessmentPlacement)
+	if err != nil {
+		return nil, err
+	}
+	if ongoing != nil {
+		if err := s.closeIfExpired(ongoing, time.Now()); err != nil {
+			return nil, err
+		}
+		if ongoing.Status == AssessmentOngoing {
+			status.InProgress = ongoing.SessionID
+		}
+	}
+
+	if user.Level == "" || user.LevelUpdatedAt == nil {
+		status.RetestAllowed, status.RetestRecommended = true, true
+		status.Reason = "No level yet; take the placement test to set one."
+		return status, nil
+	}
+	retestDays := assessmentLimits().PlacementRetestDays
+	due := user.LevelUpdatedAt.AddDate(0, 0, retestDays)
+	if !time.Now().Before(due) {
+		status.RetestAllowed = true
+		status.RetestRecommended = retestDays > 0
+		status.Reason = fmt.Sprintf("Placed at %s on %s.", user.Level, user.LevelUpdatedAt.Format("2006-01-02"))
+		return status, nil
+	}
+	answers, err := s.assessmentRepo.CountScoredAnswersSince(userID, *user.LevelUpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if status.EstimatedLevel != "" && status.EstimatedLevel != user.Level && answers >= levelDriftAnswers {
+		status.RetestAllowed, status.RetestRecommended = true, true
+		status.Reason = fmt.Sprintf("Practice results since the last placement suggest level %s.", status.EstimatedLevel)
+		return status, nil
+	}
+	status.NextRetestAt = &due
+	status.Reason = fmt.Sprintf("Placed at %s; the test can be retaken from %s.", user.Level, due.Format("2006-01-02"))
+	return status, nil
+}
+
+// StartPlacement opens a placement test that asks questions across every topic.
+func (s *assessmentService) StartPlacement(userID uint) (*model.Assessment, *model.LearnerQuestion, error) {
+	status, err := s.GetPlacementStatus(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status.InProgress != "" {
+		return nil, nil, ErrPlacementInProgress
+	}
+	if !status.RetestAllowed {
+		return nil, nil, fmt.Errorf("%w: %s", ErrPlacementNotDue, status.Reason)
+	}
+
+	estimates, err := s.skillEstimatesByTopic(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	limits := assessmentLimits()
+	assessment := model.Assessment{
+		UserID:      userID,
+		SessionID:   uuid.New().String(),
+		Title:       "Placement Test",
+		Description: "Placement across all topics",
+		Status:      AssessmentOngoing,
+		Category:    "Placement",
+		Kind:        AssessmentPlacement,
+	}
+	question, err := s.nextPlacementQuestion(&assessment, estimates, levelPrior(status.Level))
+	if err != nil {
+		return nil, nil, err
+	}
+	if question == nil {
+		return nil, nil, fmt.Errorf("no assessment questions available")
+	}
+	assessment.Questions = []model.Question{*question}
+	if limits.SessionTimeLimit > 0 {
+		expires := now.Add(seconds(limits.SessionTimeLimit))
+		assessment.ExpiresAt = &expires
+	}
+	serveQuestion(&assessment, question, now, limits)
+	if err := s.assessmentRepo.CreateAssessment(&assessment); err != nil {
+		return nil, nil, err
+	}
+	return &assessment, toLearnerQuestion(question), nil
+}
+
+// nextPlacementQuestion picks from the topic with the fewest questions
+// served so far, breaking ties by the least certain estimate, and returns
+// nil once every topic has had its share or run out of questions.
+func (s *assessmentService) nextPlacementQuestion(a *model.Assessment, estimates map[string]model.SkillEstimate, prior float64) (*model.Question, error) {
+	topics, err := s.assessmentRepo.GetTopics()
+	if err != nil {
+		return nil, err
+	}
+	served := make(map[string]int)
+	used := make(map[uint]bool, len(a.Questions))
+	for _, q := range a.Questions {
+		served[q.Category]++
+		used[q.ID] = true
+	}
+	stdError := func(topic string) float64 {
+		if est, ok := estimates[topic]; ok {
+			return est.StdError
+		}
+		return priorStdError
+	}
+	sort.SliceStable(topics, func(i, j int) bool {
+		if served[topics[i]] != served[topics[j]] {
+			return served[topics[i]] < served[topics[j]]
+		}
+		return stdError(topics[i]) > stdError(topics[j])
+	})
+
+	for _, topic := range topics {
+		if served[topic] >= placementQuestionsPerTopic {
+			continue
+		}
+		ability := prior
+		if est, ok := estimates[topic]; ok {
+			ability = est.Ability
+		}
+		questions, err := s.assessmentRepo.GetQuestionsByCategory(topic)
+		if err != nil {
+			return nil, err
+		}
+		if q := pickQuestion(questions, used, ability); q != nil {
+			return q, nil
+		}
+	}
+	return nil, nil
+}
+
+// completePlacement sets the user's level from their skill estimates across
+// all topics once a placement test ends.
+func (s *assessmentService) completePlacement(a *model.Assessment, now time.Time) (string, error) {
+	user, err := s.assessmentRepo.GetUser(a.UserID)
+	if err != nil {
+		return "", err
+	}
+	estimates, err := s.assessmentRepo.GetSkillEstimates(a.UserID)
+	if err != nil {
+		return "", err
+	}
+	ability, ok := overallAbility(estimates)
+	if !ok {
+		ability = levelPrior(user.Level)
+	}
+	entry := model.LevelHistory{
+		UserID:        a.UserID,
+		Level:         levelForAbility(ability),
+		PreviousLevel: user.Level,
+		Ability:       ability,
+		AssessmentID:  a.ID,
+		CreatedAt:     now,
+	}
+	if err := s.assessmentRepo.SetUserLevel(&entry); err != nil {
+		return "", err
+	}
+	return entry.Level, nil
+}
+
+// userPrior is the starting ability for topics the user has not been assessed on.
+func (s *assessmentService) userPrior(userID uint) (float64, error) {
+	user, err := s.assessmentRepo.GetUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	return levelPrior(user.Level), nil
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+)
+
+// RevokedErasureRequested is the reason sessions end when the user asks for their account to be erased.
+const RevokedErasureRequested = "erasure_requested"
+
+const (
+	defaultExportDir       = "exports"
+	defaultExportRetention = 72 * time.Hour
+	defaultErasureGrace    = 14 * 24 * time.Hour
+	maxPrivacyEvents       = 500
+)
+
+var (
+	ErrExportNotFound      = errors.New("export not found")
+	ErrExportNotReady      = errors.New("export is not ready")
+	ErrExportInProgress    = errors.New("an export is already being prepared")
+	ErrErasureNotScheduled = errors.New("no account deletion is scheduled")
+)
+
+// PrivacyService exports a user's data and erases accounts.
+type PrivacyService interface {
+	RequestExport(userID uint) (*model.DataExport, error)
+	ListExports(userID uint) ([]model.DataExport, error)
+	GetExport(userID uint, id string) (*model.DataExport, error)
+	OpenExport(userID uint, id string) (string, error)
+	RequestErasure(userID uint, actorID *uint, sessionID, password string) (*time.Time, error)
+	CancelErasure(userID uint) error
+	ListEvents(userID uint, limit int) ([]model.PrivacyEvent, error)
+}
+
+type privacyService struct {
+	db          *gorm.DB // for the progress reports in exports
+	userRepo    repository.UserRepository
+	privacyRepo repository.PrivacyRepository
+	sessionRepo repository.SessionRepository
+	// exportSlots limits how many exports are built at once.
+	exportSlots chan struct{}
+}
+
+func NewPrivacyService(database *gorm.DB, userRepo repository.UserRepository, privacyRepo repository.PrivacyRepository, sessionRepo repository.SessionRepository) PrivacyService {
+	return &privacyService{db: database, userRepo: userRepo, privacyRepo: privacyRepo, sessionRepo: sessionRepo, exportSlots: make(chan struct{}, 2)}
+}
+
+func privacyConfig() config.PrivacyConfig {
+	if cfg := config.GetConfig(); cfg != nil {
+		return cfg.Privacy
+	}
+	return config.PrivacyConfig{}
+}
+
+func exportDir() string {
+	if dir := privacyConfig().ExportDir; dir != "" {
+		return dir
+	}
+	return defaultExportDir
+}
+
+func exportRetention() time.Duration {
+	if h := privacyConfig().ExportRetentionHours; h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return defaultExportRetention
+}
+
+func erasureGrace() time.Duration {
+	if d := privacyConfig().ErasureGraceDays; d > 0 {
+		return time.Duration(d) * 24 * time.Hour
+	}
+	return defaultErasureGrace
+}
+
+// recordEvent adds to the audit trail; a failure is logged, not returned.
+func (s *privacyService) recordEvent(userID uint, actorID *uint, action, detail string) {
+	event := &model.PrivacyEvent{UserID: userID, ActorID: actorID, Action: action, Detail: detail}
+	if err := s.privacyRepo.CreateEvent(event); err != nil {
+		log.Printf("Failed to record %s for user %d: %v", action, userID, err)
+	}
+}
+
+// RequestExport starts building an export in the background. A user can
+// have one export in progress at a time.
+func (s *privacyService) RequestExport(userID uint) (*model.DataExport, error) {
+	if _, err := s.userRepo.GetUserByID(userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	pending, err := s.privacyRepo.HasPendingExport(userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrExportInProgress
+	}
+	export := &model.DataExport{ID: uuid.New().String(), UserID: userID, Status: model.ExportPending}
+	if err := s.privacyRepo.CreateExport(export); err != nil {
+		return nil, err
+	}
+	s.recordEvent(userID, nil, model.PrivacyExportRequested, export.ID)
+
+	go func() {
+		s.exportSlots <- struct{}{}
+		defer func() { <-s.exportSlots }()
+		s.finishExport(export)
+	}()
+	return export, nil
+}
+
+// finishExport builds the archive and records the outcome.
+func (s *privacyService) finishExport(export *model.DataExport) {
+	path := filepath.Join(exportDir(), export.ID+".zip")
+	size, err := s.buildExport(export.UserID, path)
+	now := time.Now()
+	export.CompletedAt = &now
+	if err != nil {
+		log.Printf("Failed to export data of user %d: %v", export.UserID, err)
+		export.Status = model.ExportFailed
+		s.recordEvent(export.UserID, nil, model.PrivacyExportFailed, export.ID)
+	} else {
+		expires := now.Add(exportRetention())
+		export.Status, export.FilePath, export.Size, export.ExpiresAt = model.ExportReady, path, size, &expires
+		s.recordEvent(export.UserID, nil, model.PrivacyExportReady, export.ID)
+	}
+	if err := s.privacyRepo.FinishExport(export); err != nil {
+		log.Printf("Failed to save export %s: %v", export.ID, err)
+	}
+}
+
+func (s *privacyService) ListExports(userID uint) ([]model.DataExport, error) {
+	return s.privacyRepo.ListExports(userID)
+}
+
+func (s *privacyService) GetExport(userID uint, id string) (*model.DataExport, error) {
+	export, err := s.privacyRepo.GetExport(userID, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExportNotFound
+	}
+	return export, err
+}
+
+// OpenExport returns the path of a ready export for download and records
+// the download.
+func (s *privacyService) OpenExport(userID uint, id string) (string, error) {
+	export, err := s.GetExport(userID, id)
+	if err != nil {
+		return "", err
+	}
+	if export.Status != model.ExportReady || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		return "", ErrExportNotReady
+	}
+	if _, err := os.Stat(export.FilePath); err != nil {
+		return "", ErrExportNotReady
+	}
+	s.recordEvent(userID, nil, model.PrivacyExportDownloaded, export.ID)
+	return export.FilePath, nil
+}
+
+// RequestErasure schedules the account to be erased after the grace
+// period and ends its sessions. The user can log in and cancel until then.
+// actorID is set when an admin asks on the user's behalf; then no
+// password is needed.
+func (s *privacyService) RequestErasure(userID uint, actorID *uint, sessionID, password string) (*time.Time, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if actorID == nil {
+		if err := confirmIdentity(s.sessionRepo, user, sessionID, password); err != nil {
+			return nil, err
+		}
+	}
+	if user.DeletionScheduledFor != nil {
+		return user.DeletionScheduledFor, nil
+	}
+	// Ending the sessions first also stops their access tokens, so the
+	// account is never scheduled for erasure while still logged in.
+	if err := s.sessionRepo.RevokeUserSessions(userID, RevokedErasureRequested); err != nil {
+		return nil, err
+	}
+	at := time.Now().Add(erasureGrace())
+	if err := s.userRepo.UpdateProfile(userID, map[string]interface{}{"deletion_scheduled_for": at}); err != nil {
+		return nil, err
+	}
+	s.recordEvent(userID, actorID, model.PrivacyErasureRequested, "scheduled for "+at.UTC().Format(time.RFC3339))
+	log.Printf("Erasure of user %d scheduled for %s", userID, at.Format(time.RFC3339))
+	return &at, nil
+}
+
+func (s *privacyService) CancelErasure(userID uint) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if user.DeletionScheduledFor == nil {
+		return ErrErasureNotScheduled
+	}
+	if err := s.userRepo.UpdateProfile(userID, map[string]interface{}{"deletion_scheduled_for": nil}); err != nil {
+		return err
+	}
+	s.recordEvent(userID, nil, model.PrivacyErasureCancelled, "")
+	return nil
+}
+
+func (s *privacyService) ListEvents(userID uint, limit int) ([]model.PrivacyEvent, error) {
+	return s.privacyRepo.ListEvents(userID, min(limit, maxPrivacyEvents))
+}
+
+// eraseUser deletes every row of the user, anonymises their login
+// attempts, and then deletes their files: the avatar, story images, comics
+// and exports.
+func (s *privacyService) eraseUser(userID uint) error {
+	data, err := s.privacyRepo.GetUserData(userID)
+	if err != nil {
+		return err
+	}
+	files := userFiles(data)
+	if err := s.userRepo.DeleteUser(userID); err != nil {
+		return err
+	}
+	removed := 0
+	for _, path := range files {
+		err := os.Remove(path)
+		switch {
+		case err == nil:
+			removed++
+		case !os.IsNotExist(err):
+			log.Printf("Failed to delete %s of erased user %d: %v", path, userID, err)
+		}
+	}
+	s.recordEvent(userID, nil, model.PrivacyErasureCompleted, fmt.Sprintf("%d files deleted", removed))
+	log.Printf("Erased user %d and %d files", userID, removed)
+	return nil
+}
+
+// userFiles lists the files on disk that belong to the user.
+func userFiles(data *repository.UserData) []string {
+	var files []string
+	if data.User.AvatarPath != "" {
+		files = append(files, resolveWorkingPath(data.User.AvatarPath))
+	}
+	for _, sentence := range data.Sentences {
+		if sentence.ImageURL != "" {
+			files = append(files, resolveWorkingPath(sentence.ImageURL))
+		}
+	}
+	for _, comic := range data.Comics {
+		files = append(files, comicFiles(comic)...)
+	}
+	for _, export := range data.Exports {
+		if export.FilePath != "" {
+			files = append(files, export.FilePath)
+		}
+	}
+	return files
+}
+
+// comicFiles lists the files of every format a comic version was saved in.
+// They are derived from the stored paths rather than the version, since
+// comics from before versioning are named comic_<story id>.pdf.
+func comicFiles(comic model.Comic) []string {
+	paths := []string{comic.DownloadURL, comic.ViewURL}
+	if comic.DownloadURL != "" {
+		for _, link := range comicFormatLinks(comic) {
+			paths = append(paths, link.DownloadURL)
+		}
+	}
+	seen := map[string]bool{}
+	var files []string
+	for _, p := range paths {
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		files = append(files, resolveWorkingPath(p))
+	}
+	return files
+}
+
+// StartPrivacyTasks fails exports that a restart interrupted, then
+// periodically deletes expired exports and erases accounts whose grace
+// period is over.
+func StartPrivacyTasks(userRepo repository.UserRepository, privacyRepo repository.PrivacyRepository, interval time.Duration) {
+	s := &privacyService{userRepo: userRepo, privacyRepo: privacyRepo}
+	if n, err := s.privacyRepo.FailPendingExports(); err != nil {
+		log.Printf("Failed to mark interrupted exports: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted exports as failed", n)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			s.deleteExpiredExports(now)
+			s.eraseDueUsers(now)
+		}
+	}()
+}
+
+func (s *privacyService) deleteExpiredExports(now time.Time) {
+	exports, err := s.privacyRepo.GetExpiredExports(now, now.Add(-exportRetention()))
+	if err != nil {
+		log.Printf("Failed to fetch expired exports: %v", err)
+		return
+	}
+	for _, export := range exports {
+		if export.FilePath != "" {
+			if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to delete export %s: %v", export.ID, err)
+				continue
+			}
+		}
+		if err := s.privacyRepo.DeleteExport(export.ID); err != nil {
+			log.Printf("Failed to delete export %s: %v", export.ID, err)
+		}
+	}
+}
+
+func (s *privacyService) eraseDueUsers(now time.Time) {
+	ids, err := s.privacyRepo.GetUsersDueForErasure(now)
+	if err != nil {
+		log.Printf("Failed to fetch accounts due for erasure: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := s.eraseUser(id); err != nil {
+			log.Printf("Failed to erase user %d: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+)
+
+func (r *memUserRepo) UpdateProfile(userID uint, fields map[string]interface{}) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return errors.New("record not found")
+	}
+	if at, ok := fields["deletion_scheduled_for"].(time.Time); ok {
+		user.DeletionScheduledFor = &at
+	}
+	return nil
+}
+
+func (r *memUserRepo) DeleteUser(userID uint) error {
+	delete(r.users, userID)
+	return nil
+}
+
+// memPrivacyRepo serves one user's data and collects privacy events.
+type memPrivacyRepo struct {
+	repository.PrivacyRepository
+	data   *repository.UserData
+	events []model.PrivacyEvent
+}
+
+func (r *memPrivacyRepo) GetUserData(userID uint) (*repository.UserData, error) {
+	return r.data, nil
+}
+
+func (r *memPrivacyRepo) CreateEvent(event *model.PrivacyEvent) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func TestComicFiles(t *testing.T) {
+	legacy := model.Comic{StoryID: 5, Version: 1, ViewURL: "comics/comic_5.pdf", DownloadURL: "comics/comic_5.pdf"}
+	if got, want := comicFiles(legacy), []string{filepath.Join("working", "comics", "comic_5.pdf")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("legacy comic: %v, want %v", got, want)
+	}
+
+	versioned := model.Comic{StoryID: 5, Version: 2, ViewURL: "comics/comic_5_v2.pdf", DownloadURL: "comics/comic_5_v2.pdf", Formats: "pdf,cbz,html"}
+	want := []string{
+		filepath.Join("working", "comics", "comic_5_v2.pdf"),
+		filepath.Join("working", "comics", "comic_5_v2.cbz"),
+		filepath.Join("working", "comics", "comic_5_v2.html"),
+	}
+	if got := comicFiles(versioned); !reflect.DeepEqual(got, want) {
+		t.Errorf("versioned comic: %v, want %v", got, want)
+	}
+}
+
+// Erasure deletes every file of the user, including comics saved before versioning.
+func TestEraseUserRemovesEveryFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	exportPath := filepath.Join(dir, "exports", "export.zip")
+	data := &repository.UserData{
+		User:      &model.User{ID: 1, AvatarPath: "avatars/1.png"},
+		Sentences: []model.Sentence{{ImageURL: "images/a.png"}, {ImageURL: "images/b.png"}, {}},
+		Comics: []model.Comic{
+			{StoryID: 5, Version: 1, ViewURL: "comics/comic_5.pdf", DownloadURL: "comics/comic_5.pdf"},
+			{StoryID: 5, Version: 2, ViewURL: "comics/comic_5_v2.pdf", DownloadURL: "comics/comic_5_v2.pdf", Formats: "pdf,cbz,epub,html"},
+		},
+		Exports: []model.DataExport{{FilePath: exportPath}},
+	}
+	files := userFiles(data)
+	if len(files) != 9 {
+		t.Fatalf("%d files listed: %v", len(files), files)
+	}
+	for _, path := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A file of another user stays.
+	other := filepath.Join("working", "comics", "comic_6.pdf")
+	if err := os.WriteFile(other, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	users := &memUserRepo{users: map[uint]*model.User{1: data.User}}
+	privacy := &memPrivacyRepo{data: data}
+	s := &privacyService{userRepo: users, privacyRepo: privacy}
+	if err := s.eraseUser(1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range files {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not deleted: %v", path, err)
+		}
+	}
+	var left []string
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			left = append(left, path)
+		}
+		return nil
+	})
+	if len(left) != 1 || left[0] != filepath.Join(dir, other) {
+		t.Errorf("files left: %v", left)
+	}
+	if _, ok := users.users[1]; ok {
+		t.Error("user not deleted")
+	}
+	if n := len(privacy.events); n != 1 || privacy.events[0].Action != model.PrivacyErasureCompleted || privacy.events[0].Detail != "9 files deleted" {
+		t.Errorf("events %+v", privacy.events)
+	}
+}
+
+// Requesting erasure ends every session, which also stops their access tokens.
+func TestRequestErasureEndsSessions(t *testing.T) {
+	sessions := newMemSessionRepo()
+	now := time.Now()
+	for _, id := range []string{"phone", "laptop"} {
+		_ = sessions.CreateSession(&model.Session{ID: id, FamilyID: id, UserID: 1, ExpiresAt: now.Add(time.Hour)})
+	}
+	users := &memUserRepo{users: map[uint]*model.User{1: {ID: 1}}}
+	s := &privacyService{userRepo: users, privacyRepo: &memPrivacyRepo{}, sessionRepo: sessions}
+
+	admin := uint(2)
+	at, err := s.RequestErasure(1, &admin, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users.users[1].DeletionScheduledFor == nil || !users.users[1].DeletionScheduledFor.Equal(*at) {
+		t.Errorf("deletion scheduled for %v, want %v", users.users[1].DeletionScheduledFor, at)
+	}
+	for id, session := range sessions.sessions {
+		if session.RevokedAt == nil || session.RevokedReason != RevokedErasureRequested {
+			t.Errorf("session %s: %+v", id, session)
+		}
+	}
+}
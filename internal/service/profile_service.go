@@ -0,0 +1,357 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/mailer"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+// Reasons sessions end when the user changes their credentials.
+const (
+	RevokedPasswordChanged = "password_changed"
+	RevokedEmailChanged    = "email_changed"
+)
+
+const (
+	maxUsernameLength = 50
+	maxNameLength     = 100
+)
+
+// reauthMaxAge is how recent the login must be to confirm a sensitive change
+// on an account without a password.
+const reauthMaxAge = 10 * time.Minute
+
+var ErrReauthRequired = errors.New("log in again to confirm this change")
+
+var (
+	ErrWrongPassword = errors.New("current password is incorrect")
+	ErrInvalidEmail  = errors.New("invalid email address")
+	ErrEmailInUse    = errors.New("email already in use")
+	ErrSameEmail     = errors.New("this is already your email address")
+)
+
+var (
+	uiLanguagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+	ttsVoicePattern   = regexp.MustCompile(`^[A-Za-z0-9_.\-/]{1,64}$`)
+)
+
+// ProfileService lets users manage their own account.
+type ProfileService interface {
+	GetProfile(userID uint) (*model.User, error)
+	UpdateProfile(userID uint, input ProfileUpdate) (*model.User, error)
+	SetAvatar(userID uint, data []byte) (*model.User, error)
+	RemoveAvatar(userID uint) (*model.User, error)
+	RequestEmailChange(userID uint, sessionID, email, password string) error
+	ConfirmEmailChange(token string) error
+	ChangePassword(userID uint, sessionID, current, password string) error
+	SpeechVoice(userID uint) (string, error)
+}
+
+// ProfileUpdate holds the fields to change; nil fields stay as they are.
+type ProfileUpdate struct {
+	Username    *string            `json:"username"`
+	FirstName   *string            `json:"first_name"`
+	LastName    *string            `json:"last_name"`
+	Preferences *PreferencesUpdate `json:"preferences"`
+}
+
+// PreferencesUpdate holds the preferences to change; nil fields stay as they are.
+type PreferencesUpdate struct {
+	TTSVoice    *string `json:"tts_voice"`
+	UILanguage  *string `json:"ui_language"`
+	StoryLength *string `json:"story_length"`
+}
+
+type profileService struct {
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	tokenRepo   repository.AccountTokenRepository
+	mailer      mailer.Mailer
+}
+
+func NewProfileService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, tokenRepo repository.AccountTokenRepository, mail mailer.Mailer) ProfileService {
+	return &profileService{userRepo: userRepo, sessionRepo: sessionRepo, tokenRepo: tokenRepo, mailer: mail}
+}
+
+func profileConfig() config.ProfileConfig {
+	if cfg := config.GetConfig(); cfg != nil {
+		return cfg.Profile
+	}
+	return config.ProfileConfig{}
+}
+
+func (s *profileService) GetProfile(userID uint) (*model.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// UpdateProfile changes the user's names and preferences. All fields are
+// checked before anything is saved.
+func (s *profileService) UpdateProfile(userID uint, input ProfileUpdate) (*model.User, error) {
+	if _, err := s.GetProfile(userID); err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	var errs []FieldError
+	text := func(field, column string, value *string, maxLen int, required bool) {
+		if value == nil {
+			return
+		}
+		v := strings.TrimSpace(*value)
+		switch {
+		case required && v == "":
+			errs = append(errs, FieldError{field, "is required"})
+		case len([]rune(v)) > maxLen:
+			errs = append(errs, FieldError{field, "is too long"})
+		case strings.IndexFunc(v, unicode.IsControl) >= 0:
+			errs = append(errs, FieldError{field, "must not contain control characters"})
+		default:
+			fields[column] = v
+		}
+	}
+	text("username", "username", input.Username, maxUsernameLength, true)
+	text("first_name", "first_name", input.FirstName, maxNameLength, false)
+	text("last_name", "last_name", input.LastName, maxNameLength, false)
+
+	if p := input.Preferences; p != nil {
+		cfg := profileConfig()
+		if p.TTSVoice != nil {
+			if v := strings.TrimSpace(*p.TTSVoice); v == "" || allowedChoice(v, cfg.TTSVoices, ttsVoicePattern) {
+				fields["pref_tts_voice"] = v
+			} else {
+				errs = append(errs, FieldError{"preferences.tts_voice", "is not an available voice"})
+			}
+		}
+		if p.UILanguage != nil {
+			if v := strings.TrimSpace(*p.UILanguage); allowedChoice(v, cfg.UILanguages, uiLanguagePattern) {
+				fields["pref_ui_language"] = v
+			} else {
+				errs = append(errs, FieldError{"preferences.ui_language", "is not a supported language"})
+			}
+		}
+		if p.StoryLength != nil {
+			switch v := *p.StoryLength; v {
+			case model.StoryLengthShort, model.StoryLengthMedium, model.StoryLengthLong:
+				fields["pref_story_length"] = v
+			default:
+				errs = append(errs, FieldError{"preferences.story_length", "must be short, medium or long"})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	if len(fields) > 0 {
+		if err := s.userRepo.UpdateProfile(userID, fields); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetProfile(userID)
+}
+
+// allowedChoice reports whether v is one of choices, or, when no choices
+// are configured, whether it matches pattern.
+func allowedChoice(v string, choices []string, pattern *regexp.Regexp) bool {
+	if len(choices) == 0 {
+		return pattern.MatchString(v)
+	}
+	for _, c := range choices {
+		if strings.TrimSpace(c) == v {
+			return true
+		}
+	}
+	return false
+}
+
+// SpeechVoice returns the voice to read text to the user in, or "" for the
+// TTS service's default voice.
+func (s *profileService) SpeechVoice(userID uint) (string, error) {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return "", err
+	}
+	return listedVoice(user.Preferences.TTSVoice, profileConfig().TTSVoices), nil
+}
+
+// listedVoice returns voice if it is one of the configured voices. Each
+// voice is a model the TTS service loads on first use, so voices saved
+// while no list was configured are not passed on.
+func listedVoice(voice string, voices []string) string {
+	for _, v := range voices {
+		if voice != "" && strings.TrimSpace(v) == voice {
+			return voice
+		}
+	}
+	return ""
+}
+
+// SetAvatar stores a new avatar and deletes the previous one.
+func (s *profileService) SetAvatar(userID uint, data []byte) (*model.User, error) {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	img, ext, err := processAvatar(data)
+	if err != nil {
+		return nil, err
+	}
+	path, err := saveAvatar(img, ext)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdateProfile(userID, map[string]interface{}{"avatar_path": path}); err != nil {
+		if rmErr := removeAvatar(path); rmErr != nil {
+			log.Printf("Failed to delete avatar %s: %v", path, rmErr)
+		}
+		return nil, err
+	}
+	if err := removeAvatar(user.AvatarPath); err != nil {
+		log.Printf("Failed to delete avatar %s: %v", user.AvatarPath, err)
+	}
+	user.AvatarPath = path
+	return user, nil
+}
+
+func (s *profileService) RemoveAvatar(userID uint) (*model.User, error) {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.AvatarPath == "" {
+		return user, nil
+	}
+	if err := s.userRepo.UpdateProfile(userID, map[string]interface{}{"avatar_path": ""}); err != nil {
+		return nil, err
+	}
+	if err := removeAvatar(user.AvatarPath); err != nil {
+		log.Printf("Failed to delete avatar %s: %v", user.AvatarPath, err)
+	}
+	user.AvatarPath = ""
+	return user, nil
+}
+
+// RequestEmailChange emails a confirmation link to the new address. The
+// account keeps its current address until the link is opened.
+func (s *profileService) RequestEmailChange(userID uint, sessionID, email, password string) error {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return err
+	}
+	if err := confirmIdentity(s.sessionRepo, user, sessionID, password); err != nil {
+		return err
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" {
+		return ErrInvalidEmail
+	}
+	email = normalizeEmail(addr.Address)
+	if strings.EqualFold(email, user.Email) {
+		return ErrSameEmail
+	}
+	if other, err := s.userRepo.GetUserByEmail(email); err == nil && other.ID != user.ID {
+		return ErrEmailInUse
+	}
+	if err := s.userRepo.UpdateProfile(userID, map[string]interface{}{"pending_email": email}); err != nil {
+		return err
+	}
+	return sendAccountToken(s.tokenRepo, s.mailer, user, model.TokenPurposeChangeEmail, email)
+}
+
+// ConfirmEmailChange switches the account to the pending address from the
+// link and ends the user's sessions, whose tokens carry the old address.
+func (s *profileService) ConfirmEmailChange(token string) error {
+	stored, err := useAccountToken(s.tokenRepo, token, model.TokenPurposeChangeEmail)
+	if err != nil {
+		return err
+	}
+	user, err := s.userRepo.GetUserByID(stored.UserID)
+	if err != nil || user.PendingEmail == "" {
+		return ErrInvalidAccountToken
+	}
+	if other, err := s.userRepo.GetUserByEmail(user.PendingEmail); err == nil && other.ID != user.ID {
+		return ErrEmailInUse
+	}
+	now := time.Now()
+	if err := s.userRepo.ChangeEmail(user.ID, user.PendingEmail, now); err != nil {
+		return err
+	}
+	user.Email, user.EmailVerifiedAt = user.PendingEmail, &now
+	promoteConfiguredAdmin(s.userRepo, user)
+	log.Printf("User %d changed their email address", user.ID)
+	return s.sessionRepo.RevokeUserSessions(user.ID, RevokedEmailChanged)
+}
+
+// ChangePassword sets a new password and ends the user's other sessions.
+func (s *profileService) ChangePassword(userID uint, sessionID, current, password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return err
+	}
+	if err := confirmIdentity(s.sessionRepo, user, sessionID, current); err != nil {
+		return err
+	}
+	hash, err := utilities.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(userID, hash); err != nil {
+		return err
+	}
+	if err := s.tokenRepo.InvalidateTokens(userID, model.TokenPurposeResetPassword); err != nil {
+		log.Printf("Failed to invalidate reset tokens of user %d: %v", userID, err)
+	}
+	return s.sessionRepo.RevokeOtherSessions(userID, sessionID, RevokedPasswordChanged)
+}
+
+// confirmIdentity confirms a sensitive change with the user's password.
+// Accounts created through single sign-on have none, so the change must
+// come from a login started within reauthMaxAge; an access token alone,
+// which may have been stolen, is not enough.
+func confirmIdentity(sessionRepo repository.SessionRepository, user *model.User, sessionID, password string) error {
+	if user.Password != "" {
+		return checkCurrentPassword(user, password)
+	}
+	if sessionID == "" {
+		return ErrReauthRequired
+	}
+	sessions, err := sessionRepo.GetActiveSessions(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.FamilyID == sessionID && time.Since(session.StartedAt) < reauthMaxAge {
+			return nil
+		}
+	}
+	return ErrReauthRequired
+}
+
+func checkCurrentPassword(user *model.User, password string) error {
+	ok, _, err := utilities.VerifyPassword(password, user.Password)
+	if err != nil {
+		log.Printf("Unreadable password hash for user %d: %v", user.ID, err)
+		return ErrWrongPassword
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+	return nil
+}
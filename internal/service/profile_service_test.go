@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+func (r *memSessionRepo) GetActiveSessions(userID uint) ([]model.Session, error) {
+	var sessions []model.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(time.Now()) {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func TestConfirmIdentity(t *testing.T) {
+	hash, err := utilities.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withPassword := &model.User{ID: 1, Password: hash}
+	sso := &model.User{ID: 2}
+
+	now := time.Now()
+	sessions := newMemSessionRepo()
+	for id, started := range map[string]time.Time{"fresh": now.Add(-time.Minute), "stale": now.Add(-time.Hour)} {
+		_ = sessions.CreateSession(&model.Session{ID: id + "-jti", FamilyID: id, UserID: sso.ID, StartedAt: started, ExpiresAt: now.Add(time.Hour)})
+	}
+
+	tests := []struct {
+		name      string
+		user      *model.User
+		sessionID string
+		password  string
+		want      error
+	}{
+		{"right password", withPassword, "", "secret", nil},
+		{"wrong password", withPassword, "fresh", "wrong", ErrWrongPassword},
+		{"no password, fresh login", sso, "fresh", "", nil},
+		{"no password, old login", sso, "stale", "", ErrReauthRequired},
+		{"no password, no session", sso, "", "", ErrReauthRequired},
+		{"no password, other user's login", &model.User{ID: 3}, "fresh", "", ErrReauthRequired},
+	}
+	for _, tt := range tests {
+		if err := confirmIdentity(sessions, tt.user, tt.sessionID, tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// A revoked login no longer counts as fresh.
+	_ = sessions.RevokeFamily("fresh", RevokedLogout)
+	if err := confirmIdentity(sessions, sso, "fresh", ""); !errors.Is(err, ErrReauthRequired) {
+		t.Errorf("revoked login: got %v", err)
+	}
+}
+
+func TestListedVoice(t *testing.T) {
+	voices := []string{"tts_models/en/ljspeech/vits", " tts_models/en/jenny/jenny "}
+	tests := []struct {
+		voice  string
+		voices []string
+		want   string
+	}{
+		{"tts_models/en/jenny/jenny", voices, "tts_models/en/jenny/jenny"},
+		{"tts_models/en/vctk/vits", voices, ""},
+		{"", voices, ""},
+		// Saved while any voice was allowed, but not one the server offers.
+		{"tts_models/en/vctk/vits", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := listedVoice(tt.voice, tt.voices); got != tt.want {
+			t.Errorf("listedVoice(%q, %v) = %q, want %q", tt.voice, tt.voices, got, tt.want)
+		}
+	}
+}
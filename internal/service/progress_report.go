@@ -0,0 +1,590 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// Report types accepted by BuildProgressReport.
+const (
+	ReportInitial = "initial"
+	ReportCurrent = "current"
+)
+
+// ScorePoint is a week's accuracy, as a percentage of questions answered correctly.
+type ScorePoint struct {
+	Date  time.Time `json:"date"`
+	Score float64   `json:"score"`
+}
+
+// CategorySeries is the weekly accuracy of one assessment topic.
+type CategorySeries struct {
+	Category string       `json:"category"`
+	Points   []ScorePoint `json:"points"`
+}
+
+// StoryScore is a story with the performance score given by its analysis.
+type StoryScore struct {
+	Title string    `json:"title"`
+	Date  time.Time `json:"date"`
+	Score int       `json:"score"`
+}
+
+// GrammarIssue counts corrected sentences whose feedback mentions an issue.
+type GrammarIssue struct {
+	Issue   string `json:"issue"`
+	Count   int    `json:"count"`
+	Example string `json:"example"`
+}
+
+// ProgressReport is everything printed in a downloadable progress report.
+type ProgressReport struct {
+	Type           string
+	UserName       string
+	Range          ReportRange
+	GeneratedAt    time.Time
+	Progress       *ProgressData
+	CategoryScores []CategorySeries
+	Accuracy       float64
+	Stories        []StoryScore
+	GrammarIssues  []GrammarIssue
+	Tips           []string
+}
+
+// grammarIssueKeywords classifies free-text sentence feedback into issue
+// types. The first issue with a matching keyword wins. Keywords are terms
+// that only appear when feedback is about the issue, not common words such
+// as "the" or "past" that most feedback contains.
+var grammarIssueKeywords = []struct {
+	issue    string
+	keywords []string
+}{
+	{"Verb tense", []string{"tense", "past participle", "simple past", "past simple", "present perfect", "past perfect"}},
+	{"Subject-verb agreement", []string{"agreement", "agree", "singular", "plural verb"}},
+	{"Articles", []string{"article"}},
+	{"Prepositions", []string{"preposition"}},
+	{"Punctuation", []string{"punctuation", "comma", "full stop", "apostrophe", "question mark"}},
+	{"Capitalization", []string{"capital", "uppercase", "lowercase"}},
+	{"Spelling", []string{"spelling", "misspel", "typo"}},
+	{"Plurals", []string{"plural"}},
+	{"Word order", []string{"word order", "order of"}},
+	{"Pronouns", []string{"pronoun"}},
+	{"Word choice", []string{"word choice", "instead of", "vocabulary"}},
+}
+
+const maxReportIssues = 5
+
+// classifyGrammarIssue returns the one issue type a sentence's feedback is
+// about, or "" when it matches none.
+func classifyGrammarIssue(feedback string) string {
+	feedback = strings.ToLower(feedback)
+	for _, kind := range grammarIssueKeywords {
+		for _, keyword := range kind.keywords {
+			if strings.Contains(feedback, keyword) {
+				return kind.issue
+			}
+		}
+	}
+	return ""
+}
+
+const maxReportTips = 6
+
+// BuildProgressReport gathers the data for an initial or current progress
+// report. The initial report ends at the user's first completed assessment,
+// or covers the whole range if there is none yet.
+func BuildProgressReport(db *gorm.DB, user *model.User, reportType string, rng ReportRange) (*ProgressReport, error) {
+	if reportType == ReportInitial {
+		var first model.Assessment
+		err := rng.apply(db, "created_at").Where("user_id = ? AND status = ?", user.ID, AssessmentCompleted).
+			Order("created_at asc").
+			First(&first).Error
+		switch {
+		case err == nil:
+			end := first.CreatedAt.Add(time.Second)
+			if rng.To.IsZero() || end.Before(rng.To) {
+				rng.To = end
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, fmt.Errorf("failed to get initial assessment: %w", err)
+		}
+	}
+
+	progress, err := GenerateProgressData(db, user.ID, rng)
+	if err != nil {
+		return nil, err
+	}
+	report := &ProgressReport{
+		Type:        reportType,
+		UserName:    strings.TrimSpace(user.FirstName + " " + user.LastName),
+		Range:       rng,
+		GeneratedAt: time.Now(),
+		Progress:    progress,
+	}
+	if report.UserName == "" {
+		report.UserName = user.Username
+	}
+	if stats, ok := progress.CurrentProgress["stats"].(map[string]interface{}); ok {
+		report.Accuracy, _ = stats["accuracy"].(float64)
+	}
+
+	for _, topic := range progress.Topics {
+		series := CategorySeries{Category: topic.Name}
+		for _, week := range topic.Weekly {
+			series.Points = append(series.Points, ScorePoint{Date: week.Week, Score: week.Accuracy})
+		}
+		report.CategoryScores = append(report.CategoryScores, series)
+	}
+
+	var stories []model.Story
+	if err := rng.apply(db, "created_at").Where("user_id = ? AND status = ?", user.ID, "completed").
+		Order("created_at asc").
+		Find(&stories).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch stories: %w", err)
+	}
+	seenTips := make(map[string]bool)
+	for _, story := range stories {
+		report.Stories = append(report.Stories, StoryScore{Title: story.Title, Date: story.CreatedAt, Score: story.PerformanceScore})
+		for _, tip := range strings.Split(story.Tips, "\n") {
+			tip = strings.TrimSpace(tip)
+			if tip == "" || seenTips[strings.ToLower(tip)] {
+				continue
+			}
+			seenTips[strings.ToLower(tip)] = true
+			report.Tips = append(report.Tips, tip)
+		}
+	}
+	// Most recent advice first.
+	for i, j := 0, len(report.Tips)-1; i < j; i, j = i+1, j-1 {
+		report.Tips[i], report.Tips[j] = report.Tips[j], report.Tips[i]
+	}
+	if len(report.Tips) > maxReportTips {
+		report.Tips = report.Tips[:maxReportTips]
+	}
+
+	if report.GrammarIssues, err = grammarIssues(db, user.ID, rng); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// grammarIssues classifies the feedback of sentences the LLM corrected and
+// returns the most frequent issue types.
+func grammarIssues(db *gorm.DB, userID uint, rng ReportRange) ([]GrammarIssue, error) {
+	var sentences []model.Sentence
+	err := rng.apply(db.Model(&model.Sentence{}), "sentences.created_at").
+		Joins("JOIN stories ON sentences.story_id = stories.id").
+		Where("stories.user_id = ?", userID).
+		Find(&sentences).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sentences: %w", err)
+	}
+
+	counts := make(map[string]*GrammarIssue)
+	for _, sentence := range sentences {
+		corrected := strings.TrimSpace(sentence.CorrectedText)
+		if corrected == "" || corrected == strings.TrimSpace(sentence.OriginalText) {
+			continue
+		}
+		kind := classifyGrammarIssue(sentence.Feedback)
+		if kind == "" {
+			continue
+		}
+		issue, ok := counts[kind]
+		if !ok {
+			issue = &GrammarIssue{Issue: kind, Example: sentence.OriginalText + " → " + corrected}
+			counts[kind] = issue
+		}
+		issue.Count++
+	}
+
+	issues := make([]GrammarIssue, 0, len(counts))
+	for _, issue := range counts {
+		issues = append(issues, *issue)
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Count != issues[j].Count {
+			return issues[i].Count > issues[j].Count
+		}
+		return issues[i].Issue < issues[j].Issue
+	})
+	if len(issues) > maxReportIssues {
+		issues = issues[:maxReportIssues]
+	}
+	return issues, nil
+}
+
+// reportPalette colours chart series in order.
+var reportPalette = [][3]int{
+	{52, 101, 164}, {204, 0, 0}, {78, 154, 6}, {245, 121, 0}, {117, 80, 123}, {193, 125, 17},
+}
+
+// reportRenderer writes a ProgressReport onto A4 portrait pages.
+type reportRenderer struct {
+	pdf        *gofpdf.Fpdf
+	fontFamily string
+}
+
+const (
+	reportMargin = 15.0
+	reportWidth  = 210.0 - 2*reportMargin
+)
+
+// RenderProgressReport draws the report as a PDF with vector charts.
+func RenderProgressReport(report *ProgressReport) ([]byte, error) {
+	pdf, family := newUnicodePDF("P")
+	r := &reportRenderer{pdf: pdf, fontFamily: family}
+	pdf.SetMargins(reportMargin, reportMargin, reportMargin)
+	pdf.SetAutoPageBreak(true, reportMargin)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-10)
+		pdf.SetFont(family, "", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	r.drawHeader(report)
+	r.drawSummary(report)
+	r.drawCategoryChart(report.CategoryScores)
+	r.drawBreakdown("Accuracy by topic", report.Progress.Topics)
+	r.drawBreakdown("Accuracy by question type", report.Progress.QuestionTypes)
+	r.drawStoryChart(report.Stories)
+	r.drawIssues(report.GrammarIssues)
+	r.drawTips(report.Tips)
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *reportRenderer) heading(text string) {
+	r.ensureSpace(20)
+	r.pdf.Ln(4)
+	r.pdf.SetFont(r.fontFamily, "B", 13)
+	r.pdf.SetTextColor(40, 40, 40)
+	r.pdf.CellFormat(0, 8, text, "", 1, "L", false, 0, "")
+	r.pdf.SetDrawColor(200, 200, 200)
+	y := r.pdf.GetY()
+	r.pdf.Line(reportMargin, y, reportMargin+reportWidth, y)
+	r.pdf.Ln(2)
+}
+
+func (r *reportRenderer) paragraph(text string, size float64) {
+	text, rtl := prepareUnicodeText(text)
+	align := "L"
+	if rtl {
+		r.pdf.RTL()
+		align = "R"
+	}
+	r.pdf.SetFont(r.fontFamily, "", size)
+	r.pdf.SetTextColor(60, 60, 60)
+	r.pdf.MultiCell(0, size*0.5, text, "", align, false)
+	if rtl {
+		r.pdf.LTR()
+	}
+}
+
+// ensureSpace starts a new page if fewer than h mm remain above the bottom margin.
+func (r *reportRenderer) ensureSpace(h float64) {
+	_, pageH := r.pdf.GetPageSize()
+	if r.pdf.GetY()+h > pageH-reportMargin {
+		r.pdf.AddPage()
+	}
+}
+
+func (r *reportRenderer) drawHeader(report *ProgressReport) {
+	title := "Progress Report"
+	if report.Type == ReportInitial {
+		title = "Initial Progress Report"
+	}
+	r.pdf.SetFont(r.fontFamily, "B", 20)
+	r.pdf.SetTextColor(30, 30, 30)
+	r.pdf.CellFormat(0, 10, title, "", 1, "L", false, 0, "")
+
+	period := "All time"
+	switch {
+	case !report.Range.From.IsZero() && !report.Range.To.IsZero():
+		period = report.Range.From.Format("2 Jan 2006") + " – " + report.Range.To.Add(-time.Second).Format("2 Jan 2006")
+	case !report.Range.From.IsZero():
+		period = "Since " + report.Range.From.Format("2 Jan 2006")
+	case !report.Range.To.IsZero():
+		period = "Until " + report.Range.To.Add(-time.Second).Format("2 Jan 2006")
+	}
+	name, _ := prepareUnicodeText(report.UserName)
+	r.pdf.SetFont(r.fontFamily, "", 10)
+	r.pdf.SetTextColor(100, 100, 100)
+	r.pdf.CellFormat(0, 5, name, "", 1, "L", false, 0, "")
+	r.pdf.CellFormat(0, 5, "Period: "+period+"   ·   Generated "+report.GeneratedAt.Format("2 Jan 2006"), "", 1, "L", false, 0, "")
+}
+
+func (r *reportRenderer) drawSummary(report *ProgressReport) {
+	r.heading("Summary")
+	var stats map[string]interface{}
+	if s, ok := report.Progress.CurrentProgress["stats"].(map[string]interface{}); ok {
+		stats = s
+	}
+	improvement, _ := report.Progress.CurrentProgress["improvement"].(float64)
+
+	tiles := []struct{ label, value string }{
+		{"Accuracy", fmt.Sprintf("%.0f%%", report.Accuracy)},
+		{"Stories", fmt.Sprintf("%v", stats["total_stories"])},
+		{"Sentences", fmt.Sprintf("%v", stats["total_sentences"])},
+		{"Avg. story score", fmt.Sprintf("%.0f", stats["average_performance"])},
+		{"Change within topics", fmt.Sprintf("%+.0f pts", improvement)},
+	}
+	w := reportWidth / float64(len(tiles))
+	y := r.pdf.GetY()
+	for i, tile := range tiles {
+		x := reportMargin + float64(i)*w
+		r.pdf.SetFillColor(242, 245, 250)
+		r.pdf.RoundedRect(x+1, y, w-2, 18, 2, "1234", "F")
+		r.pdf.SetXY(x+1, y+2)
+		r.pdf.SetFont(r.fontFamily, "B", 14)
+		r.pdf.SetTextColor(30, 30, 30)
+		r.pdf.CellFormat(w-2, 8, tile.value, "", 0, "C", false, 0, "")
+		r.pdf.SetXY(x+1, y+10)
+		r.pdf.SetFont(r.fontFamily, "", 8)
+		r.pdf.SetTextColor(110, 110, 110)
+		r.pdf.CellFormat(w-2, 5, tile.label, "", 0, "C", false, 0, "")
+	}
+	r.pdf.SetXY(reportMargin, y+20)
+}
+
+// chartFrame draws the axes and horizontal grid of a 0–100 chart and returns
+// the plotting area.
+func (r *reportRenderer) chartFrame(h float64) (x, y, w, plotH float64) {
+	r.ensureSpace(h + 20)
+	x, y = reportMargin+10, r.pdf.GetY()+2
+	w, plotH = reportWidth-10, h
+	r.pdf.SetFont(r.fontFamily, "", 7)
+	r.pdf.SetTextColor(120, 120, 120)
+	r.pdf.SetLineWidth(0.1)
+	for v := 0; v <= 100; v += 25 {
+		ly := y + plotH - plotH*float64(v)/100
+		r.pdf.SetDrawColor(225, 225, 225)
+		r.pdf.Line(x, ly, x+w, ly)
+		r.pdf.SetXY(reportMargin, ly-2)
+		r.pdf.CellFormat(8, 4, fmt.Sprintf("%d", v), "", 0, "R", false, 0, "")
+	}
+	r.pdf.SetDrawColor(120, 120, 120)
+	r.pdf.SetLineWidth(0.3)
+	r.pdf.Line(x, y, x, y+plotH)
+	r.pdf.Line(x, y+plotH, x+w, y+plotH)
+	return x, y, w, plotH
+}
+
+func (r *reportRenderer) emptyNote(text string) {
+	r.pdf.SetFont(r.fontFamily, "I", 9)
+	r.pdf.SetTextColor(130, 130, 130)
+	r.pdf.CellFormat(0, 6, text, "", 1, "L", false, 0, "")
+}
+
+// drawCategoryChart plots each category's assessment scores as a line over time.
+func (r *reportRenderer) drawCategoryChart(series []CategorySeries) {
+	r.heading("Weekly accuracy by topic")
+	if len(series) == 0 {
+		r.emptyNote("No completed assessments in this period.")
+		return
+	}
+
+	var first, last time.Time
+	for _, s := range series {
+		for _, p := range s.Points {
+			if first.IsZero() || p.Date.Before(first) {
+				first = p.Date
+			}
+			if p.Date.After(last) {
+				last = p.Date
+			}
+		}
+	}
+	span := last.Sub(first).Seconds()
+
+	x, y, w, h := r.chartFrame(55)
+	pos := func(p ScorePoint) (float64, float64) {
+		px := x + w/2
+		if span > 0 {
+			px = x + 4 + (w-8)*p.Date.Sub(first).Seconds()/span
+		}
+		return px, y + h - h*p.Score/100
+	}
+
+	for i, s := range series {
+		c := reportPalette[i%len(reportPalette)]
+		r.pdf.SetDrawColor(c[0], c[1], c[2])
+		r.pdf.SetFillColor(c[0], c[1], c[2])
+		r.pdf.SetLineWidth(0.6)
+		for j := 1; j < len(s.Points); j++ {
+			x1, y1 := pos(s.Points[j-1])
+			x2, y2 := pos(s.Points[j])
+			r.pdf.Line(x1, y1, x2, y2)
+		}
+		for _, p := range s.Points {
+			px, py := pos(p)
+			r.pdf.Circle(px, py, 0.9, "F")
+		}
+	}
+	r.pdf.SetLineWidth(0.2)
+
+	r.pdf.SetFont(r.fontFamily, "", 7)
+	r.pdf.SetTextColor(120, 120, 120)
+	r.pdf.SetXY(x, y+h+1)
+	r.pdf.CellFormat(w/2, 4, first.Format("2 Jan 2006"), "", 0, "L", false, 0, "")
+	if span > 0 {
+		r.pdf.CellFormat(w/2, 4, last.Format("2 Jan 2006"), "", 0, "R", false, 0, "")
+	}
+
+	// Legend.
+	lx, ly := x, y+h+6
+	r.pdf.SetFont(r.fontFamily, "", 8)
+	for i, s := range series {
+		label, _ := prepareUnicodeText(s.Category)
+		lw := r.pdf.GetStringWidth(label) + 10
+		if lx+lw > x+w {
+			lx, ly = x, ly+5
+		}
+		c := reportPalette[i%len(reportPalette)]
+		r.pdf.SetFillColor(c[0], c[1], c[2])
+		r.pdf.Rect(lx, ly+1, 3, 3, "F")
+		r.pdf.SetTextColor(60, 60, 60)
+		r.pdf.SetXY(lx+4, ly)
+		r.pdf.CellFormat(lw-4, 5, label, "", 0, "L", false, 0, "")
+		lx += lw
+	}
+	r.pdf.SetXY(reportMargin, ly+7)
+}
+
+// drawBreakdown lists each topic or question type with its answer count,
+// accuracy and change between its first and latest week.
+func (r *reportRenderer) drawBreakdown(title string, entries []ProgressBreakdown) {
+	r.heading(title)
+	if len(entries) == 0 {
+		r.emptyNote("No answered questions in this period.")
+		return
+	}
+	header := func() {
+		r.pdf.SetFont(r.fontFamily, "B", 8)
+		r.pdf.SetTextColor(90, 90, 90)
+		r.pdf.CellFormat(reportWidth-75, 5, "", "", 0, "L", false, 0, "")
+		r.pdf.CellFormat(25, 5, "Answers", "", 0, "R", false, 0, "")
+		r.pdf.CellFormat(25, 5, "Accuracy", "", 0, "R", false, 0, "")
+		r.pdf.CellFormat(25, 5, "Change", "", 1, "R", false, 0, "")
+	}
+	header()
+	r.pdf.SetFont(r.fontFamily, "", 8)
+	r.pdf.SetTextColor(60, 60, 60)
+	for _, entry := range entries {
+		r.ensureSpace(5)
+		name, _ := prepareUnicodeText(entry.Name)
+		change := "–"
+		if entry.Improvement != nil {
+			change = fmt.Sprintf("%+.0f pts", *entry.Improvement)
+		}
+		r.pdf.CellFormat(reportWidth-75, 5, name, "", 0, "L", false, 0, "")
+		r.pdf.CellFormat(25, 5, fmt.Sprintf("%d", entry.Answers), "", 0, "R", false, 0, "")
+		r.pdf.CellFormat(25, 5, fmt.Sprintf("%.0f%%", entry.Accuracy), "", 0, "R", false, 0, "")
+		r.pdf.CellFormat(25, 5, change, "", 1, "R", false, 0, "")
+	}
+}
+
+// drawStoryChart draws one bar per completed story with its performance score.
+func (r *reportRenderer) drawStoryChart(stories []StoryScore) {
+	r.heading("Stories written")
+	if len(stories) == 0 {
+		r.emptyNote("No completed stories in this period.")
+		return
+	}
+
+	x, y, w, h := r.chartFrame(50)
+	slot := w / float64(len(stories))
+	barW := slot * 0.6
+	if barW > 14 {
+		barW = 14
+	}
+	labelled := slot >= 12
+	r.pdf.SetFont(r.fontFamily, "", 6)
+	for i, story := range stories {
+		score := float64(story.Score)
+		if score > 100 {
+			score = 100
+		}
+		bx := x + float64(i)*slot + (slot-barW)/2
+		bh := h * score / 100
+		r.pdf.SetFillColor(52, 101, 164)
+		r.pdf.Rect(bx, y+h-bh, barW, bh, "F")
+		r.pdf.SetTextColor(60, 60, 60)
+		r.pdf.SetXY(bx-2, y+h-bh-4)
+		r.pdf.CellFormat(barW+4, 4, fmt.Sprintf("%d", story.Score), "", 0, "C", false, 0, "")
+		if labelled {
+			r.pdf.SetXY(x+float64(i)*slot, y+h+1)
+			r.pdf.CellFormat(slot, 4, story.Date.Format("2 Jan"), "", 0, "C", false, 0, "")
+		}
+	}
+	r.pdf.SetXY(reportMargin, y+h+7)
+
+	// Table of titles beneath the chart.
+	r.pdf.SetFont(r.fontFamily, "", 8)
+	for _, story := range stories {
+		r.ensureSpace(5)
+		title, rtl := prepareUnicodeText(story.Title)
+		r.pdf.SetTextColor(60, 60, 60)
+		r.pdf.CellFormat(25, 5, story.Date.Format("2 Jan 2006"), "", 0, "L", false, 0, "")
+		if rtl {
+			r.pdf.RTL()
+		}
+		r.pdf.CellFormat(reportWidth-40, 5, title, "", 0, "L", false, 0, "")
+		if rtl {
+			r.pdf.LTR()
+		}
+		r.pdf.CellFormat(15, 5, fmt.Sprintf("%d", story.Score), "", 1, "R", false, 0, "")
+	}
+}
+
+func (r *reportRenderer) drawIssues(issues []GrammarIssue) {
+	r.heading("Top recurring grammar issues")
+	if len(issues) == 0 {
+		r.emptyNote("No recurring issues found.")
+		return
+	}
+	max := issues[0].Count
+	for _, issue := range issues {
+		r.ensureSpace(14)
+		y := r.pdf.GetY()
+		r.pdf.SetFont(r.fontFamily, "B", 9)
+		r.pdf.SetTextColor(40, 40, 40)
+		r.pdf.CellFormat(50, 5, issue.Issue, "", 0, "L", false, 0, "")
+		barW := (reportWidth - 65) * float64(issue.Count) / float64(max)
+		r.pdf.SetFillColor(204, 0, 0)
+		r.pdf.Rect(reportMargin+50, y+1, barW, 3, "F")
+		r.pdf.SetXY(reportMargin+reportWidth-15, y)
+		r.pdf.SetFont(r.fontFamily, "", 9)
+		r.pdf.CellFormat(15, 5, fmt.Sprintf("%d×", issue.Count), "", 1, "R", false, 0, "")
+		r.paragraph(issue.Example, 8)
+		r.pdf.Ln(1)
+	}
+}
+
+func (r *reportRenderer) drawTips(tips []string) {
+	r.heading("Tips")
+	if len(tips) == 0 {
+		r.emptyNote("Complete a story to receive writing tips.")
+		return
+	}
+	for _, tip := range tips {
+		r.ensureSpace(10)
+		r.paragraph("• "+tip, 9)
+		r.pdf.Ln(1)
+	}
+}
@@ -0,0 +1,33 @@
+package service
+
+import "testing"
+
+func TestClassifyGrammarIssue(t *testing.T) {
+	tests := []struct {
+		feedback string
+		want     string
+	}{
+		{"Use the past tense \"went\" because the story happened yesterday.", "Verb tense"},
+		{"The past participle of \"write\" is \"written\".", "Verb tense"},
+		{"The verb should agree with the subject: \"she walks\".", "Subject-verb agreement"},
+		{"Use the article \"an\" before a vowel sound.", "Articles"},
+		{"You need a comma after the introductory phrase.", "Punctuation"},
+		{"Add a full stop at the end of the sentence.", "Punctuation"},
+		{"Names of the days start with a capital letter.", "Capitalization"},
+		{"\"Beautiful\" is misspelled in the first part.", "Spelling"},
+		{"Use \"in\" as the preposition for months.", "Prepositions"},
+		{"The word order in the question is wrong.", "Word order"},
+		// A sentence counts towards one issue only, the first that matches.
+		{"Use the past tense and add a comma after \"Yesterday\".", "Verb tense"},
+		// Common words alone say nothing about the mistake.
+		{"Great job! The sentence is clear and the story is fun to read.", ""},
+		{"In the past you wrote a similar sentence; this one is an improvement.", ""},
+		{"The present you got sounds lovely. Nice work on the ending.", ""},
+		{"Over a period of time your writing has improved.", ""},
+	}
+	for _, tt := range tests {
+		if got := classifyGrammarIssue(tt.feedback); got != tt.want {
+			t.Errorf("classifyGrammarIssue(%q) = %q, want %q", tt.feedback, got, tt.want)
+		}
+	}
+}
@@ -2,41 +2,197 @@ package service
 
 import (
 	"fmt"
+	"sort"
+	"time"
 
 	"gorm.io/gorm"
 	"inkwell-backend-V2.0/internal/model"
 )
 
-// ProgressData holds the metrics for the progress report.
+// ProgressData holds the metrics for the progress report. Assessment
+// progress is computed from scored answers, broken down by topic and by
+// question type, each with a weekly accuracy series.
 type ProgressData struct {
 	InitialProgress map[string]interface{} `json:"initial_progress"`
 	CurrentProgress map[string]interface{} `json:"current_progress"`
+	Topics          []ProgressBreakdown    `json:"topics"`
+	QuestionTypes   []ProgressBreakdown    `json:"question_types"`
+	Weekly          []WeekPoint            `json:"weekly"`
 }
 
-// GenerateProgressData computes the progress data for a given user.
-func GenerateProgressData(db *gorm.DB, userID uint) (*ProgressData, error) {
-	// Query for the initial (oldest completed) assessment.
-	var initialAssessment model.Assessment
-	if err := db.Where("user_id = ? AND status = ?", userID, "completed").
-		Order("created_at asc").
-		First(&initialAssessment).Error; err != nil {
-		return nil, fmt.Errorf("failed to get initial assessment: %w", err)
+// WeekPoint is the accuracy of the answers given in one week, which starts on Monday.
+type WeekPoint struct {
+	Week     time.Time `json:"week"`
+	Answers  int       `json:"answers"`
+	Correct  int       `json:"correct"`
+	Accuracy float64   `json:"accuracy"` // percentage
+}
+
+// ProgressBreakdown is the progress in one topic or question type.
+// Improvement is the latest week's accuracy minus the first week's, in
+// percentage points, and is nil until answers span two weeks.
+type ProgressBreakdown struct {
+	Name        string      `json:"name"`
+	Answers     int         `json:"answers"`
+	Correct     int         `json:"correct"`
+	Accuracy    float64     `json:"accuracy"`
+	Improvement *float64    `json:"improvement"`
+	Weekly      []WeekPoint `json:"weekly"`
+}
+
+// ReportRange limits progress data to records created within [From, To).
+// A zero bound leaves that side of the range open.
+type ReportRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// apply restricts q to rows whose column falls inside the range.
+func (r ReportRange) apply(q *gorm.DB, column string) *gorm.DB {
+	if !r.From.IsZero() {
+		q = q.Where(column+" >= ?", r.From)
+	}
+	if !r.To.IsZero() {
+		q = q.Where(column+" < ?", r.To)
+	}
+	return q
+}
+
+// weekStart returns midnight on the Monday of t's week.
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
+
+func addWeekAnswer(points []WeekPoint, week time.Time, correct bool) []WeekPoint {
+	if n := len(points); n == 0 || !points[n-1].Week.Equal(week) {
+		points = append(points, WeekPoint{Week: week})
+	}
+	p := &points[len(points)-1]
+	p.Answers++
+	if correct {
+		p.Correct++
+	}
+	return points
+}
+
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+// breakdownBuilder collects answers, oldest first, into per-name breakdowns.
+type breakdownBuilder map[string]*ProgressBreakdown
+
+func (b breakdownBuilder) add(name string, week time.Time, correct bool) {
+	entry, ok := b[name]
+	if !ok {
+		entry = &ProgressBreakdown{Name: name}
+		b[name] = entry
+	}
+	entry.Answers++
+	if correct {
+		entry.Correct++
+	}
+	entry.Weekly = addWeekAnswer(entry.Weekly, week, correct)
+}
+
+// list finishes the percentages and returns the breakdowns sorted by name.
+func (b breakdownBuilder) list() []ProgressBreakdown {
+	list := make([]ProgressBreakdown, 0, len(b))
+	for _, entry := range b {
+		entry.Accuracy = percentage(entry.Correct, entry.Answers)
+		for i := range entry.Weekly {
+			entry.Weekly[i].Accuracy = percentage(entry.Weekly[i].Correct, entry.Weekly[i].Answers)
+		}
+		if n := len(entry.Weekly); n >= 2 {
+			change := entry.Weekly[n-1].Accuracy - entry.Weekly[0].Accuracy
+			entry.Improvement = &change
+		}
+		list = append(list, *entry)
 	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
 
-	// Query for the latest (most recent completed) assessment.
-	var latestAssessment model.Assessment
-	if err := db.Where("user_id = ? AND status = ?", userID, "completed").
-		Order("created_at desc").
-		First(&latestAssessment).Error; err != nil {
-		return nil, fmt.Errorf("failed to get latest assessment: %w", err)
+// firstAndLatest maps each breakdown to its first and latest week's accuracy.
+func firstAndLatest(list []ProgressBreakdown) (first, latest map[string]float64) {
+	first, latest = make(map[string]float64), make(map[string]float64)
+	for _, entry := range list {
+		if len(entry.Weekly) == 0 {
+			continue
+		}
+		first[entry.Name] = entry.Weekly[0].Accuracy
+		latest[entry.Name] = entry.Weekly[len(entry.Weekly)-1].Accuracy
 	}
+	return first, latest
+}
 
-	// Calculate improvement as the difference between the latest and the initial scores.
-	improvement := float64(latestAssessment.Score - initialAssessment.Score)
+// overallImprovement averages the topic improvements, weighted by answers,
+// so that a change of topic mix does not count as progress.
+func overallImprovement(topics []ProgressBreakdown) float64 {
+	var sum float64
+	var weight int
+	for _, topic := range topics {
+		if topic.Improvement != nil {
+			sum += *topic.Improvement * float64(topic.Answers)
+			weight += topic.Answers
+		}
+	}
+	if weight == 0 {
+		return 0
+	}
+	return sum / float64(weight)
+}
+
+// GenerateProgressData computes the progress data for a given user within
+// the given range. Users without assessments get empty breakdowns.
+func GenerateProgressData(db *gorm.DB, userID uint, rng ReportRange) (*ProgressData, error) {
+	// Only the first, scored attempt at a question counts, and answers the
+	// LLM failed to grade say nothing about the learner.
+	var answers []struct {
+		CreatedAt    time.Time
+		IsCorrect    bool
+		Category     string
+		QuestionType string
+	}
+	if err := rng.apply(db.Table("answers"), "answers.created_at").
+		Select("answers.created_at, answers.is_correct, questions.category, questions.question_type").
+		Joins("JOIN questions ON questions.id = answers.question_id").
+		Where("answers.user_id = ? AND answers.attempt = 1 AND COALESCE(answers.graded_by, '') <> ?", userID, GradedFallback).
+		Order("answers.created_at asc").
+		Scan(&answers).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch answers: %w", err)
+	}
+	topics, types := breakdownBuilder{}, breakdownBuilder{}
+	var weekly []WeekPoint
+	correctAnswers := 0
+	for _, a := range answers {
+		week := weekStart(a.CreatedAt)
+		topics.add(a.Category, week, a.IsCorrect)
+		types.add(a.QuestionType, week, a.IsCorrect)
+		weekly = addWeekAnswer(weekly, week, a.IsCorrect)
+		if a.IsCorrect {
+			correctAnswers++
+		}
+	}
+	for i := range weekly {
+		weekly[i].Accuracy = percentage(weekly[i].Correct, weekly[i].Answers)
+	}
+	topicList, typeList := topics.list(), types.list()
+
+	var completedAssessments int64
+	if err := rng.apply(db.Model(&model.Assessment{}), "created_at").
+		Where("user_id = ? AND status = ?", userID, AssessmentCompleted).
+		Count(&completedAssessments).Error; err != nil {
+		return nil, fmt.Errorf("failed to count assessments: %w", err)
+	}
 
 	// Retrieve stories
 	var stories []model.Story
-	if err := db.Where("user_id = ?", userID).
+	if err := rng.apply(db, "created_at").Where("user_id = ?", userID).
 		Find(&stories).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch stories: %w", err)
 	}
@@ -48,59 +204,55 @@ func GenerateProgressData(db *gorm.DB, userID uint) (*ProgressData, error) {
 	var avgPerformance float64
 	if totalStories > 0 {
 		avgPerformance = float64(totalPerfScore) / float64(totalStories)
-	} else {
-		avgPerformance = 0
 	}
 
 	// Count total sentences by joining stories and sentences.
 	var totalSentences int64
-	if err := db.Table("sentences").
+	if err := rng.apply(db.Table("sentences"), "sentences.created_at").
 		Joins("JOIN stories ON sentences.story_id = stories.id").
 		Where("stories.user_id = ?", userID).
 		Count(&totalSentences).Error; err != nil {
 		return nil, fmt.Errorf("failed to count sentences: %w", err)
 	}
 
-	// Compute overall accuracy from the Answer table.
-	var totalAnswers int64
-	var correctAnswers int64
-	if err := db.Model(&model.Answer{}).
-		Where("user_id = ?", userID).
-		Count(&totalAnswers).Error; err != nil {
-		return nil, fmt.Errorf("failed to count answers: %w", err)
+	// Levels come from placement tests; the first one is the starting level.
+	initialLevel, currentLevel := "unplaced", "unplaced"
+	var levels []model.LevelHistory
+	if err := db.Where("user_id = ?", userID).Order("created_at asc, id asc").Find(&levels).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch level history: %w", err)
 	}
-	if err := db.Model(&model.Answer{}).
-		Where("user_id = ? AND is_correct = ?", userID, true).
-		Count(&correctAnswers).Error; err != nil {
-		return nil, fmt.Errorf("failed to count correct answers: %w", err)
-	}
-	var accuracy float64
-	if totalAnswers > 0 {
-		accuracy = (float64(correctAnswers) / float64(totalAnswers)) * 100
-	} else {
-		accuracy = 0
+	if len(levels) > 0 {
+		initialLevel, currentLevel = levels[0].Level, levels[len(levels)-1].Level
 	}
 
+	firstTypes, latestTypes := firstAndLatest(typeList)
+	firstTopics, latestTopics := firstAndLatest(topicList)
 	initialProgress := map[string]interface{}{
-		"level": "BEGINNER",
-		"scores": map[string]float64{
-			"masked":           float64(initialAssessment.Score),
-			"error_correction": float64(initialAssessment.Score),
-		},
+		"level":  initialLevel,
+		"scores": firstTypes,
+		"topics": firstTopics,
 	}
 
 	currentProgress := map[string]interface{}{
-		"improvement": improvement,
+		"level":       currentLevel,
+		"improvement": overallImprovement(topicList),
+		"scores":      latestTypes,
+		"topics":      latestTopics,
 		"stats": map[string]interface{}{
-			"total_stories":       totalStories,
-			"total_sentences":     totalSentences,
-			"accuracy":            accuracy,
-			"average_performance": avgPerformance,
+			"completed_assessments": completedAssessments,
+			"total_answers":         len(answers),
+			"total_stories":         totalStories,
+			"total_sentences":       totalSentences,
+			"accuracy":              percentage(correctAnswers, len(answers)),
+			"average_performance":   avgPerformance,
 		},
 	}
 
 	return &ProgressData{
 		InitialProgress: initialProgress,
 		CurrentProgress: currentProgress,
+		Topics:          topicList,
+		QuestionTypes:   typeList,
+		Weekly:          weekly,
 	}, nil
 }
@@ -0,0 +1,676 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/llm"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+)
+
+var (
+	ErrTopicNotFound    = errors.New("topic not found")
+	ErrTopicExists      = errors.New("a topic with this name already exists")
+	ErrTopicInUse       = errors.New("topic still has questions; deactivate it instead")
+	ErrQuestionNotFound = errors.New("question not found")
+	ErrQuestionInUse    = errors.New("question has been answered; deactivate it instead")
+)
+
+// FieldError describes one invalid field of a topic or question.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a topic or question fails validation.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// TopicInput is the writable part of a topic.
+type TopicInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Active      *bool  `json:"active"`
+}
+
+// QuestionRecord is the admin and import/export representation of a question.
+type QuestionRecord struct {
+	ID             uint     `json:"id,omitempty"`
+	Topic          string   `json:"topic"`
+	QuestionType   string   `json:"question_type"`
+	MaskedSentence string   `json:"masked_sentence,omitempty"`
+	ErrorSentence  string   `json:"error_sentence,omitempty"`
+	CorrectAnswer  string   `json:"correct_answer"`
+	Alternatives   []string `json:"alternatives"`
+	Difficulty     float64  `json:"difficulty"`
+	Tags           []string `json:"tags"`
+	Active         *bool    `json:"active,omitempty"`
+	// Payload is the type-specific JSON for multiple_choice, reorder,
+	// sentence_combining and free_response questions.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Read-only review fields; ignored on create, update and import.
+	Status     string `json:"status,omitempty"`
+	Source     string `json:"source,omitempty"`
+	ReviewNote string `json:"review_note,omitempty"`
+}
+
+// ImportRowError is one problem found in an imported row. Row is the 1-based
+// record number for JSON and the line number for CSV.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport summarises a bulk import. Valid rows are imported even when
+// others fail, unless DryRun is set, in which case nothing is written.
+type ImportReport struct {
+	Format  string           `json:"format"`
+	DryRun  bool             `json:"dry_run"`
+	Total   int              `json:"total"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Failed  int              `json:"failed"`
+	Errors  []ImportRowError `json:"errors"`
+}
+
+// Import/export formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+var questionCSVHeader = []string{
+	"id", "topic", "question_type", "masked_sentence", "error_sentence", "correct_answer", "alternatives", "difficulty", "tags", "active", "payload",
+}
+
+const maxTagLength = 32
+
+type QuestionBankService interface {
+	ListTopics() ([]model.Topic, error)
+	CreateTopic(input TopicInput) (*model.Topic, error)
+	UpdateTopic(id uint, input TopicInput) (*model.Topic, error)
+	DeleteTopic(id uint) error
+
+	ListQuestions(filter repository.QuestionFilter) ([]QuestionRecord, error)
+	GetQuestion(id uint) (*QuestionRecord, error)
+	CreateQuestion(rec QuestionRecord) (*QuestionRecord, error)
+	UpdateQuestion(id uint, rec QuestionRecord) (*QuestionRecord, error)
+	DeleteQuestion(id uint) error
+
+	ImportQuestions(format string, r io.Reader, dryRun bool) (*ImportReport, error)
+	ExportQuestions(format string, w io.Writer, filter repository.QuestionFilter) error
+
+	GenerateDrafts(req GenerationRequest) (*GenerationResult, error)
+	ApproveQuestion(id uint) (*QuestionRecord, error)
+	RejectQuestion(id uint, note string) (*QuestionRecord, error)
+}
+
+type questionBankService struct {
+	questionRepo repository.QuestionRepository
+	ollamaClient *llm.OllamaClient
+}
+
+func NewQuestionBankService(questionRepo repository.QuestionRepository, ollamaClient *llm.OllamaClient) QuestionBankService {
+	return &questionBankService{questionRepo: questionRepo, ollamaClient: ollamaClient}
+}
+
+//
+// TOPICS
+//
+
+func (s *questionBankService) ListTopics() ([]model.Topic, error) {
+	return s.questionRepo.ListTopics()
+}
+
+func (s *questionBankService) CreateTopic(input TopicInput) (*model.Topic, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, &ValidationError{Errors: []FieldError{{"name", "is required"}}}
+	}
+	if _, err := s.questionRepo.GetTopicByName(name); err == nil {
+		return nil, ErrTopicExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	topic := model.Topic{Name: name, Description: strings.TrimSpace(input.Description), Active: true}
+	if input.Active != nil {
+		topic.Active = *input.Active
+	}
+	if err := s.questionRepo.CreateTopic(&topic); err != nil {
+		return nil, err
+	}
+	return &topic, nil
+}
+
+// UpdateTopic changes a topic's name, description or activation. Renaming
+// carries the topic's questions and history over to the new name.
+func (s *questionBankService) UpdateTopic(id uint, input TopicInput) (*model.Topic, error) {
+	topic, err := s.topic(id)
+	if err != nil {
+		return nil, err
+	}
+	oldName := topic.Name
+	if name := strings.TrimSpace(input.Name); name != "" && name != oldName {
+		if _, err := s.questionRepo.GetTopicByName(name); err == nil {
+			return nil, ErrTopicExists
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		topic.Name = name
+	}
+	topic.Description = strings.TrimSpace(input.Description)
+	if input.Active != nil {
+		topic.Active = *input.Active
+	}
+	if err := s.questionRepo.UpdateTopic(topic, oldName); err != nil {
+		return nil, err
+	}
+	return topic, nil
+}
+
+// DeleteTopic removes an empty topic. Topics with questions can only be deactivated.
+func (s *questionBankService) DeleteTopic(id uint) error {
+	topic, err := s.topic(id)
+	if err != nil {
+		return err
+	}
+	count, err := s.questionRepo.CountQuestionsForTopic(topic.Name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTopicInUse
+	}
+	return s.questionRepo.DeleteTopic(id)
+}
+
+func (s *questionBankService) topic(id uint) (*model.Topic, error) {
+	topic, err := s.questionRepo.GetTopicByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTopicNotFound
+	}
+	return topic, err
+}
+
+func (s *questionBankService) topicNames() (map[string]bool, error) {
+	topics, err := s.questionRepo.ListTopics()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(topics))
+	for _, t := range topics {
+		names[t.Name] = true
+	}
+	return names, nil
+}
+
+//
+// QUESTIONS
+//
+
+func (s *questionBankService) ListQuestions(filter repository.QuestionFilter) ([]QuestionRecord, error) {
+	filter.Tag = normalizeTag(filter.Tag)
+	questions, err := s.questionRepo.ListQuestions(filter)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]QuestionRecord, len(questions))
+	for i := range questions {
+		records[i] = toQuestionRecord(&questions[i])
+	}
+	return records, nil
+}
+
+func (s *questionBankService) GetQuestion(id uint) (*QuestionRecord, error) {
+	question, err := s.question(id)
+	if err != nil {
+		return nil, err
+	}
+	rec := toQuestionRecord(question)
+	return &rec, nil
+}
+
+func (s *questionBankService) CreateQuestion(rec QuestionRecord) (*QuestionRecord, error) {
+	rec.ID = 0
+	topics, err := s.topicNames()
+	if err != nil {
+		return nil, err
+	}
+	normalizeRecord(&rec)
+	if errs := validateQuestionRecord(rec, topics); len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	question := model.Question{Active: true, Status: QuestionApproved, Source: "manual"}
+	applyQuestionRecord(&question, rec)
+	if err := s.questionRepo.CreateQuestion(&question); err != nil {
+		return nil, err
+	}
+	out := toQuestionRecord(&question)
+	return &out, nil
+}
+
+// UpdateQuestion replaces a question's content. Omitting active keeps the
+// current activation state.
+func (s *questionBankService) UpdateQuestion(id uint, rec QuestionRecord) (*QuestionRecord, error) {
+	question, err := s.question(id)
+	if err != nil {
+		return nil, err
+	}
+	topics, err := s.topicNames()
+	if err != nil {
+		return nil, err
+	}
+	rec.ID = id
+	normalizeRecord(&rec)
+	if errs := validateQuestionRecord(rec, topics); len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	applyQuestionRecord(question, rec)
+	if err := s.questionRepo.UpdateQuestion(question); err != nil {
+		return nil, err
+	}
+	out := toQuestionRecord(question)
+	return &out, nil
+}
+
+// DeleteQuestion removes a question that has never been answered. Answered
+// questions are kept for history and can only be deactivated.
+func (s *questionBankService) DeleteQuestion(id uint) error {
+	if _, err := s.question(id); err != nil {
+		return err
+	}
+	answers, err := s.questionRepo.CountAnswersForQuestion(id)
+	if err != nil {
+		return err
+	}
+	if answers > 0 {
+		return ErrQuestionInUse
+	}
+	return s.questionRepo.DeleteQuestion(id)
+}
+
+func (s *questionBankService) question(id uint) (*model.Question, error) {
+	question, err := s.questionRepo.GetQuestionByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrQuestionNotFound
+	}
+	return question, err
+}
+
+//
+// IMPORT / EXPORT
+//
+
+// ImportQuestions validates every row of a CSV or JSON file and imports the
+// valid ones. Rows carrying the id of an existing question update it; all
+// others are created. Duplicates of an existing question, or of an earlier
+// row, are rejected. The valid rows are written in one transaction.
+func (s *questionBankService) ImportQuestions(format string, r io.Reader, dryRun bool) (*ImportReport, error) {
+	var rows []importRow
+	var err error
+	switch format {
+	case FormatCSV:
+		rows, err = readQuestionCSV(r)
+	case FormatJSON:
+		rows, err = readQuestionJSON(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	topics, err := s.topicNames()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.questionRepo.GetAllQuestions()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*model.Question, len(existing))
+	existingKeys := make(map[string]uint, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+		existingKeys[questionKey(toQuestionRecord(&existing[i]))] = existing[i].ID
+	}
+	importedKeys := make(map[string]int)
+	var created, updated []*model.Question
+
+	report := &ImportReport{Format: format, DryRun: dryRun, Total: len(rows), Errors: []ImportRowError{}}
+	for _, row := range rows {
+		errs := row.errs
+		rec := row.rec
+		normalizeRecord(&rec)
+		for _, fe := range validateQuestionRecord(rec, topics) {
+			errs = append(errs, ImportRowError{Row: row.line, Field: fe.Field, Message: fe.Message})
+		}
+		var target *model.Question
+		if len(errs) == 0 && rec.ID != 0 {
+			if target = byID[rec.ID]; target == nil {
+				errs = append(errs, ImportRowError{Row: row.line, Field: "id", Message: "no question with this id"})
+			}
+		}
+		key := questionKey(rec)
+		if len(errs) == 0 {
+			if other, dup := existingKeys[key]; dup && other != rec.ID {
+				errs = append(errs, ImportRowError{Row: row.line, Message: fmt.Sprintf("duplicate of question %d", other)})
+			} else if line, dup := importedKeys[key]; dup {
+				errs = append(errs, ImportRowError{Row: row.line, Message: fmt.Sprintf("duplicate of row %d", line)})
+			}
+		}
+		if len(errs) > 0 {
+			report.Failed++
+			report.Errors = append(report.Errors, errs...)
+			continue
+		}
+		importedKeys[key] = row.line
+
+		if target != nil {
+			report.Updated++
+			applyQuestionRecord(target, rec)
+			updated = append(updated, target)
+		} else {
+			report.Created++
+			question := &model.Question{Active: true, Status: QuestionApproved, Source: "import"}
+			applyQuestionRecord(question, rec)
+			created = append(created, question)
+		}
+	}
+	if dryRun {
+		return report, nil
+	}
+	if err := s.questionRepo.SaveQuestions(created, updated); err != nil {
+		report.Created, report.Updated = 0, 0
+		return report, err
+	}
+	return report, nil
+}
+
+// ExportQuestions writes the matching questions as CSV or JSON in the same
+// shape ImportQuestions accepts.
+func (s *questionBankService) ExportQuestions(format string, w io.Writer, filter repository.QuestionFilter) error {
+	records, err := s.ListQuestions(filter)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(questionCSVHeader); err != nil {
+			return err
+		}
+		for _, rec := range records {
+			active := rec.Active != nil && *rec.Active
+			if err := cw.Write([]string{
+				strconv.FormatUint(uint64(rec.ID), 10),
+				rec.Topic,
+				rec.QuestionType,
+				rec.MaskedSentence,
+				rec.ErrorSentence,
+				rec.CorrectAnswer,
+				strings.Join(rec.Alternatives, alternativeSeparator),
+				strconv.FormatFloat(rec.Difficulty, 'f', -1, 64),
+				strings.Join(rec.Tags, ","),
+				strconv.FormatBool(active),
+				string(rec.Payload),
+			}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+type importRow struct {
+	line int
+	rec  QuestionRecord
+	errs []ImportRowError
+}
+
+func readQuestionJSON(r io.Reader) ([]importRow, error) {
+	var records []QuestionRecord
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, fmt.Errorf("invalid JSON: expected an array of questions: %w", err)
+	}
+	rows := make([]importRow, len(records))
+	for i, rec := range records {
+		rows[i] = importRow{line: i + 1, rec: rec}
+	}
+	return rows, nil
+}
+
+func readQuestionCSV(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: missing header row: %w", err)
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"topic", "question_type", "correct_answer"} {
+		if _, ok := col[required]; !ok {
+			return nil, fmt.Errorf("invalid CSV: missing required column %q", required)
+		}
+	}
+
+	var rows []importRow
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			rows = append(rows, importRow{line: line, errs: []ImportRowError{{Row: line, Message: err.Error()}}})
+			continue
+		}
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		row := importRow{line: line, rec: QuestionRecord{
+			Topic:          get("topic"),
+			QuestionType:   get("question_type"),
+			MaskedSentence: get("masked_sentence"),
+			ErrorSentence:  get("error_sentence"),
+			CorrectAnswer:  get("correct_answer"),
+		}}
+		if v := get("id"); v != "" {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				row.errs = append(row.errs, ImportRowError{Row: line, Field: "id", Message: "must be a positive integer"})
+			}
+			row.rec.ID = uint(id)
+		}
+		if v := get("difficulty"); v != "" {
+			d, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				row.errs = append(row.errs, ImportRowError{Row: line, Field: "difficulty", Message: "must be a number"})
+			}
+			row.rec.Difficulty = d
+		}
+		if v := get("alternatives"); v != "" {
+			row.rec.Alternatives = strings.Split(v, alternativeSeparator)
+		}
+		if v := get("tags"); v != "" {
+			row.rec.Tags = strings.Split(v, ",")
+		}
+		if v := get("payload"); v != "" {
+			row.rec.Payload = json.RawMessage(v)
+		}
+		if v := get("active"); v != "" {
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				row.errs = append(row.errs, ImportRowError{Row: line, Field: "active", Message: "must be true or false"})
+			}
+			row.rec.Active = &active
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+//
+// MAPPING & VALIDATION
+//
+
+func toQuestionRecord(q *model.Question) QuestionRecord {
+	active := q.Active
+	return QuestionRecord{
+		ID:             q.ID,
+		Topic:          q.Category,
+		QuestionType:   q.QuestionType,
+		MaskedSentence: q.MaskedSentence,
+		ErrorSentence:  q.ErrorSentence,
+		CorrectAnswer:  q.CorrectAnswer,
+		Alternatives:   append([]string{}, splitAlternatives(q.Alternatives)...),
+		Difficulty:     q.Difficulty,
+		Tags:           splitTags(q.Tags),
+		Active:         &active,
+		Payload:        json.RawMessage(q.Payload),
+		Status:         q.Status,
+		Source:         q.Source,
+		ReviewNote:     q.ReviewNote,
+	}
+}
+
+func applyQuestionRecord(q *model.Question, rec QuestionRecord) {
+	q.Category = rec.Topic
+	q.QuestionType = rec.QuestionType
+	q.MaskedSentence = rec.MaskedSentence
+	q.ErrorSentence = rec.ErrorSentence
+	q.CorrectAnswer = rec.CorrectAnswer
+	q.Alternatives = strings.Join(rec.Alternatives, alternativeSeparator)
+	q.Difficulty = rec.Difficulty
+	q.Tags = strings.Join(rec.Tags, ",")
+	q.Payload = string(rec.Payload)
+	if rec.Active != nil {
+		q.Active = *rec.Active
+	}
+}
+
+func normalizeRecord(rec *QuestionRecord) {
+	rec.Topic = strings.TrimSpace(rec.Topic)
+	rec.QuestionType = strings.ToLower(strings.TrimSpace(rec.QuestionType))
+	rec.MaskedSentence = strings.TrimSpace(rec.MaskedSentence)
+	rec.ErrorSentence = strings.TrimSpace(rec.ErrorSentence)
+	rec.CorrectAnswer = strings.TrimSpace(rec.CorrectAnswer)
+	alternatives := make([]string, 0, len(rec.Alternatives))
+	seenAlt := map[string]bool{rec.CorrectAnswer: true}
+	for _, alt := range rec.Alternatives {
+		if alt = strings.TrimSpace(alt); alt != "" && !seenAlt[alt] {
+			seenAlt[alt] = true
+			alternatives = append(alternatives, alt)
+		}
+	}
+	rec.Alternatives = alternatives
+	if len(rec.Payload) > 0 {
+		var compact bytes.Buffer
+		if json.Compact(&compact, rec.Payload) == nil {
+			rec.Payload = compact.Bytes()
+		}
+	}
+
+	tags := make([]string, 0, len(rec.Tags))
+	seen := make(map[string]bool, len(rec.Tags))
+	for _, tag := range rec.Tags {
+		tag = normalizeTag(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	rec.Tags = tags
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func splitTags(tags string) []string {
+	if tags == "" {
+		return []string{}
+	}
+	return strings.Split(tags, ",")
+}
+
+func validateQuestionRecord(rec QuestionRecord, topics map[string]bool) []FieldError {
+	var errs []FieldError
+	switch {
+	case rec.Topic == "":
+		errs = append(errs, FieldError{"topic", "is required"})
+	case !topics[rec.Topic]:
+		errs = append(errs, FieldError{"topic", fmt.Sprintf("unknown topic %q", rec.Topic)})
+	}
+	if rec.QuestionType == "" {
+		errs = append(errs, FieldError{"question_type", "is required"})
+	} else if qt, ok := questionTypes[rec.QuestionType]; ok {
+		errs = append(errs, qt.validate(rec)...)
+	} else {
+		errs = append(errs, FieldError{"question_type", fmt.Sprintf("unknown question type %q", rec.QuestionType)})
+	}
+	if rec.CorrectAnswer == "" {
+		errs = append(errs, FieldError{"correct_answer", "is required"})
+	}
+	for _, alt := range rec.Alternatives {
+		if strings.Contains(alt, alternativeSeparator) {
+			errs = append(errs, FieldError{"alternatives", fmt.Sprintf("alternative %q must not contain %q", alt, alternativeSeparator)})
+		}
+	}
+	if rec.Difficulty < -6 || rec.Difficulty > 6 {
+		errs = append(errs, FieldError{"difficulty", "must be between -6 and 6"})
+	}
+	for _, tag := range rec.Tags {
+		if len(tag) > maxTagLength || strings.Contains(tag, ",") {
+			errs = append(errs, FieldError{"tags", fmt.Sprintf("invalid tag %q", tag)})
+		}
+	}
+	return errs
+}
+
+// questionKey identifies questions that ask the same thing.
+func questionKey(rec QuestionRecord) string {
+	var sentence string
+	switch rec.QuestionType {
+	case "masked":
+		sentence = rec.MaskedSentence
+	case "error_correction":
+		sentence = rec.ErrorSentence
+	default:
+		sentence = string(rec.Payload)
+	}
+	return strings.ToLower(rec.Topic + "\x00" + rec.QuestionType + "\x00" + strings.Join(strings.Fields(sentence), " "))
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+)
+
+// memQuestionRepo keeps questions in memory. SaveQuestions writes all or
+// nothing, like the database transaction.
+type memQuestionRepo struct {
+	repository.QuestionRepository
+	questions map[uint]*model.Question
+	nextID    uint
+	saveErr   error
+}
+
+func newMemQuestionRepo(questions ...model.Question) *memQuestionRepo {
+	r := &memQuestionRepo{questions: map[uint]*model.Question{}, nextID: 1}
+	for i := range questions {
+		q := questions[i]
+		q.ID = r.nextID
+		r.nextID++
+		r.questions[q.ID] = &q
+	}
+	return r
+}
+
+func (r *memQuestionRepo) ListTopics() ([]model.Topic, error) {
+	return []model.Topic{{ID: 1, Name: "Grammar"}, {ID: 2, Name: "Spelling"}}, nil
+}
+
+func (r *memQuestionRepo) GetAllQuestions() ([]model.Question, error) {
+	questions := make([]model.Question, 0, len(r.questions))
+	for _, q := range r.questions {
+		questions = append(questions, *q)
+	}
+	sort.Slice(questions, func(i, j int) bool { return questions[i].ID < questions[j].ID })
+	return questions, nil
+}
+
+func (r *memQuestionRepo) ListQuestions(repository.QuestionFilter) ([]model.Question, error) {
+	return r.GetAllQuestions()
+}
+
+func (r *memQuestionRepo) SaveQuestions(created, updated []*model.Question) error {
+	if r.saveErr != nil {
+		return r.saveErr
+	}
+	for _, q := range created {
+		q.ID = r.nextID
+		r.nextID++
+		copied := *q
+		r.questions[q.ID] = &copied
+	}
+	for _, q := range updated {
+		copied := *q
+		r.questions[q.ID] = &copied
+	}
+	return nil
+}
+
+func testQuestionBank() (*questionBankService, *memQuestionRepo) {
+	repo := newMemQuestionRepo(
+		model.Question{Category: "Grammar", QuestionType: "masked", MaskedSentence: "She [MASK] to school.",
+			CorrectAnswer: "walks", Alternatives: "goes|runs", Difficulty: 0.5, Tags: "present,verbs", Active: true},
+		model.Question{Category: "Spelling", QuestionType: "error_correction", ErrorSentence: "I recieved it.",
+			CorrectAnswer: "I received it.", Difficulty: -1, Active: false},
+	)
+	return &questionBankService{questionRepo: repo}, repo
+}
+
+func importString(t *testing.T, s *questionBankService, format, data string, dryRun bool) *ImportReport {
+	t.Helper()
+	report, err := s.ImportQuestions(format, strings.NewReader(data), dryRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+// Importing an export updates every question in place and changes nothing.
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			s, repo := testQuestionBank()
+			before, _ := s.ListQuestions(repository.QuestionFilter{})
+			var buf bytes.Buffer
+			if err := s.ExportQuestions(format, &buf, repository.QuestionFilter{}); err != nil {
+				t.Fatal(err)
+			}
+			data := buf.String()
+			if format == FormatCSV {
+				data = "\ufeff" + data // as saved by spreadsheet programs
+			}
+
+			report := importString(t, s, format, data, false)
+			if report.Total != 2 || report.Updated != 2 || report.Created != 0 || report.Failed != 0 {
+				t.Fatalf("report %+v", report)
+			}
+			after, _ := s.ListQuestions(repository.QuestionFilter{})
+			if !reflect.DeepEqual(before, after) {
+				t.Errorf("questions changed:\n got %+v\nwant %+v", after, before)
+			}
+			if len(repo.questions) != 2 {
+				t.Errorf("%d questions, want 2", len(repo.questions))
+			}
+		})
+	}
+}
+
+func TestImportRejectsDuplicates(t *testing.T) {
+	s, repo := testQuestionBank()
+	csv := "topic,question_type,masked_sentence,correct_answer\n" +
+		"Grammar,masked,She  [MASK] to SCHOOL.,walks\n" +
+		"Grammar,masked,He [MASK] the bus.,takes\n" +
+		"Grammar,masked,He [MASK] the bus.,rides\n"
+	report := importString(t, s, FormatCSV, csv, false)
+	if report.Created != 1 || report.Failed != 2 {
+		t.Fatalf("report %+v", report)
+	}
+	want := []ImportRowError{
+		{Row: 2, Message: "duplicate of question 1"},
+		{Row: 4, Message: "duplicate of row 3"},
+	}
+	if !reflect.DeepEqual(report.Errors, want) {
+		t.Errorf("errors %+v, want %+v", report.Errors, want)
+	}
+	if len(repo.questions) != 3 {
+		t.Errorf("%d questions, want 3", len(repo.questions))
+	}
+}
+
+func TestImportRejectsBadIDs(t *testing.T) {
+	s, repo := testQuestionBank()
+	csv := "id,topic,question_type,masked_sentence,correct_answer\n" +
+		"abc,Grammar,masked,They [MASK] home.,went\n" +
+		"99,Grammar,masked,We [MASK] late.,stayed\n"
+	report := importString(t, s, FormatCSV, csv, false)
+	if report.Failed != 2 || report.Created != 0 || report.Updated != 0 {
+		t.Fatalf("report %+v", report)
+	}
+	want := []ImportRowError{
+		{Row: 2, Field: "id", Message: "must be a positive integer"},
+		{Row: 3, Field: "id", Message: "no question with this id"},
+	}
+	if !reflect.DeepEqual(report.Errors, want) {
+		t.Errorf("errors %+v, want %+v", report.Errors, want)
+	}
+	if len(repo.questions) != 2 {
+		t.Errorf("%d questions, want 2", len(repo.questions))
+	}
+}
+
+func TestImportDryRunWritesNothing(t *testing.T) {
+	s, repo := testQuestionBank()
+	before, _ := repo.GetAllQuestions()
+	csv := "id,topic,question_type,masked_sentence,correct_answer\n" +
+		"1,Grammar,masked,She [MASK] to work.,walks\n" +
+		",Grammar,masked,They [MASK] home.,went\n"
+	report := importString(t, s, FormatCSV, csv, true)
+	if !report.DryRun || report.Updated != 1 || report.Created != 1 || report.Failed != 0 {
+		t.Fatalf("report %+v", report)
+	}
+	if after, _ := repo.GetAllQuestions(); !reflect.DeepEqual(before, after) {
+		t.Errorf("dry run changed the questions: %+v", after)
+	}
+}
+
+// A failed write imports none of the rows and reports none as imported.
+func TestImportWriteFailureImportsNothing(t *testing.T) {
+	s, repo := testQuestionBank()
+	repo.saveErr = errors.New("connection lost")
+	csv := "topic,question_type,masked_sentence,correct_answer\n" +
+		"Grammar,masked,They [MASK] home.,went\n" +
+		"Grammar,masked,We [MASK] late.,stayed\n"
+	report, err := s.ImportQuestions(FormatCSV, strings.NewReader(csv), false)
+	if err == nil || report == nil {
+		t.Fatalf("got %+v, %v; want a report and an error", report, err)
+	}
+	if report.Created != 0 || report.Updated != 0 {
+		t.Errorf("report %+v counts rows as imported", report)
+	}
+	if len(repo.questions) != 2 {
+		t.Errorf("%d questions, want 2", len(repo.questions))
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"inkwell-backend-V2.0/internal/llm"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// Review states of a question.
+const (
+	QuestionDraft    = "draft"
+	QuestionApproved = "approved"
+	QuestionRejected = "rejected"
+)
+
+// ErrNotDraft is returned when approving or rejecting a question that is not awaiting review.
+var ErrNotDraft = errors.New("question is not a draft")
+
+// levelDifficulty is the starting Rasch difficulty of a generated question
+// for each learner level; calibration refines it once answers come in.
+var levelDifficulty = map[string]float64{
+	"beginner":     -1,
+	"intermediate": 0,
+	"advanced":     1,
+}
+
+const maxGeneratedQuestions = 20
+
+// maxMaskedAnswerWords keeps masked answers to a word or short phrase.
+const maxMaskedAnswerWords = 3
+
+// GenerationRequest asks the LLM for draft questions.
+type GenerationRequest struct {
+	Topic        string `json:"topic"`
+	QuestionType string `json:"question_type"`
+	Level        string `json:"level"` // beginner, intermediate or advanced
+	Count        int    `json:"count"`
+}
+
+// RejectedItem is a generated question that failed validation.
+type RejectedItem struct {
+	Item   llm.GeneratedQuestion `json:"item"`
+	Reason string                `json:"reason"`
+}
+
+// GenerationResult lists the drafts saved and the items discarded.
+type GenerationResult struct {
+	Drafts   []QuestionRecord `json:"drafts"`
+	Rejected []RejectedItem   `json:"rejected"`
+}
+
+// GenerateDrafts has the LLM write questions for a topic and level, keeps
+// those that pass validation and saves them as inactive drafts for review.
+func (s *questionBankService) GenerateDrafts(req GenerationRequest) (*GenerationResult, error) {
+	req.Topic = strings.TrimSpace(req.Topic)
+	req.QuestionType = strings.ToLower(strings.TrimSpace(req.QuestionType))
+	req.Level = strings.ToLower(strings.TrimSpace(req.Level))
+	if req.Level == "" {
+		req.Level = "intermediate"
+	}
+	if req.Count == 0 {
+		req.Count = 5
+	}
+
+	var errs []FieldError
+	topics, err := s.topicNames()
+	if err != nil {
+		return nil, err
+	}
+	if !topics[req.Topic] {
+		errs = append(errs, FieldError{"topic", fmt.Sprintf("unknown topic %q", req.Topic)})
+	}
+	if req.QuestionType != "masked" && req.QuestionType != "error_correction" {
+		errs = append(errs, FieldError{"question_type", "must be masked or error_correction"})
+	}
+	difficulty, ok := levelDifficulty[req.Level]
+	if !ok {
+		errs = append(errs, FieldError{"level", "must be beginner, intermediate or advanced"})
+	}
+	if req.Count < 1 || req.Count > maxGeneratedQuestions {
+		errs = append(errs, FieldError{"count", fmt.Sprintf("must be between 1 and %d", maxGeneratedQuestions)})
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	items, err := s.ollamaClient.GenerateQuestions(req.Topic, req.QuestionType, req.Level, req.Count)
+	if err != nil {
+		return nil, fmt.Errorf("question generation failed: %w", err)
+	}
+
+	existing, err := s.questionRepo.GetAllQuestions()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(existing)+len(items))
+	for i := range existing {
+		seen[questionKey(toQuestionRecord(&existing[i]))] = true
+	}
+
+	result := &GenerationResult{Drafts: []QuestionRecord{}, Rejected: []RejectedItem{}}
+	for _, item := range items {
+		rec := QuestionRecord{
+			Topic:          req.Topic,
+			QuestionType:   req.QuestionType,
+			MaskedSentence: item.MaskedSentence,
+			ErrorSentence:  item.ErrorSentence,
+			CorrectAnswer:  item.CorrectAnswer,
+			Difficulty:     difficulty,
+			Tags:           []string{"generated", req.Level},
+		}
+		normalizeRecord(&rec)
+		if reason := s.checkGenerated(rec, topics, seen); reason != "" {
+			result.Rejected = append(result.Rejected, RejectedItem{Item: item, Reason: reason})
+			continue
+		}
+		seen[questionKey(rec)] = true
+
+		question := model.Question{Status: QuestionDraft, Source: "llm", ReviewNote: strings.TrimSpace(item.Explanation)}
+		applyQuestionRecord(&question, rec)
+		question.Active = false
+		if err := s.questionRepo.CreateQuestion(&question); err != nil {
+			return nil, err
+		}
+		result.Drafts = append(result.Drafts, toQuestionRecord(&question))
+	}
+	log.Printf("Generated %d draft %s questions for %s (%d rejected)",
+		len(result.Drafts), req.QuestionType, req.Topic, len(result.Rejected))
+	return result, nil
+}
+
+// checkGenerated returns why a generated question is unusable, or "" if it
+// passes: the usual field validation, no duplicate of an existing or earlier
+// item, and an LLM check that the answer yields a grammatical sentence.
+func (s *questionBankService) checkGenerated(rec QuestionRecord, topics map[string]bool, seen map[string]bool) string {
+	if errs := validateQuestionRecord(rec, topics); len(errs) > 0 {
+		return errs[0].Field + " " + errs[0].Message
+	}
+	if seen[questionKey(rec)] {
+		return "duplicate of an existing question"
+	}
+
+	var corrected string
+	switch rec.QuestionType {
+	case "masked":
+		if n := len(strings.Fields(rec.CorrectAnswer)); n > maxMaskedAnswerWords {
+			return fmt.Sprintf("answer has %d words, expected at most %d", n, maxMaskedAnswerWords)
+		}
+		corrected = strings.Replace(rec.MaskedSentence, "[MASK]", rec.CorrectAnswer, 1)
+	case "error_correction":
+		if strings.EqualFold(strings.Join(strings.Fields(rec.ErrorSentence), " "), strings.Join(strings.Fields(rec.CorrectAnswer), " ")) {
+			return "corrected sentence is the same as the error sentence"
+		}
+		corrected = rec.CorrectAnswer
+	}
+	ok, reason, err := s.ollamaClient.CheckGrammar(corrected)
+	if err != nil {
+		return "grammar check unavailable: " + err.Error()
+	}
+	if !ok {
+		return "answer does not produce a grammatical sentence: " + reason
+	}
+	return ""
+}
+
+// ApproveQuestion moves a draft into the bank, making it eligible for assessments.
+func (s *questionBankService) ApproveQuestion(id uint) (*QuestionRecord, error) {
+	question, err := s.question(id)
+	if err != nil {
+		return nil, err
+	}
+	if question.Status != QuestionDraft {
+		return nil, ErrNotDraft
+	}
+	question.Status = QuestionApproved
+	question.Active = true
+	if err := s.questionRepo.UpdateQuestion(question); err != nil {
+		return nil, err
+	}
+	rec := toQuestionRecord(question)
+	return &rec, nil
+}
+
+// RejectQuestion marks a draft as rejected. It is kept so the same item is
+// recognised as a duplicate if the LLM proposes it again.
+func (s *questionBankService) RejectQuestion(id uint, note string) (*QuestionRecord, error) {
+	question, err := s.question(id)
+	if err != nil {
+		return nil, err
+	}
+	if question.Status != QuestionDraft {
+		return nil, ErrNotDraft
+	}
+	question.Status = QuestionRejected
+	question.Active = false
+	if note = strings.TrimSpace(note); note != "" {
+		question.ReviewNote = note
+	}
+	if err := s.questionRepo.UpdateQuestion(question); err != nil {
+		return nil, err
+	}
+	rec := toQuestionRecord(question)
+	return &rec, nil
+}
@@ -0,0 +1,397 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"inkwell-backend-V2.0/internal/llm"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// GradeResult is the outcome of grading one answer.
+type GradeResult struct {
+	Correct  bool
+	Score    float64 // 0–1
+	Feedback string
+	GradedBy string // the stage that decided, see the Graded* constants
+	Reason   string
+}
+
+// questionType implements validation, grading and rendering for one
+// Question.QuestionType. Payload is the question's type-specific JSON.
+type questionType interface {
+	validate(rec QuestionRecord) []FieldError
+	grade(client *llm.OllamaClient, q *model.Question, answer string) (GradeResult, error)
+	render(q *model.Question) *model.RenderHint
+}
+
+// questionTypes is the registry of supported question types.
+var questionTypes = map[string]questionType{
+	"masked":             maskedType{},
+	"error_correction":   errorCorrectionType{},
+	"multiple_choice":    multipleChoiceType{},
+	"reorder":            reorderType{},
+	"sentence_combining": sentenceCombiningType{},
+	"free_response":      freeResponseType{},
+}
+
+// gradeAnswer grades an answer with the handler for the question's type.
+// It only fails for a misconfigured question; LLM problems fall back to a verdict.
+func gradeAnswer(client *llm.OllamaClient, q *model.Question, answer string) (GradeResult, error) {
+	qt, ok := questionTypes[q.QuestionType]
+	if !ok {
+		return GradeResult{}, fmt.Errorf("unknown question type: %s", q.QuestionType)
+	}
+	return qt.grade(client, q, answer)
+}
+
+// toLearnerQuestion converts a question for sending to a learner, adding
+// the render hint for its type and leaving out the answer.
+func toLearnerQuestion(q *model.Question) *model.LearnerQuestion {
+	if q == nil {
+		return nil
+	}
+	lq := &model.LearnerQuestion{
+		ID:             q.ID,
+		Category:       q.Category,
+		QuestionType:   q.QuestionType,
+		MaskedSentence: q.MaskedSentence,
+		ErrorSentence:  q.ErrorSentence,
+	}
+	if qt, ok := questionTypes[q.QuestionType]; ok {
+		lq.Render = qt.render(q)
+	}
+	return lq
+}
+
+// decodePayload unmarshals a question payload, reporting problems as field errors.
+func decodePayload(raw []byte, v interface{}) []FieldError {
+	if len(raw) == 0 {
+		return []FieldError{{"payload", "is required for this question type"}}
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return []FieldError{{"payload", "invalid JSON: " + err.Error()}}
+	}
+	return nil
+}
+
+// matchesAny reports whether answer equals any accepted answer after normalisation.
+func matchesAny(answer string, accepted ...string) bool {
+	a := normalizeAnswer(answer)
+	for _, acc := range accepted {
+		if acc != "" && a == normalizeAnswer(acc) {
+			return true
+		}
+	}
+	return false
+}
+
+// shuffled returns a copy of items in an order that is random but stable for
+// a question, so reloading the page does not reshuffle.
+func shuffled(items []string, questionID uint) []string {
+	out := append([]string(nil), items...)
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d", questionID)
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+	r.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
+
+//
+// masked
+//
+
+type maskedType struct{}
+
+func (maskedType) validate(rec QuestionRecord) []FieldError {
+	if n := strings.Count(rec.MaskedSentence, "[MASK]"); n != 1 {
+		return []FieldError{{"masked_sentence", fmt.Sprintf("must contain exactly one [MASK], found %d", n)}}
+	}
+	return nil
+}
+
+func (maskedType) grade(client *llm.OllamaClient, q *model.Question, answer string) (GradeResult, error) {
+	policy := matchPolicy{farMiss: true, llm: true}
+	return gradeText(client, q, q.MaskedSentence, answer, questionAlternatives(q), policy), nil
+}
+
+func (maskedType) render(q *model.Question) *model.RenderHint {
+	return &model.RenderHint{Widget: "fill_blank", Prompt: "Fill in the blank.", Text: q.MaskedSentence}
+}
+
+//
+// error_correction
+//
+
+type errorCorrectionType struct{}
+
+func (errorCorrectionType) validate(rec QuestionRecord) []FieldError {
+	if rec.ErrorSentence == "" {
+		return []FieldError{{"error_sentence", "is required for error_correction questions"}}
+	}
+	if rec.ErrorSentence == rec.CorrectAnswer {
+		return []FieldError{{"correct_answer", "must differ from the error sentence"}}
+	}
+	return nil
+}
+
+func (errorCorrectionType) grade(client *llm.OllamaClient, q *model.Question, answer string) (GradeResult, error) {
+	policy := matchPolicy{original: q.ErrorSentence, farMiss: true, llm: true}
+	return gradeText(client, q, q.ErrorSentence, answer, questionAlternatives(q), policy), nil
+}
+
+func (errorCorrectionType) render(q *model.Question) *model.RenderHint {
+	return &model.RenderHint{Widget: "rewrite", Prompt: "Rewrite the sentence without the error.", Text: q.ErrorSentence}
+}
+
+//
+// multiple_choice
+//
+
+// multipleChoicePayload: {"prompt": "...", "options": ["went", "goed", "gone"], "answer_index": 0}
+type multipleChoicePayload struct {
+	Prompt      string   `json:"prompt"`
+	Options     []string `json:"options"`
+	AnswerIndex int      `json:"answer_index"`
+}
+
+type multipleChoiceType struct{}
+
+func (multipleChoiceType) validate(rec QuestionRecord) []FieldError {
+	var p multipleChoicePayload
+	if errs := decodePayload(rec.Payload, &p); errs != nil {
+		return errs
+	}
+	var errs []FieldError
+	if strings.TrimSpace(p.Prompt) == "" {
+		errs = append(errs, FieldError{"payload.prompt", "is required"})
+	}
+	if len(p.Options) < 2 || len(p.Options) > 6 {
+		errs = append(errs, FieldError{"payload.options", "must have between 2 and 6 options"})
+	}
+	seen := make(map[string]bool, len(p.Options))
+	for _, opt := range p.Options {
+		key := normalizeAnswer(opt)
+		if key == "" || seen[key] {
+			errs = append(errs, FieldError{"payload.options", "options must be non-empty and distinct"})
+			break
+		}
+		seen[key] = true
+	}
+	if p.AnswerIndex < 0 || p.AnswerIndex >= len(p.Options) {
+		errs = append(errs, FieldError{"payload.answer_index", "must point at one of the options"})
+	} else if !matchesAny(rec.CorrectAnswer, p.Options[p.AnswerIndex]) {
+		errs = append(errs, FieldError{"correct_answer", "must equal the option at answer_index"})
+	}
+	return errs
+}
+
+// grade accepts the option text or its zero-based index.
+func (multipleChoiceType) grade(_ *llm.OllamaClient, q *model.Question, answer string) (GradeResult, error) {
+	var p multipleChoicePayload
+	if err := json.Unmarshal([]byte(q.Payload), &p); err != nil {
+		return GradeResult{}, fmt.Errorf("invalid multiple_choice payload for question %d: %w", q.ID, err)
+	}
+	if i, err := strconv.Atoi(strings.TrimSpace(answer)); err == nil && i >= 0 && i < len(p.Options) {
+		answer = p.Options[i]
+	}
+	if matchesAny(answer, q.CorrectAnswer) {
+		return correctResult(GradedChoice, "picked the correct option"), nil
+	}
+	return incorrectResult(q.CorrectAnswer, GradedChoice, fmt.Sprintf("picked %q", answer)), nil
+}
+
+func (multipleChoiceType) render(q *model.Question) *model.RenderHint {
+	var p multipleChoicePayload
+	_ = json.Unmarshal([]byte(q.Payload), &p)
+	return &model.RenderHint{Widget: "choice", Prompt: p.Prompt, Options: p.Options}
+}
+
+//
+// reorder
+//
+
+// reorderPayload: {"words": ["She", "has", "already", "left"], "alternatives": ["Already she has left"]}
+// Words are stored in the correct order and shuffled when rendered.
+type reorderPayload struct {
+	Words        []string `json:"words"`
+	Alternatives []string `json:"alternatives"`
+}
+
+type reorderType struct{}
+
+func (reorderType) validate(rec QuestionRecord) []FieldError {
+	var p reorderPayload
+	if errs := decodePayload(rec.Payload, &p); errs != nil {
+		return errs
+	}
+	if len(p.Words) < 3 {
+		return []FieldError{{"payload.words", "must have at least 3 words"}}
+	}
+	if !matchesAny(strings.Join(p.Words, " "), rec.CorrectAnswer) {
+		return []FieldError{{"correct_answer", "must be the words joined in order"}}
+	}
+	return nil
+}
+
+func (reorderType) grade(client *llm.OllamaClient, q *model.Question, answer string) (GradeResult, error) {
+	var p reorderPayload
+	if err := json.Unmarshal([]byte(q.Payload), &p); err != nil {
+		return GradeResult{}, fmt.Errorf("invalid reorder payload for question %d: %w", q.ID, err)
+	}
+	alternatives := append(questionAlternatives(q), p.Alternatives...)
+	return gradeText(client, q, "", answer, alternatives, matchPolicy{}), nil
+}
+
+func (reorderType) render(q *model.Question) *model.RenderHint {
+	var p reorderPayload
+	_ = json.Unmarshal([]byte(q.Payload), &p)
+	return &model.RenderHint{Widget: "reorder", Prompt: "Put the words in the correct order.", Tokens: shuffled(p.Words, q.ID)}
+}
+
+//
+// sentence_combining
+//
+
+// sentenceCombiningPayload: {"sentences": ["I was tired.", "I went to bed."], "hint": "because", "alternatives": [...]}
+// CorrectAnswer holds a model answer; answers matching it or an alternative
+// are accepted directly and anything else is judged by the LLM.
+type sentenceCombiningPayload struct {
+	Sentences    []string `json:"sentences"`
+	Hint         string   `json:"hint"`
+	Alternatives []string `json:"alternatives"`
+}
+
+type sentenceCombiningType struct{}
+
+func (sentenceCombiningType) validate(rec QuestionRecord) []FieldError {
+	var p sentenceCombiningPayload
+	if errs := decodePayload(rec.Payload, &p); errs != nil {
+		return errs
+	}
+	if len(p.Sentences) < 2 {
+		return []FieldError{{"payload.sentences", "must have at least 2 sentences"}}
+	}
+	return nil
+}
+
+func (sentenceCombiningType) grade(client *llm.OllamaClient, q *model.Question, answer string) (GradeResult, error) {
+	var p sentenceCombiningPayload
+	if err := json.Unmarshal([]byte(q.Payload), &p); err != nil {
+		return GradeResult{}, fmt.Errorf("invalid sentence_combining payload for question %d: %w", q.ID, err)
+	}
+	task := "Combine these sentences into one: " + strings.Join(p.Sentences, " ")
+	if p.Hint != "" {
+		task += " (use: " + p.Hint + ")"
+	}
+	alternatives := append(questionAlternatives(q), p.Alternatives...)
+	return gradeText(client, q, task, answer, alternatives, matchPolicy{typos: true, llm: true}), nil
+}
+
+func (sentenceCombiningType) render(q *model.Question) *model.RenderHint {
+	var p sentenceCombiningPayload
+	_ = json.Unmarshal([]byte(q.Payload), &p)
+	return &model.RenderHint{Widget: "combine", Prompt: "Combine the sentences into one.", Sentences: p.Sentences, Hint: p.Hint}
+}
+
+//
+// free_response
+//
+
+// freeResponsePayload: {"prompt": "Describe your last holiday.", "rubric": [{"criterion": "Uses past tenses correctly", "points": 3}],
+// "min_words": 20, "max_words": 80, "pass_ratio": 0.6}. CorrectAnswer holds a sample answer.
+type freeResponsePayload struct {
+	Prompt    string                `json:"prompt"`
+	Rubric    []llm.RubricCriterion `json:"rubric"`
+	MinWords  int                   `json:"min_words"`
+	MaxWords  int                   `json:"max_words"`
+	PassRatio float64               `json:"pass_ratio"`
+}
+
+const defaultPassRatio = 0.6
+
+type freeResponseType struct{}
+
+func (freeResponseType) validate(rec QuestionRecord) []FieldError {
+	var p freeResponsePayload
+	if errs := decodePayload(rec.Payload, &p); errs != nil {
+		return errs
+	}
+	var errs []FieldError
+	if strings.TrimSpace(p.Prompt) == "" {
+		errs = append(errs, FieldError{"payload.prompt", "is required"})
+	}
+	if len(p.Rubric) == 0 {
+		errs = append(errs, FieldError{"payload.rubric", "must have at least one criterion"})
+	}
+	for _, c := range p.Rubric {
+		if strings.TrimSpace(c.Criterion) == "" || c.Points < 1 {
+			errs = append(errs, FieldError{"payload.rubric", "each criterion needs a description and at least 1 point"})
+			break
+		}
+	}
+	if p.MinWords < 0 || (p.MaxWords > 0 && p.MaxWords < p.MinWords) {
+		errs = append(errs, FieldError{"payload.max_words", "must be at least min_words"})
+	}
+	if p.PassRatio < 0 || p.PassRatio > 1 {
+		errs = append(errs, FieldError{"payload.pass_ratio", "must be between 0 and 1"})
+	}
+	return errs
+}
+
+// grade checks the length locally, then has the LLM mark each rubric
+// criterion. The answer counts as correct once it earns pass_ratio of the points.
+func (freeResponseType) grade(client *llm.OllamaClient, q *model.Question, answer string) (GradeResult, error) {
+	var p freeResponsePayload
+	if err := json.Unmarshal([]byte(q.Payload), &p); err != nil {
+		return GradeResult{}, fmt.Errorf("invalid free_response payload for question %d: %w", q.ID, err)
+	}
+	words := len(strings.Fields(answer))
+	if words < p.MinWords {
+		return GradeResult{Feedback: fmt.Sprintf("Your answer has %d words; write at least %d.", words, p.MinWords),
+			GradedBy: GradedLength, Reason: "too short"}, nil
+	}
+	if p.MaxWords > 0 && words > p.MaxWords {
+		return GradeResult{Feedback: fmt.Sprintf("Your answer has %d words; keep it to %d or fewer.", words, p.MaxWords),
+			GradedBy: GradedLength, Reason: "too long"}, nil
+	}
+
+	scores, feedback, err := client.GradeWithRubric(p.Prompt, answer, p.Rubric)
+	if err != nil {
+		log.Printf("Rubric grading failed for question %d, marking incorrect: %v", q.ID, err)
+		return GradeResult{Feedback: "Your answer could not be marked right now.",
+			GradedBy: GradedFallback, Reason: "LLM unavailable: " + err.Error()}, nil
+	}
+	var earned, total int
+	var lines []string
+	for i, s := range scores {
+		earned += s.Points
+		total += p.Rubric[i].Points
+		line := fmt.Sprintf("%s: %d/%d", s.Criterion, s.Points, p.Rubric[i].Points)
+		if s.Comment != "" {
+			line += " – " + s.Comment
+		}
+		lines = append(lines, line)
+	}
+	passRatio := p.PassRatio
+	if passRatio == 0 {
+		passRatio = defaultPassRatio
+	}
+	score := float64(earned) / float64(total)
+	if feedback != "" {
+		lines = append([]string{feedback}, lines...)
+	}
+	return GradeResult{Correct: score >= passRatio, Score: score, Feedback: strings.Join(lines, "\n"),
+		GradedBy: GradedRubric, Reason: fmt.Sprintf("%d of %d rubric points, pass at %.0f%%", earned, total, passRatio*100)}, nil
+}
+
+func (freeResponseType) render(q *model.Question) *model.RenderHint {
+	var p freeResponsePayload
+	_ = json.Unmarshal([]byte(q.Payload), &p)
+	return &model.RenderHint{Widget: "essay", Prompt: p.Prompt, MinWords: p.MinWords, MaxWords: p.MaxWords}
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"inkwell-backend-V2.0/internal/llm"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+	"inkwell-backend-V2.0/pkg/event_bus"
+)
+
+// Review card sources.
+const (
+	ReviewSourceQuestion = "question"
+	ReviewSourceSentence = "sentence"
+)
+
+// SM-2 scheduling parameters. Quality runs from 0 (blackout) to 5 (perfect);
+// anything below 3 is a lapse and starts the card over.
+const (
+	initialEaseFactor = 2.5
+	minEaseFactor     = 1.3
+	passingQuality    = 3
+	maxQuality        = 5
+
+	// recurringIssueCount is how often a sentence correction must come up
+	// before it becomes a review card.
+	recurringIssueCount = 2
+	// maxIssueWords skips corrections that rewrite more than this many words
+	// on either side; those are rephrasings rather than a single mistake.
+	maxIssueWords = 4
+
+	defaultDueLimit = 20
+	maxDueLimit     = 100
+)
+
+var (
+	ErrReviewCardNotFound = errors.New("review card not found")
+	ErrInvalidQuality     = errors.New("quality must be between 0 and 5, or an answer must be given")
+	ErrReviewUngraded     = errors.New("the answer could not be graded; try again or grade it yourself")
+	ErrReviewCardLocked   = errors.New("this question is part of an assessment in progress; finish it first")
+)
+
+// SentenceCorrectedEvent is published when the LLM changes a story sentence.
+type SentenceCorrectedEvent struct {
+	UserID   uint
+	Sentence model.Sentence
+}
+
+type ReviewService interface {
+	GetDueCards(userID uint, limit int) ([]model.DueReviewCard, int, error)
+	GradeCard(userID, cardID uint, quality *int, answer string) (*model.ReviewGradeResponse, error)
+}
+
+type reviewService struct {
+	reviewRepo   repository.ReviewRepository
+	ollamaClient *llm.OllamaClient
+}
+
+func NewReviewService(reviewRepo repository.ReviewRepository, ollamaClient *llm.OllamaClient) ReviewService {
+	return &reviewService{
+		reviewRepo:   reviewRepo,
+		ollamaClient: ollamaClient,
+	}
+}
+
+// InitReviewEventListeners turns missed questions and recurring sentence
+// corrections into review cards.
+func InitReviewEventListeners(reviewRepo repository.ReviewRepository) {
+	event_bus.GlobalEventBus.Subscribe("answer_incorrect", func(data interface{}) {
+		answer, ok := data.(model.Answer)
+		if !ok {
+			log.Println("Invalid answer received for review scheduling")
+			return
+		}
+		if err := addQuestionCard(reviewRepo, answer, time.Now()); err != nil {
+			log.Printf("Failed to schedule review of question %d for user %d: %v", answer.QuestionID, answer.UserID, err)
+		}
+	})
+	event_bus.GlobalEventBus.Subscribe("sentence_corrected", func(data interface{}) {
+		event, ok := data.(SentenceCorrectedEvent)
+		if !ok {
+			log.Println("Invalid sentence received for review scheduling")
+			return
+		}
+		if err := addSentenceCards(reviewRepo, event, time.Now()); err != nil {
+			log.Printf("Failed to schedule review of sentence %d for user %d: %v", event.Sentence.ID, event.UserID, err)
+		}
+	})
+}
+
+// addQuestionCard schedules a missed question for review the next day, so
+// that it does not come up while the assessment it was missed in may still
+// be open. Missing it again in a later assessment counts as a lapse.
+func addQuestionCard(reviewRepo repository.ReviewRepository, answer model.Answer, now time.Time) error {
+	key := strconv.FormatUint(uint64(answer.QuestionID), 10)
+	card, err := reviewRepo.GetCardBySource(answer.UserID, ReviewSourceQuestion, key)
+	if err != nil {
+		return err
+	}
+	if card == nil {
+		questionID := answer.QuestionID
+		card = newReviewCard(answer.UserID, ReviewSourceQuestion, key)
+		card.QuestionID = &questionID
+	} else {
+		card.Occurrences++
+		lapse(card)
+	}
+	due := now.AddDate(0, 0, 1)
+	card.DueAt = &due
+	return reviewRepo.SaveCard(card)
+}
+
+// addSentenceCards records each correction in a sentence and schedules the
+// ones the user has now made at least recurringIssueCount times.
+func addSentenceCards(reviewRepo repository.ReviewRepository, event SentenceCorrectedEvent, now time.Time) error {
+	s := event.Sentence
+	for _, issue := range correctionIssues(s.OriginalText, s.CorrectedText) {
+		card, err := reviewRepo.GetCardBySource(event.UserID, ReviewSourceSentence, issue.key())
+		if err != nil {
+			return err
+		}
+		if card == nil {
+			card = newReviewCard(event.UserID, ReviewSourceSentence, issue.key())
+		} else {
+			card.Occurrences++
+			if card.DueAt != nil {
+				lapse(card)
+			}
+		}
+		// The latest sentence with the mistake becomes the exercise.
+		card.Prompt = s.OriginalText
+		card.Answer = s.CorrectedText
+		card.Detail = issue.String()
+		if s.Feedback != "" {
+			card.Detail += " " + s.Feedback
+		}
+		if card.Occurrences >= recurringIssueCount {
+			card.DueAt = &now
+		}
+		if err := reviewRepo.SaveCard(card); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newReviewCard(userID uint, sourceType, sourceKey string) *model.ReviewCard {
+	return &model.ReviewCard{
+		UserID:      userID,
+		SourceType:  sourceType,
+		SourceKey:   sourceKey,
+		Occurrences: 1,
+		EaseFactor:  initialEaseFactor,
+	}
+}
+
+// lapse starts a card's schedule over after it was got wrong.
+func lapse(card *model.ReviewCard) {
+	card.Repetitions = 0
+	card.Interval = 1
+	card.Lapses++
+}
+
+// scheduleSM2 applies one review of the given quality: a pass lengthens the
+// interval to 1, 6 and then interval×ease days, a lapse resets it to 1 day,
+// and the ease factor moves with the quality.
+func scheduleSM2(card *model.ReviewCard, quality int, now time.Time) {
+	if quality < passingQuality {
+		lapse(card)
+	} else {
+		card.Repetitions++
+		switch card.Repetitions {
+		case 1:
+			card.Interval = 1
+		case 2:
+			card.Interval = 6
+		default:
+			card.Interval = int(math.Round(float64(card.Interval) * card.EaseFactor))
+		}
+	}
+	miss := float64(maxQuality - quality)
+	card.EaseFactor = max(card.EaseFactor+0.1-miss*(0.08+miss*0.02), minEaseFactor)
+	due := now.AddDate(0, 0, card.Interval)
+	card.DueAt = &due
+	card.LastReviewedAt = &now
+}
+
+// GetDueCards returns the cards due by the end of today and how many are due in total.
+func (s *reviewService) GetDueCards(userID uint, limit int) ([]model.DueReviewCard, int, error) {
+	if limit <= 0 {
+		limit = defaultDueLimit
+	}
+	limit = min(limit, maxDueLimit)
+	now := time.Now()
+	endOfDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+
+	cards, err := s.reviewRepo.GetDueCards(userID, endOfDay, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.reviewRepo.CountDueCards(userID, endOfDay)
+	if err != nil {
+		return nil, 0, err
+	}
+	due := make([]model.DueReviewCard, 0, len(cards))
+	for _, card := range cards {
+		view := model.DueReviewCard{
+			ID:          card.ID,
+			SourceType:  card.SourceType,
+			Prompt:      card.Prompt,
+			DueAt:       *card.DueAt,
+			Interval:    card.Interval,
+			Repetitions: card.Repetitions,
+			Lapses:      card.Lapses,
+		}
+		if card.Question != nil {
+			view.Question = toLearnerQuestion(card.Question)
+		}
+		due = append(due, view)
+	}
+	return due, total, nil
+}
+
+// GradeCard reschedules a card. The learner either rates their recall
+// (quality 0–5) or answers the card, in which case the answer is graded and
+// converted to a quality; an explicit quality takes precedence. Cards for a
+// question in one of the user's ongoing assessments are refused, as the
+// response reveals the answer.
+func (s *reviewService) GradeCard(userID, cardID uint, quality *int, answer string) (*model.ReviewGradeResponse, error) {
+	card, err := s.reviewRepo.GetCard(userID, cardID)
+	if err != nil || card.DueAt == nil {
+		return nil, ErrReviewCardNotFound
+	}
+	if card.QuestionID != nil {
+		open, err := s.reviewRepo.IsQuestionInOpenSession(userID, *card.QuestionID)
+		if err != nil {
+			return nil, err
+		}
+		if open {
+			return nil, ErrReviewCardLocked
+		}
+	}
+	if quality != nil && (*quality < 0 || *quality > maxQuality) || quality == nil && strings.TrimSpace(answer) == "" {
+		return nil, ErrInvalidQuality
+	}
+
+	response := &model.ReviewGradeResponse{CardID: card.ID, CorrectAnswer: card.Answer, Detail: card.Detail}
+	if card.Question != nil {
+		response.CorrectAnswer = card.Question.CorrectAnswer
+	}
+	if strings.TrimSpace(answer) != "" {
+		result, err := s.gradeReviewAnswer(card, answer)
+		if err != nil {
+			return nil, err
+		}
+		response.IsCorrect = &result.Correct
+		response.Feedback = result.Feedback
+		if quality == nil {
+			q := answerQuality(result)
+			quality = &q
+		}
+	}
+
+	scheduleSM2(card, *quality, time.Now())
+	if err := s.reviewRepo.SaveCard(card); err != nil {
+		return nil, err
+	}
+	response.Quality = *quality
+	response.Interval = card.Interval
+	response.EaseFactor = card.EaseFactor
+	response.DueAt = *card.DueAt
+	return response, nil
+}
+
+// gradeReviewAnswer grades a question card like the question itself, and a
+// sentence card against the corrected sentence without the LLM.
+func (s *reviewService) gradeReviewAnswer(card *model.ReviewCard, answer string) (GradeResult, error) {
+	if card.SourceType == ReviewSourceQuestion {
+		if card.Question == nil {
+			return GradeResult{}, ErrReviewCardNotFound
+		}
+		result, err := gradeAnswer(s.ollamaClient, card.Question, answer)
+		if err != nil {
+			return GradeResult{}, err
+		}
+		if result.GradedBy == GradedFallback {
+			return GradeResult{}, ErrReviewUngraded
+		}
+		return result, nil
+	}
+	q := &model.Question{CorrectAnswer: card.Answer}
+	return gradeText(nil, q, "", answer, nil, matchPolicy{original: card.Prompt, typos: true}), nil
+}
+
+// answerQuality converts a graded answer to SM-2 quality: 5 for a clean
+// answer, 4 for one accepted with a typo, 3 for partial credit and 1 for a
+// wrong answer.
+func answerQuality(result GradeResult) int {
+	switch {
+	case !result.Correct:
+		return 1
+	case result.GradedBy == GradedEditDistance:
+		return 4
+	case result.Score < 1:
+		return passingQuality
+	default:
+		return maxQuality
+	}
+}
+
+// correctionIssue is one change the LLM made to a sentence, as lower-cased
+// words with punctuation removed.
+type correctionIssue struct {
+	from, to string
+}
+
+func (i correctionIssue) key() string {
+	return i.from + "→" + i.to
+}
+
+func (i correctionIssue) String() string {
+	switch {
+	case i.from == "":
+		return fmt.Sprintf("Missing %q.", i.to)
+	case i.to == "":
+		return fmt.Sprintf("Unneeded %q.", i.from)
+	default:
+		return fmt.Sprintf("%q should be %q.", i.from, i.to)
+	}
+}
+
+// correctionIssues compares a sentence with its correction word by word and
+// returns each changed run of words. Changes to case or punctuation alone
+// are ignored, as are long rewrites.
+func correctionIssues(original, corrected string) []correctionIssue {
+	a := issueWords(original)
+	b := issueWords(corrected)
+
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var issues []correctionIssue
+	seen := make(map[string]bool)
+	var from, to []string
+	flush := func() {
+		if len(from) == 0 && len(to) == 0 {
+			return
+		}
+		issue := correctionIssue{from: strings.Join(from, " "), to: strings.Join(to, " ")}
+		if len(from) <= maxIssueWords && len(to) <= maxIssueWords && !seen[issue.key()] {
+			seen[issue.key()] = true
+			issues = append(issues, issue)
+		}
+		from, to = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			to = append(to, b[j])
+			j++
+		default:
+			from = append(from, a[i])
+			i++
+		}
+	}
+	flush()
+	return issues
+}
+
+func issueWords(s string) []string {
+	return strings.Fields(normalizeAnswer(s))
+}
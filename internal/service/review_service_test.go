@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/repository"
+)
+
+// memReviewRepo keeps cards in memory. openQuestions are the questions in
+// the user's ongoing assessments.
+type memReviewRepo struct {
+	repository.ReviewRepository
+	cards         map[uint]*model.ReviewCard
+	openQuestions map[uint]bool
+	saves         int
+}
+
+func newMemReviewRepo() *memReviewRepo {
+	return &memReviewRepo{cards: map[uint]*model.ReviewCard{}, openQuestions: map[uint]bool{}}
+}
+
+func (r *memReviewRepo) GetCard(userID, cardID uint) (*model.ReviewCard, error) {
+	if card, ok := r.cards[cardID]; ok && card.UserID == userID {
+		return card, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *memReviewRepo) GetCardBySource(userID uint, sourceType, sourceKey string) (*model.ReviewCard, error) {
+	for _, card := range r.cards {
+		if card.UserID == userID && card.SourceType == sourceType && card.SourceKey == sourceKey {
+			return card, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memReviewRepo) SaveCard(card *model.ReviewCard) error {
+	if card.ID == 0 {
+		card.ID = uint(len(r.cards) + 1)
+	}
+	r.cards[card.ID] = card
+	r.saves++
+	return nil
+}
+
+func (r *memReviewRepo) IsQuestionInOpenSession(userID, questionID uint) (bool, error) {
+	return r.openQuestions[questionID], nil
+}
+
+func TestAddQuestionCardIsDueTheNextDay(t *testing.T) {
+	repo := newMemReviewRepo()
+	now := time.Now()
+	if err := addQuestionCard(repo, model.Answer{UserID: 1, QuestionID: 9}, now); err != nil {
+		t.Fatal(err)
+	}
+	card := repo.cards[1]
+	if card == nil || card.QuestionID == nil || *card.QuestionID != 9 {
+		t.Fatalf("card not created: %+v", card)
+	}
+	if want := now.AddDate(0, 0, 1); !card.DueAt.Equal(want) {
+		t.Errorf("due at %v, want %v", card.DueAt, want)
+	}
+
+	// Missing it again is a lapse.
+	card.Repetitions, card.Interval = 3, 15
+	if err := addQuestionCard(repo, model.Answer{UserID: 1, QuestionID: 9}, now); err != nil {
+		t.Fatal(err)
+	}
+	if card.Occurrences != 2 || card.Lapses != 1 || card.Repetitions != 0 || card.Interval != 1 {
+		t.Errorf("after a second miss: %+v", card)
+	}
+}
+
+// A card for a question still open in an assessment must not reveal its
+// answer, or the learner could look it up and retry.
+func TestGradeCardRefusesQuestionsInOpenSessions(t *testing.T) {
+	repo := newMemReviewRepo()
+	now := time.Now()
+	questionID := uint(9)
+	repo.cards[1] = &model.ReviewCard{ID: 1, UserID: 1, SourceType: ReviewSourceQuestion, QuestionID: &questionID,
+		Question: &model.Question{ID: questionID, QuestionType: "masked", CorrectAnswer: "went"}, DueAt: &now, EaseFactor: initialEaseFactor}
+	repo.openQuestions[questionID] = true
+	s := &reviewService{reviewRepo: repo}
+
+	quality := 3
+	res, err := s.GradeCard(1, 1, &quality, "")
+	if !errors.Is(err, ErrReviewCardLocked) || res != nil {
+		t.Fatalf("got %+v, %v; want %v", res, err, ErrReviewCardLocked)
+	}
+	if repo.saves != 0 {
+		t.Error("a locked card was rescheduled")
+	}
+
+	repo.openQuestions[questionID] = false
+	res, err = s.GradeCard(1, 1, &quality, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.CorrectAnswer != "went" || res.Interval != 1 {
+		t.Errorf("after the session: %+v", res)
+	}
+}
+
+func TestScheduleSM2(t *testing.T) {
+	now := time.Now()
+	card := &model.ReviewCard{EaseFactor: initialEaseFactor}
+	for i, want := range []int{1, 6, 16} {
+		scheduleSM2(card, maxQuality, now)
+		if card.Interval != want {
+			t.Errorf("review %d: interval %d, want %d", i+1, card.Interval, want)
+		}
+	}
+	scheduleSM2(card, 1, now)
+	if card.Interval != 1 || card.Repetitions != 0 || card.Lapses != 1 {
+		t.Errorf("after a lapse: %+v", card)
+	}
+	if card.EaseFactor < minEaseFactor {
+		t.Errorf("ease factor %v below %v", card.EaseFactor, minEaseFactor)
+	}
+}
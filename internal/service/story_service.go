@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	llm2 "inkwell-backend-V2.0/internal/llm"
 	"inkwell-backend-V2.0/internal/model"
@@ -17,18 +19,21 @@ type StoryService interface {
 	AddSentence(storyID uint, sentence string) (*model.Sentence, error)
 	CompleteStory(storyID uint) error
 	GetProgress(userID uint) (map[string]interface{}, error)
+	SentenceTarget(userID uint) int
 	GetComicsByUser(userID uint) ([]ComicResponse, error)
 }
 
 type storyService struct {
 	storyRepo       repository.StoryRepository
+	userRepo        repository.UserRepository
 	llmClient       *llm2.OllamaClient
 	diffusionClient *llm2.StableDiffusionWrapper
 }
 
-func NewStoryService(storyRepo repository.StoryRepository, llmClient *llm2.OllamaClient, diffusionClient *llm2.StableDiffusionWrapper) StoryService {
+func NewStoryService(storyRepo repository.StoryRepository, userRepo repository.UserRepository, llmClient *llm2.OllamaClient, diffusionClient *llm2.StableDiffusionWrapper) StoryService {
 	return &storyService{
 		storyRepo:       storyRepo,
+		userRepo:        userRepo,
 		llmClient:       llmClient,
 		diffusionClient: diffusionClient,
 	}
@@ -74,13 +79,22 @@ func (s *storyService) AddSentence(storyID uint, sentence string) (*model.Senten
 		CreatedAt:    time.Now(),
 	}
 
+	// Pitch the correction at the writer's level, if placed.
+	level, userID := "", uint(0)
+	if story, err := s.storyRepo.GetStoryByID(storyID); err == nil {
+		userID = story.UserID
+		if user, err := s.userRepo.GetUserByID(story.UserID); err == nil {
+			level = user.Level
+		}
+	}
+
 	// Channels to receive results.
 	llmCh := make(chan llmResult)
 	imageCh := make(chan imageResult)
 
 	// Run LLM correction concurrently.
 	go func() {
-		corrected, feedback, err := s.llmClient.CorrectSentence(sentence)
+		corrected, feedback, err := s.llmClient.CorrectSentence(sentence, level)
 		llmCh <- llmResult{corrected: corrected, feedback: feedback, err: err}
 	}()
 
@@ -120,6 +134,10 @@ func (s *storyService) AddSentence(storyID uint, sentence string) (*model.Senten
 	if err != nil {
 		return nil, err
 	}
+	// Corrections feed the user's spaced-repetition review.
+	if llmRes.err == nil && userID != 0 && newSentence.CorrectedText != newSentence.OriginalText {
+		event_bus.GlobalEventBus.Publish("sentence_corrected", SentenceCorrectedEvent{UserID: userID, Sentence: *newSentence})
+	}
 	return newSentence, nil
 }
 
@@ -151,8 +169,7 @@ func (s *storyService) GetProgress(userID uint) (map[string]interface{}, error)
 		return nil, err
 	}
 
-	const maxSentencesAllowed = 5
-	sentencesLeft := maxSentencesAllowed - count
+	sentencesLeft := s.SentenceTarget(userID) - count
 
 	progress := map[string]interface{}{
 		"current_sentence_count": count,
@@ -164,15 +181,69 @@ func (s *storyService) GetProgress(userID uint) (map[string]interface{}, error)
 	return progress, nil
 }
 
+// SentenceTarget is how many sentences the user's stories have, from their
+// preferred story length.
+func (s *storyService) SentenceTarget(userID uint) int {
+	length := model.StoryLengthMedium
+	if user, err := s.userRepo.GetUserByID(userID); err == nil {
+		length = user.Preferences.StoryLength
+	}
+	return storySentenceTarget(length)
+}
+
+func storySentenceTarget(length string) int {
+	switch length {
+	case model.StoryLengthShort:
+		return 3
+	case model.StoryLengthLong:
+		return 8
+	default:
+		return 5
+	}
+}
+
 type ComicResponse struct {
-	ID          uint   `json:"id"`
-	UserID      uint   `json:"user_id"`
-	StoryID     uint   `json:"story_id"`
-	Title       string `json:"title"`
-	Thumbnail   string `json:"thumbnail"`
-	ViewURL     string `json:"view_url"`
+	ID          uint              `json:"id"`
+	UserID      uint              `json:"user_id"`
+	StoryID     uint              `json:"story_id"`
+	Version     int               `json:"version"`
+	Title       string            `json:"title"`
+	Thumbnail   string            `json:"thumbnail"`
+	ViewURL     string            `json:"view_url"`
+	DownloadURL string            `json:"download_url"`
+	Formats     []ComicFormatLink `json:"formats"`
+	DoneOn      string            `json:"done_on"`
+}
+
+// ComicFormatLink points at one downloadable format of a comic.
+type ComicFormatLink struct {
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
 	DownloadURL string `json:"download_url"`
-	DoneOn      string `json:"done_on"`
+}
+
+// comicFormatLinks expands a comic's stored format list into download links.
+// Comics generated before multi-format export only have a PDF.
+func comicFormatLinks(comic model.Comic) []ComicFormatLink {
+	names := strings.Split(comic.Formats, ",")
+	if comic.Formats == "" {
+		names = []string{"pdf"}
+	}
+	base := strings.TrimSuffix(filepath.Base(comic.DownloadURL), filepath.Ext(comic.DownloadURL))
+	links := make([]ComicFormatLink, 0, len(names))
+	for _, format := range ComicFormats {
+		for _, name := range names {
+			if name != format.Name {
+				continue
+			}
+			links = append(links, ComicFormatLink{
+				Format:      format.Name,
+				ContentType: format.ContentType,
+				DownloadURL: filepath.Join("comics", base+format.Extension),
+			})
+		}
+	}
+	return links
 }
 
 func (s *storyService) GetComicsByUser(userID uint) ([]ComicResponse, error) {
@@ -181,19 +252,25 @@ func (s *storyService) GetComicsByUser(userID uint) ([]ComicResponse, error) {
 		return nil, fmt.Errorf("failed to fetch comics: %w", err)
 	}
 
-	var response []ComicResponse
+	return ToComicResponses(comics), nil
+}
+
+// ToComicResponses converts comic records into their API representation.
+func ToComicResponses(comics []model.Comic) []ComicResponse {
+	response := make([]ComicResponse, 0, len(comics))
 	for _, comic := range comics {
 		response = append(response, ComicResponse{
 			ID:          comic.ID,
 			UserID:      comic.UserID,
 			StoryID:     comic.StoryID,
+			Version:     comic.Version,
 			Title:       comic.Title,
 			Thumbnail:   comic.Thumbnail,
 			ViewURL:     comic.ViewURL,
 			DownloadURL: comic.DownloadURL,
+			Formats:     comicFormatLinks(comic),
 			DoneOn:      comic.DoneOn.Format("2006-01-02 15:04:05"),
 		})
 	}
-
-	return response, nil
+	return response
 }
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"testing"
+
+	"inkwell-backend-V2.0/internal/model"
+)
+
+func TestSentenceTargetFollowsStoryLength(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*model.User{
+		1: {ID: 1, Preferences: model.UserPreferences{StoryLength: model.StoryLengthShort}},
+		2: {ID: 2, Preferences: model.UserPreferences{StoryLength: model.StoryLengthMedium}},
+		3: {ID: 3, Preferences: model.UserPreferences{StoryLength: model.StoryLengthLong}},
+	}}
+	s := &storyService{userRepo: users}
+	for userID, want := range map[uint]int{1: 3, 2: 5, 3: 8, 4: 5} {
+		if got := s.SentenceTarget(userID); got != want {
+			t.Errorf("user %d: %d sentences, want %d", userID, got, want)
+		}
+	}
+}
@@ -29,6 +29,8 @@ app.add_middleware(
 
 model = None
 tts_fast = None
+# Voices other than the default, by Coqui model name, loaded on first use.
+voices = {}
 executor = ThreadPoolExecutor(max_workers=2)
 
 async def load_models():
@@ -47,6 +49,19 @@ async def load_models():
                 tts_fast = TTS("tts_models/en/ljspeech/tacotron2-DDC")
                 tts_fast.to("cuda")
 
+def load_voice(name: str):
+    if not name:
+        return tts_fast
+    if name not in voices:
+        try:
+            voice = TTS(name)
+            voice.to("cuda")
+        except Exception as e:
+            logger.error(f"Failed to load voice {name}: {e}")
+            raise HTTPException(status_code=400, detail=f"Unknown voice: {name}")
+        voices[name] = voice
+    return voices[name]
+
 def split_text_smartly(text: str, max_length: int = 100) -> list:
     import re
     sentences = re.split(r'(?<=[.!?]) +', text)
@@ -98,12 +113,13 @@ async def speech_to_text(file: UploadFile):
         if os.path.exists(tmp_path):
             os.unlink(tmp_path)
 
-def generate_audio_chunk(text_chunk: str, output_path: str):
-    tts_fast.tts_to_file(text=text_chunk, file_path=output_path)
+def generate_audio_chunk(tts, text_chunk: str, output_path: str):
+    tts.tts_to_file(text=text_chunk, file_path=output_path)
 
 @app.post("/tts")
-async def text_to_speech(background_tasks: BackgroundTasks, text: str = Form(...)):
+async def text_to_speech(background_tasks: BackgroundTasks, text: str = Form(...), voice: str = Form("")):
     await load_models()
+    tts = load_voice(voice)
     start_time = asyncio.get_running_loop().time()
     out_wav = None
     out_mp3 = None
@@ -112,7 +128,7 @@ async def text_to_speech(background_tasks: BackgroundTasks, text: str = Form(...
             out_wav = tmp_wav.name
         out_mp3 = out_wav.replace(".wav", ".mp3")
         loop = asyncio.get_running_loop()
-        await loop.run_in_executor(executor, generate_audio_chunk, text, out_wav)
+        await loop.run_in_executor(executor, generate_audio_chunk, tts, text, out_wav)
         await loop.run_in_executor(
             executor,
             lambda: subprocess.run(
@@ -134,7 +150,7 @@ async def text_to_speech(background_tasks: BackgroundTasks, text: str = Form(...
         tmp_file = tempfile.NamedTemporaryFile(delete=False, suffix=f"_chunk_{i}.wav")
         temp_files.append(tmp_file.name)
         tmp_file.close()
-        tasks.append(loop.run_in_executor(executor, generate_audio_chunk, chunk, temp_files[-1]))
+        tasks.append(loop.run_in_executor(executor, generate_audio_chunk, tts, chunk, temp_files[-1]))
     await asyncio.gather(*tasks)
     final_wav_file = tempfile.NamedTemporaryFile(delete=False, suffix="_final.wav")
     final_wav = final_wav_file.name
@@ -176,7 +192,7 @@ async def text_to_speech_stream(text: str = Form(...)):
             with tempfile.NamedTemporaryFile(delete=False, suffix="_stream.wav") as tmp_wav:
                 chunk_wav = tmp_wav.name
             chunk_mp3 = chunk_wav.replace(".wav", ".mp3")
-            await loop.run_in_executor(executor, generate_audio_chunk, chunk, chunk_wav)
+            await loop.run_in_executor(executor, generate_audio_chunk, tts_fast, chunk, chunk_wav)
             await loop.run_in_executor(
                 executor,
                 lambda: subprocess.run([
@@ -1,22 +1,163 @@
 package service
 
 import (
+	"errors"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+	"inkwell-backend-V2.0/internal/config"
 	"inkwell-backend-V2.0/internal/model"
 	"inkwell-backend-V2.0/internal/repository"
 )
 
+// RevokedRoleChanged is the reason sessions end when an admin changes the user's role.
+const RevokedRoleChanged = "role_changed"
+
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidRole         = errors.New("role must be learner, teacher or admin")
+	ErrCannotChangeOwnRole = errors.New("admins cannot change their own role")
+)
+
 type UserService interface {
 	GetAllUsers() ([]model.User, error)
+	GetUser(userID uint) (*model.User, error)
+	UpdateRole(actorID, userID uint, role string) (*model.User, error)
+	RevokeSessions(userID uint) error
+	ListLoginAttempts(email, ip string, limit int) ([]model.LoginAttempt, error)
+	ResetMFA(actorID, userID uint) error
 }
 
 type userService struct {
-	userRepo repository.UserRepository
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	attemptRepo repository.LoginAttemptRepository
+	mfaRepo     repository.MFARepository
 }
 
-func NewUserService(userRepo repository.UserRepository) UserService {
-	return &userService{userRepo: userRepo}
+func NewUserService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, attemptRepo repository.LoginAttemptRepository, mfaRepo repository.MFARepository) UserService {
+	return &userService{userRepo: userRepo, sessionRepo: sessionRepo, attemptRepo: attemptRepo, mfaRepo: mfaRepo}
 }
 
 func (s *userService) GetAllUsers() ([]model.User, error) {
 	return s.userRepo.GetAllUsers()
 }
+
+func (s *userService) GetUser(userID uint) (*model.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// UpdateRole gives a user another role and ends their sessions, so that
+// tokens carrying the old permissions stop working once they expire.
+func (s *userService) UpdateRole(actorID, userID uint, role string) (*model.User, error) {
+	if !model.ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	if actorID == userID {
+		return nil, ErrCannotChangeOwnRole
+	}
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == role {
+		return user, nil
+	}
+	if err := s.userRepo.UpdateRole(userID, role); err != nil {
+		return nil, err
+	}
+	if err := s.sessionRepo.RevokeUserSessions(userID, RevokedRoleChanged); err != nil {
+		log.Printf("Failed to end sessions of user %d after role change: %v", userID, err)
+	}
+	log.Printf("User %d changed the role of user %d from %s to %s", actorID, userID, user.Role, role)
+	user.Role = role
+	return user, nil
+}
+
+// RevokeSessions ends all of a user's sessions, for example on a compromised account.
+func (s *userService) RevokeSessions(userID uint) error {
+	if _, err := s.GetUser(userID); err != nil {
+		return err
+	}
+	return s.sessionRepo.RevokeUserSessions(userID, RevokedLogoutAll)
+}
+
+// ListLoginAttempts returns the most recent logins, newest first, optionally
+// only for one email or IP address.
+func (s *userService) ListLoginAttempts(email, ip string, limit int) ([]model.LoginAttempt, error) {
+	return s.attemptRepo.ListAttempts(normalizeEmail(email), strings.TrimSpace(ip), limit)
+}
+
+// ResetMFA removes a user's authenticator and recovery codes, for a user
+// who lost both, and ends their sessions. Users whose role requires
+// two-factor authentication enrol again at their next login.
+func (s *userService) ResetMFA(actorID, userID uint) error {
+	if _, err := s.GetUser(userID); err != nil {
+		return err
+	}
+	if err := s.mfaRepo.DeleteFactor(userID); err != nil {
+		return err
+	}
+	log.Printf("User %d reset two-factor authentication of user %d", actorID, userID)
+	return s.sessionRepo.RevokeUserSessions(userID, RevokedLogoutAll)
+}
+
+// configuredAdmin reports whether the email is listed under ADMIN/EMAIL.
+func configuredAdmin(email string) bool {
+	cfg := config.GetConfig()
+	if cfg == nil || email == "" {
+		return false
+	}
+	for _, admin := range cfg.Admin.Emails {
+		if strings.EqualFold(strings.TrimSpace(admin), email) {
+			return true
+		}
+	}
+	return false
+}
+
+// PromoteConfiguredAdmins gives the admin role to existing accounts listed
+// under ADMIN/EMAIL, so that a fresh installation has someone to manage roles.
+func PromoteConfiguredAdmins(userRepo repository.UserRepository) {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return
+	}
+	for _, email := range cfg.Admin.Emails {
+		user, err := userRepo.GetUserByEmail(email)
+		if err != nil {
+			continue
+		}
+		if user.EmailVerifiedAt == nil {
+			log.Printf("Not promoting %s to admin until the address is verified", email)
+			continue
+		}
+		promoteConfiguredAdmin(userRepo, user)
+	}
+}
+
+// promoteConfiguredAdmin gives the admin role to the user if their address
+// is listed under ADMIN/EMAIL and verified. Anyone can register with a
+// listed address, so an unverified one proves nothing.
+func promoteConfiguredAdmin(userRepo repository.UserRepository, user *model.User) {
+	if !eligibleAdmin(user, configuredAdmin(user.Email)) {
+		return
+	}
+	if err := userRepo.UpdateRole(user.ID, model.RoleAdmin); err != nil {
+		log.Printf("Failed to promote user %d to admin: %v", user.ID, err)
+		return
+	}
+	user.Role = model.RoleAdmin
+	log.Printf("Promoted user %d to admin", user.ID)
+}
+
+// eligibleAdmin reports whether a user whose address is listed as an admin
+// should be promoted.
+func eligibleAdmin(user *model.User, listed bool) bool {
+	return listed && user.EmailVerifiedAt != nil && user.Role != model.RoleAdmin
+}
@@ -18,6 +18,16 @@ var (
 	refreshSecret []byte
 	accessExpiry  time.Duration
 	refreshExpiry time.Duration
+	issuer        string
+	audience      string
+)
+
+// Token types, carried in the token_type claim so that an access token
+// cannot be used as a refresh token or the other way round.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	TokenTypeMFA     = "mfa" // a login waiting for its second factor
 )
 
 // InitAuthConfig Initialize config values once
@@ -32,6 +42,16 @@ func InitAuthConfig(cfg *config.APIConfig) {
 	// Load expiration times based on time units
 	accessExpiry = parseDuration(cfg.Authentication.SessionTimeouts["ACCESS"], cfg.Authentication.TimeUnits["ACCESS"])
 	refreshExpiry = parseDuration(cfg.Authentication.SessionTimeouts["REFRESH"], cfg.Authentication.TimeUnits["REFRESH"])
+
+	issuer = cfg.Authentication.Issuer
+	audience = cfg.Authentication.Audience
+
+	if err := initSigningKeys(cfg.Authentication.Signing, refreshExpiry); err != nil {
+		panic(fmt.Sprintf("failed to load signing keys: %v", err))
+	}
+
+	initPasswordConfig(cfg.Authentication.PasswordHash)
+	initSecretKey(cfg.Authentication.MFA.EncryptionKey)
 }
 
 // parseDuration converts session timeout values based on the provided time unit
@@ -54,17 +74,33 @@ type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	// Role and Permissions are the user's when the token was issued; a role
+	// change ends the user's sessions, and the auth middleware refuses access
+	// tokens of ended sessions, so that stale tokens do not linger.
+	Role        string   `json:"role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// SessionID identifies the login session the token belongs to. It stays
+	// the same across refresh-token rotations.
+	SessionID string `json:"sid,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateTokens creates both access and refresh tokens
-func GenerateTokens(user *model.User) (string, string, error) {
-	accessToken, err := generateToken(user, accessSecret, accessExpiry)
+// RefreshExpiry is how long a refresh token, and so a session without
+// activity, stays valid.
+func RefreshExpiry() time.Duration {
+	return refreshExpiry
+}
+
+// GenerateTokens creates an access token and a refresh token for a session.
+// refreshID becomes the refresh token's jti, which keys its session record.
+func GenerateTokens(user *model.User, sessionID, refreshID string) (string, string, error) {
+	accessToken, err := generateToken(user, sessionID, "", TokenTypeAccess, accessSecret, accessExpiry)
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshToken, err := generateToken(user, refreshSecret, refreshExpiry)
+	refreshToken, err := generateToken(user, sessionID, refreshID, TokenTypeRefresh, refreshSecret, refreshExpiry)
 	if err != nil {
 		return "", "", err
 	}
@@ -72,72 +108,116 @@ func GenerateTokens(user *model.User) (string, string, error) {
 	return accessToken, refreshToken, nil
 }
 
-// ValidateToken verifies the token and extracts claims
+// ValidateToken verifies the token and extracts claims. Only the configured
+// signing algorithm is accepted, and the issuer and audience are checked
+// when they are configured.
 func ValidateToken(tokenStr string, isRefresh bool) (*Claims, error) {
 	secret := accessSecret
+	tokenType := TokenTypeAccess
 	if isRefresh {
 		secret = refreshSecret
+		tokenType = TokenTypeRefresh
 	}
 
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
-	})
-
+	claims, err := parseToken(tokenStr, secret)
 	if err != nil {
-		return nil, errors.New("invalid or malformed token")
-	}
-
-	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
-		return nil, errors.New("invalid token claims")
+		return nil, err
 	}
 
-	// Explicitly check expiration
-	if claims.ExpiresAt.Time.Before(time.Now()) {
-		return nil, errors.New("token has expired")
+	// HS256 tokens from before token_type was added have none; their
+	// separate access and refresh secrets already tell them apart.
+	if claims.TokenType != tokenType && (signingKeys != nil || claims.TokenType != "") {
+		return nil, errors.New("wrong token type")
 	}
 
 	return claims, nil
 }
 
-// RefreshTokens generates a new access and refresh token using a valid refresh token
-func RefreshTokens(refreshToken string) (string, string, error) {
-	claims, err := ValidateToken(refreshToken, true)
+// GenerateMFAToken creates the short-lived token that a login waiting for
+// its second factor is continued with.
+func GenerateMFAToken(user *model.User, expiry time.Duration) (string, error) {
+	return generateToken(user, "", "", TokenTypeMFA, accessSecret, expiry)
+}
+
+// ValidateMFAToken verifies a token from GenerateMFAToken.
+func ValidateMFAToken(tokenStr string) (*Claims, error) {
+	claims, err := parseToken(tokenStr, accessSecret)
 	if err != nil {
-		return "", "", errors.New("invalid or expired refresh token")
+		return nil, err
+	}
+	if claims.TokenType != TokenTypeMFA {
+		return nil, errors.New("wrong token type")
 	}
+	return claims, nil
+}
 
-	// Explicitly check if the refresh token is expired
-	if claims.ExpiresAt.Time.Before(time.Now()) {
-		return "", "", errors.New("refresh token has expired")
+// parseToken checks a token's signature, expiry, issuer and audience.
+func parseToken(tokenStr string, secret []byte) (*Claims, error) {
+	options := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	}
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}
+	if ring := signingKeys; ring != nil {
+		options = append(options, jwt.WithValidMethods([]string{ring.method().Alg()}))
+		keyFunc = func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			if kid == "" {
+				return nil, ErrUnknownSigningKey
+			}
+			return ring.publicKey(kid)
+		}
+	} else {
+		options = append(options, jwt.WithValidMethods([]string{AlgHS256}))
 	}
 
-	// Generate new tokens
-	newAccessToken, newRefreshToken, err := GenerateTokens(&model.User{
-		ID:       claims.UserID,
-		Username: claims.Username,
-		Email:    claims.Email,
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keyFunc, options...)
 	if err != nil {
-		return "", "", errors.New("failed to generate new tokens")
+		return nil, errors.New("invalid or malformed token")
 	}
 
-	return newAccessToken, newRefreshToken, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
 }
 
-// Helper function to generate JWT token
-func generateToken(user *model.User, secret []byte, expiry time.Duration) (string, error) {
+// Helper function to generate JWT token. With RS256 or EdDSA it is signed
+// with the current key of the ring, named in the kid header.
+func generateToken(user *model.User, sessionID, tokenID, tokenType string, secret []byte, expiry time.Duration) (string, error) {
+	now := time.Now()
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+		UserID:      user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		Role:        user.Role,
+		Permissions: model.PermissionsFor(user.Role),
+		SessionID:   sessionID,
+		TokenType:   tokenType,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        tokenID,
+			Issuer:    issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Subject:   user.Email,
 		},
 	}
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
 
+	if ring := signingKeys; ring != nil {
+		key := ring.current()
+		token := jwt.NewWithClaims(ring.method(), claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.Private)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(secret)
 }
@@ -0,0 +1,31 @@
+package utilities
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestHashOpaqueToken(t *testing.T) {
+	// SHA-256 of "abc" from FIPS 180-2.
+	if got := HashOpaqueToken("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("hash = %s", got)
+	}
+}
+
+func TestNewOpaqueToken(t *testing.T) {
+	token, hash, err := NewOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 32 {
+		t.Errorf("token %q is not 32 URL-safe bytes: %v", token, err)
+	}
+	if hash != HashOpaqueToken(token) || len(hash) != 64 {
+		t.Errorf("hash %q does not match the token", hash)
+	}
+	other, _, err := NewOpaqueToken()
+	if err != nil || other == token {
+		t.Errorf("second token %q, %v", other, err)
+	}
+}
@@ -0,0 +1,108 @@
+package utilities
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"inkwell-backend-V2.0/internal/config"
+)
+
+// Default argon2id parameters, following the OWASP recommendation.
+var passwordParams = config.PasswordHashConfig{
+	MemoryKiB:   19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var ErrInvalidPasswordHash = errors.New("invalid password hash")
+
+// initPasswordConfig overrides the default parameters with the configured ones.
+func initPasswordConfig(c config.PasswordHashConfig) {
+	if c.MemoryKiB > 0 {
+		passwordParams.MemoryKiB = c.MemoryKiB
+	}
+	if c.Iterations > 0 {
+		passwordParams.Iterations = c.Iterations
+	}
+	if c.Parallelism > 0 {
+		passwordParams.Parallelism = c.Parallelism
+	}
+	if c.SaltLength > 0 {
+		passwordParams.SaltLength = c.SaltLength
+	}
+	if c.KeyLength > 0 {
+		passwordParams.KeyLength = c.KeyLength
+	}
+}
+
+// HashPassword hashes a password with argon2id and a random salt, in the
+// PHC string format: $argon2id$v=19$m=<KiB>,t=<iterations>,p=<lanes>$<salt>$<hash>.
+func HashPassword(password string) (string, error) {
+	p := passwordParams
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.MemoryKiB, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.MemoryKiB, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword checks a password against a stored hash. It accepts
+// argon2id hashes and the unsalted SHA-256 hex digests stored before them.
+// needsRehash is true when the password matched a legacy hash or one made
+// with other parameters than the configured ones.
+func VerifyPassword(password, encoded string) (ok, needsRehash bool, err error) {
+	if IsLegacyPasswordHash(encoded) {
+		sum := sha256.Sum256([]byte(password))
+		ok = subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(encoded))) == 1
+		return ok, ok, nil
+	}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, ErrInvalidPasswordHash
+	}
+	var version int
+	var p config.PasswordHashConfig
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrInvalidPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.MemoryKiB, &p.Iterations, &p.Parallelism); err != nil {
+		return false, false, ErrInvalidPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrInvalidPasswordHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, false, ErrInvalidPasswordHash
+	}
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(want))
+
+	got := argon2.IDKey([]byte(password), salt, p.Iterations, p.MemoryKiB, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false, false, nil
+	}
+	return true, p != passwordParams, nil
+}
+
+// IsLegacyPasswordHash reports whether a stored hash is an unsalted SHA-256
+// hex digest from before argon2id was introduced.
+func IsLegacyPasswordHash(encoded string) bool {
+	if len(encoded) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
@@ -0,0 +1,101 @@
+package utilities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"inkwell-backend-V2.0/internal/config"
+)
+
+// withPasswordParams swaps in cheap argon2id parameters for the test.
+func withPasswordParams(t *testing.T, p config.PasswordHashConfig) {
+	t.Helper()
+	saved := passwordParams
+	passwordParams = p
+	t.Cleanup(func() { passwordParams = saved })
+}
+
+var testPasswordParams = config.PasswordHashConfig{MemoryKiB: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	withPasswordParams(t, testPasswordParams)
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("unexpected format: %s", hash)
+	}
+	ok, rehash, err := VerifyPassword("correct horse", hash)
+	if !ok || rehash || err != nil {
+		t.Errorf("right password: ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+	ok, rehash, err = VerifyPassword("Correct horse", hash)
+	if ok || rehash || err != nil {
+		t.Errorf("wrong password: ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+
+	other, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestVerifyPasswordLegacyHash(t *testing.T) {
+	withPasswordParams(t, testPasswordParams)
+	sum := sha256.Sum256([]byte("secret"))
+	legacy := hex.EncodeToString(sum[:])
+	if !IsLegacyPasswordHash(legacy) {
+		t.Fatal("legacy hash not recognised")
+	}
+	for _, encoded := range []string{legacy, strings.ToUpper(legacy)} {
+		ok, rehash, err := VerifyPassword("secret", encoded)
+		if !ok || !rehash || err != nil {
+			t.Errorf("legacy match: ok=%v rehash=%v err=%v", ok, rehash, err)
+		}
+	}
+	ok, rehash, err := VerifyPassword("other", legacy)
+	if ok || rehash || err != nil {
+		t.Errorf("legacy mismatch: ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+}
+
+// Hashes made with older parameters still verify but ask to be rehashed.
+func TestVerifyPasswordNeedsRehashAfterParamChange(t *testing.T) {
+	withPasswordParams(t, testPasswordParams)
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stronger := testPasswordParams
+	stronger.Iterations = 2
+	withPasswordParams(t, stronger)
+	ok, rehash, err := VerifyPassword("secret", hash)
+	if !ok || !rehash || err != nil {
+		t.Errorf("ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHashes(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"plaintext",
+		"$2a$10$abcdefghijklmnopqrstuv",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$",
+	} {
+		ok, _, err := VerifyPassword("secret", encoded)
+		if ok || !errors.Is(err, ErrInvalidPasswordHash) {
+			t.Errorf("%q: ok=%v err=%v", encoded, ok, err)
+		}
+	}
+}
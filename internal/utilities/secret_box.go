@@ -0,0 +1,80 @@
+package utilities
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// sealedPrefix marks a value encrypted by SealSecret.
+const sealedPrefix = "v1:"
+
+// secretKey encrypts secrets stored in the database; nil leaves them in plain text.
+var secretKey []byte
+
+var ErrSecretUnreadable = errors.New("stored secret cannot be decrypted")
+
+func initSecretKey(key string) {
+	if key == "" {
+		secretKey = nil
+		return
+	}
+	sum := sha256.Sum256([]byte(key))
+	secretKey = sum[:]
+}
+
+// SealSecret encrypts a secret with AES-GCM for storage. Without a
+// configured key it is returned unchanged.
+func SealSecret(plain string) (string, error) {
+	if secretKey == nil {
+		return plain, nil
+	}
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSecret reverses SealSecret. Values stored before a key was configured are returned as they are.
+func OpenSecret(stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return stored, nil
+	}
+	if secretKey == nil {
+		return "", ErrSecretUnreadable
+	}
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil {
+		return "", ErrSecretUnreadable
+	}
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", ErrSecretUnreadable
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrSecretUnreadable
+	}
+	return string(plain), nil
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
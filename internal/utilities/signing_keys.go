@@ -0,0 +1,351 @@
+package utilities
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"inkwell-backend-V2.0/internal/config"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	defaultKeyDir       = "keys"
+	defaultRotationDays = 30
+	rsaKeyBits          = 2048
+	// keyReloadInterval limits how often an unknown kid makes the key
+	// directory be read again, for keys created by another instance.
+	keyReloadInterval = time.Minute
+)
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// signingKey is one key pair of the ring. Its kid is the file name in the key directory.
+type signingKey struct {
+	ID      string
+	Created time.Time
+	Private crypto.Signer
+}
+
+// keyRing holds the asymmetric keys tokens are signed with. The newest key
+// signs; older keys still verify until RetainHours after they were replaced.
+type keyRing struct {
+	mu         sync.RWMutex
+	alg        string
+	dir        string
+	rotation   time.Duration
+	retain     time.Duration
+	keys       []*signingKey // oldest first
+	lastReload time.Time
+}
+
+// signingKeys is nil when tokens are signed with HS256.
+var signingKeys *keyRing
+
+// initSigningKeys loads the key ring for RS256 and EdDSA, creating the first key if needed.
+func initSigningKeys(c config.SigningConfig, refreshLifetime time.Duration) error {
+	alg := signingAlgorithm(c)
+	if alg == AlgHS256 {
+		signingKeys = nil
+		return nil
+	}
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return fmt.Errorf("unsupported signing algorithm %q", c.Algorithm)
+	}
+	ring := &keyRing{
+		alg:      alg,
+		dir:      c.KeyDir,
+		rotation: time.Duration(c.RotationDays) * 24 * time.Hour,
+		retain:   time.Duration(c.RetainHours) * time.Hour,
+	}
+	if ring.dir == "" {
+		ring.dir = defaultKeyDir
+	}
+	if ring.rotation <= 0 {
+		ring.rotation = defaultRotationDays * 24 * time.Hour
+	}
+	if ring.retain <= 0 {
+		ring.retain = refreshLifetime
+	}
+	if err := os.MkdirAll(ring.dir, 0o700); err != nil {
+		return err
+	}
+	if err := ring.rotate(time.Now()); err != nil {
+		return err
+	}
+	signingKeys = ring
+	return nil
+}
+
+// signingAlgorithm returns the configured algorithm, HS256 when none is set.
+func signingAlgorithm(c config.SigningConfig) string {
+	switch strings.ToUpper(c.Algorithm) {
+	case "":
+		return AlgHS256
+	case "EDDSA":
+		return AlgEdDSA
+	default:
+		return strings.ToUpper(c.Algorithm)
+	}
+}
+
+func (r *keyRing) method() jwt.SigningMethod {
+	if r.alg == AlgRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// current returns the key new tokens are signed with.
+func (r *keyRing) current() *signingKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[len(r.keys)-1]
+}
+
+// publicKey returns the public key for kid, reading the key directory again
+// when the kid is unknown, since another instance may have rotated.
+func (r *keyRing) publicKey(kid string) (crypto.PublicKey, error) {
+	if key := r.find(kid); key != nil {
+		return key.Private.Public(), nil
+	}
+	r.mu.Lock()
+	if time.Since(r.lastReload) >= keyReloadInterval {
+		if err := r.load(); err != nil {
+			log.Printf("Failed to reload signing keys: %v", err)
+		}
+	}
+	r.mu.Unlock()
+	if key := r.find(kid); key != nil {
+		return key.Private.Public(), nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+func (r *keyRing) find(kid string) *signingKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, key := range r.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// rotate reloads the key directory, creates a new key when the newest one
+// is older than the rotation period, and deletes keys that were replaced
+// longer than the retain period ago.
+func (r *keyRing) rotate(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.load(); err != nil {
+		return err
+	}
+	if len(r.keys) == 0 || !now.Before(r.keys[len(r.keys)-1].Created.Add(r.rotation)) {
+		key, err := r.generate(now)
+		if err != nil {
+			return err
+		}
+		r.keys = append(r.keys, key)
+		log.Printf("Created %s signing key %s", r.alg, key.ID)
+	}
+	kept := r.keys[:0]
+	for i, key := range r.keys {
+		if i < len(r.keys)-1 && r.keys[i+1].Created.Add(r.retain).Before(now) {
+			if err := os.Remove(r.keyPath(key.ID)); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to delete signing key %s: %v", key.ID, err)
+			} else {
+				log.Printf("Deleted retired signing key %s", key.ID)
+			}
+			continue
+		}
+		kept = append(kept, key)
+	}
+	r.keys = kept
+	return nil
+}
+
+// load reads all keys for the configured algorithm from the key directory.
+// Callers hold the write lock.
+func (r *keyRing) load() error {
+	r.lastReload = time.Now()
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	keys := make([]*signingKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := readSigningKey(path)
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v", path, err)
+			continue
+		}
+		if keyAlgorithm(key.Private) != r.alg {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Created.Before(keys[j].Created) })
+	r.keys = keys
+	return nil
+}
+
+// generate creates a key pair and stores it in the key directory.
+func (r *keyRing) generate(now time.Time) (*signingKey, error) {
+	var private crypto.Signer
+	var err error
+	if r.alg == AlgRS256 {
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	} else {
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	key := &signingKey{ID: uuid.New().String(), Created: now.UTC().Truncate(time.Second), Private: private}
+	block := &pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{"Created": key.Created.Format(time.RFC3339)},
+		Bytes:   der,
+	}
+
+	// Write to a temporary file first so other instances never read a partial key.
+	tmp := r.keyPath(key.ID) + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(block), 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, r.keyPath(key.ID)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (r *keyRing) keyPath(kid string) string {
+	return filepath.Join(r.dir, kid+".pem")
+}
+
+func readSigningKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("not a PKCS #8 PEM file")
+	}
+	created, err := time.Parse(time.RFC3339, block.Headers["Created"])
+	if err != nil {
+		return nil, errors.New("missing or invalid Created header")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok || keyAlgorithm(private) == "" {
+		return nil, errors.New("unsupported key type")
+	}
+	return &signingKey{
+		ID:      strings.TrimSuffix(filepath.Base(path), ".pem"),
+		Created: created,
+		Private: private,
+	}, nil
+}
+
+func keyAlgorithm(key crypto.Signer) string {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return AlgRS256
+	case ed25519.PrivateKey:
+		return AlgEdDSA
+	}
+	return ""
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that tokens may currently be signed with.
+// It is empty with HS256, whose secrets cannot be published.
+func JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if signingKeys == nil {
+		return set
+	}
+	signingKeys.mu.RLock()
+	defer signingKeys.mu.RUnlock()
+	for _, key := range signingKeys.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: signingKeys.alg}
+		switch public := key.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// StartKeyRotation periodically checks whether the signing key is due for
+// rotation and removes retired keys. It does nothing with HS256.
+func StartKeyRotation(interval time.Duration) {
+	ring := signingKeys
+	if ring == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if err := ring.rotate(now); err != nil {
+				log.Printf("Failed to rotate signing keys: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+package utilities
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/model"
+)
+
+// withSigningKeys sets up a key ring for alg in a temporary directory.
+func withSigningKeys(t *testing.T, alg string) *keyRing {
+	t.Helper()
+	savedRing, savedAccess, savedRefresh := signingKeys, accessExpiry, refreshExpiry
+	t.Cleanup(func() { signingKeys, accessExpiry, refreshExpiry = savedRing, savedAccess, savedRefresh })
+	accessExpiry, refreshExpiry = time.Minute, time.Hour
+	if err := initSigningKeys(config.SigningConfig{Algorithm: alg, KeyDir: t.TempDir()}, refreshExpiry); err != nil {
+		t.Fatal(err)
+	}
+	return signingKeys
+}
+
+var testUser = &model.User{ID: 7, Email: "ann@example.com", Username: "ann", Role: "student"}
+
+func TestSignedTokensRoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			ring := withSigningKeys(t, alg)
+			access, refresh, err := GenerateTokens(testUser, "sid", "jti")
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, _, err := jwt.NewParser().ParseUnverified(access, &Claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Method.Alg() != alg || token.Header["kid"] != ring.current().ID {
+				t.Errorf("header alg %s kid %v, want %s %s", token.Method.Alg(), token.Header["kid"], alg, ring.current().ID)
+			}
+
+			claims, err := ValidateToken(access, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != testUser.ID || claims.SessionID != "sid" || claims.TokenType != TokenTypeAccess {
+				t.Errorf("access claims: %+v", claims)
+			}
+			if claims, err := ValidateToken(refresh, true); err != nil || claims.ID != "jti" {
+				t.Errorf("refresh token: %+v, %v", claims, err)
+			}
+
+			// Access and refresh tokens share the key, so the type claim must tell them apart.
+			if _, err := ValidateToken(refresh, false); err == nil {
+				t.Error("refresh token accepted as an access token")
+			}
+			if _, err := ValidateToken(access, true); err == nil {
+				t.Error("access token accepted as a refresh token")
+			}
+		})
+	}
+}
+
+func TestSignedTokensRejectForgeries(t *testing.T) {
+	ring := withSigningKeys(t, AlgEdDSA)
+	claims := &Claims{UserID: 1, TokenType: TokenTypeAccess, RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+
+	// An HS256 token must not verify, even when signed with the secret.
+	hs, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(accessSecret)
+	if _, err := ValidateToken(hs, false); err == nil {
+		t.Error("HS256 token accepted")
+	}
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := ValidateToken(none, false); err == nil {
+		t.Error("unsigned token accepted")
+	}
+
+	// A key that is not in the ring, whatever kid it claims.
+	_, stranger, _ := ed25519.GenerateKey(nil)
+	for _, kid := range []string{"", "unknown", ring.current().ID} {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, _ := token.SignedString(stranger)
+		if _, err := ValidateToken(signed, false); err == nil {
+			t.Errorf("token from an unknown key with kid %q accepted", kid)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ring := withSigningKeys(t, AlgEdDSA)
+	old := ring.current()
+	access, _, err := GenerateTokens(testUser, "sid", "jti")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ring.rotate(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if ring.current().ID != old.ID {
+		t.Fatal("key rotated before the rotation period")
+	}
+
+	// After the rotation period a new key signs and the old one still verifies.
+	replaced := old.Created.Add(ring.rotation)
+	if err := ring.rotate(replaced); err != nil {
+		t.Fatal(err)
+	}
+	if ring.current().ID == old.ID || len(ring.keys) != 2 {
+		t.Fatalf("no new key: %d keys", len(ring.keys))
+	}
+	if _, err := ValidateToken(access, false); err != nil {
+		t.Errorf("token of the replaced key: %v", err)
+	}
+	if ids := jwksIDs(); !ids[old.ID] || !ids[ring.current().ID] {
+		t.Errorf("JWKS has %v, want both keys", ids)
+	}
+
+	// Once the retain period is over the old key is deleted.
+	if err := ring.rotate(ring.current().Created.Add(ring.retain + time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if ring.find(old.ID) != nil {
+		t.Error("retired key still in the ring")
+	}
+	if _, err := os.Stat(ring.keyPath(old.ID)); !os.IsNotExist(err) {
+		t.Errorf("retired key file: %v", err)
+	}
+	if jwksIDs()[old.ID] {
+		t.Error("retired key still published")
+	}
+}
+
+// Keys written by another instance are picked up when their kid is seen.
+func TestKeyRingLoadsKeysFromOtherInstances(t *testing.T) {
+	ring := withSigningKeys(t, AlgEdDSA)
+	other := &keyRing{alg: AlgEdDSA, dir: ring.dir}
+	key, err := other.generate(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring.lastReload = time.Time{}
+	if _, err := ring.publicKey(key.ID); err != nil {
+		t.Errorf("key of another instance: %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	t.Run(AlgRS256, func(t *testing.T) {
+		ring := withSigningKeys(t, AlgRS256)
+		set := JWKS()
+		if len(set.Keys) != 1 {
+			t.Fatalf("%d keys", len(set.Keys))
+		}
+		jwk, public := set.Keys[0], ring.current().Private.Public().(*rsa.PublicKey)
+		if jwk.Kty != "RSA" || jwk.Alg != AlgRS256 || jwk.Use != "sig" || jwk.Kid != ring.current().ID {
+			t.Errorf("jwk %+v", jwk)
+		}
+		n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+		if new(big.Int).SetBytes(n).Cmp(public.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(public.E) {
+			t.Error("modulus or exponent does not match the key")
+		}
+	})
+	t.Run(AlgEdDSA, func(t *testing.T) {
+		ring := withSigningKeys(t, AlgEdDSA)
+		jwk := JWKS().Keys[0]
+		x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || !ed25519.PublicKey(x).Equal(ring.current().Private.Public()) {
+			t.Errorf("jwk %+v", jwk)
+		}
+	})
+	t.Run(AlgHS256, func(t *testing.T) {
+		withSigningKeys(t, AlgHS256)
+		if n := len(JWKS().Keys); n != 0 {
+			t.Errorf("HS256 publishes %d keys", n)
+		}
+	})
+}
+
+func jwksIDs() map[string]bool {
+	ids := map[string]bool{}
+	for _, jwk := range JWKS().Keys {
+		ids[jwk.Kid] = true
+	}
+	return ids
+}
@@ -0,0 +1,76 @@
+package utilities
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors, "12345678901234567890".
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// The RFC lists 8-digit codes; 6-digit codes are their last six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		if got := totpCode([]byte("12345678901234567890"), v.unix/totpPeriod); got != v.code {
+			t.Errorf("T=%d: code %s, want %s", v.unix, got, v.code)
+		}
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, time.Unix(v.unix, 0))
+		if !ok || step != v.unix/totpPeriod {
+			t.Errorf("T=%d: ValidateTOTP = %d, %v", v.unix, step, ok)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	step := at.Unix() / totpPeriod
+	for offset := int64(-1); offset <= 1; offset++ {
+		code := totpCode([]byte("12345678901234567890"), step+offset)
+		if got, ok := ValidateTOTP(rfc6238Secret, code, at); !ok || got != step+offset {
+			t.Errorf("offset %d: got step %d, %v", offset, got, ok)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		code := totpCode([]byte("12345678901234567890"), step+offset)
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at); ok {
+			t.Errorf("code %d steps off accepted", offset)
+		}
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	at := time.Unix(59, 0)
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), "287 082", at); !ok {
+		t.Error("lowercase secret or spaced code rejected")
+	}
+	for _, code := range []string{"", "28708", "2870820", "94287082", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "287082", at); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Inkwell", "ann@example.com", "JBSWY3DPEHPK3PXP")
+	for _, part := range []string{"otpauth://totp/Inkwell:ann@example.com?", "secret=JBSWY3DPEHPK3PXP", "issuer=Inkwell", "digits=6", "period=30"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("%s lacks %s", uri, part)
+		}
+	}
+}
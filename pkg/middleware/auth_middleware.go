@@ -4,16 +4,56 @@ import (
 	"github.com/gin-gonic/gin"
 	"inkwell-backend-V2.0/internal/utilities"
 
+	"log"
 	"net/http"
 	"strings"
 )
 
-// AuthMiddleware ensures each request is authenticated
-func AuthMiddleware() gin.HandlerFunc {
+// SessionChecker tells whether the login session an access token belongs to
+// is still active.
+type SessionChecker interface {
+	IsSessionActive(sessionID string) (bool, error)
+}
+
+// publicPaths can be used without logging in. Every other route needs an
+// access token, including the session endpoints under /auth.
+var publicPaths = map[string]bool{
+	"/auth/register": true,
+	"/auth/login":    true,
+	"/auth/refresh":  true,
+
+	"/auth/verify-email/request":   true,
+	"/auth/verify-email/confirm":   true,
+	"/auth/password-reset/request": true,
+	"/auth/password-reset/confirm": true,
+	"/auth/email-change/confirm":   true,
+	"/auth/mfa/verify":             true,
+	"/auth/mfa/enroll":             true,
+
+	"/.well-known/jwks.json": true,
+}
+
+// publicPrefixes are path prefixes served without logging in. The
+// OpenID Connect login routes take the provider name in the path.
+var publicPrefixes = []string{"/static/", "/download/", "/auth/oidc/"}
+
+func isPublicPath(path string) bool {
+	if publicPaths[path] {
+		return true
+	}
+	for _, prefix := range publicPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthMiddleware ensures each request is authenticated. Access tokens of
+// sessions that ended, such as by logout or a role change, are refused.
+func AuthMiddleware(sessions SessionChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		path := c.Request.URL.Path
-		// Allow unauthenticated access to static files and auth endpoints
-		if strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/auth") || strings.HasPrefix(path, "/download") {
+		if isPublicPath(c.Request.URL.Path) {
 			c.Next()
 			return
 		}
@@ -32,11 +72,31 @@ func AuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if claims.SessionID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session has ended"})
+			c.Abort()
+			return
+		}
+		active, err := sessions.IsSessionActive(claims.SessionID)
+		if err != nil {
+			log.Printf("Failed to check session %s: %v", claims.SessionID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check session"})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session has ended"})
+			c.Abort()
+			return
+		}
 
 		// Store claims in context for later use
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
+		c.Set("role", claims.Role)
+		c.Set("permissions", claims.Permissions)
+		c.Set("session_id", claims.SessionID)
 
 		c.Next()
 	}
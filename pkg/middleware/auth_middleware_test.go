@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"inkwell-backend-V2.0/internal/config"
+	"inkwell-backend-V2.0/internal/model"
+	"inkwell-backend-V2.0/internal/utilities"
+)
+
+// fakeSessions reports the sessions in active as active.
+type fakeSessions struct {
+	active map[string]bool
+	err    error
+}
+
+func (f *fakeSessions) IsSessionActive(sessionID string) (bool, error) {
+	return f.active[sessionID], f.err
+}
+
+func TestAuthMiddlewareChecksSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	utilities.InitAuthConfig(&config.APIConfig{Authentication: config.AuthenticationConfig{
+		SecretKeys:      map[string]string{"ACCESS": "test-access", "REFRESH": "test-refresh"},
+		SessionTimeouts: map[string]int{"ACCESS": 15, "REFRESH": 24},
+		TimeUnits:       map[string]string{"ACCESS": "MINUTES", "REFRESH": "HOURS"},
+	}})
+	user := &model.User{ID: 1, Email: "ann@example.com", Role: model.RoleAdmin}
+	access, _, err := utilities.GenerateTokens(user, "live", "jti")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended, _, _ := utilities.GenerateTokens(user, "ended", "jti")
+	unbound, _, _ := utilities.GenerateTokens(user, "", "jti")
+
+	sessions := &fakeSessions{active: map[string]bool{"live": true}}
+	r := gin.New()
+	r.Use(AuthMiddleware(sessions))
+	r.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"active session", access, http.StatusOK},
+		{"ended session", ended, http.StatusUnauthorized},
+		{"no session", unbound, http.StatusUnauthorized},
+		{"garbage", "not-a-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := get(tt.token); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	sessions.err = errors.New("database down")
+	if got := get(access); got != http.StatusInternalServerError {
+		t.Errorf("failed check: status %d, want %d", got, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission allows only users whose role grants the permission, as
+// carried in their access token. It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, granted := range c.GetStringSlice("permissions") {
+			if granted == permission {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied: " + permission + " required"})
+		c.Abort()
+	}
+}